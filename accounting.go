@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiUsage describes how much of the API's rate limit a run used. Only requests that reached the API are counted, so
+// responses served from the cache aren't included.
+type apiUsage struct {
+	RequestsSent       int            `json:"requests_sent"`
+	RequestsByCategory map[string]int `json:"requests_by_category"`
+	PeakRequestRate    int            `json:"peak_requests_per_second"`
+	RateLimited        int            `json:"rate_limited"`
+	BackoffSeconds     float64        `json:"backoff_seconds"`
+
+	// PausedSeconds is how long every request was held back for, because a 429 said how long to wait. Unlike
+	// BackoffSeconds, it's the time that passed, rather than the total of every request's wait.
+	PausedSeconds float64 `json:"paused_seconds"`
+
+	// RateLimitWaitSeconds is the total of how long each request was held back for before it was sent, by
+	// -rate-limit or by a pause. Unlike the rest, it counts requests that were served from the cache, since they wait
+	// too.
+	RateLimitWaitSeconds float64 `json:"rate_limit_wait_seconds"`
+
+	// RateLimitRemaining is the lowest number of requests that the API said were left in the rate limit window, and
+	// RateLimitQuota is the size of the window. They're nil if the API didn't send rate limit headers.
+	RateLimitRemaining *int `json:"rate_limit_remaining,omitempty"`
+	RateLimitQuota     *int `json:"rate_limit_quota,omitempty"`
+}
+
+// accountingTransport counts the requests that are sent to the API, along with what the API says about the rate limit.
+// It goes underneath the cache, so that it sees exactly what Cloudflare does.
+type accountingTransport struct {
+	next http.RoundTripper
+
+	mutex sync.Mutex
+	usage apiUsage
+
+	// recent holds the times of the requests made in the last second, for the peak rate
+	recent []time.Time
+}
+
+func newAccountingTransport(next http.RoundTripper) *accountingTransport {
+	return &accountingTransport{
+		next: next,
+		usage: apiUsage{
+			RequestsByCategory: map[string]int{},
+		},
+	}
+}
+
+func (t *accountingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	t.countRequest(requestCategory(request.URL.Path))
+
+	response, err := t.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	t.countResponse(response)
+	return response, nil
+}
+
+func (t *accountingTransport) countRequest(category string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.usage.RequestsSent++
+	t.usage.RequestsByCategory[category]++
+
+	now := time.Now()
+	for len(t.recent) > 0 && now.Sub(t.recent[0]) >= time.Second {
+		t.recent = t.recent[1:]
+	}
+	t.recent = append(t.recent, now)
+	if len(t.recent) > t.usage.PeakRequestRate {
+		t.usage.PeakRequestRate = len(t.recent)
+	}
+}
+
+func (t *accountingTransport) countResponse(response *http.Response) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		t.usage.RateLimited++
+	}
+
+	remaining, quota, ok := parseRateLimitHeaders(response.Header)
+	if ok && (t.usage.RateLimitRemaining == nil || remaining < *t.usage.RateLimitRemaining) {
+		t.usage.RateLimitRemaining = &remaining
+		if quota > 0 {
+			t.usage.RateLimitQuota = &quota
+		}
+	}
+}
+
+// addBackoff records time spent waiting before retrying a request.
+func (t *accountingTransport) addBackoff(delay time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.usage.BackoffSeconds += delay.Seconds()
+}
+
+// addRateLimitWait records time that a request spent waiting for the rate limiter, or for a pause, before it was sent.
+func (t *accountingTransport) addRateLimitWait(wait time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.usage.RateLimitWaitSeconds += wait.Seconds()
+}
+
+// waited returns how long requests have spent waiting so far, for the rate limiter and to retry.
+func (t *accountingTransport) waited() (float64, float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.usage.RateLimitWaitSeconds, t.usage.BackoffSeconds
+}
+
+// requestsSent returns the number of requests sent so far.
+func (t *accountingTransport) requestsSent() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.usage.RequestsSent
+}
+
+// snapshot returns a copy of the usage so far.
+func (t *accountingTransport) snapshot() apiUsage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	usage := t.usage
+	usage.RequestsByCategory = map[string]int{}
+	for category, count := range t.usage.RequestsByCategory {
+		usage.RequestsByCategory[category] = count
+	}
+	return usage
+}
+
+// requestCategory groups API paths by the kind of resource they're for, like "dns_records" for
+// /client/v4/zones/<id>/dns_records. Requests for zones or accounts themselves are "zones" and "accounts".
+func requestCategory(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(parts); i++ {
+		switch parts[i] {
+		case "zones", "accounts":
+			if i+2 < len(parts) {
+				return parts[i+2]
+			}
+			return parts[i]
+		case "user", "memberships", "certificates", "ips":
+			return parts[i]
+		}
+	}
+	return "other"
+}
+
+// parseRateLimitHeaders reads the number of requests left in the rate limit window from a response, along with the
+// size of the window, if the API sent them. Both the standard Ratelimit and Ratelimit-Policy headers, like
+// `"default";r=1150;t=30` and `"default";q=1200;w=300`, and the older X-RateLimit-* headers are understood.
+func parseRateLimitHeaders(header http.Header) (int, int, bool) {
+	remaining, ok := rateLimitParameter(header.Get("Ratelimit"), "r")
+	if ok {
+		quota, _ := rateLimitParameter(header.Get("Ratelimit-Policy"), "q")
+		return remaining, quota, true
+	}
+
+	remaining, err := strconv.Atoi(strings.TrimSpace(header.Get("X-Ratelimit-Remaining")))
+	if err != nil {
+		return 0, 0, false
+	}
+	quota, _ := strconv.Atoi(strings.TrimSpace(header.Get("X-Ratelimit-Limit")))
+	return remaining, quota, true
+}
+
+// rateLimitParameter reads a parameter, like r=1150, from a structured rate limit header.
+func rateLimitParameter(value string, name string) (int, bool) {
+	for _, part := range strings.Split(value, ";") {
+		pair := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(pair) != 2 || pair[0] != name {
+			continue
+		}
+		parsed, err := strconv.Atoi(pair[1])
+		return parsed, err == nil
+	}
+	return 0, false
+}
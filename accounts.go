@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// accountsDirName is the directory in the output directory that holds a directory for each account.
+const accountsDirName = "accounts"
+
+func init() {
+	registerAccountCollector(accountDetailsCollector{}, true)
+}
+
+// accountDetailsCollector fetches an account's details and settings.
+type accountDetailsCollector struct{}
+
+func (accountDetailsCollector) Name() string {
+	return "account"
+}
+
+func (accountDetailsCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionAccountSettings}
+}
+
+func (accountDetailsCollector) CollectAccount(ctx context.Context, client *cloudflare.Client, account cloudflare.Account) (Section, error) {
+	details, err := client.GetAccountDetails(ctx, account.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	return Section{
+		Name:  "account",
+		Title: "Account details",
+		Data:  details,
+	}, nil
+}
+
+// accountDirNames picks the directory name used for each account's output, keyed by account ID.
+func accountDirNames(accounts []cloudflare.Account) map[string]string {
+	ids := []string{}
+	names := []string{}
+	for _, account := range accounts {
+		ids = append(ids, account.ID)
+		names = append(names, account.Name)
+	}
+	return uniqueFileNames(ids, names)
+}
+
+// backupAccounts runs the account collectors for every account. Errors in individual accounts are recorded in the
+// report, while errors that stop the whole step are returned.
+func (b *backupRun) backupAccounts(ctx context.Context) error {
+	accounts, err := b.listAccounts(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't list accounts: %w", err)
+	}
+
+	dirNames := accountDirNames(accounts)
+	for _, account := range accounts {
+		log.Printf("Processing account %s...", account.Name)
+
+		err = b.handleAccount(ctx, account, dirNames[account.ID])
+		if err != nil {
+			log.Printf("Failed to back up account %s: %s", account.Name, err)
+			b.report.AddError(fmt.Errorf("account %s: %w", account.Name, err))
+		}
+	}
+
+	return nil
+}
+
+// listAccounts returns the accounts to back up: the one given with -account-id, or else every account that the token
+// can access.
+func (b *backupRun) listAccounts(ctx context.Context) ([]cloudflare.Account, error) {
+	accounts, err := b.client.ListAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if b.options.AccountID == "" {
+		return accounts, nil
+	}
+
+	for _, account := range accounts {
+		if account.ID == b.options.AccountID {
+			return []cloudflare.Account{account}, nil
+		}
+	}
+	return nil, fmt.Errorf("account %s doesn't exist, or the API token can't access it", b.options.AccountID)
+}
+
+func (b *backupRun) handleAccount(ctx context.Context, account cloudflare.Account, dirName string) error {
+	manifestAccount := &manifestZone{
+		ID:                account.ID,
+		Name:              account.Name,
+		Files:             []manifestFile{},
+		Collectors:        []string{},
+		SkippedCollectors: []string{},
+	}
+
+	for _, dir := range []string{accountsDirName, filepath.Join(accountsDirName, dirName)} {
+		dir = filepath.Join(b.options.OutputDir, dir)
+		err := os.MkdirAll(dir, os.FileMode(b.options.DirMode))
+		if err != nil {
+			return err
+		}
+		err = setFileMode(dir, os.FileMode(b.options.DirMode))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, collector := range b.accountCollectors {
+		section, err := collector.CollectAccount(b.collectorContext(ctx, collector), b.client, account)
+		if cloudflare.IsPermissionError(err) {
+			b.skipMissingResource("account "+account.Name, collector, err, manifestAccount)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", collector.Name(), err)
+		}
+
+		section, err = b.redactSecrets(collector, section)
+		if err != nil {
+			return fmt.Errorf("%s: couldn't redact secrets: %w", collector.Name(), err)
+		}
+
+		err = b.writeOutputFile(path.Join(accountsDirName, dirName, section.Name+".json"), nil, manifestAccount, func(w io.Writer) error {
+			return writeJSON(w, section.Data)
+		})
+		if err != nil {
+			return err
+		}
+		err = b.writeSectionFiles(path.Join(accountsDirName, dirName), section, nil, manifestAccount)
+		if err != nil {
+			return err
+		}
+		manifestAccount.Collectors = append(manifestAccount.Collectors, collector.Name())
+	}
+
+	b.manifest.Accounts = append(b.manifest.Accounts, manifestAccount)
+
+	return nil
+}
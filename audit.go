@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// auditFinding is a problem found by the audit.
+type auditFinding struct {
+	Zone    string `json:"zone"`
+	Record  string `json:"record"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// auditZone holds the records of a zone that are checked by the audit.
+type auditZone struct {
+	Name    string
+	Records []cloudflare.DNSRecord
+
+	// Partial is set for partial (CNAME setup) zones, which only have the records that are proxied through Cloudflare.
+	Partial bool
+}
+
+// auditConfig holds the audit's settings from the command line.
+type auditConfig struct {
+	// MinTTL and MaxTTL are the bounds for ttl-too-low and ttl-too-high. MinTTL is 0 if there's no lower bound.
+	MinTTL uint64
+	MaxTTL uint64
+
+	// Disabled holds the names of the rules turned off with -audit-disable.
+	Disabled map[string]bool
+
+	// RequireOwnerTag is set by -require-owner-tag, for owner-missing.
+	RequireOwnerTag bool
+}
+
+// auditRule checks a zone for one kind of problem. Every zone in the backup is passed in as well, for rules that look
+// across zones. Rules that expect the zone to have all of its records are skipped for partial zones.
+type auditRule struct {
+	Name         string
+	Check        func(zone auditZone, zones []auditZone, config auditConfig) []auditFinding
+	NeedsFullDNS bool
+}
+
+var auditRules = []auditRule{
+	{"apex-missing", checkApexMissing, true},
+	{"www-missing", checkWWWMissing, true},
+	{"spf-missing", checkSPFMissing, true},
+	{"dmarc-missing", checkDMARCMissing, true},
+	{"dangling-cname", checkDanglingCNAME, false},
+	{"duplicate-record", checkDuplicateRecord, false},
+	{"unproxiable-proxied", checkUnproxiableProxied, false},
+	{"ttl-too-high", checkTTLTooHigh, false},
+	{"ttl-too-low", checkTTLTooLow, false},
+	{"auto-ttl-unproxied", checkAutoTTLUnproxied, false},
+	{"proxied-explicit-ttl", checkProxiedExplicitTTL, false},
+	{"owner-missing", checkOwnerMissing, false},
+}
+
+// auditRuleNames returns the names of every audit rule, including the baseline, for -audit-disable.
+func auditRuleNames() []string {
+	names := []string{}
+	for _, rule := range auditRules {
+		names = append(names, rule.Name)
+	}
+	return append(names, baselineRule)
+}
+
+// newAuditConfig checks the audit's flags, and builds its settings from them.
+func newAuditConfig(minTTL uint64, maxTTL uint64, disable string) (auditConfig, error) {
+	if maxTTL < minTTL {
+		return auditConfig{}, errors.New("The -audit-max-ttl flag can't be lower than -audit-min-ttl.")
+	}
+
+	config := auditConfig{MinTTL: minTTL, MaxTTL: maxTTL, Disabled: map[string]bool{}}
+	known := map[string]bool{}
+	for _, name := range auditRuleNames() {
+		known[name] = true
+	}
+	for _, name := range strings.Split(disable, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return auditConfig{}, fmt.Errorf("Unknown audit rule %q in -audit-disable. The available rules are: %s.", name, strings.Join(auditRuleNames(), ", "))
+		}
+		config.Disabled[name] = true
+	}
+	return config, nil
+}
+
+// runAudit checks every zone with every rule that isn't disabled.
+func runAudit(zones []auditZone, config auditConfig) []auditFinding {
+	findings := []auditFinding{}
+	for _, zone := range zones {
+		for _, rule := range auditRules {
+			if (rule.NeedsFullDNS && zone.Partial) || config.Disabled[rule.Name] {
+				continue
+			}
+			for _, finding := range rule.Check(zone, zones, config) {
+				finding.Zone = zone.Name
+				finding.Rule = rule.Name
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// describeRecord formats a record for the audit, like "www.example.com CNAME example.com".
+func describeRecord(record cloudflare.DNSRecord) string {
+	return record.Name + " " + record.Type + " " + record.Content
+}
+
+// normalizeName lower-cases a DNS name and removes any trailing dot, so that names can be compared.
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// hasRecord returns true if the zone has a record at the given name with one of the given types, including through a
+// wildcard record. If no types are given, any type matches.
+func hasRecord(zone auditZone, name string, types ...string) bool {
+	name = normalizeName(name)
+	wildcard := ""
+	if i := strings.Index(name, "."); i != -1 {
+		wildcard = "*" + name[i:]
+	}
+
+	exact := false
+	wildcardMatch := false
+	for _, record := range zone.Records {
+		recordName := normalizeName(record.Name)
+		if recordName != name && recordName != wildcard {
+			continue
+		}
+		typeMatches := len(types) == 0
+		for _, recordType := range types {
+			if strings.EqualFold(record.Type, recordType) {
+				typeMatches = true
+			}
+		}
+		if recordName == name {
+			// a name that exists blocks the wildcard, even if it has none of the types we're looking for
+			if typeMatches {
+				return true
+			}
+			exact = true
+		} else if typeMatches {
+			wildcardMatch = true
+		}
+	}
+
+	return !exact && wildcardMatch
+}
+
+// hasTXTPrefix returns true if the zone has a TXT record at the given name starting with the given prefix.
+func hasTXTPrefix(zone auditZone, name string, prefix string) bool {
+	name = normalizeName(name)
+	for _, record := range zone.Records {
+		if !strings.EqualFold(record.Type, "TXT") || normalizeName(record.Name) != name {
+			continue
+		}
+		content := strings.Trim(strings.TrimSpace(record.Content), `"`)
+		if strings.HasPrefix(strings.ToLower(content), strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkApexMissing(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	if hasRecord(zone, zone.Name, "A", "AAAA", "CNAME") {
+		return nil
+	}
+	return []auditFinding{{Record: zone.Name, Message: "The zone apex has no A, AAAA, or CNAME record."}}
+}
+
+func checkWWWMissing(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	name := "www." + zone.Name
+	if hasRecord(zone, name, "A", "AAAA", "CNAME") {
+		return nil
+	}
+	return []auditFinding{{Record: name, Message: "There's no A, AAAA, or CNAME record for www."}}
+}
+
+// mailNames returns the names in the zone that have MX records.
+func mailNames(zone auditZone) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, record := range zone.Records {
+		name := normalizeName(record.Name)
+		if strings.EqualFold(record.Type, "MX") && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func checkSPFMissing(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	findings := []auditFinding{}
+	for _, name := range mailNames(zone) {
+		if !hasTXTPrefix(zone, name, "v=spf1") {
+			findings = append(findings, auditFinding{Record: name, Message: "This name has MX records, but no SPF TXT record."})
+		}
+	}
+	return findings
+}
+
+func checkDMARCMissing(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	if len(mailNames(zone)) == 0 {
+		return nil
+	}
+
+	// receivers fall back to the organizational domain, so a record at the apex covers every name in the zone
+	name := "_dmarc." + normalizeName(zone.Name)
+	if hasTXTPrefix(zone, name, "v=DMARC1") {
+		return nil
+	}
+	return []auditFinding{{Record: name, Message: "The zone has MX records, but no DMARC TXT record."}}
+}
+
+// checkDanglingCNAME looks for CNAME records pointing into a zone in the backup (including their own) where the target
+// name doesn't exist.
+func checkDanglingCNAME(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	findings := []auditFinding{}
+	for _, record := range zone.Records {
+		if !strings.EqualFold(record.Type, "CNAME") {
+			continue
+		}
+
+		target := normalizeName(record.Content)
+
+		// find the most specific zone that the target falls in
+		var targetZone *auditZone
+		for i, candidate := range zones {
+			candidateName := normalizeName(candidate.Name)
+			if target != candidateName && !strings.HasSuffix(target, "."+candidateName) {
+				continue
+			}
+			if targetZone == nil || len(candidateName) > len(targetZone.Name) {
+				targetZone = &zones[i]
+			}
+		}
+
+		// a partial zone's other names are hosted elsewhere, so we can't tell if they exist
+		if targetZone != nil && !targetZone.Partial && !hasRecord(*targetZone, target) {
+			findings = append(findings, auditFinding{
+				Record:  describeRecord(record),
+				Message: "The target doesn't exist in the " + targetZone.Name + " zone.",
+			})
+		}
+	}
+	return findings
+}
+
+func checkDuplicateRecord(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	findings := []auditFinding{}
+	seen := map[string]bool{}
+	for _, record := range zone.Records {
+		key := strings.ToUpper(record.Type) + " " + normalizeName(record.Name) + " " + record.Content
+		if seen[key] {
+			findings = append(findings, auditFinding{Record: describeRecord(record), Message: "This record appears more than once."})
+		}
+		seen[key] = true
+	}
+	return findings
+}
+
+func checkUnproxiableProxied(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	findings := []auditFinding{}
+	for _, record := range zone.Records {
+		if !record.Proxied {
+			continue
+		}
+		switch strings.ToUpper(record.Type) {
+		case "A", "AAAA", "CNAME":
+			continue
+		}
+		findings = append(findings, auditFinding{
+			Record:  describeRecord(record),
+			Message: "This record is marked as proxied, but Cloudflare can only proxy A, AAAA, and CNAME records.",
+		})
+	}
+	return findings
+}
+
+// writeAuditText writes the audit findings in the same style as the text backup format.
+func writeAuditText(w io.Writer, zonesChecked int, findings []auditFinding) error {
+	const separator = textSeparator
+
+	outputFile := bufio.NewWriter(w)
+	outputFile.WriteString(
+		"#\r\n" +
+			"# DNS audit\r\n" +
+			"# " + strconv.Itoa(len(findings)) + " problem(s) found in " + strconv.Itoa(zonesChecked) + " zone(s)\r\n" +
+			"#\r\n",
+	)
+	if len(findings) == 0 {
+		outputFile.WriteString("# (no problems found)\r\n")
+	} else {
+		outputFile.WriteString("# Zone" + separator + "Rule" + separator + "Record" + separator + "Problem\r\n")
+	}
+	for _, finding := range findings {
+		outputFile.WriteString(finding.Zone + separator + finding.Rule + separator + finding.Record + separator + finding.Message + "\r\n")
+	}
+
+	return outputFile.Flush()
+}
+
+func checkOwnerMissing(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	if !config.RequireOwnerTag {
+		return nil
+	}
+
+	findings := []auditFinding{}
+	for _, record := range zone.Records {
+		// Cloudflare owns the records that it manages itself
+		if record.ManagedBy != "" || len(recordOwners(record)) > 0 {
+			continue
+		}
+		findings = append(findings, auditFinding{
+			Record:  describeRecord(record),
+			Message: "This record has no owner. Give it an " + ownerTagName + ":<name> tag, or put owner: <name> in its comment.",
+		})
+	}
+	return findings
+}
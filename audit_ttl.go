@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// autoTTL is the TTL that the API gives records set to "Auto", which is 300 seconds for unproxied records, and
+// whatever Cloudflare picks for proxied ones.
+const autoTTL = 1
+
+// defaultAuditMaxTTL is the default for -audit-max-ttl: a day.
+const defaultAuditMaxTTL = 86400
+
+func checkTTLTooHigh(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	findings := []auditFinding{}
+	for _, record := range zone.Records {
+		if record.TTL == autoTTL || record.TTL <= config.MaxTTL {
+			continue
+		}
+		// the apex NS records are what the parent zone delegates to, so they're expected to be cached for long
+		if strings.EqualFold(record.Type, "NS") && normalizeName(record.Name) == normalizeName(zone.Name) {
+			continue
+		}
+		findings = append(findings, auditFinding{
+			Record:  describeRecord(record),
+			Message: "The TTL of " + strconv.FormatUint(record.TTL, 10) + " is more than the " + strconv.FormatUint(config.MaxTTL, 10) + " allowed by -audit-max-ttl.",
+		})
+	}
+	return findings
+}
+
+func checkTTLTooLow(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	findings := []auditFinding{}
+	for _, record := range zone.Records {
+		if record.TTL == autoTTL || record.TTL >= config.MinTTL {
+			continue
+		}
+		findings = append(findings, auditFinding{
+			Record:  describeRecord(record),
+			Message: "The TTL of " + strconv.FormatUint(record.TTL, 10) + " is less than the " + strconv.FormatUint(config.MinTTL, 10) + " allowed by -audit-min-ttl.",
+		})
+	}
+	return findings
+}
+
+func checkAutoTTLUnproxied(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	findings := []auditFinding{}
+	for _, record := range zone.Records {
+		if record.Proxied || record.TTL != autoTTL {
+			continue
+		}
+		findings = append(findings, auditFinding{
+			Record:  describeRecord(record),
+			Message: "This record isn't proxied, but its TTL is set to Auto, which means 300 seconds. Give it a TTL of its own.",
+		})
+	}
+	return findings
+}
+
+func checkProxiedExplicitTTL(zone auditZone, zones []auditZone, config auditConfig) []auditFinding {
+	findings := []auditFinding{}
+	for _, record := range zone.Records {
+		if !record.Proxied || record.TTL == autoTTL || record.TTL == 0 {
+			continue
+		}
+		findings = append(findings, auditFinding{
+			Record:  describeRecord(record),
+			Message: "This record is proxied, so Cloudflare ignores its TTL of " + strconv.FormatUint(record.TTL, 10) + " and uses its own. Set it to Auto.",
+		})
+	}
+	return findings
+}
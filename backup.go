@@ -0,0 +1,1237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// backupRun holds the state of a single backup run.
+type backupRun struct {
+	options           *options
+	client            *cloudflare.Client
+	collectors        []Collector
+	accountCollectors []AccountCollector
+	format            outputFormat
+	report            *RunReport
+	manifest          *manifest
+
+	// fileNames holds the base name of each zone's output, keyed by zone ID
+	fileNames map[string]string
+
+	// accountDirs holds the directory that -group-by-account puts each zone's output in, keyed by zone ID
+	accountDirs map[string]string
+
+	// zoneRecords holds the records of each zone for the audit and DNS verification, if either is enabled, and of the
+	// zones in -compare-zones
+	zoneRecords []auditZone
+
+	// zoneSettings holds the settings of each zone for -audit-baseline
+	zoneSettings []auditSettings
+
+	// changes holds the changes found in each zone, if drift detection is enabled
+	changes []zoneChanges
+
+	// tombstones holds the records that drift detection found were removed, for deleted-records.ndjson
+	tombstones []tombstone
+
+	// previousRecordCounts holds how many DNS records each zone had in the previous backup's manifest, keyed by zone
+	// ID, for checkShrink. previousFilter is the filter that the previous backup was made with, if any.
+	previousRecordCounts map[string]int
+	previousFilter       string
+
+	// reportZones holds what the -report outputs show about each zone, keyed by zone ID
+	reportZones map[string]*reportZone
+
+	// cache is nil if caching is disabled
+	cache *cachingTransport
+
+	// state records the zones completed so far, for -resume
+	state *runState
+
+	// accounting counts the requests that reach the API
+	accounting *accountingTransport
+
+	// connections counts how often connections to the API were reused, for the debug log
+	connections *connectionTracingTransport
+
+	// requestLimit is nil unless -max-requests is set
+	requestLimit *requestLimitTransport
+
+	// singleFile is nil unless -single-file is set
+	singleFile *singleFile
+
+	// zoneHashMatches is set while a zone is being written if its content hash is the same as in the previous backup,
+	// so -skip-unchanged leaves its files alone without comparing them
+	zoneHashMatches bool
+}
+
+func newBackupRun(opts *options) (*backupRun, error) {
+	selectedCollectors, selectedAccountCollectors, err := selectCollectors(opts.Resources, opts.IncludeAccountResources, opts.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	for i, collector := range selectedCollectors {
+		configurable, ok := collector.(configurableCollector)
+		if ok {
+			selectedCollectors[i] = configurable.withOptions(opts)
+		}
+	}
+	for i, collector := range selectedAccountCollectors {
+		configurable, ok := collector.(configurableAccountCollector)
+		if ok {
+			selectedAccountCollectors[i] = configurable.withOptions(opts)
+		}
+	}
+
+	if opts.baseline != nil && !hasCollector(selectedCollectors, "settings") {
+		return nil, errors.New("The -audit-baseline flag checks the zone settings, so settings must be one of the -resources.")
+	}
+
+	format, err := getOutputFormat(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &backupRun{
+		options:           opts,
+		collectors:        selectedCollectors,
+		accountCollectors: selectedAccountCollectors,
+		format:            format,
+		report:            newRunReport(),
+		manifest:          newManifest(opts.Layout, opts.recordFilter.String()),
+		reportZones:       map[string]*reportZone{},
+	}
+	b.previousRecordCounts, b.previousFilter = loadPreviousRecordCounts(opts.OutputDir)
+	b.manifest.Endpoint = opts.endpoint
+	b.report.Endpoint = opts.endpoint
+
+	if opts.IncludeSecrets {
+		for _, collector := range selectedCollectors {
+			_, ok := collector.(secretCollector)
+			b.manifest.ContainsSecrets = b.manifest.ContainsSecrets || ok
+		}
+		for _, collector := range selectedAccountCollectors {
+			_, ok := collector.(secretCollector)
+			b.manifest.ContainsSecrets = b.manifest.ContainsSecrets || ok
+		}
+	}
+
+	fingerprint := optionsFingerprint(opts, selectedCollectors)
+	if opts.Resume {
+		var valid bool
+		b.state, valid = loadRunState(opts.OutputDir, fingerprint)
+		if !valid {
+			log.Println("There's no usable state from a previous run with the same options, so every zone will be backed up.")
+		}
+	} else {
+		b.state = newRunState(fingerprint)
+	}
+
+	transport, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	b.connections = newConnectionTracingTransport(transport)
+	b.accounting = newAccountingTransport(b.connections)
+	var roundTripper http.RoundTripper = b.accounting
+	if opts.MaxRequests > 0 {
+		b.requestLimit = newRequestLimitTransport(b.accounting, opts.MaxRequests)
+		roundTripper = b.requestLimit
+	}
+	if !opts.NoCache && opts.GPGRecipient == "" {
+		// the cache holds plaintext responses, so it's never used when the backup is encrypted
+		cacheDir := opts.CacheDir
+		if cacheDir == "" {
+			cacheDir = filepath.Join(opts.OutputDir, cacheDirName)
+		}
+		b.cache, err = newCachingTransport(roundTripper, cacheDir, os.FileMode(opts.DirMode), os.FileMode(opts.FileMode))
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't create the cache directory: %w", err)
+		}
+		b.cache.onHit = func(url string) {
+			b.debugf("Using cached response for %s", url)
+			b.report.CacheHits++
+		}
+		roundTripper = b.cache
+	}
+
+	b.client = opts.apiCredentials.newClient()
+	if opts.accountIDFromEnv {
+		log.Printf("Using the account ID from %s.", accountIDEnv)
+	}
+	b.client.BaseURL = opts.APIBaseURL
+	b.client.UserAgent = opts.UserAgent
+	b.client.PerPage = opts.PerPage
+	if opts.RateLimit > 0 {
+		b.client.RateLimiter = cloudflare.NewRateLimiter(opts.RateLimit, 1)
+	}
+	b.client.HTTPClient = &http.Client{
+		Transport: roundTripper,
+		Timeout:   opts.Timeout,
+	}
+	b.client.OnRequest = func(path string, statusCode int) {
+		b.debugf("GET %s: %d", path, statusCode)
+		if statusCode == 0 {
+			b.report.AddAPIRequest("error")
+		} else {
+			b.report.AddAPIRequest(strconv.Itoa(statusCode))
+		}
+	}
+	b.client.OnRetry = func(path string, err error) {
+		log.Printf("Request to %s failed, retrying: %s", path, err)
+		b.report.Retries++
+	}
+	b.client.OnBackoff = func(path string, delay time.Duration) {
+		b.accounting.addBackoff(delay)
+	}
+	b.client.OnRateLimitWait = func(path string, wait time.Duration) {
+		b.accounting.addRateLimitWait(wait)
+	}
+	b.client.OnPause = func(path string, wait time.Duration) {
+		log.Printf("Rate limited by the API, so pausing every request for %s.", wait.Round(time.Second))
+	}
+	if opts.StrictDecode {
+		b.client.OnUnknownFields = func(path string, fields []string) {
+			b.report.AddSchemaDrift(requestCategory(path), fields)
+		}
+	}
+
+	b.debugf("Using API base URL %s", b.client.BaseURL)
+
+	return b, nil
+}
+
+// backupInfo returns the information about the run passed to writers.
+func (b *backupRun) backupInfo() backupInfo {
+	return backupInfo{
+		TakenAt:    b.report.Start,
+		TimeZone:   b.options.timeZone,
+		TimeFormat: b.options.TimeFormat,
+		Filter:     b.options.recordFilter.String(),
+		Warn:       b.report.AddWarning,
+
+		RecordFlags: b.options.TextRecordFlags,
+	}
+}
+
+// zoneInfo returns the information passed to writers for a zone, which also lists the resources that were skipped.
+func (b *backupRun) zoneInfo(manifestZone *manifestZone) backupInfo {
+	info := b.backupInfo()
+	info.Missing = manifestZone.Warnings
+	return info
+}
+
+// debugf logs a message if debug logging is enabled.
+func (b *backupRun) debugf(format string, args ...interface{}) {
+	if b.options.Debug {
+		log.Printf("[debug] "+format, args...)
+	}
+}
+
+// run performs the backup, then writes out the summary and sends any notifications. The returned report says
+// whether the run succeeded.
+func (b *backupRun) run(ctx context.Context) *RunReport {
+	pingHealthcheck(b.options, "/start", nil)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if b.requestLimit != nil {
+		b.requestLimit.cancel = cancel
+	}
+
+	if len(b.collectors) > 0 {
+		err := b.backupZones(ctx)
+		if err != nil {
+			log.Println(err)
+			b.report.AddError(err)
+		}
+	}
+
+	if len(b.accountCollectors) > 0 && ctx.Err() == nil {
+		err := b.backupAccounts(ctx)
+		if err != nil {
+			log.Println(err)
+			b.report.AddError(err)
+		}
+	}
+
+	b.debugf("connections: %s", b.connections)
+
+	var err error
+	if b.options.VerifyDNS {
+		b.verifyDNS(ctx)
+	}
+
+	if b.options.Drift {
+		err = b.appendChangelog()
+		if err != nil {
+			log.Printf("Couldn't write changelog: %s", err)
+			b.report.AddError(err)
+		}
+
+		err = b.writeTombstones()
+		if err != nil {
+			log.Printf("Couldn't write %s: %s", tombstonesFileName, err)
+			b.report.AddError(err)
+		}
+	}
+
+	if b.options.Audit {
+		err = b.writeAudit()
+		if err != nil {
+			log.Printf("Couldn't write audit: %s", err)
+			b.report.AddError(err)
+		}
+	}
+
+	if len(b.options.CompareZones) > 0 {
+		err = b.writeZoneComparison()
+		if err != nil {
+			log.Printf("Couldn't write the zone comparison: %s", err)
+			b.report.AddError(err)
+		}
+	}
+
+	for _, name := range b.options.reports {
+		err = reportWriters[name](b)
+		if err != nil {
+			log.Printf("Couldn't write %s report: %s", name, err)
+			b.report.AddError(err)
+		}
+	}
+
+	err = b.addHistoryFiles()
+	if err != nil {
+		log.Printf("Couldn't add the changelog and tombstones to the manifest: %s", err)
+		b.report.AddError(err)
+	}
+
+	err = b.manifest.write(b.options.OutputDir, os.FileMode(b.options.FileMode))
+	if err != nil {
+		log.Printf("Couldn't write manifest: %s", err)
+		b.report.AddError(err)
+	} else if b.options.signingKey != nil {
+		err = signManifest(b.options.OutputDir, b.options.signingKey, os.FileMode(b.options.FileMode))
+		if err != nil {
+			log.Printf("Couldn't sign manifest: %s", err)
+			b.report.AddError(err)
+		}
+	}
+
+	b.report.APIUsage = b.accounting.snapshot()
+	b.report.APIUsage.PausedSeconds = b.client.Paused().Seconds()
+	b.report.Finish()
+	b.report.Print()
+
+	if b.options.SummaryJSON != "" {
+		err = b.report.WriteJSON(b.options.SummaryJSON, os.FileMode(b.options.FileMode))
+		if err != nil {
+			log.Printf("Couldn't write summary JSON: %s", err)
+		}
+	}
+
+	if b.options.MetricsFile != "" {
+		err = writeMetrics(b.options.MetricsFile, b.report)
+		if err != nil {
+			log.Printf("Couldn't write metrics file: %s", err)
+		}
+	}
+
+	sendWebhook(b.options, b.report)
+
+	if b.report.Failed() {
+		pingHealthcheck(b.options, "/fail", healthcheckSummary(b.options, b.report))
+	} else {
+		pingHealthcheck(b.options, "", healthcheckSummary(b.options, b.report))
+	}
+
+	return b.report
+}
+
+// listZones returns every zone that the token can access, along with the ones selected by -zones. With -zone-id,
+// -zones-from, or zone names on the command line, only the given zones are looked up, and both lists hold just them.
+func (b *backupRun) listZones(ctx context.Context) ([]cloudflare.Zone, []cloudflare.Zone, error) {
+	if len(b.options.ZoneIDs) > 0 {
+		zones, err := b.getZonesByID(ctx)
+		return zones, zones, err
+	}
+	if len(b.options.ZoneNames) > 0 {
+		zones, err := b.getZonesByName(ctx)
+		return zones, zones, err
+	}
+	if len(b.options.zonesFromNames) > 0 {
+		zones, err := b.getZonesFromList(ctx)
+		return zones, zones, err
+	}
+
+	zones := []cloudflare.Zone{}
+	err := b.client.ForEachZone(ctx, func(zone cloudflare.Zone) error {
+		zones = append(zones, zone)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selected, unused := b.options.zoneFilter.apply(zones)
+	for _, pattern := range unused {
+		b.report.AddWarning("%q in -zones didn't match any zone", pattern)
+	}
+	return zones, selected, nil
+}
+
+// getZonesByID looks up each zone given with -zone-id. If the token can't even read a zone's details, the collectors
+// are still run with just its ID, which is also used as its file name.
+func (b *backupRun) getZonesByID(ctx context.Context) ([]cloudflare.Zone, error) {
+	zones := []cloudflare.Zone{}
+	for _, id := range b.options.ZoneIDs {
+		zone, err := b.client.GetZone(ctx, id)
+		if cloudflare.IsPermissionError(err) {
+			b.report.AddWarning("the API token can't read the details of zone %s, so it's named by its ID", id)
+			zone = cloudflare.Zone{ID: id, Name: id}
+		} else if err != nil {
+			return nil, fmt.Errorf("Couldn't get zone %s: %w", id, err)
+		}
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
+// getZonesByName looks up each zone named on the command line. Unlike -zones, each name has to match exactly one zone,
+// since naming a zone that can't be found is almost certainly a mistake.
+func (b *backupRun) getZonesByName(ctx context.Context) ([]cloudflare.Zone, error) {
+	zones := []cloudflare.Zone{}
+	seen := map[string]bool{}
+	for _, name := range b.options.ZoneNames {
+		found, err := b.client.FindZones(ctx, normalizeName(name))
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't look up zone %s: %w", name, err)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("There's no zone named %s that the API token can access.", name)
+		}
+		if len(found) > 1 {
+			ids := []string{}
+			for _, zone := range found {
+				if zone.Account != nil && zone.Account.Name != "" {
+					ids = append(ids, zone.ID+" in "+zone.Account.Name)
+				} else {
+					ids = append(ids, zone.ID)
+				}
+			}
+			return nil, fmt.Errorf("There are %d zones named %s: %s. Pick one with -zone-id instead.", len(found), name, strings.Join(ids, ", "))
+		}
+		if !seen[found[0].ID] {
+			seen[found[0].ID] = true
+			zones = append(zones, found[0])
+		}
+	}
+	return zones, nil
+}
+
+// getZonesFromList looks up each zone named in the -zones-from list. Like -zones, a name that doesn't match any zone is
+// a warning rather than an error, since the list usually comes from somewhere else, and a name that matches zones in
+// more than one account picks all of them.
+func (b *backupRun) getZonesFromList(ctx context.Context) ([]cloudflare.Zone, error) {
+	zones := []cloudflare.Zone{}
+	seen := map[string]bool{}
+	for _, name := range b.options.zonesFromNames {
+		found, err := b.client.FindZones(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't look up zone %s: %w", name, err)
+		}
+		if len(found) == 0 {
+			b.report.AddWarning("%q in -zones-from didn't match any zone", name)
+		}
+		for _, zone := range found {
+			if !seen[zone.ID] {
+				seen[zone.ID] = true
+				zones = append(zones, zone)
+			}
+		}
+	}
+	return zones, nil
+}
+
+// backupZones backs up every selected zone. Errors in individual zones are recorded in the report, while errors
+// that stop the whole run are returned.
+func (b *backupRun) backupZones(ctx context.Context) error {
+	allZones, zones, err := b.listZones(ctx)
+	if err != nil {
+		return err
+	}
+	zones = b.limitZones(zones)
+
+	if b.options.SingleFile {
+		err = b.openSingleFile()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := b.closeSingleFile()
+			if err != nil {
+				log.Printf("Couldn't write %s: %s", singleFileName, err)
+				b.report.AddError(err)
+			}
+		}()
+	}
+
+	// the names are picked from every zone, so that a zone's file name doesn't depend on which zones were selected
+	b.fileNames = zoneFileNames(allZones)
+	b.accountDirs = zoneAccountDirNames(allZones)
+	if b.cache != nil {
+		for _, zone := range zones {
+			b.cache.setZoneVersion(zone.ID, zone.ModifiedOn)
+		}
+	}
+
+	for _, zone := range zones {
+		if ctx.Err() != nil {
+			return b.stopError()
+		}
+		log.Printf("Processing %s...", zone.Name)
+
+		zoneReport := b.report.AddZone(zone)
+		zoneStart := time.Now()
+
+		if b.options.Resume {
+			completed, ok := b.state.completedSince(zone.ID, b.report.Start.Add(-b.options.ResumeMaxAge))
+			if ok {
+				log.Printf("Skipping %s, which was already backed up at %s.", zone.Name, completed.FinishedAt.Format(time.RFC3339))
+				zoneReport.Resumed = true
+				b.manifest.Zones = append(b.manifest.Zones, completed.Manifest)
+				continue
+			}
+		}
+
+		requestsBefore := b.accounting.requestsSent()
+		err := b.zoneHook(ctx, "pre-zone", b.options.PreZoneHook, zone, zoneReport, nil)
+		if err == nil {
+			zoneCtx, cancel := b.zoneContext(ctx)
+			err = b.handleZone(zoneCtx, zone, zoneReport)
+			if err != nil && zoneCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				zoneReport.TimedOut = true
+				err = fmt.Errorf("timed out after %s", b.options.ZoneTimeout)
+			}
+			if errors.Is(err, errZoneVanished) {
+				zoneReport.Vanished = true
+				b.debugf("%s: %s", zone.Name, err)
+				b.report.AddWarning("%s vanished during the run, so it was skipped, and its previous backup was left as it was", zone.Name)
+				err = nil
+			}
+			cancel()
+		}
+		zoneReport.DurationSeconds = time.Since(zoneStart).Seconds()
+		zoneReport.APIRequestsSent = b.accounting.requestsSent() - requestsBefore
+
+		hookErr := b.zoneHook(ctx, "post-zone", b.options.PostZoneHook, zone, zoneReport, err)
+		if err == nil {
+			err = hookErr
+		}
+		if err != nil {
+			log.Printf("Failed to back up %s: %s", zone.Name, err)
+			zoneReport.Error = err.Error()
+			b.report.AddError(fmt.Errorf("%s: %w", zone.Name, err))
+		}
+	}
+
+	if ctx.Err() != nil {
+		return b.stopError()
+	}
+	return nil
+}
+
+func (b *backupRun) handleZone(ctx context.Context, zone cloudflare.Zone, zoneReport *ZoneReport) error {
+	manifestZone := &manifestZone{
+		ID:                zone.ID,
+		Name:              zone.Name,
+		Files:             []manifestFile{},
+		Collectors:        []string{},
+		SkippedCollectors: []string{},
+	}
+	if b.options.GroupByAccount {
+		manifestZone.Account = b.accountDirs[zone.ID]
+	}
+
+	// this is cleared as soon as any file is written
+	zoneReport.Unchanged = b.options.SkipUnchanged
+
+	// the hold and development mode aren't part of the zone listing, so they're added to the zone's metadata here
+	zone.Hold = b.zoneHold(ctx, zone)
+	zone.DevelopmentMode = b.zoneDevelopmentMode(ctx, zone)
+	for _, collector := range b.collectors {
+		if _, isPageRules := collector.(pageRulesCollector); isPageRules {
+			zone.PageRuleEntitlements = b.zonePageRuleEntitlements(ctx, zone)
+		}
+	}
+
+	// run each collector for this zone
+	sections := []Section{}
+	zoneReport.Partial = isPartialZone(zone)
+	for _, collector := range b.collectors {
+		typeCollector, ok := collector.(zoneTypeCollector)
+		if ok && !typeCollector.AppliesTo(zone) {
+			b.debugf("Skipping %s for %s, since it doesn't apply to %s zones", collector.Name(), zone.Name, zone.Type)
+			continue
+		}
+
+		var section Section
+		var err error
+		stopTiming := b.startCollectorTiming(collector.Name())
+		if _, isDNS := collector.(dnsCollector); isDNS && b.options.StreamRecords {
+			section = streamDNSRecords(ctx, b.client, zone, b.options.recordFilter)
+		} else {
+			section, err = collector.Collect(b.collectorContext(ctx, collector), b.client, zone)
+		}
+		zoneReport.Collectors = append(zoneReport.Collectors, stopTiming())
+		err = b.checkVanished(ctx, zone, err)
+		if errors.Is(err, errZoneVanished) {
+			// nothing has been written for the zone yet, so returning now leaves its previous backup alone
+			return fmt.Errorf("%s: %w", collector.Name(), err)
+		}
+		if cloudflare.IsPermissionError(err) {
+			b.skipMissingResource(zone.Name, collector, err, manifestZone)
+			zoneReport.SkippedCollectors = append(zoneReport.SkippedCollectors, collector.Name())
+			continue
+		}
+		if isPartialZone(zone) && cloudflare.IsClientError(err) {
+			// some endpoints refuse partial zones, but that shouldn't stop us backing up the rest
+			b.report.AddWarning("skipped %s for %s, which isn't available for partial (CNAME setup) zones: %s", collector.Name(), zone.Name, err)
+			zoneReport.SkippedCollectors = append(zoneReport.SkippedCollectors, collector.Name())
+			manifestZone.SkippedCollectors = append(manifestZone.SkippedCollectors, collector.Name())
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", collector.Name(), err)
+		}
+
+		section, err = b.redactSecrets(collector, section)
+		if err != nil {
+			return fmt.Errorf("%s: couldn't redact secrets: %w", collector.Name(), err)
+		}
+
+		records, isDNS := section.Data.([]cloudflare.DNSRecord)
+		if isDNS {
+			zoneReport.RecordsFetched = len(records)
+			if b.options.Audit || b.options.VerifyDNS || b.options.CompareZones.includes(zone.Name) {
+				b.zoneRecords = append(b.zoneRecords, auditZone{Name: zone.Name, Records: records, Partial: isPartialZone(zone)})
+			}
+			if b.options.recordFilter.active() {
+				section.Data = b.options.recordFilter.apply(records)
+			}
+		}
+
+		sections = append(sections, section)
+		manifestZone.Collectors = append(manifestZone.Collectors, collector.Name())
+
+		switch section.Name {
+		case "dns":
+			zoneReport.Records = section.ItemCount()
+		case "pagerules":
+			zoneReport.PageRules = section.ItemCount()
+		case "settings":
+			if b.options.baseline != nil {
+				b.zoneSettings = append(b.zoneSettings, auditSettings{Name: zone.Name, Settings: section.Data.([]cloudflare.ZoneSetting)})
+			}
+		}
+	}
+
+	// this is checked before anything else looks at the records, so that a zone that came back nearly empty doesn't
+	// show up in the changelog or the tombstones as having had most of its records deleted
+	err := b.checkShrink(zone, sections, zoneReport)
+	if err != nil {
+		return err
+	}
+
+	// the content hash says whether anything changed, for the summary, -drift, and -skip-unchanged alike
+	contentHash := zoneContentHash(zone, sections, b.renderingOptions())
+	zoneReport.ContentHash = contentHash
+	zoneReport.PreviousContentHash = b.readZoneHash(zone.ID)
+	manifestZone.ContentHash = contentHash
+	b.zoneHashMatches = contentHash != "" && contentHash == zoneReport.PreviousContentHash
+	defer func() {
+		b.zoneHashMatches = false
+	}()
+
+	var changes []recordChange
+	compared := false
+	if b.options.Drift {
+		changes, compared = b.detectDrift(zone, sections, zoneReport)
+	}
+	if len(b.options.reports) > 0 {
+		b.reportZones[zone.ID] = newReportZone(zone, sections, compared, changes)
+	}
+
+	// write them out
+	if b.options.Layout == "dir" {
+		err = b.writeZoneDir(zone, sections, zoneReport, manifestZone)
+	} else {
+		if b.options.GroupByAccount {
+			err = b.createDir(b.accountDirs[zone.ID])
+		}
+		if err == nil && b.singleFile != nil {
+			err = b.writeSingleFile(zone, sections, zoneReport, manifestZone)
+		} else if err == nil {
+			name := b.zonePath(zone.ID) + "." + b.format.Extension
+			err = b.writeRecordsFile(name, zoneReport, manifestZone, b.selfChecked(name, zone, sections, func(w io.Writer) error {
+				return writeZone(b.format.NewWriter(w, b.zoneInfo(manifestZone)), zone, sections)
+			}))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, section := range sections {
+		stream, isStream := section.Data.(*recordStream)
+		if isStream {
+			// the records were only counted as they were written
+			zoneReport.RecordsFetched = stream.fetched
+			zoneReport.Records = stream.written
+		}
+		if section.Name == "dns" {
+			records := zoneReport.Records
+			manifestZone.Records = &records
+			if b.options.recordFilter.active() {
+				fetched := zoneReport.RecordsFetched
+				manifestZone.RecordsFetched = &fetched
+			}
+		}
+
+		err = b.writeSectionFiles(b.zonePath(zone.ID), section, zoneReport, manifestZone)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.options.IncludeCFExport {
+		err = b.writeCFExport(ctx, zone, zoneReport, manifestZone)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = b.writeZoneHash(zone, manifestZone)
+	if err != nil {
+		return err
+	}
+
+	b.manifest.Zones = append(b.manifest.Zones, manifestZone)
+
+	b.state.Zones[zone.ID] = &zoneState{
+		Name:        zone.Name,
+		ContentHash: manifestContentHash(manifestZone),
+		FinishedAt:  time.Now().UTC(),
+		Manifest:    manifestZone,
+	}
+	err = b.state.write(b.options.OutputDir, os.FileMode(b.options.FileMode))
+	if err != nil {
+		b.report.AddWarning("couldn't save progress to the state file: %s", err)
+	}
+
+	return nil
+}
+
+// errZoneVanished is returned for a zone that was deleted, or that the token lost access to, after it was listed.
+var errZoneVanished = errors.New("the zone no longer exists")
+
+// checkVanished works out whether a request for one of the zone's resources failed because the zone itself is gone,
+// by looking the zone up again, and returns errZoneVanished if so. A 403 or 404 can also just mean that the token
+// can't read that resource, or that the zone doesn't have it, so any other error is returned as it was.
+func (b *backupRun) checkVanished(ctx context.Context, zone cloudflare.Zone, err error) error {
+	apiError := &cloudflare.APIError{}
+	if !errors.As(err, &apiError) || (apiError.StatusCode != http.StatusNotFound && apiError.StatusCode != http.StatusForbidden) {
+		return err
+	}
+
+	if b.cache != nil {
+		// without its version, the zone's saved responses can't be reused, so this really asks the API
+		b.cache.setZoneVersion(zone.ID, "")
+	}
+	_, lookupErr := b.client.GetZone(ctx, zone.ID)
+	if !errors.As(lookupErr, &apiError) || (apiError.StatusCode != http.StatusNotFound && apiError.StatusCode != http.StatusForbidden) {
+		if b.cache != nil {
+			b.cache.setZoneVersion(zone.ID, zone.ModifiedOn)
+		}
+		return err
+	}
+	return fmt.Errorf("%w: %s", errZoneVanished, err)
+}
+
+// skipMissingResource records a collector that was skipped because the token doesn't have permission for it, in the
+// report and in the manifest. With -require-all-resources, it also makes the run fail.
+func (b *backupRun) skipMissingResource(owner string, collector interface{ Name() string }, err error, manifestZone *manifestZone) {
+	missing := missingResource{
+		Zone:       owner,
+		Resource:   collector.Name(),
+		Permission: neededPermission(collector, err),
+	}
+	b.report.AddWarning("skipped %s for %s, because the API token doesn't have the %s permission", missing.Resource, owner, missing.Permission)
+	b.report.MissingResources = append(b.report.MissingResources, missing)
+	manifestZone.SkippedCollectors = append(manifestZone.SkippedCollectors, missing.Resource)
+	manifestZone.Warnings = append(manifestZone.Warnings, missing)
+
+	if b.options.RequireAllResources {
+		b.report.AddError(fmt.Errorf("%s: %s: %w", owner, missing.Resource, err))
+	}
+}
+
+// neededPermission names the permission that a collector was denied, like "Zone / DNS / Read". It's worked out from
+// the request that failed if possible, or else from what the collector says it needs.
+func neededPermission(collector interface{}, err error) string {
+	apiError := &cloudflare.APIError{}
+	if errors.As(err, &apiError) && apiError.MissingScope() != "" {
+		return apiError.MissingScope()
+	}
+
+	permissionCollector, ok := collector.(permissionCollector)
+	if ok {
+		return permissionCollector.RequiredPermission()
+	}
+	return "an unknown permission"
+}
+
+// writeCFExport saves the zone's DNS records as exported by Cloudflare. It's kept as a second opinion on what the zone
+// looks like, but the backup's own format is what's used to restore from.
+func (b *backupRun) writeCFExport(ctx context.Context, zone cloudflare.Zone, zoneReport *ZoneReport, manifestZone *manifestZone) error {
+	export, err := b.client.ExportDNSRecords(ctx, zone.ID)
+	if cloudflare.IsPermissionError(err) || (isPartialZone(zone) && cloudflare.IsClientError(err)) {
+		b.report.AddWarning("couldn't get Cloudflare's export of %s: %s", zone.Name, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+
+	name := b.zonePath(zone.ID) + ".cf-export.zone"
+	if b.options.Layout == "dir" {
+		name = path.Join(b.zonePath(zone.ID), "cf-export.zone")
+	}
+	return b.writeOutputFile(name, zoneReport, manifestZone, func(w io.Writer) error {
+		_, err := w.Write(export)
+		return err
+	})
+}
+
+// zoneHold fetches the zone's hold. If it can't be read, the backup just goes without it, since it's only metadata.
+func (b *backupRun) zoneHold(ctx context.Context, zone cloudflare.Zone) *cloudflare.ZoneHold {
+	hold, err := b.client.GetZoneHold(ctx, zone.ID)
+	if cloudflare.IsClientError(err) {
+		b.debugf("couldn't get the hold of %s, so it isn't in the backup: %s", zone.Name, err)
+		return nil
+	}
+	if err != nil {
+		b.report.AddWarning("couldn't get the hold of %s, so it isn't in the backup: %s", zone.Name, err)
+		return nil
+	}
+	return &hold
+}
+
+// zoneDevelopmentMode fetches the zone's development mode setting. Like the hold, the backup goes without it if it
+// can't be read.
+func (b *backupRun) zoneDevelopmentMode(ctx context.Context, zone cloudflare.Zone) *cloudflare.DevelopmentMode {
+	developmentMode, err := b.client.GetDevelopmentMode(ctx, zone.ID)
+	if cloudflare.IsClientError(err) {
+		b.debugf("couldn't get the development mode of %s, so it isn't in the backup: %s", zone.Name, err)
+		return nil
+	}
+	if err != nil {
+		b.report.AddWarning("couldn't get the development mode of %s, so it isn't in the backup: %s", zone.Name, err)
+		return nil
+	}
+	return &developmentMode
+}
+
+// zonePageRuleEntitlements fetches what the zone's plan allows for page rules, so that a restore can tell whether the
+// rules will fit. Like the hold, the backup goes without it if it can't be read.
+func (b *backupRun) zonePageRuleEntitlements(ctx context.Context, zone cloudflare.Zone) *cloudflare.PageRuleEntitlements {
+	settings, err := b.client.GetPageRuleSettings(ctx, zone.ID)
+	if cloudflare.IsClientError(err) {
+		b.debugf("couldn't get the page rule entitlements of %s, so they aren't in the backup: %s", zone.Name, err)
+		return nil
+	}
+	if err != nil {
+		b.report.AddWarning("couldn't get the page rule entitlements of %s, so they aren't in the backup: %s", zone.Name, err)
+		return nil
+	}
+
+	entitlements := &cloudflare.PageRuleEntitlements{Settings: settings}
+	if zone.Meta != nil {
+		entitlements.MaxRules = zone.Meta.PageRuleQuota
+	}
+	return entitlements
+}
+
+// detectDrift compares the zone's settings and DNS records to its previous backup, before it's overwritten. It returns
+// the changes to the records, and false if there were no records to compare to.
+func (b *backupRun) detectDrift(zone cloudflare.Zone, sections []Section, zoneReport *ZoneReport) ([]recordChange, bool) {
+	if b.zoneHashMatches {
+		b.debugf("%s has the same content hash as its previous backup, so nothing changed", zone.Name)
+		return nil, true
+	}
+
+	changed := zoneChanges{
+		Time: b.changelogTime(),
+		Zone: zone.Name,
+	}
+
+	previousZone, found, err := b.loadPreviousZone(zone)
+	if err != nil {
+		b.report.AddWarning("couldn't read the settings in the previous backup of %s, so they weren't checked for changes: %s", zone.Name, err)
+	} else if found {
+		changed.Settings = diffZoneSettings(previousZone, zone)
+		for _, change := range changed.Settings {
+			zoneReport.SettingsChanged = append(zoneReport.SettingsChanged, change.Setting+": "+change.Old+" -> "+change.New)
+		}
+	}
+
+	compared := false
+	for _, section := range sections {
+		if section.Name != "dns" {
+			continue
+		}
+
+		previous, lastSeen, found, err := b.loadPreviousRecords(zone)
+		if err != nil {
+			b.report.AddWarning("couldn't read the previous backup of %s, so it wasn't checked for changes: %s", zone.Name, err)
+			break
+		}
+		if !found {
+			b.debugf("%s has no previous backup to compare to", zone.Name)
+			break
+		}
+
+		// a filtered backup only has some of the zone's records, so only the records that both backups would have had
+		// are compared, and the rest aren't reported as having been added or removed
+		filter := b.options.recordFilter.String()
+		if b.previousFilter != "" && b.previousFilter != filter {
+			current := "isn't filtered"
+			if filter != "" {
+				current = "is filtered with " + filter
+			}
+			b.report.AddWarning("the previous backup of %s was filtered with %s, but this one %s, so its records weren't checked for changes", zone.Name, b.previousFilter, current)
+			break
+		}
+		if b.options.recordFilter.active() {
+			previous = b.options.recordFilter.apply(previous)
+		}
+
+		changed.Changes = diffRecords(previous, section.Data.([]cloudflare.DNSRecord), b.format.recordKey())
+		for _, change := range changed.Changes {
+			switch change.Kind {
+			case "+":
+				zoneReport.RecordsAdded++
+			case "-":
+				zoneReport.RecordsRemoved++
+			case "~":
+				zoneReport.RecordsModified++
+			}
+		}
+		b.addTombstones(zone, changed.Changes, lastSeen)
+		compared = true
+		break
+	}
+
+	if len(changed.Changes) > 0 || len(changed.Settings) > 0 {
+		b.changes = append(b.changes, changed)
+	}
+	return changed.Changes, compared
+}
+
+// writeAudit checks the records of every zone that was backed up, and their settings with -audit-baseline, and writes
+// the findings to audit.txt and audit.json.
+func (b *backupRun) writeAudit() error {
+	findings := runAudit(b.zoneRecords, b.options.auditConfig)
+	recordFindings := len(findings)
+	if b.options.baseline != nil {
+		findings = append(findings, checkBaseline(b.options.baseline, b.zoneSettings)...)
+	}
+	baselineFindings := len(findings) - recordFindings
+	b.report.AuditFindings = len(findings)
+
+	zonesChecked := map[string]bool{}
+	for _, zone := range b.zoneRecords {
+		zonesChecked[zone.Name] = true
+	}
+	for _, zone := range b.zoneSettings {
+		zonesChecked[zone.Name] = true
+	}
+
+	err := b.writeRootFile("audit.txt", func(w io.Writer) error {
+		return writeAuditText(w, len(zonesChecked), findings)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = b.writeRootFile("audit.json", func(w io.Writer) error {
+		return writeJSON(w, map[string]interface{}{
+			"zones_checked": len(zonesChecked),
+			"findings":      findings,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if b.options.AuditStrict && recordFindings > 0 {
+		b.report.AddError(fmt.Errorf("the audit found %d problem(s), see audit.txt", recordFindings))
+	}
+	if b.options.AuditStrict && baselineFindings > 0 {
+		b.report.AddError(fmt.Errorf("%w: %d setting(s) are different, see audit.txt", errBaselineDeviation, baselineFindings))
+	}
+
+	return nil
+}
+
+// writeZoneDir writes a zone into its own directory, with a file for each section. The DNS records are written in the
+// selected format, while everything else is written as JSON.
+func (b *backupRun) writeZoneDir(zone cloudflare.Zone, sections []Section, zoneReport *ZoneReport, manifestZone *manifestZone) error {
+	zoneDirName := b.zonePath(zone.ID)
+	err := b.createDir(zoneDirName)
+	if err != nil {
+		return err
+	}
+
+	err = b.writeOutputFile(path.Join(zoneDirName, "zone.json"), zoneReport, manifestZone, func(w io.Writer) error {
+		return writeJSON(w, zone)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, section := range sections {
+		section := section
+		if section.Name == "dns" {
+			name := path.Join(zoneDirName, "dns."+b.format.Extension)
+			err = b.writeRecordsFile(name, zoneReport, manifestZone, b.selfChecked(name, zone, []Section{section}, func(w io.Writer) error {
+				return writeZone(b.format.NewWriter(w, b.zoneInfo(manifestZone)), zone, []Section{section})
+			}))
+		} else {
+			err = b.writeOutputFile(path.Join(zoneDirName, section.Name+".json"), zoneReport, manifestZone, func(w io.Writer) error {
+				return writeJSON(w, section.Data)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSectionFiles writes the extra files of a section, in a directory named after the section inside the zone's (or
+// account's) directory. That directory is created if needed, even in the flat layout.
+func (b *backupRun) writeSectionFiles(zoneDirName string, section Section, zoneReport *ZoneReport, manifestZone *manifestZone) error {
+	names := []string{}
+	for name := range section.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// every part of the path comes from the API, so each of them needs to be made safe
+		parts := []string{zoneDirName, section.Name}
+		for _, part := range strings.Split(name, "/") {
+			parts = append(parts, sanitizeFileName(part))
+		}
+		filePath := path.Join(parts...)
+
+		err := b.createDir(path.Dir(filePath))
+		if err != nil {
+			return err
+		}
+
+		data := section.Files[name]
+		err = b.writeOutputFile(filePath, zoneReport, manifestZone, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		manifestZone.Files[len(manifestZone.Files)-1].Section = section.Name
+	}
+
+	return nil
+}
+
+// zonePath returns where a zone's output goes, relative to the output directory and without an extension. It's the
+// zone's file name, inside its account's directory with -group-by-account.
+func (b *backupRun) zonePath(zoneID string) string {
+	if !b.options.GroupByAccount {
+		return b.fileNames[zoneID]
+	}
+	return path.Join(b.accountDirs[zoneID], b.fileNames[zoneID])
+}
+
+// createDir creates a directory in the output directory, along with any parents that don't exist. The name is relative
+// to the output directory, and uses forward slashes.
+func (b *backupRun) createDir(name string) error {
+	dir := filepath.Join(b.options.OutputDir, filepath.FromSlash(name))
+	err := os.MkdirAll(dir, os.FileMode(b.options.DirMode))
+	if err != nil {
+		return err
+	}
+	return setFileMode(dir, os.FileMode(b.options.DirMode))
+}
+
+// writeOutputFile creates a file in the output directory, encrypting it if needed, and records it in the report and
+// manifest. The name is relative to the output directory, and uses forward slashes. The zone report may be nil, for
+// files that don't belong to a zone.
+func (b *backupRun) writeOutputFile(name string, zoneReport *ZoneReport, manifestZone *manifestZone, write func(w io.Writer) error) error {
+	outputPath, written, err := b.writeFile(name, write)
+	if err != nil {
+		return err
+	}
+
+	if written >= 0 && zoneReport != nil {
+		zoneReport.Unchanged = false
+		zoneReport.BytesWritten += written
+	}
+
+	file, err := newManifestFile(b.options.OutputDir, outputPath)
+	if err != nil {
+		return err
+	}
+	manifestZone.Files = append(manifestZone.Files, file)
+
+	return nil
+}
+
+// writeRootFile creates a file in the output directory that doesn't belong to a zone, like audit.txt, and adds it to
+// the manifest. The name is relative to the output directory, and uses forward slashes.
+func (b *backupRun) writeRootFile(name string, write func(w io.Writer) error) error {
+	outputPath, _, err := b.writeFile(name, write)
+	if err != nil {
+		return err
+	}
+	return b.addRootFile(outputPath)
+}
+
+// addRootFile adds a file in the output directory that doesn't belong to a zone to the manifest, replacing its entry if
+// it was already added.
+func (b *backupRun) addRootFile(path string) error {
+	file, err := newManifestFile(b.options.OutputDir, path)
+	if err != nil {
+		return err
+	}
+	for i := range b.manifest.Files {
+		if b.manifest.Files[i].Path == file.Path {
+			b.manifest.Files[i] = file
+			return nil
+		}
+	}
+	b.manifest.Files = append(b.manifest.Files, file)
+	return nil
+}
+
+// addHistoryFiles adds the changelog and the tombstones to the manifest, if the output directory has them. They're kept
+// from run to run, so they're part of the backup even when this run didn't use -drift.
+func (b *backupRun) addHistoryFiles() error {
+	for _, name := range []string{changelogFileName, changelogJSONFileName, tombstonesFileName} {
+		path := filepath.Join(b.options.OutputDir, name)
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			err = b.addRootFile(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile creates a file in the output directory, encrypting it if needed, and returns its path and the number of
+// bytes written. The name is relative to the output directory, and uses forward slashes.
+//
+// The file is written to a temporary file first, then renamed into place, so a failure never leaves a partial file
+// behind. With -skip-unchanged, an existing file whose contents only differ in volatile lines is left alone, and -1 is
+// returned as the number of bytes written.
+func (b *backupRun) writeFile(name string, write func(w io.Writer) error) (string, int64, error) {
+	var outputFile io.WriteCloser
+	var err error
+	outputPath := filepath.Join(b.options.OutputDir, filepath.FromSlash(name))
+	if b.options.GPGRecipient != "" {
+		outputPath += ".gpg"
+	}
+	tempPath := filepath.Join(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".tmp")
+
+	if b.options.GPGRecipient != "" {
+		outputFile, err = createEncryptedFile(tempPath, os.FileMode(b.options.FileMode), b.options.GPGRecipient)
+	} else {
+		outputFile, err = createFile(tempPath, os.FileMode(b.options.FileMode))
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	counter := countingWriter{w: outputFile}
+	err = write(&counter)
+	closeErr := outputFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", 0, err
+	}
+
+	if b.options.SkipUnchanged && b.unchangedFile(outputPath, tempPath) {
+		b.debugf("%s is unchanged", name)
+		err = os.Remove(tempPath)
+		if err != nil {
+			return "", 0, err
+		}
+		return outputPath, -1, nil
+	}
+
+	err = os.Rename(tempPath, outputPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return "", 0, err
+	}
+
+	b.report.BytesWritten += counter.count
+	return outputPath, counter.count, nil
+}
+
+// unchangedFile returns true if a file that -skip-unchanged would replace can be left alone. A zone's files are left
+// alone if its content hash hasn't changed, and any other file is compared with what's already there, ignoring the
+// volatile lines.
+func (b *backupRun) unchangedFile(outputPath string, tempPath string) bool {
+	if b.zoneHashMatches {
+		_, err := os.Stat(outputPath)
+		return err == nil
+	}
+	return sameContent(outputPath, tempPath, b.format.VolatilePrefixes)
+}
+
+// writeJSON writes data as indented JSON.
+func writeJSON(w io.Writer, data interface{}) error {
+	dataJSON, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(dataJSON, '\n'))
+	return err
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func TestBackupGolden(t *testing.T) {
+	for _, test := range []struct {
+		fixture string
+		file    string
+	}{
+		{"empty", "empty.example.txt"},
+		{"all-types", "example.com.txt"},
+		{"idn", "xn--bcher-kva.example.txt"},
+	} {
+		t.Run(test.fixture, func(t *testing.T) {
+			api := newFakeAPI(t, test.fixture)
+			dir := runTestBackup(t, api)
+			checkGoldenFile(t, dir, test.file, "backup/"+test.fixture+".txt")
+		})
+	}
+}
+
+func TestBackupPaginates(t *testing.T) {
+	api := newFakeAPI(t, "all-types")
+	runTestBackup(t, api)
+
+	// the fixture has 24 records, and the fake API returns 3 in each page
+	pages := api.requested("zones/*/dns_records")
+	if pages != 8 {
+		t.Errorf("got %d requests for DNS records, want 8", pages)
+	}
+}
+
+func TestConcurrentBackups(t *testing.T) {
+	// each backup has its own options, so two at once with different ones shouldn't see anything of the other's
+	allTypes := newFakeAPI(t, "all-types")
+	idn := newFakeAPI(t, "idn")
+	runs := []*backupRun{
+		newTestBackup(t, allTypes, "-format", "text"),
+		newTestBackup(t, idn, "-format", "json", "-resources", "dns"),
+	}
+
+	reports := make([]*RunReport, len(runs))
+	wg := sync.WaitGroup{}
+	for i, run := range runs {
+		wg.Add(1)
+		go func(i int, run *backupRun) {
+			defer wg.Done()
+			reports[i] = run.run(context.Background())
+		}(i, run)
+	}
+	wg.Wait()
+
+	for i, report := range reports {
+		if report.Failed() {
+			t.Fatalf("backup %d failed: %s", i, strings.Join(report.Errors, "; "))
+		}
+		if len(report.Zones) != 1 {
+			t.Errorf("backup %d has %d zones, want 1", i, len(report.Zones))
+		}
+	}
+
+	checkGoldenFile(t, runs[0].options.OutputDir, "example.com.txt", "backup/all-types.txt")
+	alone, err := ioutil.ReadFile(filepath.Join(runTestBackup(t, idn, "-format", "json", "-resources", "dns"), "xn--bcher-kva.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	concurrent, err := ioutil.ReadFile(filepath.Join(runs[1].options.OutputDir, "xn--bcher-kva.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(concurrent, alone) {
+		t.Error("the json backup made alongside the text one isn't the same as one made on its own")
+	}
+	for _, file := range []string{"xn--bcher-kva.example.txt", "xn--bcher-kva.example.json"} {
+		if _, err := os.Stat(filepath.Join(runs[0].options.OutputDir, file)); err == nil {
+			t.Errorf("%s was written to the other backup's directory", file)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(runs[1].options.OutputDir, "example.com.txt")); err == nil {
+		t.Error("example.com.txt was written to the other backup's directory")
+	}
+	if allTypes.requested("zones/*/pagerules") != 1 || idn.requested("zones/*/pagerules") != 0 {
+		t.Error("each backup should only have used its own -resources")
+	}
+}
+
+// liveHeap returns how much of the heap was in use after the last garbage collection, which doesn't count garbage
+// that's waiting to be collected, unlike runtime.MemStats.HeapAlloc.
+func liveHeap(b *testing.B) uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		b.Skip("this version of Go doesn't report the live heap")
+	}
+	return sample[0].Value.Uint64()
+}
+
+// BenchmarkDNSRecords100k backs up a zone with 100,000 DNS records, with the records fetched in full before they're
+// written, and with -stream-records. peak-live-MB is the most memory that was in use at once during the backup, as of
+// each garbage collection, over what was in use before it started. The garbage collector runs more often than usual,
+// so that it doesn't miss the peak, which makes both take longer.
+func BenchmarkDNSRecords100k(b *testing.B) {
+	api := newFakeAPI(b, "empty")
+	api.maxPerPage = cloudflare.MaxPerPage
+	records := []json.RawMessage{}
+	for i := 0; i < 100000; i++ {
+		records = append(records, json.RawMessage(fmt.Sprintf(
+			`{"id":"%032x","type":"A","name":"host%d.empty.example","content":"192.0.%d.%d","proxiable":true,"proxied":%t,"ttl":1,"locked":false,"created_on":"2020-01-01T00:00:00.000000Z","modified_on":"2020-01-01T00:00:00.000000Z","meta":{"auto_added":false}}`,
+			i, i, i/256%256, i%256, i%2 == 0,
+		)))
+	}
+	api.zones[0].DNSRecords = records
+
+	// the pages are put together before the benchmark starts, so that the fake API's memory isn't counted
+	pages := map[string][]byte{}
+	for page := 1; (page-1)*api.maxPerPage < len(records); page++ {
+		recorder := httptest.NewRecorder()
+		api.serveDefault(recorder, httptest.NewRequest("GET", "/client/v4/zones/"+api.zones[0].id+"/dns_records?per_page=5000&page="+strconv.Itoa(page), nil))
+		pages[strconv.Itoa(page)] = recorder.Body.Bytes()
+	}
+	api.handle("zones/*/dns_records", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(pages[r.URL.Query().Get("page")])
+	})
+
+	defer debug.SetGCPercent(debug.SetGCPercent(10))
+	for _, bench := range []struct {
+		name string
+		args []string
+	}{
+		{"buffered/text", []string{}},
+		{"streamed/text", []string{"-stream-records"}},
+		{"buffered/json", []string{"-format", "json"}},
+		{"streamed/json", []string{"-format", "json", "-stream-records"}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			peak := uint64(0)
+			for i := 0; i < b.N; i++ {
+				run := newTestBackup(b, api, append([]string{"-resources", "dns", "-self-check=false"}, bench.args...)...)
+
+				runtime.GC()
+				base := liveHeap(b)
+				done := make(chan bool)
+				sampled := make(chan uint64)
+				go func() {
+					runPeak := uint64(0)
+					ticker := time.NewTicker(time.Millisecond)
+					defer ticker.Stop()
+					for {
+						select {
+						case <-done:
+							sampled <- runPeak
+							return
+						case <-ticker.C:
+							if live := liveHeap(b); live > base && live-base > runPeak {
+								runPeak = live - base
+							}
+						}
+					}
+				}()
+
+				report := run.run(context.Background())
+				close(done)
+				if runPeak := <-sampled; runPeak > peak {
+					peak = runPeak
+				}
+				if report.Failed() || report.Zones[0].Records != len(records) {
+					b.Fatalf("backed up %d records, want %d: %s", report.Zones[0].Records, len(records), strings.Join(report.Errors, "; "))
+				}
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-live-MB")
+		})
+	}
+}
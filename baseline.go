@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// errBaselineDeviation is wrapped by the error added with -audit-strict when zone settings don't match the baseline,
+// so that the run exits with its own code.
+var errBaselineDeviation = errors.New("the zone settings don't match the audit baseline")
+
+// baselineRule is the name that findings from -audit-baseline are reported under.
+const baselineRule = "baseline"
+
+// baselineValue is what the baseline expects a setting to be. Exactly one of its fields is set: Equals for a plain
+// value, OneOf for a list of allowed values, Compare and Than for a minimum or maximum like ">= 1.2", and Fields for a
+// setting whose value is an object, with what each of the fields that matter is expected to be.
+type baselineValue struct {
+	Equals  string
+	OneOf   []string
+	Compare string
+	Than    string
+	Fields  map[string]baselineValue
+}
+
+// baselineComparisons are the operators that a baseline value can start with, longest first so that ">=" isn't read
+// as ">".
+var baselineComparisons = []string{">=", "<=", ">", "<"}
+
+// auditSettings holds the settings of a zone that are checked against the baseline.
+type auditSettings struct {
+	Name     string
+	Settings []cloudflare.ZoneSetting
+}
+
+// loadBaseline reads the baseline for -audit-baseline, a YAML file mapping setting IDs to the values that every zone
+// should have.
+func loadBaseline(path string) (map[string]baselineValue, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := parseBaseline(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the -audit-baseline file: %w.", err)
+	}
+	if len(baseline) == 0 {
+		return nil, errors.New("The -audit-baseline file doesn't have any settings in it.")
+	}
+	return baseline, nil
+}
+
+// baselineLine is a line of the baseline file with its comment and indentation removed.
+type baselineLine struct {
+	Number int
+	Indent int
+	Key    string
+	Value  string
+}
+
+// parseBaseline reads the subset of YAML that a baseline needs: mappings, nested by indentation, whose values are
+// plain or quoted strings, or lists of them in brackets. Unquoted values are kept as strings, so on and off stay as
+// they are instead of becoming booleans, which matches how the API returns them.
+func parseBaseline(data string) (map[string]baselineValue, error) {
+	lines := []baselineLine{}
+	for i, text := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		text = strings.TrimRight(stripYAMLComment(text), " ")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, newParseError(i+1, "tabs can't be used for indentation")
+		}
+		colon := strings.Index(trimmed, ":")
+		if colon <= 0 || (colon+1 < len(trimmed) && trimmed[colon+1] != ' ') {
+			return nil, newParseError(i+1, "expected a line like \"setting_id: value\"")
+		}
+		lines = append(lines, baselineLine{
+			Number: i + 1,
+			Indent: len(text) - len(trimmed),
+			Key:    unquoteYAML(strings.TrimSpace(trimmed[:colon])),
+			Value:  strings.TrimSpace(trimmed[colon+1:]),
+		})
+	}
+
+	values, next, err := parseBaselineBlock(lines, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, newParseError(lines[next].Number, "this line is indented less than the first one")
+	}
+	return values, nil
+}
+
+// parseBaselineBlock reads the lines at the given indentation, starting from the given one, as a mapping. It returns
+// the index of the first line after the mapping.
+func parseBaselineBlock(lines []baselineLine, start int, indent int) (map[string]baselineValue, int, error) {
+	values := map[string]baselineValue{}
+	i := start
+	for i < len(lines) && lines[i].Indent >= indent {
+		line := lines[i]
+		if line.Indent > indent {
+			return nil, 0, newParseError(line.Number, "this line is indented more than the one before it")
+		}
+		if _, exists := values[line.Key]; exists {
+			return nil, 0, newParseError(line.Number, "%s is listed more than once", line.Key)
+		}
+		i++
+
+		if line.Value != "" {
+			value, err := parseBaselineValue(line.Value)
+			if err != nil {
+				return nil, 0, newParseError(line.Number, "%s", err)
+			}
+			values[line.Key] = value
+			continue
+		}
+
+		if i >= len(lines) || lines[i].Indent <= indent {
+			return nil, 0, newParseError(line.Number, "%s doesn't have a value", line.Key)
+		}
+		fields, next, err := parseBaselineBlock(lines, i, lines[i].Indent)
+		if err != nil {
+			return nil, 0, err
+		}
+		values[line.Key] = baselineValue{Fields: fields}
+		i = next
+	}
+	return values, i, nil
+}
+
+func parseBaselineValue(text string) (baselineValue, error) {
+	if strings.HasPrefix(text, "[") {
+		if !strings.HasSuffix(text, "]") {
+			return baselineValue{}, errors.New("the list isn't closed with ]")
+		}
+		oneOf := []string{}
+		for _, item := range strings.Split(text[1:len(text)-1], ",") {
+			item = unquoteYAML(strings.TrimSpace(item))
+			if item != "" {
+				oneOf = append(oneOf, item)
+			}
+		}
+		if len(oneOf) == 0 {
+			return baselineValue{}, errors.New("the list is empty")
+		}
+		return baselineValue{OneOf: oneOf}, nil
+	}
+
+	text = unquoteYAML(text)
+	for _, comparison := range baselineComparisons {
+		if strings.HasPrefix(text, comparison) {
+			than := strings.TrimSpace(text[len(comparison):])
+			if _, ok := parseVersion(than); !ok {
+				return baselineValue{}, fmt.Errorf("%q can only be compared to a number, like 1.2", comparison)
+			}
+			return baselineValue{Compare: comparison, Than: than}, nil
+		}
+	}
+	return baselineValue{Equals: text}, nil
+}
+
+// stripYAMLComment removes a comment from the end of a line, as long as the # isn't in a quoted string.
+func stripYAMLComment(line string) string {
+	quote := rune(0)
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteYAML(text string) string {
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		unquoted, err := strconv.Unquote(text)
+		if err == nil {
+			return unquoted
+		}
+	}
+	if len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'")
+	}
+	return text
+}
+
+// parseVersion splits a number like 1.2 into its parts, so that 1.10 comes after 1.9.
+func parseVersion(text string) ([]int, bool) {
+	parts := []int{}
+	for _, part := range strings.Split(text, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
+
+// compareVersions returns -1, 0, or 1 as a is before, the same as, or after b.
+func compareVersions(a []int, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		x, y := 0, 0
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// String describes what the value is expected to be, for a finding.
+func (v baselineValue) String() string {
+	switch {
+	case v.OneOf != nil:
+		quoted := []string{}
+		for _, value := range v.OneOf {
+			quoted = append(quoted, strconv.Quote(value))
+		}
+		return "one of " + strings.Join(quoted, ", ")
+	case v.Compare != "":
+		return v.Compare + " " + v.Than
+	case v.Fields != nil:
+		return "an object"
+	}
+	return strconv.Quote(v.Equals)
+}
+
+// matches checks a value from the API, returning a description of each way it differs from what's expected, by the
+// path to the field that differs.
+func (v baselineValue) matches(path string, actual json.RawMessage) []auditFinding {
+	if v.Fields != nil {
+		fields := map[string]json.RawMessage{}
+		if json.Unmarshal(actual, &fields) != nil {
+			return []auditFinding{{Record: path, Message: fmt.Sprintf("%s is %s, but the baseline expects an object.", path, displayJSONValue(actual))}}
+		}
+
+		findings := []auditFinding{}
+		for _, name := range sortedBaselineKeys(v.Fields) {
+			fieldPath := path + "." + name
+			value, ok := fields[name]
+			if !ok {
+				findings = append(findings, auditFinding{Record: fieldPath, Message: fmt.Sprintf("%s isn't set, but the baseline expects %s.", fieldPath, v.Fields[name])})
+				continue
+			}
+			findings = append(findings, v.Fields[name].matches(fieldPath, value)...)
+		}
+		return findings
+	}
+
+	value := displayJSONValue(actual)
+	matched := false
+	switch {
+	case v.OneOf != nil:
+		for _, allowed := range v.OneOf {
+			matched = matched || strings.EqualFold(value, allowed)
+		}
+	case v.Compare != "":
+		actualVersion, ok := parseVersion(value)
+		if ok {
+			than, _ := parseVersion(v.Than)
+			order := compareVersions(actualVersion, than)
+			switch v.Compare {
+			case ">=":
+				matched = order >= 0
+			case "<=":
+				matched = order <= 0
+			case ">":
+				matched = order > 0
+			case "<":
+				matched = order < 0
+			}
+		}
+	default:
+		matched = strings.EqualFold(value, v.Equals)
+	}
+	if matched {
+		return nil
+	}
+	return []auditFinding{{Record: path, Message: fmt.Sprintf("%s is %q, but the baseline expects %s.", path, value, v)}}
+}
+
+// checkBaseline compares each zone's settings to the baseline. Settings that aren't in the baseline are ignored, but
+// one that's in the baseline and missing from a zone is reported, since the zone can't be meeting it.
+func checkBaseline(baseline map[string]baselineValue, zones []auditSettings) []auditFinding {
+	findings := []auditFinding{}
+	for _, zone := range zones {
+		settings := map[string]json.RawMessage{}
+		for _, setting := range zone.Settings {
+			settings[setting.ID] = baselineSettingValue(setting)
+		}
+
+		for _, id := range sortedBaselineKeys(baseline) {
+			var zoneFindings []auditFinding
+			value, ok := settings[id]
+			if ok {
+				zoneFindings = baseline[id].matches(id, value)
+			} else {
+				zoneFindings = []auditFinding{{Record: id, Message: fmt.Sprintf("The zone doesn't have the %s setting, but the baseline expects %s.", id, baseline[id])}}
+			}
+			for _, finding := range zoneFindings {
+				finding.Zone = zone.Name
+				finding.Rule = baselineRule
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+func sortedBaselineKeys(values map[string]baselineValue) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
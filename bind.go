@@ -0,0 +1,465 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// bindToken is a word from a zone file. Quoted is set for quoted strings, which are never treated as keywords.
+type bindToken struct {
+	Text   string
+	Quoted bool
+}
+
+// bindLine is a logical line of a zone file, with any parentheses joined up. Indented is set if the line started
+// with whitespace, meaning that it has the same owner name as the line before it.
+type bindLine struct {
+	Number   int
+	Indented bool
+	Tokens   []bindToken
+}
+
+// bindRecord is a record read from a zone file, along with the line that it came from.
+type bindRecord struct {
+	Line   int
+	Record cloudflare.DNSRecord
+}
+
+// bindSkipped is a record in a zone file that can't be imported.
+type bindSkipped struct {
+	Line   int
+	Reason string
+}
+
+// bindImportTypes are the record types that parseBINDZone can import.
+var bindImportTypes = []string{"A", "AAAA", "CNAME", "MX", "TXT", "SRV", "CAA", "NS"}
+
+// readBINDLines splits a zone file into logical lines, removing comments and joining lines inside parentheses.
+func readBINDLines(r io.Reader) ([]bindLine, error) {
+	lines := []bindLine{}
+	scanner := newLineScanner(r)
+
+	var current *bindLine
+	depth := 0
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := scanner.Text()
+		if strings.ContainsRune(text, 0) {
+			return nil, newParseError(lineNumber, "the line contains a NUL byte")
+		}
+
+		if depth == 0 {
+			current = &bindLine{
+				Number:   lineNumber,
+				Indented: text != "" && (text[0] == ' ' || text[0] == '\t'),
+				Tokens:   []bindToken{},
+			}
+		}
+
+		i := 0
+		for i < len(text) {
+			c := text[i]
+			switch {
+			case c == ';':
+				i = len(text)
+			case c == ' ' || c == '\t' || c == '\r':
+				i++
+			case c == '(':
+				depth++
+				i++
+			case c == ')':
+				if depth == 0 {
+					return nil, newParseError(lineNumber, "unexpected )")
+				}
+				depth--
+				i++
+			case c == '"':
+				value, end, err := readBINDQuoted(text, i)
+				if err != nil {
+					return nil, &parseError{Line: lineNumber, Err: err}
+				}
+				current.Tokens = append(current.Tokens, bindToken{Text: value, Quoted: true})
+				i = end
+			default:
+				start := i
+				for i < len(text) && !strings.ContainsRune(" \t\r;()\"", rune(text[i])) {
+					if text[i] == '\\' {
+						i++
+					}
+					i++
+				}
+				if i > len(text) {
+					i = len(text)
+				}
+				current.Tokens = append(current.Tokens, bindToken{Text: text[start:i]})
+			}
+		}
+
+		if depth == 0 && len(current.Tokens) > 0 {
+			lines = append(lines, *current)
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, scanError(err, lineNumber)
+	}
+	if depth != 0 {
+		return nil, newParseError(current.Number, "the ( is never closed")
+	}
+
+	return lines, nil
+}
+
+// readBINDQuoted reads the quoted string starting at text[start], and returns its contents with escapes resolved,
+// along with the index just past the closing quote.
+func readBINDQuoted(text string, start int) (string, int, error) {
+	value := strings.Builder{}
+	for i := start + 1; i < len(text); i++ {
+		c := text[i]
+		if c == '"' {
+			return value.String(), i + 1, nil
+		}
+		if c != '\\' || i+1 >= len(text) {
+			value.WriteByte(c)
+			continue
+		}
+
+		// either \DDD, a decimal byte value, or a character that's taken literally
+		if i+3 < len(text) && isDigits(text[i+1:i+4]) {
+			code, _ := strconv.Atoi(text[i+1 : i+4])
+			if code > 255 {
+				return "", 0, fmt.Errorf("invalid escape \\%s", text[i+1:i+4])
+			}
+			value.WriteByte(byte(code))
+			i += 3
+		} else {
+			value.WriteByte(text[i+1])
+			i++
+		}
+	}
+	return "", 0, fmt.Errorf("the quoted string is never closed")
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// parseBINDTTL parses a TTL, which is either a number of seconds or a duration like "1h30m".
+func parseBINDTTL(text string) (uint64, bool) {
+	if isDigits(text) {
+		ttl, err := strconv.ParseUint(text, 10, 32)
+		return ttl, err == nil
+	}
+
+	units := map[byte]uint64{'s': 1, 'm': 60, 'h': 60 * 60, 'd': 24 * 60 * 60, 'w': 7 * 24 * 60 * 60}
+	total := uint64(0)
+	number := ""
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c >= '0' && c <= '9' {
+			number += string(c)
+			continue
+		}
+		unit, ok := units[c|0x20]
+		if !ok || number == "" {
+			return 0, false
+		}
+		value, err := strconv.ParseUint(number, 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		total += value * unit
+		if total > math.MaxUint32 {
+			return 0, false
+		}
+		number = ""
+	}
+	return total, number == "" && total > 0
+}
+
+// parseBINDZone reads the records from a zone file. Relative names are taken to be in the given origin, until a
+// $ORIGIN line changes it. Records without a TTL use the one from the $TTL line, or the last TTL given, or automatic
+// if there isn't one. Records of types that can't be imported, like SOA, are returned separately.
+func parseBINDZone(r io.Reader, origin string) ([]bindRecord, []bindSkipped, error) {
+	lines, err := readBINDLines(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	origin = normalizeName(origin)
+	zoneName := origin
+	defaultTTL := uint64(0)
+	lastTTL := uint64(1)
+	owner := ""
+
+	records := []bindRecord{}
+	skipped := []bindSkipped{}
+	for _, line := range lines {
+		tokens := line.Tokens
+		first := tokens[0]
+
+		// directives
+		if !first.Quoted && strings.HasPrefix(first.Text, "$") {
+			switch strings.ToUpper(first.Text) {
+			case "$ORIGIN":
+				if len(tokens) != 2 {
+					return nil, nil, newParseError(line.Number, "$ORIGIN needs a single name")
+				}
+				origin = absoluteBINDName(tokens[1].Text, origin)
+			case "$TTL":
+				ttl, ok := parseBINDTTL(tokens[len(tokens)-1].Text)
+				if len(tokens) != 2 || !ok {
+					return nil, nil, newParseError(line.Number, "$TTL needs a single TTL")
+				}
+				defaultTTL = ttl
+			default:
+				return nil, nil, newParseError(line.Number, "%s isn't supported", first.Text)
+			}
+			continue
+		}
+
+		if !line.Indented {
+			owner = absoluteBINDName(first.Text, origin)
+			tokens = tokens[1:]
+		}
+		if owner == "" {
+			return nil, nil, newParseError(line.Number, "the record doesn't have a name")
+		}
+
+		// the TTL and class can come in either order, and both are optional
+		ttl := uint64(0)
+		for len(tokens) > 0 && !tokens[0].Quoted {
+			value, isTTL := parseBINDTTL(tokens[0].Text)
+			if isTTL && ttl == 0 {
+				ttl = value
+			} else if !strings.EqualFold(tokens[0].Text, "IN") {
+				break
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) == 0 {
+			return nil, nil, newParseError(line.Number, "the record doesn't have a type")
+		}
+		if ttl == 0 {
+			ttl = defaultTTL
+			if ttl == 0 {
+				ttl = lastTTL
+			}
+		} else {
+			lastTTL = ttl
+		}
+
+		recordType := strings.ToUpper(tokens[0].Text)
+		fields := tokens[1:]
+
+		if owner != zoneName && !strings.HasSuffix(owner, "."+zoneName) {
+			return nil, nil, newParseError(line.Number, "%s isn't in the %s zone", owner, zoneName)
+		}
+		if recordType == "SOA" {
+			skipped = append(skipped, bindSkipped{line.Number, "SOA records are managed by Cloudflare"})
+			continue
+		}
+		if recordType == "NS" && owner == zoneName {
+			skipped = append(skipped, bindSkipped{line.Number, "the zone's own NS records are managed by Cloudflare"})
+			continue
+		}
+
+		record := cloudflare.DNSRecord{
+			Type: recordType,
+			Name: owner,
+			TTL:  ttl,
+		}
+		err = fillBINDRecord(&record, fields, origin)
+		if err == errBINDUnsupported {
+			skipped = append(skipped, bindSkipped{line.Number, recordType + " records can't be imported"})
+			continue
+		}
+		if err != nil {
+			return nil, nil, newParseError(line.Number, "%s record: %w", recordType, err)
+		}
+
+		records = append(records, bindRecord{Line: line.Number, Record: record})
+	}
+
+	return records, skipped, nil
+}
+
+// absoluteBINDName turns a name from a zone file into a full name, without the trailing dot.
+func absoluteBINDName(name string, origin string) string {
+	if name == "@" {
+		return origin
+	}
+	if strings.HasSuffix(name, ".") {
+		return normalizeName(name)
+	}
+	if origin == "" {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name) + "." + origin
+}
+
+// errBINDUnsupported is returned by fillBINDRecord for record types that can't be imported.
+var errBINDUnsupported = errors.New("unsupported record type")
+
+// fillBINDRecord sets the content of a record from the fields after its type, in the form the API expects.
+func fillBINDRecord(record *cloudflare.DNSRecord, fields []bindToken, origin string) error {
+	expect := func(count int) error {
+		if len(fields) != count {
+			return fmt.Errorf("expected %d field(s), found %d", count, len(fields))
+		}
+		return nil
+	}
+	uint16Field := func(i int, name string) (uint16, error) {
+		value, err := strconv.ParseUint(fields[i].Text, 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", name, fields[i].Text)
+		}
+		return uint16(value), nil
+	}
+
+	switch record.Type {
+	case "A", "AAAA":
+		err := expect(1)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(fields[0].Text)
+		if ip == nil || (ip.To4() != nil) != (record.Type == "A") {
+			return fmt.Errorf("invalid address %q", fields[0].Text)
+		}
+		record.Content = ip.String()
+
+	case "CNAME", "NS":
+		err := expect(1)
+		if err != nil {
+			return err
+		}
+		record.Content = absoluteBINDName(fields[0].Text, origin)
+
+	case "MX":
+		err := expect(2)
+		if err != nil {
+			return err
+		}
+		priority, err := uint16Field(0, "preference")
+		if err != nil {
+			return err
+		}
+		record.Priority = &priority
+		record.Content = absoluteBINDName(fields[1].Text, origin)
+
+	case "TXT":
+		if len(fields) == 0 {
+			return fmt.Errorf("expected at least one string")
+		}
+		if len(fields) == 1 {
+			record.Content = fields[0].Text
+			break
+		}
+		// keep long values split up the same way
+		parts := []string{}
+		for _, field := range fields {
+			parts = append(parts, strconv.Quote(field.Text))
+		}
+		record.Content = strings.Join(parts, " ")
+
+	case "SRV":
+		err := expect(4)
+		if err != nil {
+			return err
+		}
+		data := srvFields{Target: absoluteBINDName(fields[3].Text, origin)}
+		for i, value := range []*uint16{&data.Priority, &data.Weight, &data.Port} {
+			*value, err = uint16Field(i, []string{"priority", "weight", "port"}[i])
+			if err != nil {
+				return err
+			}
+		}
+		record.Data, _ = json.Marshal(data)
+
+	case "CAA":
+		err := expect(3)
+		if err != nil {
+			return err
+		}
+		flags, err := strconv.ParseUint(fields[0].Text, 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid flags %q", fields[0].Text)
+		}
+		record.Data, _ = json.Marshal(caaFields{uint8(flags), strings.ToLower(fields[1].Text), fields[2].Text})
+
+	default:
+		return errBINDUnsupported
+	}
+
+	return nil
+}
+
+// bindRecordLine formats a record as a line of a zone file, the way that parseBINDZone reads it back. It returns false
+// for records that it can't write, which are the ones of types that can't be imported.
+func bindRecordLine(record cloudflare.DNSRecord) (string, bool) {
+	value := ""
+	switch record.Type {
+	case "A", "AAAA":
+		value = record.Content
+
+	case "CNAME", "NS":
+		value = dnscontrolTarget(record.Content)
+
+	case "MX":
+		if record.Priority == nil {
+			return "", false
+		}
+		value = strconv.Itoa(int(*record.Priority)) + " " + dnscontrolTarget(record.Content)
+
+	case "TXT":
+		parts, quoted := splitTXTContent(record.Content)
+		if !quoted {
+			parts = []string{record.Content}
+		}
+		for i, part := range parts {
+			parts[i] = bindQuote(part)
+		}
+		value = strings.Join(parts, " ")
+
+	case "SRV":
+		srv, ok := recordSRVFields(record)
+		if !ok {
+			return "", false
+		}
+		value = strconv.Itoa(int(srv.Priority)) + " " + strconv.Itoa(int(srv.Weight)) + " " + strconv.Itoa(int(srv.Port)) + " " + dnscontrolTarget(srv.Target)
+
+	case "CAA":
+		caa, ok := recordCAAFields(record)
+		if !ok {
+			return "", false
+		}
+		value = strconv.Itoa(int(caa.Flags)) + " " + caa.Tag + " " + bindQuote(caa.Value)
+
+	default:
+		return "", false
+	}
+
+	return dnscontrolTarget(record.Name) + " " + strconv.FormatUint(record.TTL, 10) + " IN " + record.Type + " " + value, true
+}
+
+// bindQuote quotes a string for a zone file, escaping the characters that readBINDQuoted treats specially, and line
+// breaks, which would end the line.
+func bindQuote(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\010", "\r", "\\013").Replace(s) + "\""
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseBINDZone(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "zones", "all-types.zone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records, skipped, err := parseBINDZone(file, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, record := range records {
+		line := strconv.Itoa(record.Line) + " " + record.Record.Name + " " + strconv.FormatUint(record.Record.TTL, 10) + " " + record.Record.Type
+		if record.Record.Priority != nil {
+			line += " " + strconv.Itoa(int(*record.Record.Priority))
+		}
+		if len(record.Record.Data) > 0 {
+			line += " " + string(record.Record.Data)
+		} else {
+			line += " " + strconv.Quote(record.Record.Content)
+		}
+		got = append(got, line)
+	}
+	want := []string{
+		`23 sub.example.com 86400 NS "ns1.other.example"`,
+		`26 example.com 1 A "192.0.2.1"`,
+		`27 locked.example.com 120 A "198.51.100.7"`,
+		`30 example.com 1 AAAA "2001:db8::1"`,
+		`33 www.example.com 1 CNAME "example.com"`,
+		`36 example.com 3600 MX 10 "mx1.example.com"`,
+		`37 example.com 3600 MX 20 "mx2.example.com"`,
+		`40 example.com 300 TXT "v=spf1 include:_spf.example.com ~all"`,
+		`41 _dmarc.example.com 3600 TXT "v=DMARC1; p=none; rua=mailto:dmarc@example.com"`,
+		`42 quoted.example.com 1 TXT "\"one\" \"two\""`,
+		`43 escaped.example.com 3600 TXT "say \"hi\"; with a \\ and \xe9"`,
+		`46 _sip._tcp.example.com 3600 SRV {"priority":10,"weight":5,"port":5060,"target":"sip.example.com"}`,
+		`49 example.com 3600 CAA {"flags":0,"tag":"issue","value":"letsencrypt.org"}`,
+		`55 host.sub.example.com 3600 A "203.0.113.9"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got records:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	reasons := []string{}
+	for _, skip := range skipped {
+		reasons = append(reasons, strconv.Itoa(skip.Line)+": "+skip.Reason)
+	}
+	wantSkipped := "13: SOA records are managed by Cloudflare, 21: the zone's own NS records are managed by Cloudflare, " +
+		"22: the zone's own NS records are managed by Cloudflare, 52: PTR records can't be imported"
+	if strings.Join(reasons, ", ") != wantSkipped {
+		t.Errorf("got skipped lines %s, want %s", strings.Join(reasons, ", "), wantSkipped)
+	}
+}
+
+func TestParseBINDZoneErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"NUL", "@ IN A 192.0.2.1\nwww IN TXT \"a\x00b\"\n", "line 2: the line contains a NUL byte"},
+		{"unclosed parenthesis", "@ IN SOA ns1 dns (\n1 2 3\n", "line 1: the ( is never closed"},
+		{"unexpected parenthesis", "@ IN A 192.0.2.1 )\n", "line 1: unexpected )"},
+		{"unclosed quote", "@ IN TXT \"never closed\n", "line 1: the quoted string is never closed"},
+		{"escape", "@ IN TXT \"\\999\"\n", `line 1: invalid escape \999`},
+		{"no type", "@ 300 IN\n", "line 1: the record doesn't have a type"},
+		{"no owner", "\tIN A 192.0.2.1\n", "line 1: the record doesn't have a name"},
+		{"outside the zone", "www.other.example. IN A 192.0.2.1\n", "line 1: www.other.example isn't in the example.com zone"},
+		{"directive", "$INCLUDE other.zone\n", "line 1: $INCLUDE isn't supported"},
+		{"TTL directive", "$TTL forever\n", "line 1: $TTL needs a single TTL"},
+		{"fields", "\n\n@ IN MX mx1.example.com.\n", "line 3: MX record: expected 2 field(s), found 1"},
+		{"long line", "@ IN TXT \"" + strings.Repeat("a", maxParseLineLength) + "\"\n", "line 1: the line is longer than"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := parseBINDZone(strings.NewReader(test.input), "example.com")
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Fatalf("got error %v, want %s", err, test.want)
+			}
+			checkParseError(t, test.input, err)
+		})
+	}
+}
+
+func FuzzParseBINDZone(f *testing.F) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "zones", "all-types.zone"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(string(data))
+	// what isn't a zone file has to be turned down as cleanly as what is one
+	addGoldenSeeds(f, "*/*.txt")
+	f.Add("@ IN SOA ns1 dns (\n1 2 3\n")
+	f.Add("$ORIGIN .\n@ IN A 192.0.2.1\n")
+	f.Add("\t( \"\\1\" ) ;\n")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		records, skipped, err := parseBINDZone(strings.NewReader(input), "example.com")
+		if err != nil {
+			checkParseError(t, input, err)
+			return
+		}
+
+		lines := strings.Count(input, "\n") + 1
+		for _, record := range records {
+			if record.Line < 1 || record.Line > lines {
+				t.Fatalf("got a record from line %d of %d", record.Line, lines)
+			}
+			name := record.Record.Name
+			if name != "example.com" && !strings.HasSuffix(name, ".example.com") {
+				t.Fatalf("got the record %+v, which isn't in the zone", record.Record)
+			}
+		}
+		for _, skip := range skipped {
+			if skip.Line < 1 || skip.Line > lines {
+				t.Fatalf("skipped line %d of %d", skip.Line, lines)
+			}
+		}
+	})
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// cacheDirName is the name of the default cache directory, inside the output directory.
+const cacheDirName = ".cache"
+
+// cacheEntry is a response saved by cachingTransport.
+type cacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type"`
+
+	// ZoneVersion is the modified_on time of the zone that the response belongs to, for responses without an ETag or
+	// Last-Modified header.
+	ZoneVersion string `json:"zone_version,omitempty"`
+
+	SHA256 string `json:"sha256"`
+	Body   []byte `json:"body"`
+}
+
+// zonePathPattern matches the zone ID in an API URL.
+var zonePathPattern = regexp.MustCompile(`/zones/([0-9a-zA-Z]+)/`)
+
+// uncachedContextKey marks the requests whose responses the cache mustn't save.
+type uncachedContextKey struct{}
+
+// withoutCache returns a context for requests whose responses hold secrets. The cache has the responses as they were
+// received, before the secrets were redacted, so they're never saved or reused, and anything saved for them by an
+// earlier version is removed.
+func withoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncachedContextKey{}, true)
+}
+
+// collectorContext returns the context for a collector's requests, which aren't cached if the collector's resources
+// have secrets that are redacted from the backup.
+func (b *backupRun) collectorContext(ctx context.Context, collector interface{}) context.Context {
+	_, hasSecrets := collector.(secretCollector)
+	if hasSecrets && !b.options.IncludeSecrets {
+		return withoutCache(ctx)
+	}
+	return ctx
+}
+
+// cachingTransport saves API responses on disk and reuses them on the next run when they haven't changed. If the API
+// gave an ETag or Last-Modified header, the request is made conditional and a 304 reuses the saved body. Otherwise,
+// the saved body is reused without making a request as long as the zone's modified_on time is the same as when it was
+// saved.
+type cachingTransport struct {
+	next     http.RoundTripper
+	dir      string
+	fileMode os.FileMode
+
+	// onHit is called when a response is served from the cache.
+	onHit func(url string)
+
+	mutex        sync.Mutex
+	zoneVersions map[string]string
+}
+
+func newCachingTransport(next http.RoundTripper, dir string, dirMode os.FileMode, fileMode os.FileMode) (*cachingTransport, error) {
+	err := os.MkdirAll(dir, dirMode)
+	if err != nil {
+		return nil, err
+	}
+	err = setFileMode(dir, dirMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cachingTransport{
+		next:         next,
+		dir:          dir,
+		fileMode:     fileMode,
+		zoneVersions: map[string]string{},
+	}, nil
+}
+
+// setZoneVersion records a zone's modified_on time, from the zone listing.
+func (t *cachingTransport) setZoneVersion(zoneID string, modifiedOn string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.zoneVersions[zoneID] = modifiedOn
+}
+
+func (t *cachingTransport) zoneVersion(url string) string {
+	match := zonePathPattern.FindStringSubmatch(url)
+	if match == nil {
+		return ""
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.zoneVersions[match[1]]
+}
+
+// entryPath returns where the response to the request is saved. The token (or API key) is part of the key, so that
+// credentials with different permissions don't share responses.
+func (t *cachingTransport) entryPath(request *http.Request) string {
+	credentials := request.Header.Get("Authorization")
+	if apiKey := request.Header.Get("X-Auth-Key"); apiKey != "" {
+		credentials = apiKey
+	}
+	key := sha256.Sum256([]byte(credentials + "\x00" + request.URL.String()))
+	return filepath.Join(t.dir, hex.EncodeToString(key[:])+".json")
+}
+
+func (t *cachingTransport) load(path string) (cacheEntry, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+
+	entry := cacheEntry{}
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+
+	sum := sha256.Sum256(entry.Body)
+	if hex.EncodeToString(sum[:]) != entry.SHA256 {
+		// the entry is damaged, so make a fresh request instead
+		return cacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+func (t *cachingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Method != "GET" {
+		return t.next.RoundTrip(request)
+	}
+
+	path := t.entryPath(request)
+	if request.Context().Value(uncachedContextKey{}) != nil {
+		os.Remove(path)
+		return t.next.RoundTrip(request)
+	}
+	url := request.URL.String()
+	zoneVersion := t.zoneVersion(url)
+	entry, found := t.load(path)
+
+	if found {
+		if entry.ETag == "" && entry.LastModified == "" {
+			if zoneVersion != "" && entry.ZoneVersion == zoneVersion {
+				t.hit(url)
+				return cachedResponse(request, entry), nil
+			}
+		} else {
+			// RoundTrip must not modify the request it was given
+			request = request.Clone(request.Context())
+			if entry.ETag != "" {
+				request.Header.Set("If-None-Match", entry.ETag)
+			}
+			if entry.LastModified != "" {
+				request.Header.Set("If-Modified-Since", entry.LastModified)
+			}
+		}
+	}
+
+	response, err := t.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if found && response.StatusCode == http.StatusNotModified {
+		response.Body.Close()
+		t.hit(url)
+		return cachedResponse(request, entry), nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return response, nil
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		// the response isn't cached, but what was received is passed on, so that the error says how much of it came
+		response.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), failedReader{err}))
+		return response, nil
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry = cacheEntry{
+		URL:          url,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+		ContentType:  response.Header.Get("Content-Type"),
+		Body:         body,
+	}
+	if entry.ETag == "" && entry.LastModified == "" {
+		if zoneVersion == "" {
+			// there's nothing to tell us when this response goes stale
+			return response, nil
+		}
+		entry.ZoneVersion = zoneVersion
+	}
+	sum := sha256.Sum256(body)
+	entry.SHA256 = hex.EncodeToString(sum[:])
+
+	t.save(path, entry)
+
+	return response, nil
+}
+
+// save writes an entry to the cache. Failing to save an entry only means that the request is made again next time,
+// so errors are ignored.
+func (t *cachingTransport) save(path string, entry cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	writeFileAtomic(path, data, t.fileMode)
+}
+
+func (t *cachingTransport) hit(url string) {
+	if t.onHit != nil {
+		t.onHit(url)
+	}
+}
+
+// cachedResponse builds a response to the request from a cache entry.
+func cachedResponse(request *http.Request, entry cacheEntry) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{entry.ContentType}},
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       request,
+	}
+}
+
+// failedReader is the rest of a response body that failed partway through.
+type failedReader struct {
+	err error
+}
+
+func (r failedReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
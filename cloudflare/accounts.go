@@ -0,0 +1,31 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// ListAccounts returns every account that the client's token can access.
+func (c *Client) ListAccounts(ctx context.Context) ([]Account, error) {
+	accounts := []Account{}
+	err := c.paginate(ctx, url.Values{
+		"per_page": []string{c.perPage(50)},
+	}, func(params url.Values) (ResultInfo, error) {
+		result := accountsResult{}
+		err := c.Get(ctx, "accounts", params, &result)
+		accounts = append(accounts, result.Accounts...)
+		return result.ResultInfo, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// GetAccountDetails returns the full details of an account, including its settings, as they were returned by the
+// API.
+func (c *Client) GetAccountDetails(ctx context.Context, accountID string) (json.RawMessage, error) {
+	return c.GetResult(ctx, "accounts/"+accountID, url.Values{})
+}
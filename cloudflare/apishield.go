@@ -0,0 +1,87 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// APISchema is an OpenAPI schema uploaded to API Shield for schema validation. Source is only set by GetAPISchema.
+type APISchema struct {
+	ID                string `json:"schema_id"`
+	Name              string `json:"name"`
+	Kind              string `json:"kind"`
+	Source            string `json:"source,omitempty"`
+	ValidationEnabled bool   `json:"validation_enabled"`
+	CreatedAt         string `json:"created_at,omitempty"`
+}
+
+type apiSchemasResult struct {
+	Response
+	Schemas []APISchema `json:"result"`
+}
+
+type apiSchemaResult struct {
+	Response
+	Schema APISchema `json:"result"`
+}
+
+type rawListResult struct {
+	Response
+	Results []json.RawMessage `json:"result"`
+}
+
+// ListAPISchemas returns the schemas uploaded to API Shield for the given zone, without their sources.
+func (c *Client) ListAPISchemas(ctx context.Context, zoneID string) ([]APISchema, error) {
+	schemas := []APISchema{}
+	err := c.paginate(ctx, url.Values{
+		"per_page":    []string{c.perPage(50)},
+		"omit_source": []string{"true"},
+	}, func(params url.Values) (ResultInfo, error) {
+		result := apiSchemasResult{}
+		err := c.Get(ctx, "zones/"+zoneID+"/api_gateway/user_schemas", params, &result)
+		schemas = append(schemas, result.Schemas...)
+		return result.ResultInfo, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schemas, nil
+}
+
+// GetAPISchema returns a single API Shield schema, including its source.
+func (c *Client) GetAPISchema(ctx context.Context, zoneID string, schemaID string) (APISchema, error) {
+	result := apiSchemaResult{}
+	err := c.Get(ctx, "zones/"+zoneID+"/api_gateway/user_schemas/"+schemaID, url.Values{}, &result)
+	if err != nil {
+		return APISchema{}, err
+	}
+
+	return result.Schema, nil
+}
+
+// ListAPIOperations returns the operations (endpoints) that API Shield knows about for the given zone, as they were
+// returned by the API.
+func (c *Client) ListAPIOperations(ctx context.Context, zoneID string) ([]json.RawMessage, error) {
+	operations := []json.RawMessage{}
+	err := c.paginate(ctx, url.Values{
+		"per_page": []string{c.perPage(100)},
+	}, func(params url.Values) (ResultInfo, error) {
+		result := rawListResult{}
+		err := c.Get(ctx, "zones/"+zoneID+"/api_gateway/operations", params, &result)
+		operations = append(operations, result.Results...)
+		return result.ResultInfo, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return operations, nil
+}
+
+// GetSchemaValidationSettings returns the zone's API Shield schema validation settings, as they were returned by the
+// API.
+func (c *Client) GetSchemaValidationSettings(ctx context.Context, zoneID string) (json.RawMessage, error) {
+	return c.GetResult(ctx, "zones/"+zoneID+"/api_gateway/settings/schema_validation", url.Values{})
+}
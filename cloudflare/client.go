@@ -0,0 +1,374 @@
+// Package cloudflare is a small client for the parts of the Cloudflare API that cloudflare-backup uses.
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the base URL of Cloudflare's v4 API.
+const DefaultBaseURL = "https://api.cloudflare.com/client/v4/"
+
+// RetryPolicy controls how failed requests are retried. Requests are retried if they fail at the network level, or
+// if the server responds with a 429 or 5xx status.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a request is attempted, including the first one.
+	MaxAttempts int
+
+	// Backoff is how long to wait before the first retry. The delay grows linearly with each attempt.
+	Backoff time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by clients created with NewClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     time.Second,
+}
+
+// Client makes requests to the Cloudflare API.
+type Client struct {
+	Token       string
+	BaseURL     string
+	HTTPClient  *http.Client
+	RetryPolicy RetryPolicy
+
+	// APIKey and Email, if set, authenticate with a global API key and the email of the user that it belongs to,
+	// instead of Token.
+	APIKey string
+	Email  string
+
+	// UserAgent is sent with every request, if set.
+	UserAgent string
+
+	// RateLimiter, if set, limits how often requests are made.
+	RateLimiter *RateLimiter
+
+	// PerPage, if set, is the page size asked for from list endpoints. It's capped at each endpoint's maximum, and by
+	// default, the maximum is used.
+	PerPage int
+
+	// OnRequest, if set, is called after every HTTP request with the requested path and the response's status code,
+	// or 0 if no response was received.
+	OnRequest func(path string, statusCode int)
+
+	// OnRetry, if set, is called before a failed request is retried.
+	OnRetry func(path string, err error)
+
+	// OnBackoff, if set, is called with how long the client is about to wait before retrying a request.
+	OnBackoff func(path string, delay time.Duration)
+
+	// OnPause, if set, is called when a 429 response says how long to wait, and every request made with the client is
+	// held back until then. It's only called once for each pause, however many requests are held back by it, and
+	// again if another 429 makes it longer.
+	OnPause func(path string, wait time.Duration)
+
+	// OnRateLimitWait, if set, is called with how long a request was held back for before it was sent, by the rate
+	// limiter or by a pause after a 429. It's only called if the request had to wait.
+	OnRateLimitWait func(path string, wait time.Duration)
+
+	// OnUnknownFields, if set, is called with the fields of a response that the types in this package don't have,
+	// like "result[].comment", so that new fields in the API can be noticed. Checking for them takes about as long as
+	// decoding the response again, so it's only done when this is set.
+	OnUnknownFields func(path string, fields []string)
+
+	gate pauseGate
+}
+
+// NewClient creates a client that authenticates with the given API token.
+func NewClient(token string) *Client {
+	return &Client{
+		Token:       token,
+		BaseURL:     DefaultBaseURL,
+		HTTPClient:  http.DefaultClient,
+		RetryPolicy: DefaultRetryPolicy,
+	}
+}
+
+// NewClientWithKey creates a client that authenticates with a global API key, and the email of the user that it
+// belongs to.
+func NewClientWithKey(key string, email string) *Client {
+	client := NewClient("")
+	client.APIKey = key
+	client.Email = email
+	return client
+}
+
+// the maximum amount of an error response's body that's read, since it's only used for error messages
+const errorBodyLimit = 64 * 1024
+
+// apiResponse is implemented by the result types that embed Response.
+type apiResponse interface {
+	apiResponse() *Response
+}
+
+func (r *Response) apiResponse() *Response {
+	return r
+}
+
+// Get requests the given path, relative to the base URL, and decodes the JSON response into output.
+func (c *Client) Get(ctx context.Context, path string, params url.Values, output interface{}) error {
+	return c.withRetries(ctx, path, func() (bool, error) {
+		return c.tryGet(ctx, path, params, output)
+	})
+}
+
+// GetResult requests the given path, and returns the result field of the response without decoding it. It's useful for
+// resources that the client doesn't have a type for.
+func (c *Client) GetResult(ctx context.Context, path string, params url.Values) (json.RawMessage, error) {
+	result := rawResult{}
+	err := c.Get(ctx, path, params, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Result, nil
+}
+
+// GetRaw requests the given path, and returns the response body and its content type, for endpoints that don't
+// return JSON.
+func (c *Client) GetRaw(ctx context.Context, path string, params url.Values) ([]byte, string, error) {
+	var body []byte
+	var contentType string
+	err := c.withRetries(ctx, path, func() (bool, error) {
+		response, err := c.do(ctx, path, params)
+		if err != nil {
+			return false, err
+		}
+		recorder := newBodyRecorder(response.Body)
+		defer recorder.Close()
+
+		body, err = ioutil.ReadAll(recorder)
+		if err != nil {
+			return true, recorder.decodeError(path, response, err)
+		}
+		contentType = response.Header.Get("Content-Type")
+		return false, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, contentType, nil
+}
+
+// withRetries calls try until it succeeds, it returns an error that isn't worth retrying, or the retry policy's
+// attempts run out. Failed requests are already retried by the transport, so this is only for responses that turn out
+// to be broken while they're being read, like one that's cut off partway through.
+func (c *Client) withRetries(ctx context.Context, path string, try func() (bool, error)) error {
+	maxAttempts := c.RetryPolicy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retryable bool
+		retryable, err = try()
+		if err == nil || !retryable || attempt >= maxAttempts {
+			break
+		}
+		if ctx.Err() != nil {
+			// the response was cut off because the request was cancelled, so trying again won't help
+			return err
+		}
+
+		if c.OnRetry != nil {
+			c.OnRetry(path, err)
+		}
+
+		delay := time.Duration(attempt) * c.RetryPolicy.Backoff
+		if c.OnBackoff != nil {
+			c.OnBackoff(path, delay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// do makes a GET request to the API, retrying it if needed. Responses with an error status are turned into a
+// APIError. Otherwise, the caller must close the response body.
+func (c *Client) do(ctx context.Context, path string, params url.Values) (*http.Response, error) {
+	return c.send(ctx, "GET", path, params, nil, "application/json")
+}
+
+// send is like do, but for any method, with an optional request body.
+func (c *Client) send(ctx context.Context, method string, path string, params url.Values, body []byte, contentType string) (*http.Response, error) {
+	requestURL := strings.TrimSuffix(c.BaseURL, "/") + "/" + path + "?" + params.Encode()
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(withRequestPath(ctx, path), method, requestURL, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	response, err := c.transport().RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		return response, nil
+	}
+	return nil, readAPIError(path, response)
+}
+
+// tryGet makes a request to the API and decodes its response. If it fails, it also returns whether the request is
+// worth retrying.
+func (c *Client) tryGet(ctx context.Context, path string, params url.Values, output interface{}) (bool, error) {
+	response, err := c.do(ctx, path, params)
+	if err != nil {
+		return false, err
+	}
+	if c.OnUnknownFields == nil {
+		return decodeResponse(path, response, output)
+	}
+
+	recorder := newBodyRecorder(response.Body)
+	data, err := ioutil.ReadAll(recorder)
+	recorder.Close()
+	if err != nil {
+		return true, recorder.decodeError(path, response, err)
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	retryable, err := decodeResponse(path, response, output)
+	if err != nil {
+		return retryable, err
+	}
+
+	fields, err := unknownFields(data, output)
+	if err == nil && len(fields) > 0 {
+		c.OnUnknownFields(path, fields)
+	}
+	return false, nil
+}
+
+// Post sends the body to the given path, and decodes the JSON response into output. Since the request might have been
+// carried out even if it failed, it's only retried when the API turned it away because of the rate limit.
+func (c *Client) Post(ctx context.Context, path string, body []byte, contentType string, output interface{}) error {
+	response, err := c.send(ctx, "POST", path, url.Values{}, body, contentType)
+	if err != nil {
+		return err
+	}
+
+	_, err = decodeResponse(path, response, output)
+	return err
+}
+
+// decodeResponse decodes a response from the API into output, and closes it. If it fails, it also returns whether the
+// request is worth retrying.
+func decodeResponse(path string, response *http.Response, output interface{}) (bool, error) {
+	recorder := newBodyRecorder(response.Body)
+	defer recorder.Close()
+
+	err := json.NewDecoder(recorder).Decode(output)
+	if err != nil {
+		return true, recorder.decodeError(path, response, err)
+	}
+
+	result, ok := output.(apiResponse)
+	if ok && !result.apiResponse().Success {
+		apiError := newAPIError(path, response)
+		apiError.Errors = result.apiResponse().Errors
+		return false, apiError
+	}
+
+	return false, nil
+}
+
+// describeConnectionError adds whether a proxy was used to an error from a request that didn't get a response, since
+// that's usually the first question when debugging these.
+func (c *Client) describeConnectionError(request *http.Request, err error) error {
+	transport := c.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	httpTransport, ok := transport.(*http.Transport)
+	if !ok || httpTransport.Proxy == nil {
+		return err
+	}
+
+	proxyURL, proxyErr := httpTransport.Proxy(request)
+	if proxyErr != nil || proxyURL == nil {
+		return fmt.Errorf("%w (not using a proxy)", err)
+	}
+
+	// only the host is included, since the proxy URL might have credentials in it
+	return fmt.Errorf("%w (using proxy %s)", err, proxyURL.Host)
+}
+
+// MaxPerPage is the largest page size that any list endpoint allows.
+const MaxPerPage = 5000
+
+// perPage returns the page size to ask for from an endpoint that allows up to max items per page.
+func (c *Client) perPage(max int) string {
+	if c.PerPage > 0 && c.PerPage < max {
+		return strconv.Itoa(c.PerPage)
+	}
+	return strconv.Itoa(max)
+}
+
+// paginate calls fetch for each page of a list endpoint, until the last page is reached. The API can use a smaller
+// page size than the one asked for, so the number of pages comes from the result info of each response, rather than
+// being worked out from the page size. It stops before the next page if the context is done.
+func (c *Client) paginate(ctx context.Context, params url.Values, fetch func(params url.Values) (ResultInfo, error)) error {
+	for page := 1; ; page++ {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		params.Set("page", strconv.Itoa(page))
+
+		resultInfo, err := fetch(params)
+		if err != nil {
+			return err
+		}
+
+		if page >= resultInfo.TotalPages {
+			return nil
+		}
+	}
+}
+
+// listRaw fetches every page of a list endpoint, returning the items as they were returned by the API. If limit is
+// more than 0, it stops once it has that many items.
+func (c *Client) listRaw(ctx context.Context, path string, params url.Values, limit int) ([]json.RawMessage, error) {
+	items := []json.RawMessage{}
+	err := c.paginate(ctx, params, func(params url.Values) (ResultInfo, error) {
+		result := rawListResult{}
+		err := c.Get(ctx, path, params, &result)
+		items = append(items, result.Results...)
+		if limit > 0 && len(items) >= limit {
+			// pretend this was the last page
+			return ResultInfo{}, err
+		}
+		return result.ResultInfo, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
@@ -0,0 +1,360 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for an httptest server that answers every request with handler, which is stopped
+// when the test finishes. It retries failed requests without waiting.
+func newTestClient(t testing.TB, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := NewClient("test-token")
+	client.BaseURL = server.URL + "/client/v4/"
+	client.RetryPolicy.Backoff = time.Millisecond
+	return client
+}
+
+// writeTestResponse writes a response with the given status and JSON body.
+func writeTestResponse(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+// writeTestPage writes the page of items that the request asks for, with at most perPage items in each page.
+func writeTestPage(w http.ResponseWriter, r *http.Request, items []string, perPage int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+	totalPages := (len(items) + perPage - 1) / perPage
+
+	writeTestResponse(w, http.StatusOK, fmt.Sprintf(
+		`{"success":true,"errors":[],"messages":[],"result":[%s],"result_info":{"page":%d,"per_page":%d,"count":%d,"total_count":%d,"total_pages":%d}}`,
+		strings.Join(items[start:end], ","), page, perPage, end-start, len(items), totalPages,
+	))
+}
+
+// requestLog records the requests that a test server gets.
+type requestLog struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (l *requestLog) add(r *http.Request) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests = append(l.requests, r)
+	return len(l.requests)
+}
+
+func (l *requestLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.requests)
+}
+
+func TestListZonesPaginates(t *testing.T) {
+	zones := []string{}
+	for i := 1; i <= 5; i++ {
+		zones = append(zones, fmt.Sprintf(`{"id":"zone%d","name":"example%d.com","paused":%t}`, i, i, i == 3))
+	}
+	log := &requestLog{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		log.add(r)
+		if r.URL.Path != "/client/v4/zones" {
+			t.Errorf("unexpected request for %s", r.URL.Path)
+		}
+		writeTestPage(w, r, zones, 2)
+	})
+
+	result, err := client.ListZones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 5 {
+		t.Fatalf("got %d zones, want 5", len(result))
+	}
+	for i, zone := range result {
+		if zone.ID != fmt.Sprintf("zone%d", i+1) || zone.Name != fmt.Sprintf("example%d.com", i+1) {
+			t.Errorf("zone %d is %s (%s)", i, zone.ID, zone.Name)
+		}
+	}
+	if !result[2].Paused {
+		t.Error("zone3 should be paused")
+	}
+
+	// the server only returns 2 zones in each page, whatever the page size asked for
+	if log.count() != 3 {
+		t.Errorf("made %d requests, want 3", log.count())
+	}
+	for i, request := range log.requests {
+		if got := request.URL.Query().Get("page"); got != strconv.Itoa(i+1) {
+			t.Errorf("request %d asked for page %s", i, got)
+		}
+		if got := request.URL.Query().Get("per_page"); got != "50" {
+			t.Errorf("request %d asked for %s zones per page, want 50", i, got)
+		}
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		client  func() *Client
+		headers map[string]string
+	}{
+		{"token", func() *Client { return NewClient("test-token") }, map[string]string{
+			"Authorization": "Bearer test-token",
+			"X-Auth-Key":    "",
+		}},
+		{"key", func() *Client { return NewClientWithKey("test-key", "user@example.com") }, map[string]string{
+			"Authorization": "",
+			"X-Auth-Key":    "test-key",
+			"X-Auth-Email":  "user@example.com",
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var headers http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers = r.Header
+				writeTestResponse(w, http.StatusOK, `{"success":true,"errors":[],"messages":[],"result":{"id":"zone1","name":"example.com"}}`)
+			}))
+			defer server.Close()
+
+			client := test.client()
+			client.BaseURL = server.URL
+			client.UserAgent = "cloudflare-backup-test/1.0"
+			_, err := client.GetZone(context.Background(), "zone1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.headers["User-Agent"] = "cloudflare-backup-test/1.0"
+			for name, want := range test.headers {
+				if got := headers.Get(name); got != want {
+					t.Errorf("%s header is %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestListDNSRecords(t *testing.T) {
+	records := []string{
+		`{"id":"r1","type":"A","name":"example.com","content":"192.0.2.1","proxiable":true,"proxied":true,"ttl":1,"comment":"web","tags":["owner:web"]}`,
+		`{"id":"r2","type":"MX","name":"example.com","content":"mx.example.com","priority":10,"ttl":3600}`,
+		`{"id":"r3","type":"SRV","name":"_sip._tcp.example.com","content":"5 5060 sip.example.com","priority":10,"data":{"priority":10,"weight":5,"port":5060,"target":"sip.example.com"},"ttl":3600}`,
+	}
+	log := &requestLog{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		log.add(r)
+		if r.URL.Path != "/client/v4/zones/zone1/dns_records" {
+			t.Errorf("unexpected request for %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("per_page"); got != "5000" {
+			t.Errorf("asked for %s records per page, want 5000", got)
+		}
+		writeTestPage(w, r, records, 2)
+	})
+
+	result, err := client.ListDNSRecords(context.Background(), "zone1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 3 || log.count() != 2 {
+		t.Fatalf("got %d records in %d requests, want 3 in 2", len(result), log.count())
+	}
+	if result[0].Comment != "web" || len(result[0].Tags) != 1 || !result[0].Proxied {
+		t.Errorf("first record is %+v", result[0])
+	}
+	if result[1].Priority == nil || *result[1].Priority != 10 {
+		t.Errorf("MX record's priority is %v, want 10", result[1].Priority)
+	}
+	data := map[string]interface{}{}
+	err = json.Unmarshal(result[2].Data, &data)
+	if err != nil || data["port"] != 5060.0 {
+		t.Errorf("SRV record's data is %s", result[2].Data)
+	}
+}
+
+func TestClientPerPage(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("per_page"); got != "100" {
+			t.Errorf("asked for %s records per page, want 100", got)
+		}
+		writeTestPage(w, r, []string{}, 100)
+	})
+	client.PerPage = 100
+
+	_, err := client.ListDNSRecords(context.Background(), "zone1")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForEachDNSRecordStops(t *testing.T) {
+	records := []string{`{"id":"r1"}`, `{"id":"r2"}`, `{"id":"r3"}`, `{"id":"r4"}`}
+	log := &requestLog{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		log.add(r)
+		writeTestPage(w, r, records, 2)
+	})
+
+	stop := errors.New("stop")
+	seen := 0
+	err := client.ForEachDNSRecord(context.Background(), "zone1", func(record DNSRecord) error {
+		seen++
+		if record.ID == "r1" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("got error %v, want the one returned by handle", err)
+	}
+	if seen != 1 || log.count() != 1 {
+		t.Errorf("saw %d records in %d requests, want 1 in 1", seen, log.count())
+	}
+}
+
+func TestListPageRules(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/client/v4/zones/zone1/pagerules" || r.URL.Query().Get("order") != "priority" {
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+		writeTestResponse(w, http.StatusOK, `{"success":true,"errors":[],"messages":[],"result":[`+
+			`{"id":"pr1","targets":[{"target":"url","constraint":{"operator":"matches","value":"*example.com/old/*"}}],"actions":[{"id":"forwarding_url","value":{"url":"https://example.com/new/$2","status_code":301}}],"priority":2,"status":"active"},`+
+			`{"id":"pr2","targets":[],"actions":[{"id":"always_use_https"}],"priority":1,"status":"disabled"}]}`)
+	})
+
+	result, err := client.ListPageRules(context.Background(), "zone1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("got %d page rules, want 2", len(result))
+	}
+	if result[0].Targets[0].Constraint.Value != "*example.com/old/*" || result[0].Actions[0].ID != "forwarding_url" {
+		t.Errorf("first page rule is %+v", result[0])
+	}
+	if result[1].Status != "disabled" || result[1].Priority != 1 {
+		t.Errorf("second page rule is %+v", result[1])
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	for _, test := range []struct {
+		status   int
+		code     int
+		is       error
+		scope    string
+		requests int
+	}{
+		{http.StatusForbidden, 10000, ErrPermission, "Zone / DNS / Read", 1},
+		{http.StatusBadRequest, 9109, ErrPermission, "Zone / DNS / Read", 1},
+		{http.StatusBadRequest, 6003, ErrAuthentication, "", 1},
+		{http.StatusUnauthorized, 10000, ErrAuthentication, "", 1},
+		{http.StatusNotFound, 7003, ErrNotFound, "", 1},
+		{http.StatusTooManyRequests, 971, ErrRateLimited, "", 3},
+	} {
+		t.Run(strconv.Itoa(test.code), func(t *testing.T) {
+			log := &requestLog{}
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				log.add(r)
+				w.Header().Set("Cf-Ray", "0123456789abcdef-SJC")
+				writeTestResponse(w, test.status, fmt.Sprintf(`{"success":false,"errors":[{"code":%d,"message":"failed"}],"messages":[],"result":null}`, test.code))
+			})
+
+			_, err := client.ListDNSRecords(context.Background(), "zone1")
+			if !errors.Is(err, test.is) {
+				t.Fatalf("got error %v, want %v", err, test.is)
+			}
+			apiError := &APIError{}
+			if !errors.As(err, &apiError) {
+				t.Fatalf("got error %T, want an APIError", err)
+			}
+			if apiError.StatusCode != test.status || apiError.Code() != test.code || apiError.RayID != "0123456789abcdef-SJC" {
+				t.Errorf("got %+v", apiError)
+			}
+			if apiError.Path != "zones/zone1/dns_records" {
+				t.Errorf("error's path is %s", apiError.Path)
+			}
+			if got := apiError.MissingScope(); got != test.scope {
+				t.Errorf("missing scope is %q, want %q", got, test.scope)
+			}
+
+			// only rate limits are worth retrying
+			if log.count() != test.requests {
+				t.Errorf("made %d requests, want %d", log.count(), test.requests)
+			}
+		})
+	}
+}
+
+func TestRetriesServerErrors(t *testing.T) {
+	log := &requestLog{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if log.add(r) < 3 {
+			writeTestResponse(w, http.StatusBadGateway, `<html>Bad gateway</html>`)
+			return
+		}
+		writeTestResponse(w, http.StatusOK, `{"success":true,"errors":[],"messages":[],"result":{"id":"zone1","name":"example.com"}}`)
+	})
+	retries := 0
+	client.OnRetry = func(path string, err error) {
+		retries++
+	}
+
+	zone, err := client.GetZone(context.Background(), "zone1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.Name != "example.com" {
+		t.Errorf("got zone %s", zone.Name)
+	}
+	if log.count() != 3 || retries != 2 {
+		t.Errorf("made %d requests with %d retries, want 3 and 2", log.count(), retries)
+	}
+}
+
+func TestRetriesRunOut(t *testing.T) {
+	log := &requestLog{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		log.add(r)
+		writeTestResponse(w, http.StatusServiceUnavailable, `{"success":false,"errors":[{"code":10001,"message":"service unavailable"}],"messages":[],"result":null}`)
+	})
+	client.RetryPolicy.MaxAttempts = 2
+
+	_, err := client.GetZone(context.Background(), "zone1")
+	apiError := &APIError{}
+	if !errors.As(err, &apiError) || apiError.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got error %v, want the last response's", err)
+	}
+	if log.count() != 2 {
+		t.Errorf("made %d requests, want 2", log.count())
+	}
+}
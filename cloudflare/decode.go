@@ -0,0 +1,85 @@
+package cloudflare
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// decodeTailLength is how much of the end of a response body is kept for DecodeError, which is usually enough to see
+// where a cut off response stopped, or what a proxy put in its place.
+const decodeTailLength = 120
+
+// maxDrainLength is the most of a response body that's read after it fails to decode, to count how long it was.
+const maxDrainLength = 1024 * 1024
+
+// DecodeError is a response from the API that couldn't be decoded, usually because it was cut off partway through,
+// or because something between the client and the API replaced it. It says how much of the body was received, and
+// how it ended, since the error from the JSON decoder alone doesn't.
+type DecodeError struct {
+	Path string
+	Err  error
+
+	// ContentLength is the length that the response said it had, or -1 if it didn't say.
+	ContentLength int64
+
+	// BytesRead is how much of the body was received.
+	BytesRead int64
+
+	// Tail is the end of what was received.
+	Tail []byte
+
+	ids string
+}
+
+func (e *DecodeError) Error() string {
+	received := strconv.FormatInt(e.BytesRead, 10) + " bytes"
+	if e.ContentLength >= 0 {
+		received = strconv.FormatInt(e.BytesRead, 10) + " of the " + strconv.FormatInt(e.ContentLength, 10) + " bytes in its Content-Length"
+	}
+	return e.Path + ": couldn't decode the response (" + e.Err.Error() + "), after receiving " + received + ", ending with " + strconv.Quote(string(e.Tail)) + e.ids
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// bodyRecorder wraps a response body, counting the bytes read from it and keeping the last decodeTailLength of them.
+type bodyRecorder struct {
+	body io.ReadCloser
+	read int64
+	tail []byte
+}
+
+func newBodyRecorder(body io.ReadCloser) *bodyRecorder {
+	return &bodyRecorder{body: body}
+}
+
+func (r *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.read += int64(n)
+	r.tail = append(r.tail, p[:n]...)
+	if len(r.tail) > decodeTailLength {
+		r.tail = append(r.tail[:0], r.tail[len(r.tail)-decodeTailLength:]...)
+	}
+	return n, err
+}
+
+func (r *bodyRecorder) Close() error {
+	return r.body.Close()
+}
+
+// decodeError describes a response body that couldn't be decoded. The rest of the body is read first, so that the
+// error has its full length and how it really ended, rather than where the decoder gave up.
+func (r *bodyRecorder) decodeError(path string, response *http.Response, err error) error {
+	io.Copy(ioutil.Discard, io.LimitReader(r, maxDrainLength))
+	return &DecodeError{
+		Path:          path,
+		Err:           err,
+		ContentLength: response.ContentLength,
+		BytesRead:     r.read,
+		Tail:          r.tail,
+		ids:           newAPIError(path, response).ids(),
+	}
+}
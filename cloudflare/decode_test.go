@@ -0,0 +1,146 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// closeMidBody starts a response with body, but closes the connection after only n bytes of it were sent, like a
+// proxy that gave up partway through.
+func closeMidBody(t *testing.T, w http.ResponseWriter, body string, n int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(body[:n]))
+	w.(http.Flusher).Flush()
+
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conn.Close()
+}
+
+const testZoneResponse = `{"success":true,"errors":[],"messages":[],"result":{"id":"zone1","name":"example.com","status":"active"}}`
+
+func TestTruncatedResponseDecodeError(t *testing.T) {
+	log := &requestLog{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		log.add(r)
+		closeMidBody(t, w, testZoneResponse, 60)
+	})
+	client.RetryPolicy.MaxAttempts = 2
+
+	_, err := client.GetZone(context.Background(), "zone1")
+	decodeError := &DecodeError{}
+	if !errors.As(err, &decodeError) {
+		t.Fatalf("got error %v, want a DecodeError", err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("the DecodeError doesn't wrap io.ErrUnexpectedEOF: %v", decodeError.Err)
+	}
+	if decodeError.Path != "zones/zone1" || decodeError.ContentLength != int64(len(testZoneResponse)) || decodeError.BytesRead != 60 {
+		t.Errorf("got path %s with %d of %d bytes, want zones/zone1 with 60 of %d", decodeError.Path, decodeError.BytesRead, decodeError.ContentLength, len(testZoneResponse))
+	}
+	if string(decodeError.Tail) != testZoneResponse[:60] {
+		t.Errorf("got tail %q, want %q", decodeError.Tail, testZoneResponse[:60])
+	}
+	if !strings.Contains(err.Error(), "after receiving 60 of the "+strconv.Itoa(len(testZoneResponse))+" bytes in its Content-Length") {
+		t.Errorf("the error doesn't say how much was received: %v", err)
+	}
+
+	if log.count() != 2 {
+		t.Errorf("the request was made %d times, want 2", log.count())
+	}
+}
+
+func TestLongTruncatedResponseTail(t *testing.T) {
+	body := `{"success":true,"errors":[],"messages":[],"result":{"id":"zone1","name":"` + strings.Repeat("a", 500) + `"}}`
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		closeMidBody(t, w, body, 400)
+	})
+	client.RetryPolicy.MaxAttempts = 1
+
+	_, err := client.GetZone(context.Background(), "zone1")
+	decodeError := &DecodeError{}
+	if !errors.As(err, &decodeError) {
+		t.Fatalf("got error %v, want a DecodeError", err)
+	}
+	if string(decodeError.Tail) != body[400-decodeTailLength:400] {
+		t.Errorf("got tail %q, want the last %d bytes received", decodeError.Tail, decodeTailLength)
+	}
+}
+
+func TestReplacedResponseDecodeError(t *testing.T) {
+	// something in between answered with a page of its own, rather than cutting the response off
+	body := "<html><body>Request blocked by the proxy</body></html>"
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeTestResponse(w, http.StatusOK, body)
+	})
+	client.RetryPolicy.MaxAttempts = 1
+
+	_, err := client.GetZone(context.Background(), "zone1")
+	decodeError := &DecodeError{}
+	if !errors.As(err, &decodeError) {
+		t.Fatalf("got error %v, want a DecodeError", err)
+	}
+	if decodeError.BytesRead != int64(len(body)) || string(decodeError.Tail) != body {
+		t.Errorf("got %d bytes ending with %q, want all of %q", decodeError.BytesRead, decodeError.Tail, body)
+	}
+}
+
+func TestTruncatedDNSRecordsPageIsRetried(t *testing.T) {
+	items := []string{}
+	for i := 0; i < 5; i++ {
+		items = append(items, `{"id":"record`+strconv.Itoa(i)+`","type":"A","name":"example.com","content":"192.0.2.1","ttl":1}`)
+	}
+	mu := sync.Mutex{}
+	truncated := false
+	log := &requestLog{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		log.add(r)
+		mu.Lock()
+		truncate := r.URL.Query().Get("page") == "2" && !truncated
+		truncated = truncated || truncate
+		mu.Unlock()
+
+		if truncate {
+			// the page breaks off after its first record, which has to be dropped rather than handled twice
+			closeMidBody(t, w, `{"success":true,"errors":[],"messages":[],"result":[`+items[2]+`,`+items[3]+`]}`, 60+len(items[2]))
+			return
+		}
+		writeTestPage(w, r, items, 2)
+	})
+	client.PerPage = 2
+	retries := []error{}
+	client.OnRetry = func(path string, err error) {
+		retries = append(retries, err)
+	}
+
+	records := []string{}
+	err := client.ForEachDNSRecord(context.Background(), "zone1", func(record DNSRecord) error {
+		records = append(records, record.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(records, ",") != "record0,record1,record2,record3,record4" {
+		t.Errorf("got records %v", records)
+	}
+	if log.count() != 4 {
+		t.Errorf("got %d requests, want 4", log.count())
+	}
+	decodeError := &DecodeError{}
+	if len(retries) != 1 || !errors.As(retries[0], &decodeError) || decodeError.Path != "zones/zone1/dns_records" {
+		t.Errorf("OnRetry was called with %v, want a DecodeError for the broken page", retries)
+	}
+}
@@ -0,0 +1,223 @@
+package cloudflare
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the kinds of failure that callers usually need to tell apart. An APIError matches them with errors.Is, as
+// does any error that wraps one.
+var (
+	// ErrAuthentication means that the API didn't accept the token at all, like when it's mistyped or was revoked.
+	ErrAuthentication = errors.New("the API token was rejected")
+
+	// ErrPermission means that the token is valid, but isn't allowed to access the resource. APIError.MissingScope
+	// says which permission is probably missing.
+	ErrPermission = errors.New("the API token doesn't have permission for this")
+
+	// ErrRateLimited means that the API turned the request away because of its rate limit. APIError.RetryAfter says
+	// how long to wait, if the API said.
+	ErrRateLimited = errors.New("the API's rate limit was hit")
+
+	// ErrNotFound means that the resource doesn't exist.
+	ErrNotFound = errors.New("not found")
+)
+
+// the Cloudflare error codes that mean each kind of failure, for when the status code doesn't say
+var (
+	authenticationErrorCodes = map[int]bool{1000: true, 6003: true, 6100: true, 6101: true, 6102: true, 6103: true, 6111: true, 9103: true, 9106: true, 9107: true}
+	permissionErrorCodes     = map[int]bool{9109: true, 10000: true}
+	rateLimitErrorCodes      = map[int]bool{971: true}
+	notFoundErrorCodes       = map[int]bool{7000: true, 7003: true}
+)
+
+// scopesByResource maps the first part of a path after the zone or account ID to the token permission that's needed
+// to read it, for MissingScope.
+var scopesByResource = map[string]string{
+	"zones":             "Zone / Zone / Read",
+	"dns_records":       "Zone / DNS / Read",
+	"dnssec":            "Zone / DNS / Read",
+	"hold":              "Zone / Zone / Read",
+	"pagerules":         "Zone / Page Rules / Read",
+	"settings":          "Zone / Zone Settings / Read",
+	"url_normalization": "Zone / Zone Settings / Read",
+	"managed_headers":   "Zone / Transform Rules / Read",
+	"rulesets":          "Zone / Zone WAF / Read",
+	"ssl":               "Zone / SSL and Certificates / Read",
+	"custom_certs":      "Zone / SSL and Certificates / Read",
+	"bot_management":    "Zone / Bot Management / Read",
+	"web3":              "Zone / Web3 Hostnames / Read",
+	"snippets":          "Zone / Snippets / Read",
+	"settings/zaraz":    "Zone / Zaraz / Read",
+	"api_gateway":       "Zone / API Gateway / Read",
+	"argo":              "Zone / Argo / Read",
+	"cache":             "Zone / Cache Settings / Read",
+	"accounts":          "Account / Account Settings / Read",
+	"pages":             "Account / Cloudflare Pages / Read",
+	"workers":           "Account / Workers Scripts / Read",
+	"r2":                "Account / Workers R2 Storage / Read",
+	"d1":                "Account / D1 / Read",
+	"registrar":         "Account / Registrar Domains / Read",
+}
+
+// APIError is returned when the API responds to a request with an error.
+type APIError struct {
+	Path       string
+	StatusCode int
+	Errors     []Error
+
+	// RayID and RequestID identify the request to Cloudflare support. They're empty if the response didn't have
+	// the corresponding headers.
+	RayID     string
+	RequestID string
+
+	// RetryAfter is how long the API asked us to wait before trying again, from the Retry-After header, or 0 if it
+	// didn't say.
+	RetryAfter time.Duration
+}
+
+// RequestError is the old name of APIError.
+//
+// Deprecated: use APIError.
+type RequestError = APIError
+
+func newAPIError(path string, response *http.Response) *APIError {
+	apiError := &APIError{
+		Path:       path,
+		StatusCode: response.StatusCode,
+		RayID:      response.Header.Get("Cf-Ray"),
+		RequestID:  response.Header.Get("Request-Id"),
+		RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+	}
+	if apiError.RequestID == "" {
+		apiError.RequestID = response.Header.Get("X-Request-Id")
+	}
+	return apiError
+}
+
+// parseRetryAfter reads a Retry-After header, which is either a number of seconds or a date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(value)
+	if err == nil && time.Until(date) > 0 {
+		return time.Until(date).Round(time.Second)
+	}
+	return 0
+}
+
+func (e *APIError) Error() string {
+	return e.Path + ": " + e.Reason() + e.ids()
+}
+
+// Reason describes why the request failed, using the messages from the API if there were any. Unlike Error, it
+// doesn't include the path or anything that changes between requests.
+func (e *APIError) Reason() string {
+	if len(e.Errors) == 0 {
+		return "request failed with status " + strconv.Itoa(e.StatusCode)
+	}
+
+	messages := []string{}
+	for _, apiError := range e.Errors {
+		messages = append(messages, apiError.Message+" (code "+strconv.Itoa(apiError.Code)+")")
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Code returns the Cloudflare error code of the first error in the response, or 0 if there wasn't one.
+func (e *APIError) Code() int {
+	if len(e.Errors) == 0 {
+		return 0
+	}
+	return e.Errors[0].Code
+}
+
+// Message returns the message of the first error in the response, or "" if there wasn't one.
+func (e *APIError) Message() string {
+	if len(e.Errors) == 0 {
+		return ""
+	}
+	return e.Errors[0].Message
+}
+
+// hasCode returns true if any of the errors in the response has one of the given codes.
+func (e *APIError) hasCode(codes map[int]bool) bool {
+	for _, apiError := range e.Errors {
+		if codes[apiError.Code] {
+			return true
+		}
+	}
+	return false
+}
+
+// Is matches the error against ErrAuthentication, ErrPermission, ErrRateLimited, and ErrNotFound.
+func (e *APIError) Is(target error) bool {
+	authentication := e.StatusCode == http.StatusUnauthorized || e.hasCode(authenticationErrorCodes)
+	switch target {
+	case ErrAuthentication:
+		return authentication
+	case ErrPermission:
+		return !authentication && (e.StatusCode == http.StatusForbidden || e.hasCode(permissionErrorCodes))
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests || e.hasCode(rateLimitErrorCodes)
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.hasCode(notFoundErrorCodes)
+	}
+	return false
+}
+
+// MissingScope returns the token permission that the request probably needed, like "Zone / DNS / Read", if this is a
+// permission error. The API doesn't say, so it's worked out from the path, and is "" if that isn't known.
+func (e *APIError) MissingScope() string {
+	if !e.Is(ErrPermission) {
+		return ""
+	}
+
+	parts := strings.Split(e.Path, "/")
+	if (parts[0] == "zones" || parts[0] == "accounts") && len(parts) > 2 {
+		parts = parts[2:]
+	}
+	if len(parts) > 1 {
+		scope, ok := scopesByResource[parts[0]+"/"+parts[1]]
+		if ok {
+			return scope
+		}
+	}
+	return scopesByResource[parts[0]]
+}
+
+// ids formats the request's identifiers for inclusion in an error message.
+func (e *APIError) ids() string {
+	ids := ""
+	if e.RayID != "" {
+		ids += " [cf-ray: " + e.RayID + "]"
+	}
+	if e.RequestID != "" {
+		ids += " [request-id: " + e.RequestID + "]"
+	}
+	return ids
+}
+
+// IsPermissionError returns true if the error was caused by the token not having access to the requested resource.
+func IsPermissionError(err error) bool {
+	return errors.Is(err, ErrPermission)
+}
+
+// IsClientError returns true if the API rejected the request with a 4xx status, other than for rate limiting. These
+// errors won't go away by retrying.
+func IsClientError(err error) bool {
+	apiError := &APIError{}
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	return apiError.StatusCode >= 400 && apiError.StatusCode <= 499 && apiError.StatusCode != http.StatusTooManyRequests
+}
@@ -0,0 +1,28 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+// ListPagesProjects returns the account's Pages projects, with their build and deployment configuration, as they
+// were returned by the API.
+func (c *Client) ListPagesProjects(ctx context.Context, accountID string) ([]json.RawMessage, error) {
+	return c.listRaw(ctx, "accounts/"+accountID+"/pages/projects", url.Values{
+		"per_page": []string{c.perPage(10)},
+	}, 0)
+}
+
+// ListPagesDeployments returns the latest deployments of a Pages project, newest first, up to the given limit.
+func (c *Client) ListPagesDeployments(ctx context.Context, accountID string, projectName string, limit int) ([]json.RawMessage, error) {
+	// there's no point fetching more than the limit
+	perPage, _ := strconv.Atoi(c.perPage(25))
+	if limit < perPage {
+		perPage = limit
+	}
+	return c.listRaw(ctx, "accounts/"+accountID+"/pages/projects/"+url.PathEscape(projectName)+"/deployments", url.Values{
+		"per_page": []string{strconv.Itoa(perPage)},
+	}, limit)
+}
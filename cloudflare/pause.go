@@ -0,0 +1,99 @@
+package cloudflare
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pauseGate holds back every request made with a client once the API has said to wait, after a 429 with a Retry-After
+// (or Ratelimit) header. Without it, the other goroutines using the client would keep sending requests, and keep
+// getting 429s, while the one that saw it waits on its own.
+type pauseGate struct {
+	mutex  sync.Mutex
+	until  time.Time
+	paused time.Duration
+}
+
+// pauseExtensionNotice is how much longer a pause that's already under way has to get before it's worth mentioning
+// again. Requests that were sent together get their 429s at slightly different times, which would otherwise each make
+// the pause a little longer.
+const pauseExtensionNotice = time.Second
+
+// pause holds back requests until the given time from now. It returns true if the pause is new, or if it's now a lot
+// longer than it was, in which case it's worth mentioning.
+func (g *pauseGate) pause(wait time.Duration) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := time.Now()
+	until := now.Add(wait)
+	if !until.After(g.until) {
+		return false
+	}
+
+	// only the extra time is counted, so overlapping pauses from several requests aren't counted twice
+	notice := true
+	if g.until.After(now) {
+		g.paused += until.Sub(g.until)
+		notice = until.Sub(g.until) >= pauseExtensionNotice
+	} else {
+		g.paused += wait
+	}
+	g.until = until
+	return notice
+}
+
+// wait blocks until requests aren't held back anymore, or the context is done.
+func (g *pauseGate) wait(ctx context.Context) error {
+	for {
+		g.mutex.Lock()
+		wait := time.Until(g.until)
+		g.mutex.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+
+		// the pause might have been made longer in the meantime, so it's checked again afterwards
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// total returns how long requests have been held back for, in all.
+func (g *pauseGate) total() time.Duration {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.paused
+}
+
+// rateLimitWait returns how long a 429 response asked for the client to wait, from its Retry-After header, or else
+// from the t parameter of its Ratelimit header, like `"default";r=0;t=30`, which is when the rate limit window resets.
+// It returns 0 if the response didn't say.
+func rateLimitWait(response *http.Response, apiError *APIError) time.Duration {
+	if apiError.RetryAfter > 0 {
+		return apiError.RetryAfter
+	}
+	for _, part := range strings.Split(response.Header.Get("Ratelimit"), ";") {
+		pair := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(pair) == 2 && pair[0] == "t" {
+			seconds, err := strconv.Atoi(pair[1])
+			if err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return 0
+}
+
+// Paused returns how long requests made with the client have been held back for in all, because the API said to wait
+// after turning one of them away. Overlapping pauses are only counted once.
+func (c *Client) Paused() time.Duration {
+	return c.gate.total()
+}
@@ -0,0 +1,70 @@
+package cloudflare
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket that limits how often requests are made. A single RateLimiter can be shared by
+// several clients, or by several goroutines using the same client.
+//
+// Time spent waiting before a retry counts towards the limit, so a retried request doesn't wait for both the backoff
+// and the limiter.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter that allows the given number of requests per second on average, which can be
+// fractional. Up to burst requests can be made at once after a quiet period.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request can be made, or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mutex.Lock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// take the token now, even if it isn't there yet, so that waiters are served in order
+	l.tokens--
+	if l.tokens >= 0 {
+		l.mutex.Unlock()
+		return nil
+	}
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// give the token back, since the request won't be made
+		l.mutex.Lock()
+		l.tokens++
+		l.mutex.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,38 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// RegistrarDomain is a domain registered through Cloudflare Registrar. The registrant's contact details are kept as
+// the API returns them.
+type RegistrarDomain struct {
+	Name              string          `json:"name"`
+	CurrentRegistrar  string          `json:"current_registrar,omitempty"`
+	CreatedAt         string          `json:"created_at,omitempty"`
+	ExpiresAt         string          `json:"expires_at,omitempty"`
+	AutoRenew         bool            `json:"auto_renew"`
+	Locked            bool            `json:"locked"`
+	Privacy           bool            `json:"privacy"`
+	NameServers       []string        `json:"name_servers,omitempty"`
+	RegistryStatuses  string          `json:"registry_statuses,omitempty"`
+	RegistrantContact json.RawMessage `json:"registrant_contact,omitempty"`
+}
+
+type registrarDomainResult struct {
+	Response
+	Domain RegistrarDomain `json:"result"`
+}
+
+// GetRegistrarDomain returns the given domain from the account's Cloudflare Registrar domains.
+func (c *Client) GetRegistrarDomain(ctx context.Context, accountID string, name string) (RegistrarDomain, error) {
+	result := registrarDomainResult{}
+	err := c.Get(ctx, "accounts/"+accountID+"/registrar/domains/"+url.PathEscape(name), url.Values{}, &result)
+	if err != nil {
+		return RegistrarDomain{}, err
+	}
+
+	return result.Domain, nil
+}
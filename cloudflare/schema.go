@@ -0,0 +1,149 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields returns the fields in the JSON data that aren't in output's type, like "result[].comment". Anything
+// decoded into a json.RawMessage, an interface{}, or a map has every field that it could have, so it's never reported.
+func unknownFields(data []byte, output interface{}) ([]string, error) {
+	var generic interface{}
+	err := json.Unmarshal(data, &generic)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	compareFields(generic, reflect.TypeOf(output), "", found)
+	return sortedFields(found), nil
+}
+
+// decodeItem decodes the next value from the decoder into output, for getEach. If OnUnknownFields is set, any fields
+// that output's type doesn't have are added to unknown, under path.
+func (c *Client) decodeItem(decoder *json.Decoder, output interface{}, path string, unknown map[string]bool) error {
+	if c.OnUnknownFields == nil {
+		return decoder.Decode(output)
+	}
+
+	raw := json.RawMessage{}
+	err := decoder.Decode(&raw)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(raw, output)
+	if err != nil {
+		return err
+	}
+
+	var generic interface{}
+	if json.Unmarshal(raw, &generic) == nil {
+		compareFields(generic, reflect.TypeOf(output), path, unknown)
+	}
+	return nil
+}
+
+// reportUnknownFields calls OnUnknownFields with the fields found in a response, if there were any.
+func (c *Client) reportUnknownFields(path string, unknown map[string]bool) {
+	if c.OnUnknownFields != nil && len(unknown) > 0 {
+		c.OnUnknownFields(path, sortedFields(unknown))
+	}
+}
+
+func sortedFields(found map[string]bool) []string {
+	fields := []string{}
+	for field := range found {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// compareFields adds the fields of value that typ doesn't have to found, looking inside objects and arrays.
+func compareFields(value interface{}, typ reflect.Type, path string, found map[string]bool) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if reflect.PtrTo(typ).Implements(jsonUnmarshalerType) || typ == reflect.TypeOf(json.RawMessage{}) {
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if typ.Kind() != reflect.Struct {
+			return
+		}
+		fields := structFields(typ)
+		for key, fieldValue := range value {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+
+			fieldType, ok := fields[key]
+			if !ok {
+				// encoding/json matches field names without caring about case
+				for name, candidate := range fields {
+					if strings.EqualFold(name, key) {
+						fieldType, ok = candidate, true
+						break
+					}
+				}
+			}
+			if !ok {
+				found[fieldPath] = true
+				continue
+			}
+			compareFields(fieldValue, fieldType, fieldPath, found)
+		}
+
+	case []interface{}:
+		if typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array {
+			return
+		}
+		for _, element := range value {
+			compareFields(element, typ.Elem(), path+"[]", found)
+		}
+	}
+}
+
+// structFields returns the type of each field that encoding/json would decode into, keyed by its name in the JSON.
+// Fields of embedded structs are included, like the ones from Response.
+func structFields(typ reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.SplitN(tag, ",", 2)[0]
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			for embeddedName, embeddedType := range structFields(fieldType) {
+				if _, ok := fields[embeddedName]; !ok {
+					fields[embeddedName] = embeddedType
+				}
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
@@ -0,0 +1,93 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+)
+
+// Snippet is a piece of JavaScript that runs on requests to a zone, as selected by the zone's snippet rules.
+type Snippet struct {
+	Name       string `json:"snippet_name"`
+	CreatedOn  string `json:"created_on,omitempty"`
+	ModifiedOn string `json:"modified_on,omitempty"`
+}
+
+type snippetsResult struct {
+	Response
+	ResultInfo ResultInfo `json:"result_info"`
+	Snippets   []Snippet  `json:"result"`
+}
+
+// ListSnippets returns the snippets of the given zone. Their code isn't included; use GetSnippetContent for that.
+func (c *Client) ListSnippets(ctx context.Context, zoneID string) ([]Snippet, error) {
+	snippets := []Snippet{}
+	err := c.paginate(ctx, url.Values{
+		"per_page": []string{c.perPage(50)},
+	}, func(params url.Values) (ResultInfo, error) {
+		result := snippetsResult{}
+		err := c.Get(ctx, "zones/"+zoneID+"/snippets", params, &result)
+		snippets = append(snippets, result.Snippets...)
+		return result.ResultInfo, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// GetSnippetContent returns the files that make up a snippet, keyed by file name. The API returns them as a
+// multipart/form-data body.
+func (c *Client) GetSnippetContent(ctx context.Context, zoneID string, name string) (map[string][]byte, error) {
+	path := "zones/" + zoneID + "/snippets/" + url.PathEscape(name) + "/content"
+	body, contentType, err := c.GetRaw(ctx, path, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		// a snippet with a single file might just be returned as is
+		return map[string][]byte{name + ".js": body}, nil
+	}
+
+	files := map[string][]byte{}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: couldn't read the snippet's files: %w", path, err)
+		}
+
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("%s: couldn't read the snippet's files: %w", path, err)
+		}
+
+		fileName := part.FileName()
+		if fileName == "" {
+			fileName = part.FormName()
+		}
+		files[fileName] = data
+	}
+
+	return files, nil
+}
+
+// GetSnippetRules returns the rules that decide which requests each of the zone's snippets runs on, as they were
+// returned by the API.
+func (c *Client) GetSnippetRules(ctx context.Context, zoneID string) (json.RawMessage, error) {
+	return c.GetResult(ctx, "zones/"+zoneID+"/snippets/snippet_rules", url.Values{})
+}
@@ -0,0 +1,94 @@
+package cloudflare
+
+import (
+	"context"
+	"net/url"
+)
+
+// R2Bucket is an R2 storage bucket.
+type R2Bucket struct {
+	Name         string `json:"name"`
+	Location     string `json:"location,omitempty"`
+	CreationDate string `json:"creation_date,omitempty"`
+}
+
+// D1Database is a D1 database. FileSize and NumTables are only set by GetD1Database.
+type D1Database struct {
+	UUID      string `json:"uuid"`
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	FileSize  int64  `json:"file_size"`
+	NumTables int    `json:"num_tables"`
+}
+
+type r2BucketsResult struct {
+	Response
+	Result struct {
+		Buckets []R2Bucket `json:"buckets"`
+	} `json:"result"`
+	CursorInfo struct {
+		Cursor string `json:"cursor"`
+	} `json:"result_info"`
+}
+
+type d1DatabasesResult struct {
+	Response
+	Databases []D1Database `json:"result"`
+}
+
+type d1DatabaseResult struct {
+	Response
+	Database D1Database `json:"result"`
+}
+
+// ListR2Buckets returns the account's R2 buckets. Only the buckets are listed, not their contents.
+func (c *Client) ListR2Buckets(ctx context.Context, accountID string) ([]R2Bucket, error) {
+	buckets := []R2Bucket{}
+	params := url.Values{
+		"per_page": []string{c.perPage(1000)},
+	}
+	for {
+		result := r2BucketsResult{}
+		err := c.Get(ctx, "accounts/"+accountID+"/r2/buckets", params, &result)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, result.Result.Buckets...)
+
+		// this endpoint uses a cursor instead of page numbers
+		if result.CursorInfo.Cursor == "" || len(result.Result.Buckets) == 0 {
+			return buckets, nil
+		}
+		params.Set("cursor", result.CursorInfo.Cursor)
+	}
+}
+
+// ListD1Databases returns the account's D1 databases.
+func (c *Client) ListD1Databases(ctx context.Context, accountID string) ([]D1Database, error) {
+	databases := []D1Database{}
+	err := c.paginate(ctx, url.Values{
+		"per_page": []string{c.perPage(100)},
+	}, func(params url.Values) (ResultInfo, error) {
+		result := d1DatabasesResult{}
+		err := c.Get(ctx, "accounts/"+accountID+"/d1/database", params, &result)
+		databases = append(databases, result.Databases...)
+		return result.ResultInfo, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return databases, nil
+}
+
+// GetD1Database returns the details of a D1 database, including its size and number of tables.
+func (c *Client) GetD1Database(ctx context.Context, accountID string, databaseID string) (D1Database, error) {
+	result := d1DatabaseResult{}
+	err := c.Get(ctx, "accounts/"+accountID+"/d1/database/"+databaseID, url.Values{}, &result)
+	if err != nil {
+		return D1Database{}, err
+	}
+
+	return result.Database, nil
+}
@@ -0,0 +1,136 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// getEach requests a list endpoint and calls handle for each item in the result as it's decoded, so that the whole
+// response never has to be held in memory. handle must decode exactly one value from the decoder.
+//
+// A request that fails after some items were already handled is only retried if restart is given, which is called
+// first to undo whatever handle did with them. Otherwise, it isn't retried, since that would handle them twice.
+func (c *Client) getEach(ctx context.Context, path string, params url.Values, handle func(decoder *json.Decoder) error, restart func()) (Response, error) {
+	result := Response{}
+	err := c.withRetries(ctx, path, func() (bool, error) {
+		handled := 0
+		var err error
+		var retryable bool
+		result, retryable, err = c.tryGetEach(ctx, path, params, func(decoder *json.Decoder) error {
+			err := handle(decoder)
+			if err == nil {
+				handled++
+			}
+			return err
+		})
+		if retryable && handled > 0 {
+			if restart == nil {
+				return false, err
+			}
+			restart()
+		}
+		return retryable, err
+	})
+	return result, err
+}
+
+// isDecodeFailure returns true if an error from decoding an item means that the response itself was broken, rather
+// than that the item couldn't be handled.
+func isDecodeFailure(err error) bool {
+	syntaxError := &json.SyntaxError{}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.As(err, &syntaxError)
+}
+
+// tryGetEach makes a request for getEach. If it fails, it also returns whether the request is worth retrying, which
+// is only the case if the response couldn't be decoded.
+func (c *Client) tryGetEach(ctx context.Context, path string, params url.Values, handle func(decoder *json.Decoder) error) (Response, bool, error) {
+	result := Response{}
+
+	response, err := c.do(ctx, path, params)
+	if err != nil {
+		return result, false, err
+	}
+	recorder := newBodyRecorder(response.Body)
+	defer recorder.Close()
+
+	decoder := json.NewDecoder(recorder)
+	decodeError := func(err error) error {
+		return recorder.decodeError(path, response, err)
+	}
+
+	err = expectDelim(decoder, '{')
+	if err != nil {
+		return result, true, decodeError(err)
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return result, true, decodeError(err)
+		}
+
+		key, _ := token.(string)
+		switch key {
+		case "success":
+			err = decoder.Decode(&result.Success)
+		case "errors":
+			err = decoder.Decode(&result.Errors)
+		case "messages":
+			err = decoder.Decode(&result.Messages)
+		case "result_info":
+			err = decoder.Decode(&result.ResultInfo)
+		case "result":
+			token, err = decoder.Token()
+			if err != nil || token == nil {
+				// a null result just means there's nothing here
+				break
+			}
+			if token != json.Delim('[') {
+				err = fmt.Errorf("expected the result to be a list, got %v", token)
+				break
+			}
+			for decoder.More() {
+				err = handle(decoder)
+				if err != nil && isDecodeFailure(err) {
+					return result, true, decodeError(err)
+				}
+				if err != nil {
+					return result, false, err
+				}
+			}
+			_, err = decoder.Token()
+		default:
+			var ignored json.RawMessage
+			err = decoder.Decode(&ignored)
+		}
+		if err != nil {
+			return result, true, decodeError(err)
+		}
+	}
+
+	if !result.Success {
+		apiError := newAPIError(path, response)
+		apiError.Errors = result.Errors
+		return result, false, apiError
+	}
+
+	return result, false, nil
+}
+
+// expectDelim reads the next token from the decoder, and checks that it's the given delimiter.
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %s, got %v", delim, token)
+	}
+
+	return nil
+}
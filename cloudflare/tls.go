@@ -0,0 +1,59 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// HostnameSetting is a TLS setting that overrides the zone's value for a single hostname.
+type HostnameSetting struct {
+	Hostname  string          `json:"hostname"`
+	Value     json.RawMessage `json:"value"`
+	Status    string          `json:"status,omitempty"`
+	CreatedAt string          `json:"created_at,omitempty"`
+	UpdatedAt string          `json:"updated_at,omitempty"`
+}
+
+// TotalTLS is a zone's Total TLS configuration, which issues certificates for every proxied hostname.
+type TotalTLS struct {
+	Enabled              bool   `json:"enabled"`
+	CertificateAuthority string `json:"certificate_authority,omitempty"`
+	ValidityPeriod       int    `json:"validity_period,omitempty"`
+}
+
+type hostnameSettingsResult struct {
+	Response
+	Settings []HostnameSetting `json:"result"`
+}
+
+type totalTLSResult struct {
+	Response
+	TotalTLS TotalTLS `json:"result"`
+}
+
+// ListHostnameSettings returns the hostnames that override the given TLS setting in a zone. The setting is one of
+// "min_tls_version", "ciphers", or "http2".
+func (c *Client) ListHostnameSettings(ctx context.Context, zoneID string, setting string) ([]HostnameSetting, error) {
+	result := hostnameSettingsResult{}
+	err := c.Get(ctx, "zones/"+zoneID+"/hostnames/settings/"+setting, url.Values{}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Settings == nil {
+		return []HostnameSetting{}, nil
+	}
+	return result.Settings, nil
+}
+
+// GetTotalTLS returns a zone's Total TLS configuration.
+func (c *Client) GetTotalTLS(ctx context.Context, zoneID string) (TotalTLS, error) {
+	result := totalTLSResult{}
+	err := c.Get(ctx, "zones/"+zoneID+"/acm/total_tls", url.Values{}, &result)
+	if err != nil {
+		return TotalTLS{}, err
+	}
+
+	return result.TotalTLS, nil
+}
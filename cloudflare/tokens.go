@@ -0,0 +1,104 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// TokenStatus describes the API token in use, as returned by VerifyToken.
+type TokenStatus struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	NotBefore string `json:"not_before,omitempty"`
+	ExpiresOn string `json:"expires_on,omitempty"`
+}
+
+type tokenStatusResult struct {
+	Response
+	TokenStatus TokenStatus `json:"result"`
+}
+
+// VerifyToken checks that the client's token is valid, and returns its status. The status is "active" for a token
+// that can be used.
+func (c *Client) VerifyToken(ctx context.Context) (TokenStatus, error) {
+	result := tokenStatusResult{}
+	err := c.Get(ctx, "user/tokens/verify", url.Values{}, &result)
+	if err != nil {
+		return TokenStatus{}, err
+	}
+
+	return result.TokenStatus, nil
+}
+
+// PermissionGroup is a set of permissions that can be given to an API token, like "DNS Read". Scopes says what kind of
+// resource it applies to, like "com.cloudflare.api.account.zone" for zones.
+type PermissionGroup struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+type permissionGroupsResult struct {
+	Response
+	PermissionGroups []PermissionGroup `json:"result"`
+}
+
+// ListPermissionGroups returns every permission group that an API token can be given.
+func (c *Client) ListPermissionGroups(ctx context.Context) ([]PermissionGroup, error) {
+	result := permissionGroupsResult{}
+	err := c.Get(ctx, "user/tokens/permission_groups", url.Values{}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.PermissionGroups, nil
+}
+
+// TokenPolicy gives an API token the permission groups for the resources that it names, like
+// {"com.cloudflare.api.account.zone.*": "*"} for every zone. Only the IDs of the permission groups are sent.
+type TokenPolicy struct {
+	Effect           string                 `json:"effect"`
+	Resources        map[string]interface{} `json:"resources"`
+	PermissionGroups []PermissionGroup      `json:"permission_groups"`
+}
+
+// CreatedToken is an API token made with CreateToken. Value is the token itself, which the API never shows again.
+type CreatedToken struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type createdTokenResult struct {
+	Response
+	Token CreatedToken `json:"result"`
+}
+
+// CreateToken creates an API token with the given name and policies. The client's own token needs permission to
+// create API tokens.
+func (c *Client) CreateToken(ctx context.Context, name string, policies []TokenPolicy) (CreatedToken, error) {
+	sent := []TokenPolicy{}
+	for _, policy := range policies {
+		groups := []PermissionGroup{}
+		for _, group := range policy.PermissionGroups {
+			groups = append(groups, PermissionGroup{ID: group.ID})
+		}
+		policy.PermissionGroups = groups
+		sent = append(sent, policy)
+	}
+	body, err := json.Marshal(struct {
+		Name     string        `json:"name"`
+		Policies []TokenPolicy `json:"policies"`
+	}{name, sent})
+	if err != nil {
+		return CreatedToken{}, err
+	}
+
+	result := createdTokenResult{}
+	err = c.Post(ctx, "user/tokens", body, "application/json", &result)
+	if err != nil {
+		return CreatedToken{}, err
+	}
+	return result.Token, nil
+}
@@ -0,0 +1,246 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Each request goes through a chain of round trippers, each handling one thing, built by Client.transport. They're
+// kept unexported, since they depend on the request having been made by the client.
+
+type contextKey string
+
+// pathContextKey holds the path of a request relative to the base URL, which the round trippers use when reporting on
+// the request.
+const pathContextKey contextKey = "path"
+
+// requestPath returns the path of a request relative to the base URL, like "zones/<id>/dns_records".
+func requestPath(request *http.Request) string {
+	path, ok := request.Context().Value(pathContextKey).(string)
+	if !ok {
+		return strings.TrimPrefix(request.URL.Path, "/")
+	}
+	return path
+}
+
+// withRequestPath returns a context for a request to the given path.
+func withRequestPath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, pathContextKey, path)
+}
+
+// headerTransport sets a header on every request, like the Authorization or User-Agent header.
+type headerTransport struct {
+	next  http.RoundTripper
+	name  string
+	value string
+}
+
+func (t headerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	// a round tripper isn't allowed to change the request it's given
+	request = request.Clone(request.Context())
+	request.Header.Set(t.name, t.value)
+	return t.next.RoundTrip(request)
+}
+
+// rateLimitTransport waits for the rate limiter before each request.
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	limiter *RateLimiter
+	onWait  func(path string, wait time.Duration)
+}
+
+func (t rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	err := t.limiter.Wait(request.Context())
+	if err != nil {
+		return nil, err
+	}
+	reportWait(t.onWait, request, start)
+	return t.next.RoundTrip(request)
+}
+
+// reportWait passes how long a request has waited since start to onWait, if it had to wait at all. Anything under a
+// millisecond is just the time that it took to check.
+func reportWait(onWait func(path string, wait time.Duration), request *http.Request, start time.Time) {
+	wait := time.Since(start)
+	if onWait != nil && wait >= time.Millisecond {
+		onWait(requestPath(request), wait)
+	}
+}
+
+// retryTransport retries requests that fail at the network level, or that get a 429 or 5xx response. Requests other
+// than GET and HEAD might have been carried out even if they failed, so they're only retried after a 429, which means
+// that the API turned them away. Once the attempts run out, the last response or error is returned as it was.
+//
+// A 429 that says how long to wait pauses the gate for that long, which holds back every attempt at every request,
+// rather than just the one that was turned away.
+type retryTransport struct {
+	next      http.RoundTripper
+	policy    RetryPolicy
+	gate      *pauseGate
+	onRetry   func(path string, err error)
+	onBackoff func(path string, delay time.Duration)
+	onPause   func(path string, wait time.Duration)
+	onWait    func(path string, wait time.Duration)
+}
+
+func (t retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	maxAttempts := t.policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	idempotent := request.Method == "GET" || request.Method == "HEAD"
+	path := requestPath(request)
+
+	for attempt := 1; ; attempt++ {
+		attemptRequest := request
+		if attempt > 1 && request.Body != nil {
+			if request.GetBody == nil {
+				return nil, fmt.Errorf("%s: the request can't be retried, since its body can't be read again", path)
+			}
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptRequest = request.Clone(request.Context())
+			attemptRequest.Body = body
+		}
+
+		waitStart := time.Now()
+		err := t.gate.wait(request.Context())
+		if err != nil {
+			return nil, err
+		}
+		reportWait(t.onWait, request, waitStart)
+		response, err := t.next.RoundTrip(attemptRequest)
+
+		var retryReason error
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if !idempotent || request.Context().Err() != nil || attempt >= maxAttempts {
+				return nil, err
+			}
+			retryReason = err
+		case response.StatusCode == http.StatusTooManyRequests:
+			// the other requests are held back even if this one is out of attempts, since they'd only be turned away too
+			wait = rateLimitWait(response, newAPIError(path, response))
+			if wait > 0 && t.gate.pause(wait) && t.onPause != nil {
+				t.onPause(path, wait)
+			}
+			if attempt >= maxAttempts {
+				return response, nil
+			}
+			retryReason = readAPIError(path, response)
+		case idempotent && response.StatusCode >= 500:
+			if attempt >= maxAttempts {
+				return response, nil
+			}
+			retryReason = readAPIError(path, response)
+		default:
+			return response, nil
+		}
+
+		if t.onRetry != nil {
+			t.onRetry(path, retryReason)
+		}
+
+		if wait > 0 {
+			// the gate is waited for before the next attempt, along with every other request
+			if t.onBackoff != nil {
+				t.onBackoff(path, wait)
+			}
+			continue
+		}
+
+		delay := time.Duration(attempt) * t.policy.Backoff
+		if t.onBackoff != nil {
+			t.onBackoff(path, delay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+	}
+}
+
+// hookTransport calls a function after every attempt at a request, with the response's status code, or 0 if there
+// was no response.
+type hookTransport struct {
+	next      http.RoundTripper
+	onRequest func(path string, statusCode int)
+}
+
+func (t hookTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(request)
+	statusCode := 0
+	if err == nil {
+		statusCode = response.StatusCode
+	}
+	t.onRequest(requestPath(request), statusCode)
+	return response, err
+}
+
+// clientTransport sends requests with the client's HTTPClient, so that its timeout, redirect policy, and transport
+// (which might be a cache) are used for each attempt.
+type clientTransport struct {
+	client *Client
+}
+
+func (t clientTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.client.HTTPClient.Do(request)
+	if err != nil {
+		return nil, t.client.describeConnectionError(request, err)
+	}
+	return response, nil
+}
+
+// transport builds the chain of round trippers that requests go through:
+//
+//	auth → user agent → rate limiter → retries (and the pause gate) → OnRequest → HTTPClient
+//
+// Anything in HTTPClient's transport, like a cache, comes last, so it sees each attempt on its own.
+func (c *Client) transport() http.RoundTripper {
+	var transport http.RoundTripper = clientTransport{client: c}
+	if c.OnRequest != nil {
+		transport = hookTransport{next: transport, onRequest: c.OnRequest}
+	}
+	transport = retryTransport{
+		next: transport, policy: c.RetryPolicy, gate: &c.gate, onRetry: c.OnRetry, onBackoff: c.OnBackoff, onPause: c.OnPause,
+		onWait: c.OnRateLimitWait,
+	}
+	if c.RateLimiter != nil {
+		transport = rateLimitTransport{next: transport, limiter: c.RateLimiter, onWait: c.OnRateLimitWait}
+	}
+	if c.UserAgent != "" {
+		transport = headerTransport{next: transport, name: "User-Agent", value: c.UserAgent}
+	}
+	if c.APIKey != "" {
+		transport = headerTransport{next: transport, name: "X-Auth-Email", value: c.Email}
+		return headerTransport{next: transport, name: "X-Auth-Key", value: c.APIKey}
+	}
+	return headerTransport{next: transport, name: "Authorization", value: "Bearer " + c.Token}
+}
+
+// readAPIError reads an error response into an APIError, and closes it.
+func readAPIError(path string, response *http.Response) *APIError {
+	defer response.Body.Close()
+	apiError := newAPIError(path, response)
+
+	// the body usually has error messages from the API, but we don't need more than the start of it
+	errorBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, errorBodyLimit))
+	errorResponse := Response{}
+	err := json.Unmarshal(errorBody, &errorResponse)
+	if err == nil {
+		apiError.Errors = errorResponse.Errors
+	}
+	return apiError
+}
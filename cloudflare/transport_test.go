@@ -0,0 +1,207 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripperFunc is a round tripper that calls a function, standing in for the rest of the chain.
+type roundTripperFunc func(request *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// statusSequence returns a round tripper that answers with each status in turn, and counts the attempts.
+func statusSequence(attempts *int, statuses ...int) roundTripperFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		status := statuses[*attempts]
+		*attempts++
+		recorder := httptest.NewRecorder()
+		writeTestResponse(recorder, status, `{"success":false,"errors":[{"code":10001,"message":"failed"}],"messages":[],"result":null}`)
+		return recorder.Result(), nil
+	}
+}
+
+func newTestRequest(method string) *http.Request {
+	request := httptest.NewRequest(method, "https://api.cloudflare.com/client/v4/zones/zone1/dns_records", strings.NewReader("{}"))
+	request.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("{}")), nil
+	}
+	return request.WithContext(withRequestPath(context.Background(), "zones/zone1/dns_records"))
+}
+
+func TestHeaderTransport(t *testing.T) {
+	request := newTestRequest("GET")
+	var sent *http.Request
+	transport := headerTransport{next: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		sent = request
+		return httptest.NewRecorder().Result(), nil
+	}), name: "Authorization", value: "Bearer test-token"}
+
+	_, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.Header.Get("Authorization") != "Bearer test-token" {
+		t.Errorf("sent Authorization header %q", sent.Header.Get("Authorization"))
+	}
+	if request.Header.Get("Authorization") != "" {
+		t.Error("the request that the transport was given was changed")
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		method   string
+		statuses []int
+		attempts int
+		status   int
+	}{
+		{"server error", "GET", []int{502, 503, 200}, 3, 200},
+		{"attempts run out", "GET", []int{500, 500, 500}, 3, 500},
+		{"client error", "GET", []int{403}, 1, 403},
+		{"not idempotent", "POST", []int{502}, 1, 502},
+		{"rate limited, not idempotent", "POST", []int{429, 200}, 2, 200},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			retries := []string{}
+			transport := retryTransport{
+				next:    statusSequence(&attempts, test.statuses...),
+				policy:  RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+				gate:    &pauseGate{},
+				onRetry: func(path string, err error) { retries = append(retries, path) },
+			}
+
+			response, err := transport.RoundTrip(newTestRequest(test.method))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != test.status || attempts != test.attempts {
+				t.Errorf("got a %d after %d attempts, want a %d after %d", response.StatusCode, attempts, test.status, test.attempts)
+			}
+			if len(retries) != test.attempts-1 {
+				t.Errorf("OnRetry was called %d times, want %d", len(retries), test.attempts-1)
+			}
+			for _, path := range retries {
+				if path != "zones/zone1/dns_records" {
+					t.Errorf("OnRetry was called with path %s", path)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportNetworkErrors(t *testing.T) {
+	attempts := 0
+	transport := retryTransport{
+		next: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			attempts++
+			return nil, errors.New("connection reset by peer")
+		}),
+		policy: RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+		gate:   &pauseGate{},
+	}
+
+	_, err := transport.RoundTrip(newTestRequest("GET"))
+	if err == nil || attempts != 2 {
+		t.Errorf("got error %v after %d attempts, want an error after 2", err, attempts)
+	}
+
+	// a POST might have been carried out before the connection broke, so it isn't tried again
+	attempts = 0
+	_, err = transport.RoundTrip(newTestRequest("POST"))
+	if err == nil || attempts != 1 {
+		t.Errorf("got error %v after %d attempts, want an error after 1", err, attempts)
+	}
+}
+
+func TestHookTransport(t *testing.T) {
+	statuses := []int{}
+	attempts := 0
+	transport := hookTransport{next: statusSequence(&attempts, 404), onRequest: func(path string, statusCode int) {
+		statuses = append(statuses, statusCode)
+	}}
+	transport.RoundTrip(newTestRequest("GET"))
+
+	failing := hookTransport{next: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}), onRequest: transport.onRequest}
+	failing.RoundTrip(newTestRequest("GET"))
+
+	if len(statuses) != 2 || statuses[0] != 404 || statuses[1] != 0 {
+		t.Errorf("OnRequest was called with %v, want [404 0]", statuses)
+	}
+}
+
+func TestTransportOrder(t *testing.T) {
+	// OnRequest comes after the retries, so it sees every attempt, and so does anything in HTTPClient's transport
+	log := &requestLog{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if log.add(r) == 1 {
+			writeTestResponse(w, http.StatusBadGateway, `<html>Bad gateway</html>`)
+			return
+		}
+		writeTestResponse(w, http.StatusOK, `{"success":true,"errors":[],"messages":[],"result":{"id":"zone1","name":"example.com"}}`)
+	})
+	statuses := []int{}
+	client.OnRequest = func(path string, statusCode int) {
+		statuses = append(statuses, statusCode)
+	}
+	seen := 0
+	next := http.DefaultTransport
+	client.HTTPClient = &http.Client{Transport: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		seen++
+		if request.Header.Get("Authorization") != "Bearer test-token" {
+			t.Error("a request reached HTTPClient without its Authorization header")
+		}
+		return next.RoundTrip(request)
+	})}
+
+	_, err := client.GetZone(context.Background(), "zone1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0] != 502 || statuses[1] != 200 {
+		t.Errorf("OnRequest was called with %v, want [502 200]", statuses)
+	}
+	if seen != 2 {
+		t.Errorf("HTTPClient's transport saw %d attempts, want 2", seen)
+	}
+}
+
+func TestTransportCachedResponseNotRetried(t *testing.T) {
+	// a response from something in HTTPClient's transport, like a cache, is treated like one from the API, so a
+	// cached success is never retried, and the API is never asked
+	log := &requestLog{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		log.add(r)
+		writeTestResponse(w, http.StatusServiceUnavailable, `{"success":false,"errors":[],"messages":[],"result":null}`)
+	})
+	retries := 0
+	client.OnRetry = func(path string, err error) {
+		retries++
+	}
+	client.HTTPClient = &http.Client{Transport: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		recorder := httptest.NewRecorder()
+		writeTestResponse(recorder, http.StatusOK, `{"success":true,"errors":[],"messages":[],"result":{"id":"zone1","name":"cached.example"}}`)
+		return recorder.Result(), nil
+	})}
+
+	zone, err := client.GetZone(context.Background(), "zone1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.Name != "cached.example" || retries != 0 || log.count() != 0 {
+		t.Errorf("got zone %s with %d retries and %d requests to the API, want the cached one with none", zone.Name, retries, log.count())
+	}
+}
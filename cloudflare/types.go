@@ -0,0 +1,253 @@
+package cloudflare
+
+import "encoding/json"
+
+// ResultInfo holds the pagination information returned by list endpoints.
+type ResultInfo struct {
+	TotalPages int `json:"total_pages"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+}
+
+// Error is an error message returned by the API.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Response holds the fields common to every API response.
+type Response struct {
+	Success    bool       `json:"success"`
+	Errors     []Error    `json:"errors"`
+	Messages   []Error    `json:"messages"`
+	ResultInfo ResultInfo `json:"result_info"`
+}
+
+// PageRuleTarget is a URL pattern that a page rule matches.
+type PageRuleTarget struct {
+	Target     string `json:"target"`
+	Constraint struct {
+		Operator string `json:"operator"`
+		Value    string `json:"value"`
+	} `json:"constraint"`
+}
+
+// PageRuleAction is a setting that a page rule applies.
+type PageRuleAction struct {
+	ID    string      `json:"id"`
+	Value interface{} `json:"value"`
+}
+
+// PageRule is a zone's page rule.
+type PageRule struct {
+	ID         string           `json:"id"`
+	Targets    []PageRuleTarget `json:"targets"`
+	Actions    []PageRuleAction `json:"actions"`
+	Priority   int              `json:"priority"`
+	Status     string           `json:"status"`
+	ModifiedOn string           `json:"modified_on"`
+	CreatedOn  string           `json:"created_on"`
+}
+
+// DNSRecord is a DNS record in a zone. Priority is only set for MX records (and URI records), and Data holds the
+// separate fields of the record types that need them, like SRV and CAA.
+type DNSRecord struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Name      string          `json:"name"`
+	Content   string          `json:"content"`
+	Proxiable bool            `json:"proxiable"`
+	Proxied   bool            `json:"proxied"`
+	TTL       uint64          `json:"ttl"`
+	Locked    bool            `json:"locked"`
+	Priority  *uint16         `json:"priority,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Comment   string          `json:"comment,omitempty"`
+	Tags      []string        `json:"tags,omitempty"`
+	Meta      *DNSRecordMeta  `json:"meta,omitempty"`
+
+	// ManagedBy isn't part of the API's response. It's set for records that Cloudflare manages itself, to what manages
+	// them, like "email_routing", so that they aren't created again by hand when the zone is restored.
+	ManagedBy string `json:"managed_by,omitempty"`
+}
+
+// DNSRecordMeta is what the API says about where a DNS record came from.
+type DNSRecordMeta struct {
+	AutoAdded           bool `json:"auto_added,omitempty"`
+	ManagedByApps       bool `json:"managed_by_apps,omitempty"`
+	ManagedByArgoTunnel bool `json:"managed_by_argo_tunnel,omitempty"`
+	EmailRouting        bool `json:"email_routing,omitempty"`
+	ReadOnly            bool `json:"read_only,omitempty"`
+}
+
+// DNSRecordBody is the request body that creates a DNS record. It's a DNSRecord without the fields that only the API
+// sets, like its ID and whether it's locked.
+type DNSRecordBody struct {
+	Type     string          `json:"type"`
+	Name     string          `json:"name"`
+	Content  string          `json:"content,omitempty"`
+	Proxied  bool            `json:"proxied"`
+	TTL      uint64          `json:"ttl"`
+	Priority *uint16         `json:"priority,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Comment  string          `json:"comment,omitempty"`
+	Tags     []string        `json:"tags,omitempty"`
+}
+
+// Body returns the request body that would create the record again.
+func (r DNSRecord) Body() DNSRecordBody {
+	return DNSRecordBody{r.Type, r.Name, r.Content, r.Proxied, r.TTL, r.Priority, r.Data, r.Comment, r.Tags}
+}
+
+// Zone is a zone (domain) in a Cloudflare account. Its Type is "full" for zones that use Cloudflare's nameservers,
+// "partial" for zones set up with CNAMEs, and "secondary" for zones transferred from another nameserver.
+type Zone struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	ModifiedOn  string `json:"modified_on"`
+	ActivatedOn string `json:"activated_on"`
+	CreatedOn   string `json:"created_on"`
+
+	// Paused is set if the zone is paused, so Cloudflare only answers DNS queries for it, without proxying or caching.
+	Paused bool `json:"paused"`
+
+	// Permissions lists what the token can do in the zone, like "#dns_records:read". It's only returned for some
+	// kinds of tokens.
+	Permissions []string `json:"permissions,omitempty"`
+
+	// Account is the account that the zone belongs to. Only its ID and name are set.
+	Account *Account `json:"account,omitempty"`
+
+	// Plan is the zone's plan, like "Free Website".
+	Plan *ZonePlan `json:"plan,omitempty"`
+
+	// Meta has some of what the zone's plan allows. Only the parts that the backup uses are kept.
+	Meta *ZoneMeta `json:"meta,omitempty"`
+
+	// Hold isn't part of the zone in the API. It's filled in from GetZoneHold by the backup, and is nil if the hold
+	// couldn't be read.
+	Hold *ZoneHold `json:"hold,omitempty"`
+
+	// DevelopmentMode is filled in from GetDevelopmentMode by the backup, and is nil if the setting couldn't be read.
+	// The zone in the API has a development_mode field of its own, with just the seconds until it expires, so this
+	// has a different name.
+	DevelopmentMode *DevelopmentMode `json:"development_mode_setting,omitempty"`
+
+	// PageRuleEntitlements isn't part of the zone in the API either. It's filled in by the backup when page rules are
+	// backed up, and is nil if they weren't, or the entitlements couldn't be read.
+	PageRuleEntitlements *PageRuleEntitlements `json:"page_rule_entitlements,omitempty"`
+}
+
+// ZonePlan is the plan that a zone is on.
+type ZonePlan struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// ZoneMeta is the part of a zone's meta field that the backup uses.
+type ZoneMeta struct {
+	// PageRuleQuota is the most page rules that the zone can have.
+	PageRuleQuota int `json:"page_rule_quota"`
+}
+
+// PageRuleEntitlements is what a zone's plan allows for page rules. MaxRules comes from the zone's page rule quota,
+// and is 0 if that isn't known, and Settings is the list of actions that the zone's page rules can use, as
+// zones/:id/pagerules/settings returns it.
+type PageRuleEntitlements struct {
+	MaxRules int             `json:"max_rules,omitempty"`
+	Settings json.RawMessage `json:"settings,omitempty"`
+}
+
+// DevelopmentMode is a zone's development mode setting, which bypasses the cache while it's on. It turns itself off
+// after a few hours, and TimeRemaining is how many seconds are left until then.
+type DevelopmentMode struct {
+	Value         string `json:"value"`
+	TimeRemaining int64  `json:"time_remaining,omitempty"`
+	ModifiedOn    string `json:"modified_on,omitempty"`
+}
+
+type developmentModeResult struct {
+	Response
+	DevelopmentMode DevelopmentMode `json:"result"`
+}
+
+// ZoneSetting is one of a zone's settings, like ssl or min_tls_version. Value is usually a string like "on" or "off",
+// but some settings have a number or an object instead.
+type ZoneSetting struct {
+	ID         string          `json:"id"`
+	Value      json.RawMessage `json:"value"`
+	Editable   bool            `json:"editable"`
+	ModifiedOn string          `json:"modified_on,omitempty"`
+}
+
+type zoneSettingsResult struct {
+	Response
+	Settings []ZoneSetting `json:"result"`
+}
+
+// ZoneHold is a zone's hold, which stops it from being added to another Cloudflare account. If the hold has been
+// turned off for a while, HoldAfter is when it comes back on.
+type ZoneHold struct {
+	Hold              bool   `json:"hold"`
+	IncludeSubdomains bool   `json:"include_subdomains"`
+	HoldAfter         string `json:"hold_after,omitempty"`
+}
+
+// DNSSEC is a zone's DNSSEC setup. Status is "active", "pending", "disabled", "pending-disabled", or "error".
+type DNSSEC struct {
+	Status     string `json:"status"`
+	Algorithm  string `json:"algorithm,omitempty"`
+	DS         string `json:"ds,omitempty"`
+	ModifiedOn string `json:"modified_on,omitempty"`
+}
+
+type dnssecResult struct {
+	Response
+	DNSSEC DNSSEC `json:"result"`
+}
+
+type zoneHoldResult struct {
+	Response
+	Hold ZoneHold `json:"result"`
+}
+
+type pageRulesResult struct {
+	Response
+	PageRules []PageRule `json:"result"`
+}
+
+type pageRuleResult struct {
+	Response
+	PageRule PageRule `json:"result"`
+}
+
+// Account is a Cloudflare account.
+type Account struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type,omitempty"`
+	CreatedOn string `json:"created_on,omitempty"`
+}
+
+type accountsResult struct {
+	Response
+	Accounts []Account `json:"result"`
+}
+
+type rawResult struct {
+	Response
+	Result json.RawMessage `json:"result"`
+}
+
+type zonesResult struct {
+	Response
+	Zones []Zone `json:"result"`
+}
+
+type zoneResult struct {
+	Response
+	Zone Zone `json:"result"`
+}
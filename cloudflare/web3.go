@@ -0,0 +1,37 @@
+package cloudflare
+
+import (
+	"context"
+	"net/url"
+)
+
+// Web3Hostname is a hostname that serves content from an IPFS or Ethereum gateway.
+type Web3Hostname struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Target      string `json:"target"`
+	DNSLink     string `json:"dnslink,omitempty"`
+	Status      string `json:"status"`
+	CreatedOn   string `json:"created_on,omitempty"`
+	ModifiedOn  string `json:"modified_on,omitempty"`
+}
+
+type web3HostnamesResult struct {
+	Response
+	Hostnames []Web3Hostname `json:"result"`
+}
+
+// ListWeb3Hostnames returns the Web3 gateway hostnames of the given zone.
+func (c *Client) ListWeb3Hostnames(ctx context.Context, zoneID string) ([]Web3Hostname, error) {
+	result := web3HostnamesResult{}
+	err := c.Get(ctx, "zones/"+zoneID+"/web3/hostnames", url.Values{}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Hostnames == nil {
+		return []Web3Hostname{}, nil
+	}
+	return result.Hostnames, nil
+}
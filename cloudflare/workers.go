@@ -0,0 +1,137 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// WorkersDomain is a custom domain that routes requests to a Workers service.
+type WorkersDomain struct {
+	ID          string `json:"id"`
+	Hostname    string `json:"hostname"`
+	Service     string `json:"service"`
+	Environment string `json:"environment"`
+	ZoneID      string `json:"zone_id"`
+	ZoneName    string `json:"zone_name"`
+}
+
+type workersDomainsResult struct {
+	Response
+	Domains []WorkersDomain `json:"result"`
+}
+
+// ListWorkersServices returns the account's Workers services, as they were returned by the API.
+func (c *Client) ListWorkersServices(ctx context.Context, accountID string) ([]json.RawMessage, error) {
+	return c.listRaw(ctx, "accounts/"+accountID+"/workers/services", url.Values{}, 0)
+}
+
+// GetWorkersService returns a Workers service with all of its environments, as it was returned by the API.
+func (c *Client) GetWorkersService(ctx context.Context, accountID string, serviceName string) (json.RawMessage, error) {
+	return c.GetResult(ctx, "accounts/"+accountID+"/workers/services/"+url.PathEscape(serviceName), url.Values{})
+}
+
+// ListWorkersDeployments returns the deployments of a Workers script, newest first, as they were returned by the API.
+func (c *Client) ListWorkersDeployments(ctx context.Context, accountID string, scriptName string) ([]json.RawMessage, error) {
+	path := "accounts/" + accountID + "/workers/scripts/" + url.PathEscape(scriptName) + "/deployments"
+	result, err := c.GetResult(ctx, path, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	deployments := struct {
+		Deployments []json.RawMessage `json:"deployments"`
+	}{}
+	err = json.Unmarshal(result, &deployments)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if deployments.Deployments == nil {
+		return []json.RawMessage{}, nil
+	}
+	return deployments.Deployments, nil
+}
+
+// ListWorkersDomains returns the custom domains of every Workers service in the account.
+func (c *Client) ListWorkersDomains(ctx context.Context, accountID string) ([]WorkersDomain, error) {
+	result := workersDomainsResult{}
+	err := c.Get(ctx, "accounts/"+accountID+"/workers/domains", url.Values{}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Domains == nil {
+		return []WorkersDomain{}, nil
+	}
+	return result.Domains, nil
+}
+
+// WorkersSchedule is a cron trigger of a Workers script.
+type WorkersSchedule struct {
+	Cron       string `json:"cron"`
+	CreatedOn  string `json:"created_on,omitempty"`
+	ModifiedOn string `json:"modified_on,omitempty"`
+}
+
+// ListWorkersSchedules returns the cron triggers of a Workers script, sorted by their cron expression.
+func (c *Client) ListWorkersSchedules(ctx context.Context, accountID string, scriptName string) ([]WorkersSchedule, error) {
+	path := "accounts/" + accountID + "/workers/scripts/" + url.PathEscape(scriptName) + "/schedules"
+	result, err := c.GetResult(ctx, path, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := struct {
+		Schedules []WorkersSchedule `json:"schedules"`
+	}{}
+	err = json.Unmarshal(result, &schedules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if schedules.Schedules == nil {
+		return []WorkersSchedule{}, nil
+	}
+	sort.SliceStable(schedules.Schedules, func(i, j int) bool {
+		return schedules.Schedules[i].Cron < schedules.Schedules[j].Cron
+	})
+	return schedules.Schedules, nil
+}
+
+// WorkersBinding is a binding of a Workers script, like a KV namespace or a secret. Only its name and type are kept,
+// since the rest can hold the binding's value, and the API never returns the values of secrets anyway.
+type WorkersBinding struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ListWorkersBindings returns the bindings of a Workers script, from its settings, sorted by name.
+func (c *Client) ListWorkersBindings(ctx context.Context, accountID string, scriptName string) ([]WorkersBinding, error) {
+	path := "accounts/" + accountID + "/workers/scripts/" + url.PathEscape(scriptName) + "/settings"
+	result, err := c.GetResult(ctx, path, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	settings := struct {
+		Bindings []WorkersBinding `json:"bindings"`
+	}{}
+	err = json.Unmarshal(result, &settings)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if settings.Bindings == nil {
+		return []WorkersBinding{}, nil
+	}
+	sort.SliceStable(settings.Bindings, func(i, j int) bool {
+		if settings.Bindings[i].Name != settings.Bindings[j].Name {
+			return settings.Bindings[i].Name < settings.Bindings[j].Name
+		}
+		return settings.Bindings[i].Type < settings.Bindings[j].Type
+	})
+	return settings.Bindings, nil
+}
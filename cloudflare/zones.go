@@ -0,0 +1,372 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/url"
+	"strconv"
+)
+
+// ListZones returns every zone that the client's token can access.
+func (c *Client) ListZones(ctx context.Context) ([]Zone, error) {
+	zones := []Zone{}
+	err := c.ForEachZone(ctx, func(zone Zone) error {
+		zones = append(zones, zone)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+// ForEachZone calls handle for each zone that the client's token can access, a page at a time. If handle returns an
+// error, it stops and returns that error.
+func (c *Client) ForEachZone(ctx context.Context, handle func(zone Zone) error) error {
+	return c.paginate(ctx, url.Values{
+		"per_page": []string{c.perPage(50)},
+	}, func(params url.Values) (ResultInfo, error) {
+		result := zonesResult{}
+		err := c.Get(ctx, "zones", params, &result)
+		if err != nil {
+			return ResultInfo{}, err
+		}
+		for _, zone := range result.Zones {
+			err = handle(zone)
+			if err != nil {
+				return ResultInfo{}, err
+			}
+		}
+		return result.ResultInfo, nil
+	})
+}
+
+// FindZones returns the zones with exactly the given name that the client's token can access. There's normally at most
+// one, but the same name can be added to more than one account.
+func (c *Client) FindZones(ctx context.Context, name string) ([]Zone, error) {
+	result := zonesResult{}
+	err := c.Get(ctx, "zones", url.Values{"name": []string{name}, "per_page": []string{c.perPage(50)}}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Zones, nil
+}
+
+// GetZone returns the zone with the given ID. Unlike ListZones, it only needs access to that zone.
+func (c *Client) GetZone(ctx context.Context, zoneID string) (Zone, error) {
+	result := zoneResult{}
+	err := c.Get(ctx, "zones/"+zoneID, url.Values{}, &result)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	return result.Zone, nil
+}
+
+// GetZoneHold returns the given zone's hold.
+func (c *Client) GetZoneHold(ctx context.Context, zoneID string) (ZoneHold, error) {
+	result := zoneHoldResult{}
+	err := c.Get(ctx, "zones/"+zoneID+"/hold", url.Values{}, &result)
+	if err != nil {
+		return ZoneHold{}, err
+	}
+
+	return result.Hold, nil
+}
+
+// GetDevelopmentMode returns the given zone's development mode setting.
+func (c *Client) GetDevelopmentMode(ctx context.Context, zoneID string) (DevelopmentMode, error) {
+	result := developmentModeResult{}
+	err := c.Get(ctx, "zones/"+zoneID+"/settings/development_mode", url.Values{}, &result)
+	if err != nil {
+		return DevelopmentMode{}, err
+	}
+
+	return result.DevelopmentMode, nil
+}
+
+// ListZoneSettings returns all of the given zone's settings. They come back in a single response, rather than in pages.
+func (c *Client) ListZoneSettings(ctx context.Context, zoneID string) ([]ZoneSetting, error) {
+	result := zoneSettingsResult{}
+	err := c.Get(ctx, "zones/"+zoneID+"/settings", url.Values{}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Settings, nil
+}
+
+// ListEmailRoutingDNSRecords returns the DNS records that Email Routing needs the zone to have, like its MX records.
+// They're only the records' types, names, and contents, without IDs.
+func (c *Client) ListEmailRoutingDNSRecords(ctx context.Context, zoneID string) ([]DNSRecord, error) {
+	result, err := c.GetResult(ctx, "zones/"+zoneID+"/email/routing/dns", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+
+	records := []DNSRecord{}
+	if json.Unmarshal(result, &records) == nil {
+		return records, nil
+	}
+	// newer responses wrap the records in an object, along with any problems with them
+	wrapped := struct {
+		Record []DNSRecord `json:"record"`
+	}{}
+	err = json.Unmarshal(result, &wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return wrapped.Record, nil
+}
+
+// GetDNSSEC returns the given zone's DNSSEC setup.
+func (c *Client) GetDNSSEC(ctx context.Context, zoneID string) (DNSSEC, error) {
+	result := dnssecResult{}
+	err := c.Get(ctx, "zones/"+zoneID+"/dnssec", url.Values{}, &result)
+	if err != nil {
+		return DNSSEC{}, err
+	}
+
+	return result.DNSSEC, nil
+}
+
+// SetZoneHold turns on the given zone's hold, optionally covering its subdomains too.
+func (c *Client) SetZoneHold(ctx context.Context, zoneID string, includeSubdomains bool) (ZoneHold, error) {
+	path := "zones/" + zoneID + "/hold"
+	params := url.Values{}
+	params.Set("include_subdomains", strconv.FormatBool(includeSubdomains))
+	response, err := c.send(ctx, "POST", path, params, nil, "")
+	if err != nil {
+		return ZoneHold{}, err
+	}
+
+	result := zoneHoldResult{}
+	_, err = decodeResponse(path, response, &result)
+	if err != nil {
+		return ZoneHold{}, err
+	}
+
+	return result.Hold, nil
+}
+
+// ListDNSRecords returns every DNS record in the given zone.
+func (c *Client) ListDNSRecords(ctx context.Context, zoneID string) ([]DNSRecord, error) {
+	records := []DNSRecord{}
+	err := c.ForEachDNSRecord(ctx, zoneID, func(record DNSRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ForEachDNSRecord calls handle for each DNS record in the given zone, a page at a time, so that no more than a page
+// of them is ever held in memory. Each page is decoded completely before handle sees any of its records, so a page
+// that's cut off partway through is fetched again without handle seeing the same record twice. If handle returns an
+// error, it stops and returns that error.
+func (c *Client) ForEachDNSRecord(ctx context.Context, zoneID string, handle func(record DNSRecord) error) error {
+	page := []DNSRecord{}
+	return c.paginate(ctx, url.Values{
+		"per_page": []string{c.perPage(5000)},
+	}, func(params url.Values) (ResultInfo, error) {
+		page = page[:0]
+		resultInfo, err := c.dnsRecordsPage(ctx, zoneID, params, func(record DNSRecord) error {
+			page = append(page, record)
+			return nil
+		}, func() {
+			page = page[:0]
+		})
+		if err != nil {
+			return ResultInfo{}, err
+		}
+		for _, record := range page {
+			err = handle(record)
+			if err != nil {
+				return ResultInfo{}, err
+			}
+		}
+		return resultInfo, nil
+	})
+}
+
+// EachDNSRecord calls handle for each DNS record in the given zone.
+//
+// Deprecated: use ForEachDNSRecord, which this is the same as.
+func (c *Client) EachDNSRecord(ctx context.Context, zoneID string, handle func(record DNSRecord) error) error {
+	return c.ForEachDNSRecord(ctx, zoneID, handle)
+}
+
+// dnsRecordsPage fetches a page of the zone's DNS records, calling handle for each one. See getEach for restart.
+func (c *Client) dnsRecordsPage(ctx context.Context, zoneID string, params url.Values, handle func(record DNSRecord) error, restart func()) (ResultInfo, error) {
+	path := "zones/" + zoneID + "/dns_records"
+	unknown := map[string]bool{}
+	result, err := c.getEach(ctx, path, params, func(decoder *json.Decoder) error {
+		record := DNSRecord{}
+		err := c.decodeItem(decoder, &record, "result[]", unknown)
+		if err != nil {
+			return err
+		}
+		return handle(record)
+	}, restart)
+	c.reportUnknownFields(path, unknown)
+	return result.ResultInfo, err
+}
+
+// ListPageRules returns the page rules of the given zone, in priority order.
+func (c *Client) ListPageRules(ctx context.Context, zoneID string) ([]PageRule, error) {
+	pageRules := []PageRule{}
+	err := c.ForEachPageRule(ctx, zoneID, func(pageRule PageRule) error {
+		pageRules = append(pageRules, pageRule)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pageRules, nil
+}
+
+// ForEachPageRule calls handle for each page rule of the given zone, in priority order. The API returns them all at
+// once, rather than in pages. If handle returns an error, it stops and returns that error.
+func (c *Client) ForEachPageRule(ctx context.Context, zoneID string, handle func(pageRule PageRule) error) error {
+	result := pageRulesResult{}
+	err := c.Get(ctx, "zones/"+zoneID+"/pagerules", url.Values{
+		"order": []string{"priority"},
+	}, &result)
+	if err != nil {
+		return err
+	}
+
+	for _, pageRule := range result.PageRules {
+		err = handle(pageRule)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPageRuleSettings returns the list of actions that the given zone's page rules can use.
+func (c *Client) GetPageRuleSettings(ctx context.Context, zoneID string) (json.RawMessage, error) {
+	return c.GetResult(ctx, "zones/"+zoneID+"/pagerules/settings", url.Values{})
+}
+
+// CreatePageRule creates a page rule in the given zone, with the rule's targets, actions, priority, and status, and
+// returns the new rule.
+func (c *Client) CreatePageRule(ctx context.Context, zoneID string, rule PageRule) (PageRule, error) {
+	body, err := json.Marshal(struct {
+		Targets  []PageRuleTarget `json:"targets"`
+		Actions  []PageRuleAction `json:"actions"`
+		Priority int              `json:"priority"`
+		Status   string           `json:"status"`
+	}{rule.Targets, rule.Actions, rule.Priority, rule.Status})
+	if err != nil {
+		return PageRule{}, err
+	}
+
+	result := pageRuleResult{}
+	err = c.Post(ctx, "zones/"+zoneID+"/pagerules", body, "application/json", &result)
+	if err != nil {
+		return PageRule{}, err
+	}
+
+	return result.PageRule, nil
+}
+
+// ExportDNSRecords returns the zone's DNS records as a BIND zone file, exactly as Cloudflare generated it.
+func (c *Client) ExportDNSRecords(ctx context.Context, zoneID string) ([]byte, error) {
+	export, _, err := c.GetRaw(ctx, "zones/"+zoneID+"/dns_records/export", url.Values{})
+	return export, err
+}
+
+type dnsRecordResult struct {
+	Response
+	Record DNSRecord `json:"result"`
+}
+
+// DNSImportResult is the outcome of ImportDNSRecords.
+type DNSImportResult struct {
+	RecordsAdded       int `json:"recs_added"`
+	TotalRecordsParsed int `json:"total_records_parsed"`
+}
+
+type dnsImportResult struct {
+	Response
+	Result DNSImportResult `json:"result"`
+}
+
+// CreateDNSRecord adds a record to the given zone, and returns it as it was created. The record's ID, Proxiable, and
+// Locked fields are ignored.
+func (c *Client) CreateDNSRecord(ctx context.Context, zoneID string, record DNSRecord) (DNSRecord, error) {
+	body, err := json.Marshal(record.Body())
+	if err != nil {
+		return DNSRecord{}, err
+	}
+
+	result := dnsRecordResult{}
+	err = c.Post(ctx, "zones/"+zoneID+"/dns_records", body, "application/json", &result)
+	if err != nil {
+		return DNSRecord{}, err
+	}
+
+	return result.Record, nil
+}
+
+type dnsRecordBatchResult struct {
+	Response
+	Result struct {
+		Posts []DNSRecord `json:"posts"`
+	} `json:"result"`
+}
+
+// BatchCreateDNSRecords adds several records to the given zone in a single request, and returns them as they were
+// created, in the same order. The batch is applied as a whole, so either every record is created or none of them are.
+func (c *Client) BatchCreateDNSRecords(ctx context.Context, zoneID string, records []DNSRecord) ([]DNSRecord, error) {
+	posts := []DNSRecordBody{}
+	for _, record := range records {
+		posts = append(posts, record.Body())
+	}
+	body, err := json.Marshal(map[string]interface{}{"posts": posts})
+	if err != nil {
+		return nil, err
+	}
+
+	result := dnsRecordBatchResult{}
+	err = c.Post(ctx, "zones/"+zoneID+"/dns_records/batch", body, "application/json", &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Result.Posts, nil
+}
+
+// ImportDNSRecords uploads a BIND zone file to the given zone, and lets Cloudflare add the records in it.
+func (c *Client) ImportDNSRecords(ctx context.Context, zoneID string, zoneFile []byte, proxied bool) (DNSImportResult, error) {
+	body := bytes.Buffer{}
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "import.zone")
+	if err != nil {
+		return DNSImportResult{}, err
+	}
+	file.Write(zoneFile)
+	form.WriteField("proxied", strconv.FormatBool(proxied))
+	err = form.Close()
+	if err != nil {
+		return DNSImportResult{}, err
+	}
+
+	result := dnsImportResult{}
+	err = c.Post(ctx, "zones/"+zoneID+"/dns_records/import", body.Bytes(), form.FormDataContentType(), &result)
+	if err != nil {
+		return DNSImportResult{}, err
+	}
+
+	return result.Result, nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// Section is one part of a zone's backup, produced by a Collector.
+type Section struct {
+	// Name identifies the section. It's the name of the collector that produced it.
+	Name string
+
+	// Title is a human-readable name for the section, like "Page rules".
+	Title string
+
+	// Data holds the section's contents. It must be serializable as JSON.
+	Data interface{}
+
+	// Summary holds human-readable lines describing the section, for formats that show them.
+	Summary []string
+
+	// Files holds extra files for the section that don't fit in its data, like the source code of a snippet. They're
+	// written as is, in a directory named after the section inside the zone's directory. The keys are paths relative to
+	// that directory, using forward slashes.
+	Files map[string][]byte
+}
+
+// ItemCount returns the number of items in the section, or 1 if its data isn't a list. For streamed DNS records, it's
+// the number written so far.
+func (s Section) ItemCount() int {
+	stream, isStream := s.Data.(*recordStream)
+	if isStream {
+		return stream.written
+	}
+	return len(s.Items())
+}
+
+// Items returns the items in the section, or a single item with all of its data if it isn't a list. Raw JSON is
+// treated as a list if it holds an array.
+func (s Section) Items() []interface{} {
+	raw, isRaw := s.Data.(json.RawMessage)
+	if isRaw {
+		elements := []json.RawMessage{}
+		if json.Unmarshal(raw, &elements) != nil {
+			return []interface{}{raw}
+		}
+
+		items := []interface{}{}
+		for _, element := range elements {
+			items = append(items, element)
+		}
+		return items
+	}
+
+	value := reflect.ValueOf(s.Data)
+	if value.Kind() != reflect.Slice {
+		return []interface{}{s.Data}
+	}
+
+	items := []interface{}{}
+	for i := 0; i < value.Len(); i++ {
+		items = append(items, value.Index(i).Interface())
+	}
+	return items
+}
+
+// Collector fetches one kind of resource from a zone.
+type Collector interface {
+	// Name returns the name used to select the collector with the -resources flag.
+	Name() string
+
+	// Collect fetches the resources from the given zone.
+	Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error)
+
+	// Permissions returns the permissions that the API token needs for the collector, for the token-scopes
+	// subcommand. The ones that every backup needs, like Zone Read, don't have to be listed.
+	Permissions() []tokenPermission
+}
+
+// optionalResources tracks the parts of a collector's section that aren't available for a zone, such as features that
+// its plan doesn't include. They're recorded in the section instead of failing the whole collector.
+type optionalResources struct {
+	// Unavailable holds the reason each unavailable resource couldn't be fetched, keyed by a name for the resource.
+	// The reasons don't change between runs, so they don't show up as changes.
+	Unavailable map[string]string
+
+	attempts int
+	denied   error
+	deniedN  int
+}
+
+func newOptionalResources() *optionalResources {
+	return &optionalResources{
+		Unavailable: map[string]string{},
+	}
+}
+
+// check records the result of fetching a resource. It returns false if the resource wasn't available, and an error if
+// fetching it failed in a way that should fail the collector.
+func (o *optionalResources) check(name string, err error) (bool, error) {
+	o.attempts++
+	if err == nil {
+		return true, nil
+	}
+	if !cloudflare.IsClientError(err) {
+		return false, err
+	}
+
+	if cloudflare.IsPermissionError(err) {
+		o.deniedN++
+		if o.denied == nil {
+			o.denied = err
+		}
+	}
+
+	apiError := &cloudflare.APIError{}
+	errors.As(err, &apiError)
+	o.Unavailable[name] = "not available: " + apiError.Reason()
+	return false, nil
+}
+
+// allDenied returns a permission error if every resource was denied, meaning that the token can't read any of them.
+func (o *optionalResources) allDenied() error {
+	if o.attempts > 0 && o.deniedN == o.attempts {
+		return o.denied
+	}
+	return nil
+}
+
+// AccountCollector fetches one kind of resource from an account, rather than a zone. Account collectors are only run
+// when they're selected with -resources, or with -include-account-resources.
+type AccountCollector interface {
+	// Name returns the name used to select the collector with the -resources flag.
+	Name() string
+
+	// CollectAccount fetches the resources from the given account.
+	CollectAccount(ctx context.Context, client *cloudflare.Client, account cloudflare.Account) (Section, error)
+
+	// Permissions is the same as for Collector.
+	Permissions() []tokenPermission
+}
+
+// singleAccountCollector is implemented by account collectors that make many requests per account, like ones that
+// fetch every Pages project. They're only run for the account given with -account-id, rather than for every account.
+type singleAccountCollector interface {
+	singleAccount()
+}
+
+// configurableAccountCollector is implemented by account collectors with settings of their own. withOptions returns a
+// copy of the collector that uses the settings from the given options.
+type configurableAccountCollector interface {
+	withOptions(opts *options) AccountCollector
+}
+
+// configurableCollector is the same as configurableAccountCollector, for zone collectors.
+type configurableCollector interface {
+	withOptions(opts *options) Collector
+}
+
+// permissionCollector is implemented by collectors that know which zone permission they need, as listed in the
+// zone's permissions field. It's used by -dry-run to find problems without making any requests for the resources.
+type permissionCollector interface {
+	RequiredPermission() string
+}
+
+// zoneTypeCollector is implemented by collectors that only apply to some kinds of zones, like ones that don't work
+// for partial (CNAME setup) zones. Collectors that don't implement it are run for every zone.
+type zoneTypeCollector interface {
+	AppliesTo(zone cloudflare.Zone) bool
+}
+
+// secretCollector is implemented by zone and account collectors whose sections can hold secrets, like API keys.
+// Unless -include-secrets is set, the values picked out by SecretRules are redacted before the section is written.
+type secretCollector interface {
+	SecretRules() []redactionRule
+}
+
+// isPartialZone returns true if the zone uses a partial (CNAME) setup, where its DNS is hosted somewhere else.
+func isPartialZone(zone cloudflare.Zone) bool {
+	return zone.Type == "partial"
+}
+
+type registeredCollector struct {
+	collector        Collector
+	enabledByDefault bool
+}
+
+// collectors holds every registered collector, in the order that their sections appear in the output.
+var collectors = []registeredCollector{}
+
+type registeredAccountCollector struct {
+	collector         AccountCollector
+	includedByDefault bool
+}
+
+// accountCollectors holds every registered account collector, in the order that they're run.
+var accountCollectors = []registeredAccountCollector{}
+
+// checkCollectorName panics if a collector with the given name was already registered.
+func checkCollectorName(name string) {
+	for _, existing := range collectorNames() {
+		if existing == name {
+			panic("collector " + name + " registered twice")
+		}
+	}
+}
+
+// registerCollector adds a collector to the registry. Collectors that aren't enabled by default must be requested
+// with the -resources flag.
+func registerCollector(collector Collector, enabledByDefault bool) {
+	checkCollectorName(collector.Name())
+
+	collectors = append(collectors, registeredCollector{
+		collector:        collector,
+		enabledByDefault: enabledByDefault,
+	})
+}
+
+// registerAccountCollector adds an account collector to the registry. If includedByDefault is set, the collector is
+// selected by -include-account-resources.
+func registerAccountCollector(collector AccountCollector, includedByDefault bool) {
+	checkCollectorName(collector.Name())
+	accountCollectors = append(accountCollectors, registeredAccountCollector{
+		collector:         collector,
+		includedByDefault: includedByDefault,
+	})
+}
+
+// collectorNames returns the names of every registered collector, including account collectors, sorted
+// alphabetically.
+func collectorNames() []string {
+	names := []string{}
+	for _, registered := range collectors {
+		names = append(names, registered.collector.Name())
+	}
+	for _, registered := range accountCollectors {
+		names = append(names, registered.collector.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultResources returns the value of the -resources flag that selects the default collectors.
+func defaultResources() string {
+	names := []string{}
+	for _, registered := range collectors {
+		if registered.enabledByDefault {
+			names = append(names, registered.collector.Name())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// selectCollectors parses a comma-separated list of collector names, as given to the -resources flag. The special
+// name "all" selects every collector, and includeAccount selects the account collectors that are included by default.
+// Collectors that need a single account are only selected if accountID is set. The collectors are returned in
+// registration order.
+func selectCollectors(resources string, includeAccount bool, accountID string) ([]Collector, []AccountCollector, error) {
+	requested := map[string]bool{}
+	for _, name := range strings.Split(resources, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		requested[name] = true
+	}
+
+	selected := []Collector{}
+	for _, registered := range collectors {
+		name := registered.collector.Name()
+		if requested[name] || requested["all"] {
+			selected = append(selected, registered.collector)
+			delete(requested, name)
+		}
+	}
+
+	selectedAccount := []AccountCollector{}
+	for _, registered := range accountCollectors {
+		collector := registered.collector
+		name := collector.Name()
+		_, single := collector.(singleAccountCollector)
+		if requested[name] && single && accountID == "" {
+			return nil, nil, fmt.Errorf("The %s resource can only be backed up from a single account, given with the -account-id flag.", name)
+		}
+
+		included := requested["all"] || (includeAccount && registered.includedByDefault)
+		if requested[name] || (included && (!single || accountID != "")) {
+			selectedAccount = append(selectedAccount, collector)
+		}
+		delete(requested, name)
+	}
+	delete(requested, "all")
+
+	for name := range requested {
+		return nil, nil, fmt.Errorf("Unknown resource %q. The available resources are: %s.", name, strings.Join(collectorNames(), ", "))
+	}
+	if len(selected) == 0 && len(selectedAccount) == 0 {
+		return nil, nil, fmt.Errorf("You must select at least one resource with the -resources flag.")
+	}
+
+	return selected, selectedAccount, nil
+}
+
+// hasCollector returns true if the collector with the given name is one of the selected ones.
+func hasCollector(selected []Collector, name string) bool {
+	for _, collector := range selected {
+		if collector.Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	// this is how a collector from outside the built-in ones is added, so the tests check that it's enough
+	registerCollector(widgetsCollector{}, false)
+}
+
+// widgetsCollector fetches a made-up zone resource from zones/<id>/widgets, which the fake API only has when a test
+// adds it.
+type widgetsCollector struct{}
+
+func (widgetsCollector) Name() string {
+	return "widgets"
+}
+
+func (widgetsCollector) Permissions() []tokenPermission {
+	return []tokenPermission{{"Zone / Widgets / Read", "Widgets Read", false}}
+}
+
+func (widgetsCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	widgets, err := client.GetResult(ctx, "zones/"+zone.ID+"/widgets", nil)
+	if err != nil {
+		return Section{}, err
+	}
+
+	return Section{
+		Name:    "widgets",
+		Title:   "Widgets",
+		Data:    widgets,
+		Summary: []string{"The zone's widgets."},
+	}, nil
+}
+
+func TestRegisteredCollector(t *testing.T) {
+	api := newFakeAPI(t, "empty")
+	api.handle("zones/*/widgets", func(w http.ResponseWriter, r *http.Request) {
+		writeFakeResult(w, []map[string]string{{"id": "w1", "color": "blue"}, {"id": "w2", "color": "green"}})
+	})
+	dir := runTestBackup(t, api, "-resources", "dns,widgets", "-format", "json")
+
+	backup := struct {
+		Sections map[string]json.RawMessage `json:"sections"`
+	}{}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "empty.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(data, &backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	widgets := []map[string]string{}
+	err = json.Unmarshal(backup.Sections["widgets"], &widgets)
+	if err != nil || len(widgets) != 2 || widgets[1]["color"] != "green" {
+		t.Errorf("widgets section is %s", backup.Sections["widgets"])
+	}
+
+	manifest, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(manifest.Zones[0].Collectors, ","); got != "dns,widgets" {
+		t.Errorf("manifest lists collectors %s, want dns,widgets", got)
+	}
+}
+
+func TestRegisteredCollectorPermissionSkip(t *testing.T) {
+	// the fake API answers zones/<id>/widgets with a permission error, so the collector is skipped rather than failing
+	// the zone
+	api := newFakeAPI(t, "empty")
+	run := newTestBackup(t, api, "-resources", "dns,widgets")
+	report := run.run(context.Background())
+	if report.Failed() {
+		t.Fatalf("backup failed: %s", strings.Join(report.Errors, "; "))
+	}
+
+	manifest, err := readManifest(run.options.OutputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(manifest.Zones[0].SkippedCollectors, ","); got != "widgets" {
+		t.Errorf("manifest lists skipped collectors %q, want widgets", got)
+	}
+	if len(report.MissingResources) != 1 || report.MissingResources[0].Resource != "widgets" {
+		t.Errorf("report lists missing resources %+v", report.MissingResources)
+	}
+}
+
+func TestSelectCollectorsIncludesRegistered(t *testing.T) {
+	selected, _, err := selectCollectors("all", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasCollector(selected, "widgets") {
+		t.Error("-resources all doesn't include the registered collector")
+	}
+
+	selected, _, err = selectCollectors(defaultResources(), false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasCollector(selected, "widgets") {
+		t.Error("the registered collector isn't enabled by default, but was selected")
+	}
+}
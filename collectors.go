@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(dnsCollector{}, true)
+	registerCollector(pageRulesCollector{}, true)
+}
+
+// dnsCollector fetches a zone's DNS records.
+type dnsCollector struct{}
+
+func (dnsCollector) Name() string {
+	return "dns"
+}
+
+func (dnsCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionDNS, permissionEmailRouting}
+}
+
+func (dnsCollector) RequiredPermission() string {
+	return "#dns_records:read"
+}
+
+func (dnsCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	managed, err := fetchManagedRecords(ctx, client, zone)
+	if err != nil {
+		return Section{}, err
+	}
+
+	records := []cloudflare.DNSRecord{}
+	err = client.ForEachDNSRecord(ctx, zone.ID, func(record cloudflare.DNSRecord) error {
+		managed.tag(&record)
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return Section{}, err
+	}
+
+	return Section{
+		Name:  "dns",
+		Title: "DNS records",
+		Data:  records,
+	}, nil
+}
+
+// recordStream is the data of a DNS section with -stream-records. Instead of being fetched by the collector, the
+// records are fetched while the section is written, and handed to the writer a page at a time, so a zone's records
+// are never all in memory at once. Because of that, it can only be written once.
+type recordStream struct {
+	fetch func(handle func(record cloudflare.DNSRecord) error) error
+	used  bool
+
+	// fetched counts the records received from the API, and written counts the ones that got through the record
+	// filter. They're only complete once the section has been written.
+	fetched int
+	written int
+}
+
+// streamDNSRecords returns a DNS section for the zone whose records are fetched as it's written. Records that don't
+// match the filter are dropped as they arrive.
+func streamDNSRecords(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone, filter recordFilter) Section {
+	stream := &recordStream{}
+	stream.fetch = func(handle func(record cloudflare.DNSRecord) error) error {
+		managed, err := fetchManagedRecords(ctx, client, zone)
+		if err != nil {
+			return err
+		}
+
+		return client.ForEachDNSRecord(ctx, zone.ID, func(record cloudflare.DNSRecord) error {
+			managed.tag(&record)
+			stream.fetched++
+			if filter.active() && !filter.matches(record) {
+				return nil
+			}
+			stream.written++
+			return handle(record)
+		})
+	}
+
+	return Section{
+		Name:  "dns",
+		Title: "DNS records",
+		Data:  stream,
+	}
+}
+
+// each fetches the records, and calls handle for each of them.
+func (s *recordStream) each(handle func(record cloudflare.DNSRecord) error) error {
+	if s.used {
+		return errors.New("the DNS records were already written, and can't be streamed twice")
+	}
+	s.used = true
+	return s.fetch(handle)
+}
+
+// eachRecord returns a function like recordStream.each for records that are already in memory.
+func eachRecord(records []cloudflare.DNSRecord) func(handle func(record cloudflare.DNSRecord) error) error {
+	return func(handle func(record cloudflare.DNSRecord) error) error {
+		for _, record := range records {
+			err := handle(record)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// pageRulesCollector fetches a zone's page rules.
+type pageRulesCollector struct{}
+
+func (pageRulesCollector) Name() string {
+	return "pagerules"
+}
+
+func (pageRulesCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionPageRules}
+}
+
+func (pageRulesCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	pageRules := []cloudflare.PageRule{}
+	err := client.ForEachPageRule(ctx, zone.ID, func(pageRule cloudflare.PageRule) error {
+		pageRules = append(pageRules, pageRule)
+		return nil
+	})
+	if err != nil {
+		return Section{}, err
+	}
+	sortPageRules(pageRules)
+
+	// page rules are being replaced by Rulesets, so the backup suggests what to move each of them to
+	files := map[string][]byte{}
+	if len(pageRules) > 0 {
+		err = addJSONFile(files, migrationFileName, migratePageRules(zone, pageRules))
+		if err != nil {
+			return Section{}, err
+		}
+	}
+
+	return Section{
+		Name:    "pagerules",
+		Title:   "Page rules",
+		Data:    pageRules,
+		Summary: pageRulesSummary(zone, pageRules),
+		Files:   files,
+	}, nil
+}
+
+// sortPageRules puts page rules in the order that they're applied, which is the highest priority first, with the ID
+// breaking ties, so that the order is the same in every backup.
+func sortPageRules(pageRules []cloudflare.PageRule) {
+	sort.SliceStable(pageRules, func(i, j int) bool {
+		if pageRules[i].Priority != pageRules[j].Priority {
+			return pageRules[i].Priority > pageRules[j].Priority
+		}
+		return pageRules[i].ID < pageRules[j].ID
+	})
+}
+
+// pageRulesSummary says how many of the zone's page rules are used, then lists the rules in order, with whether each
+// one is disabled up front.
+func pageRulesSummary(zone cloudflare.Zone, pageRules []cloudflare.PageRule) []string {
+	summary := []string{}
+	if zone.PageRuleEntitlements != nil && zone.PageRuleEntitlements.MaxRules > 0 {
+		summary = append(summary, fmt.Sprintf("%d of the zone's %d page rules are used.", len(pageRules), zone.PageRuleEntitlements.MaxRules))
+	}
+
+	for i, pageRule := range pageRules {
+		targets := []string{}
+		for _, target := range pageRule.Targets {
+			targets = append(targets, target.Constraint.Value)
+		}
+		actions := []string{}
+		for _, action := range pageRule.Actions {
+			actions = append(actions, describePageRuleAction(action))
+		}
+		summary = append(summary, fmt.Sprintf(
+			"%d. %s (priority %d): %s -> %s",
+			i+1, strings.ToUpper(pageRule.Status), pageRule.Priority, strings.Join(targets, ", "), strings.Join(actions, ", "),
+		))
+	}
+	return summary
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(apiShieldCollector{}, false)
+}
+
+// apiSchemaBackup is a schema in the section written by apiShieldCollector. File is where its source was saved,
+// relative to the zone's directory.
+type apiSchemaBackup struct {
+	cloudflare.APISchema
+	File string `json:"file"`
+}
+
+// apiShieldCollector fetches the zone's API Shield schemas, operations, and schema validation settings. Each schema's
+// source is saved as its own file, so that it can be uploaded again as is.
+type apiShieldCollector struct{}
+
+func (apiShieldCollector) Name() string {
+	return "api_shield"
+}
+
+func (apiShieldCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionAPIGateway}
+}
+
+func (apiShieldCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	schemas, err := client.ListAPISchemas(ctx, zone.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	ids := []string{}
+	names := []string{}
+	for _, schema := range schemas {
+		ids = append(ids, schema.ID)
+		// schemas are often named after the file they were uploaded from, which would double up the extension
+		name := schema.Name
+		for _, extension := range []string{".json", ".yaml", ".yml"} {
+			name = strings.TrimSuffix(name, extension)
+		}
+		names = append(names, name)
+	}
+	fileNames := uniqueFileNames(ids, names)
+
+	backups := []apiSchemaBackup{}
+	files := map[string][]byte{}
+	for _, schema := range schemas {
+		schema, err = client.GetAPISchema(ctx, zone.ID, schema.ID)
+		if err != nil {
+			return Section{}, err
+		}
+
+		fileName := fileNames[schema.ID] + schemaExtension(schema.Source)
+		files[fileName] = []byte(schema.Source)
+
+		// the source is in its own file, so there's no need to keep a second copy
+		schema.Source = ""
+		backups = append(backups, apiSchemaBackup{APISchema: schema, File: "api_shield/" + fileName})
+	}
+
+	operations, err := client.ListAPIOperations(ctx, zone.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	settings, err := client.GetSchemaValidationSettings(ctx, zone.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	return Section{
+		Name:  "api_shield",
+		Title: "API Shield",
+		Data: struct {
+			Schemas          []apiSchemaBackup `json:"schemas"`
+			Operations       []json.RawMessage `json:"operations"`
+			SchemaValidation json.RawMessage   `json:"schema_validation"`
+		}{backups, operations, settings},
+		Files: files,
+	}, nil
+}
+
+// schemaExtension picks the file extension for a schema's source. OpenAPI schemas can be either JSON or YAML, and
+// JSON ones always start with an object.
+func schemaExtension(source string) string {
+	if strings.HasPrefix(strings.TrimSpace(source), "{") {
+		return ".json"
+	}
+	return ".yaml"
+}
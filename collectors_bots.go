@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(botManagementCollector{}, false)
+}
+
+// botManagementFields are the bot management settings shown in the section's summary, in order. Which of them the
+// API returns depends on whether the zone has Bot Management, Super Bot Fight Mode, or Bot Fight Mode.
+var botManagementFields = []string{
+	"fight_mode",
+	"enable_js",
+	"sbfm_definitely_automated",
+	"sbfm_likely_automated",
+	"sbfm_verified_bots",
+	"sbfm_static_resource_protection",
+	"optimize_wordpress",
+	"ai_bots_protection",
+	"auto_update_model",
+	"suppress_session_score",
+	"using_latest_model",
+}
+
+// botManagementCollector fetches the zone's bot management configuration. The configuration is kept exactly as the
+// API returns it, since its shape depends on the zone's plan.
+type botManagementCollector struct{}
+
+func (botManagementCollector) Name() string {
+	return "bot_management"
+}
+
+func (botManagementCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionBotManagement}
+}
+
+func (botManagementCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	optional := newOptionalResources()
+
+	config, err := client.GetResult(ctx, "zones/"+zone.ID+"/bot_management", url.Values{})
+	ok, err := optional.check("bot_management", err)
+	if err != nil {
+		return Section{}, err
+	}
+	err = optional.allDenied()
+	if err != nil {
+		return Section{}, err
+	}
+
+	section := Section{
+		Name:  "bot_management",
+		Title: "Bot management",
+	}
+	if !ok {
+		section.Data = struct {
+			Unavailable map[string]string `json:"unavailable"`
+		}{optional.Unavailable}
+		section.Summary = []string{"Bot management isn't available on this zone's plan."}
+		return section, nil
+	}
+
+	section.Data = struct {
+		Config json.RawMessage `json:"config"`
+	}{config}
+	section.Summary = botManagementSummary(config)
+	return section, nil
+}
+
+// botManagementSummary describes the configuration using whichever of botManagementFields it has.
+func botManagementSummary(config json.RawMessage) []string {
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(config, &fields) != nil {
+		return nil
+	}
+
+	product := "Bot Fight Mode"
+	if _, ok := fields["using_latest_model"]; ok {
+		product = "Bot Management"
+	} else if _, ok := fields["sbfm_definitely_automated"]; ok {
+		product = "Super Bot Fight Mode"
+	}
+
+	lines := []string{"Product: " + product}
+	for _, name := range botManagementFields {
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+		lines = append(lines, name+": "+displayJSONValue(value))
+	}
+	return lines
+}
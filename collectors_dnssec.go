@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(dnssecCollector{}, false)
+}
+
+// dnssecCollector fetches the zone's DNSSEC setup, including the DS record to give the registrar.
+type dnssecCollector struct{}
+
+func (dnssecCollector) Name() string {
+	return "dnssec"
+}
+
+func (dnssecCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionDNS}
+}
+
+func (dnssecCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	dnssec, err := client.GetDNSSEC(ctx, zone.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	return Section{
+		Name:    "dnssec",
+		Title:   "DNSSEC",
+		Data:    dnssec,
+		Summary: []string{"Status: " + dnssec.Status},
+	}, nil
+}
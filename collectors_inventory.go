@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerAccountCollector(inventoryCollector{}, true)
+}
+
+// inventoryCollector lists the account's storage: its R2 buckets and D1 databases. Only their metadata is saved, never
+// their contents. Each list is saved in a file of its own, and the section itself only has how many of each there are.
+type inventoryCollector struct{}
+
+func (inventoryCollector) Name() string {
+	return "inventory"
+}
+
+func (inventoryCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionR2, permissionD1}
+}
+
+func (inventoryCollector) CollectAccount(ctx context.Context, client *cloudflare.Client, account cloudflare.Account) (Section, error) {
+	optional := newOptionalResources()
+	files := map[string][]byte{}
+	counts := map[string]int{}
+
+	buckets, err := client.ListR2Buckets(ctx, account.ID)
+	ok, err := optional.check("r2_buckets", err)
+	if err != nil {
+		return Section{}, err
+	}
+	if ok {
+		counts["r2_buckets"] = len(buckets)
+		err = addJSONFile(files, "r2-buckets.json", buckets)
+		if err != nil {
+			return Section{}, err
+		}
+	}
+
+	databases, err := client.ListD1Databases(ctx, account.ID)
+	ok, err = optional.check("d1_databases", err)
+	if err != nil {
+		return Section{}, err
+	}
+	if ok {
+		for i, database := range databases {
+			databases[i], err = client.GetD1Database(ctx, account.ID, database.UUID)
+			if err != nil {
+				return Section{}, err
+			}
+		}
+		counts["d1_databases"] = len(databases)
+		err = addJSONFile(files, "d1-databases.json", databases)
+		if err != nil {
+			return Section{}, err
+		}
+	}
+
+	err = optional.allDenied()
+	if err != nil {
+		return Section{}, err
+	}
+
+	return Section{
+		Name:  "inventory",
+		Title: "Storage inventory",
+		Data: struct {
+			Counts      map[string]int    `json:"counts"`
+			Unavailable map[string]string `json:"unavailable,omitempty"`
+		}{counts, optional.Unavailable},
+		Files: files,
+	}, nil
+}
+
+// addJSONFile adds a file with the given data, formatted like the rest of the JSON files in the backup, to a section's
+// files.
+func addJSONFile(files map[string][]byte, name string, data interface{}) error {
+	dataJSON, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	files[name] = append(dataJSON, '\n')
+	return nil
+}
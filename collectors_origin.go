@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(originRulesCollector{}, false)
+}
+
+// originRule is a rule in the zone's origin rules entrypoint, which sends matching requests to a different origin
+// than the DNS record says, or changes the host header or SNI that's sent to it.
+type originRule struct {
+	ID               string                     `json:"id"`
+	Action           string                     `json:"action"`
+	Expression       string                     `json:"expression"`
+	Description      string                     `json:"description,omitempty"`
+	Enabled          bool                       `json:"enabled"`
+	ActionParameters originRuleActionParameters `json:"action_parameters"`
+}
+
+type originRuleActionParameters struct {
+	HostHeader string `json:"host_header,omitempty"`
+	Origin     *struct {
+		Host string `json:"host,omitempty"`
+		Port int    `json:"port,omitempty"`
+	} `json:"origin,omitempty"`
+	SNI *struct {
+		Value string `json:"value,omitempty"`
+	} `json:"sni,omitempty"`
+}
+
+// originRulesCollector fetches the zone's origin rules.
+type originRulesCollector struct{}
+
+func (originRulesCollector) Name() string {
+	return "origin_rules"
+}
+
+func (originRulesCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionOriginRules}
+}
+
+func (originRulesCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	section := Section{
+		Name:  "origin_rules",
+		Title: "Origin rules",
+	}
+
+	entrypoint, err := client.GetResult(ctx, "zones/"+zone.ID+"/rulesets/phases/http_request_origin/entrypoint", url.Values{})
+	apiError := &cloudflare.APIError{}
+	if errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound {
+		// the entrypoint only exists once the zone has had an origin rule
+		section.Data = []originRule{}
+		section.Summary = []string{"No origin rules."}
+		return section, nil
+	}
+	if err != nil {
+		return Section{}, err
+	}
+
+	ruleset := struct {
+		Rules []originRule `json:"rules"`
+	}{}
+	err = json.Unmarshal(entrypoint, &ruleset)
+	if err != nil {
+		return Section{}, err
+	}
+	if ruleset.Rules == nil {
+		ruleset.Rules = []originRule{}
+	}
+
+	enabled := 0
+	for _, rule := range ruleset.Rules {
+		if rule.Enabled {
+			enabled++
+		}
+	}
+	section.Data = ruleset.Rules
+	section.Summary = []string{strconv.Itoa(len(ruleset.Rules)) + " origin rule(s), " + strconv.Itoa(enabled) + " enabled"}
+	return section, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerAccountCollector(pagesCollector{}, false)
+}
+
+// accountItem is an entry in the index of a section that saves each of its items in a file of its own. File is
+// relative to the account's directory.
+type accountItem struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+}
+
+// pagesCollector fetches the account's Pages projects, with their build configuration, environment variables, custom
+// domains, and latest deployments. Each project is saved in a file of its own.
+type pagesCollector struct {
+	deploymentHistory int
+}
+
+func (pagesCollector) Name() string {
+	return "pages"
+}
+
+func (pagesCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionPages}
+}
+
+func (pagesCollector) singleAccount() {}
+
+func (c pagesCollector) withOptions(opts *options) AccountCollector {
+	c.deploymentHistory = opts.DeploymentHistory
+	return c
+}
+
+func (c pagesCollector) CollectAccount(ctx context.Context, client *cloudflare.Client, account cloudflare.Account) (Section, error) {
+	projects, err := client.ListPagesProjects(ctx, account.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	names := []string{}
+	for _, project := range projects {
+		parsed := struct {
+			Name string `json:"name"`
+		}{}
+		err = json.Unmarshal(project, &parsed)
+		if err != nil {
+			return Section{}, err
+		}
+		names = append(names, parsed.Name)
+	}
+	fileNames := uniqueFileNames(names, names)
+
+	index := []accountItem{}
+	files := map[string][]byte{}
+	for i, project := range projects {
+		deployments := []json.RawMessage{}
+		if c.deploymentHistory > 0 {
+			deployments, err = client.ListPagesDeployments(ctx, account.ID, names[i], c.deploymentHistory)
+			if err != nil {
+				return Section{}, err
+			}
+		}
+
+		fileName := fileNames[names[i]] + ".json"
+		err = addJSONFile(files, fileName, struct {
+			Project     json.RawMessage   `json:"project"`
+			Deployments []json.RawMessage `json:"deployments"`
+		}{project, deployments})
+		if err != nil {
+			return Section{}, err
+		}
+		index = append(index, accountItem{Name: names[i], File: "pages/" + fileName})
+	}
+
+	return Section{
+		Name:  "pages",
+		Title: "Pages projects",
+		Data:  index,
+		Files: files,
+	}, nil
+}
+
+// SecretRules picks out the values of the projects' environment variables, leaving their names. Secret variables
+// never have their values returned by the API, but plain text ones do, and they're often secrets anyway.
+func (pagesCollector) SecretRules() []redactionRule {
+	return []redactionRule{
+		{Path: "**.env_vars.*.value"},
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(performanceCollector{}, false)
+}
+
+// performanceSetting is one of the settings fetched by performanceCollector.
+type performanceSetting struct {
+	Key   string
+	Title string
+	Path  string
+}
+
+// performanceSettings lists the caching and routing settings that live outside the zone settings endpoint.
+var performanceSettings = []performanceSetting{
+	{"cache_reserve", "Cache Reserve", "cache/cache_reserve"},
+	{"tiered_caching", "Argo Tiered Caching", "argo/tiered_caching"},
+	{"smart_tiered_cache", "Smart Tiered Cache", "cache/tiered_cache_smart_topology_enable"},
+	{"regional_tiered_cache", "Regional Tiered Cache", "cache/regional_tiered_cache"},
+	{"argo_smart_routing", "Argo Smart Routing", "argo/smart_routing"},
+}
+
+// performanceCollector fetches the zone's Cache Reserve, Tiered Cache, and Argo settings. Most of them need a paid plan
+// or add-on, so a setting that isn't available is recorded as such, rather than failing the collector.
+type performanceCollector struct{}
+
+func (performanceCollector) Name() string {
+	return "performance"
+}
+
+func (performanceCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionCacheSettings, permissionArgo}
+}
+
+func (performanceCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	optional := newOptionalResources()
+	settings := map[string]json.RawMessage{}
+	summary := []string{}
+
+	for _, setting := range performanceSettings {
+		result, err := client.GetResult(ctx, "zones/"+zone.ID+"/"+setting.Path, url.Values{})
+		ok, err := optional.check(setting.Key, err)
+		if err != nil {
+			return Section{}, err
+		}
+		if !ok {
+			summary = append(summary, setting.Title+": not available on this plan")
+			continue
+		}
+
+		settings[setting.Key] = result
+		summary = append(summary, setting.Title+": "+settingValue(result))
+	}
+
+	err := optional.allDenied()
+	if err != nil {
+		return Section{}, err
+	}
+
+	return Section{
+		Name:  "performance",
+		Title: "Performance settings",
+		Data: struct {
+			Settings    map[string]json.RawMessage `json:"settings"`
+			Unavailable map[string]string          `json:"unavailable"`
+		}{settings, optional.Unavailable},
+		Summary: summary,
+	}, nil
+}
+
+// settingValue returns the value field of a setting, like "on", as a string.
+func settingValue(setting json.RawMessage) string {
+	parsed := struct {
+		Value json.RawMessage `json:"value"`
+	}{}
+	if json.Unmarshal(setting, &parsed) != nil || parsed.Value == nil {
+		return "(unknown)"
+	}
+	return displayJSONValue(parsed.Value)
+}
+
+// displayJSONValue formats a JSON value for a summary line. Strings are shown without quotes, and anything else is
+// shown as JSON.
+func displayJSONValue(value json.RawMessage) string {
+	str := ""
+	if json.Unmarshal(value, &str) == nil {
+		return str
+	}
+	return string(value)
+}
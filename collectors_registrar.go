@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(registrarCollector{}, false)
+}
+
+// maxRDAPResponseSize is the most that's read from an RDAP server. Responses are usually a few kilobytes.
+const maxRDAPResponseSize = 1024 * 1024
+
+// rdapSnapshot is what an RDAP lookup says about a domain. It isn't from Cloudflare, so External is always set, and
+// Source is the URL that it came from.
+type rdapSnapshot struct {
+	External     bool     `json:"external"`
+	Source       string   `json:"source"`
+	Registrar    string   `json:"registrar,omitempty"`
+	RegisteredAt string   `json:"registered_at,omitempty"`
+	ExpiresAt    string   `json:"expires_at,omitempty"`
+	Status       []string `json:"status,omitempty"`
+	NameServers  []string `json:"name_servers,omitempty"`
+}
+
+// rdapEntity is a contact in an RDAP response, like the domain's registrar. Its details are in a jCard (RFC 7095).
+type rdapEntity struct {
+	Roles      []string          `json:"roles"`
+	VCardArray []json.RawMessage `json:"vcardArray"`
+	Entities   []rdapEntity      `json:"entities"`
+}
+
+// registrarCollector fetches the zone's domain registration: from Cloudflare Registrar, if the domain is registered
+// there, and optionally from RDAP, which works for any registrar. Either can fail without failing the collector, in
+// which case the reason is recorded as unavailable.
+type registrarCollector struct {
+	rdap       bool
+	rdapServer string
+	client     *http.Client
+	userAgent  string
+}
+
+func (registrarCollector) Name() string {
+	return "registrar"
+}
+
+func (registrarCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionRegistrarDomains}
+}
+
+func (c registrarCollector) withOptions(opts *options) Collector {
+	c.rdap = opts.RDAP
+	c.rdapServer = opts.RDAPServer
+	c.client = &http.Client{Timeout: opts.Timeout}
+	c.userAgent = opts.UserAgent
+	return c
+}
+
+func (c registrarCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	optional := newOptionalResources()
+
+	var domain *cloudflare.RegistrarDomain
+	if zone.Account == nil {
+		optional.Unavailable["cloudflare_registrar"] = "the zone's account isn't known"
+	} else {
+		result, err := client.GetRegistrarDomain(ctx, zone.Account.ID, zone.Name)
+		ok, err := optional.check("cloudflare_registrar", err)
+		if err != nil {
+			return Section{}, err
+		}
+		if ok {
+			domain = &result
+		}
+	}
+	if !c.rdap {
+		// with RDAP, there's still something to back up without the permission
+		err := optional.allDenied()
+		if err != nil {
+			return Section{}, err
+		}
+	}
+
+	var rdap *rdapSnapshot
+	if c.rdap {
+		snapshot, err := c.lookupRDAP(ctx, zone.Name)
+		if err != nil {
+			optional.Unavailable["rdap"] = err.Error()
+		} else {
+			rdap = &snapshot
+		}
+	}
+
+	return Section{
+		Name:  "registrar",
+		Title: "Registrar",
+		Data: struct {
+			CloudflareRegistrar *cloudflare.RegistrarDomain `json:"cloudflare_registrar,omitempty"`
+			RDAP                *rdapSnapshot               `json:"rdap,omitempty"`
+			Unavailable         map[string]string           `json:"unavailable,omitempty"`
+		}{domain, rdap, optional.Unavailable},
+		Summary: registrarSummary(domain, rdap, optional.Unavailable),
+	}, nil
+}
+
+// lookupRDAP asks the RDAP server about the domain.
+func (c registrarCollector) lookupRDAP(ctx context.Context, name string) (rdapSnapshot, error) {
+	source := strings.TrimSuffix(c.rdapServer, "/") + "/domain/" + url.PathEscape(name)
+	request, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+	if err != nil {
+		return rdapSnapshot{}, err
+	}
+	request.Header.Set("Accept", "application/rdap+json")
+	request.Header.Set("User-Agent", c.userAgent)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return rdapSnapshot{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return rdapSnapshot{}, fmt.Errorf("the RDAP server doesn't know about %s", name)
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return rdapSnapshot{}, fmt.Errorf("the RDAP server responded with %s", response.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxRDAPResponseSize))
+	if err != nil {
+		return rdapSnapshot{}, err
+	}
+
+	parsed := struct {
+		Status []string `json:"status"`
+		Events []struct {
+			Action string `json:"eventAction"`
+			Date   string `json:"eventDate"`
+		} `json:"events"`
+		Entities    []rdapEntity `json:"entities"`
+		Nameservers []struct {
+			LDHName string `json:"ldhName"`
+		} `json:"nameservers"`
+	}{}
+	err = json.Unmarshal(body, &parsed)
+	if err != nil {
+		return rdapSnapshot{}, fmt.Errorf("couldn't read the RDAP response: %w", err)
+	}
+
+	snapshot := rdapSnapshot{
+		External:  true,
+		Source:    source,
+		Registrar: rdapRegistrar(parsed.Entities),
+		Status:    parsed.Status,
+	}
+	for _, event := range parsed.Events {
+		switch event.Action {
+		case "registration":
+			snapshot.RegisteredAt = event.Date
+		case "expiration":
+			snapshot.ExpiresAt = event.Date
+		}
+	}
+	for _, nameserver := range parsed.Nameservers {
+		snapshot.NameServers = append(snapshot.NameServers, strings.ToLower(nameserver.LDHName))
+	}
+	return snapshot, nil
+}
+
+// rdapRegistrar returns the name of the entity with the registrar role, from the "fn" property of its jCard.
+func rdapRegistrar(entities []rdapEntity) string {
+	for _, entity := range entities {
+		isRegistrar := false
+		for _, role := range entity.Roles {
+			isRegistrar = isRegistrar || role == "registrar"
+		}
+		if !isRegistrar {
+			if name := rdapRegistrar(entity.Entities); name != "" {
+				return name
+			}
+			continue
+		}
+
+		// a jCard is ["vcard", [[name, parameters, type, value], ...]]
+		if len(entity.VCardArray) != 2 {
+			continue
+		}
+		properties := [][]json.RawMessage{}
+		if json.Unmarshal(entity.VCardArray[1], &properties) != nil {
+			continue
+		}
+		for _, property := range properties {
+			propertyName := ""
+			value := ""
+			if len(property) == 4 && json.Unmarshal(property[0], &propertyName) == nil && propertyName == "fn" && json.Unmarshal(property[3], &value) == nil {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// registrarSummary describes the registration, one fact per line.
+func registrarSummary(domain *cloudflare.RegistrarDomain, rdap *rdapSnapshot, unavailable map[string]string) []string {
+	lines := []string{}
+	if domain != nil {
+		lines = append(lines, "Cloudflare Registrar: expires "+registrarDate(domain.ExpiresAt)+", auto-renew "+onOff(domain.AutoRenew)+", lock "+onOff(domain.Locked))
+		if len(domain.NameServers) > 0 {
+			lines = append(lines, "  name servers: "+strings.Join(domain.NameServers, ", "))
+		}
+	}
+	if rdap != nil {
+		registrar := rdap.Registrar
+		if registrar == "" {
+			registrar = "unknown"
+		}
+		lines = append(lines, "RDAP (external data, from "+rdap.Source+"): registrar "+registrar+", expires "+registrarDate(rdap.ExpiresAt))
+		if len(rdap.Status) > 0 {
+			lines = append(lines, "  status: "+strings.Join(rdap.Status, ", "))
+		}
+		if len(rdap.NameServers) > 0 {
+			lines = append(lines, "  name servers: "+strings.Join(rdap.NameServers, ", "))
+		}
+	}
+	for _, name := range []string{"cloudflare_registrar", "rdap"} {
+		reason, ok := unavailable[name]
+		if ok {
+			lines = append(lines, name+": unavailable ("+reason+")")
+		}
+	}
+	return lines
+}
+
+// registrarDate shortens an expiry date to the day, since the time isn't useful.
+func registrarDate(raw string) string {
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		if raw == "" {
+			return "unknown"
+		}
+		return raw
+	}
+	return parsed.UTC().Format("2006-01-02")
+}
+
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
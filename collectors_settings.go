@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(settingsCollector{}, false)
+}
+
+// summarySettings are the settings shown in the section's summary, in order, since they matter most for security.
+var summarySettings = []string{
+	"ssl",
+	"min_tls_version",
+	"always_use_https",
+	"automatic_https_rewrites",
+	"security_level",
+}
+
+// the settings that aren't returned with the rest, which the collector fetches from their own endpoints and adds to
+// the end of the list
+const (
+	urlNormalizationSettingID = "url_normalization"
+	managedHeadersSettingID   = "managed_headers"
+)
+
+// managedHeaders is the zone's Managed Transforms, which add or remove request and response headers, like the security
+// headers that add_security_headers adds.
+type managedHeaders struct {
+	Request  []managedHeader `json:"managed_request_headers"`
+	Response []managedHeader `json:"managed_response_headers"`
+}
+
+type managedHeader struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+}
+
+// toggles returns whether each of the Managed Transforms is on or off, by their IDs.
+func (m managedHeaders) toggles() map[string]string {
+	toggles := map[string]string{}
+	for _, header := range append(append([]managedHeader{}, m.Request...), m.Response...) {
+		toggles[header.ID] = "off"
+		if header.Enabled {
+			toggles[header.ID] = "on"
+		}
+	}
+	return toggles
+}
+
+// settingsCollector fetches the zone's settings, like its SSL mode and minimum TLS version. They're what -audit-baseline
+// checks.
+type settingsCollector struct{}
+
+func (settingsCollector) Name() string {
+	return "settings"
+}
+
+func (settingsCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionZoneSettings, permissionTransformRules}
+}
+
+func (settingsCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	settings, err := client.ListZoneSettings(ctx, zone.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	// these are kept as the API returned them, like the rest of the settings
+	for _, id := range []string{urlNormalizationSettingID, managedHeadersSettingID} {
+		value, err := client.GetResult(ctx, "zones/"+zone.ID+"/"+id, url.Values{})
+		if err != nil {
+			return Section{}, err
+		}
+		settings = append(settings, cloudflare.ZoneSetting{ID: id, Value: value, Editable: true})
+	}
+
+	return Section{
+		Name:    "settings",
+		Title:   "Zone settings",
+		Data:    settings,
+		Summary: settingsSummary(settings),
+	}, nil
+}
+
+// settingsSummary counts the settings, and shows whichever of summarySettings the zone has, followed by its URL
+// normalization and whether each of its Managed Transforms is on.
+func settingsSummary(settings []cloudflare.ZoneSetting) []string {
+	values := map[string]string{}
+	for _, setting := range settings {
+		values[setting.ID] = displayJSONValue(setting.Value)
+	}
+
+	lines := []string{strconv.Itoa(len(settings)) + " setting(s)"}
+	for _, id := range summarySettings {
+		value, ok := values[id]
+		if ok {
+			lines = append(lines, id+": "+value)
+		}
+	}
+
+	for _, setting := range settings {
+		switch setting.ID {
+		case urlNormalizationSettingID:
+			normalization := struct {
+				Type  string `json:"type"`
+				Scope string `json:"scope"`
+			}{}
+			if json.Unmarshal(setting.Value, &normalization) == nil {
+				lines = append(lines, "url_normalization: "+normalization.Type+" (scope: "+normalization.Scope+")")
+			}
+		case managedHeadersSettingID:
+			headers := managedHeaders{}
+			if json.Unmarshal(setting.Value, &headers) == nil {
+				toggles := headers.toggles()
+				for _, header := range append(append([]managedHeader{}, headers.Request...), headers.Response...) {
+					lines = append(lines, "managed transform "+header.ID+": "+toggles[header.ID])
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// baselineSettingValue returns a setting's value in the shape that the baseline compares to. That's the value as the
+// API returned it, except for the Managed Transforms, which are turned into an object with whether each of them is on
+// or off, so that the baseline can say managed_headers: {add_security_headers: on}.
+func baselineSettingValue(setting cloudflare.ZoneSetting) json.RawMessage {
+	if setting.ID != managedHeadersSettingID {
+		return setting.Value
+	}
+
+	headers := managedHeaders{}
+	if json.Unmarshal(setting.Value, &headers) != nil {
+		return setting.Value
+	}
+	value, err := json.Marshal(headers.toggles())
+	if err != nil {
+		return setting.Value
+	}
+	return value
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(snippetsCollector{}, false)
+}
+
+// snippetBackup is a snippet in the section written by snippetsCollector, along with the names of its files.
+type snippetBackup struct {
+	cloudflare.Snippet
+	Files []string `json:"files"`
+}
+
+// snippetsCollector fetches the zone's snippets and snippet rules. Each snippet's code is fetched separately and
+// saved as its own files, in a directory for the snippet.
+type snippetsCollector struct{}
+
+func (snippetsCollector) Name() string {
+	return "snippets"
+}
+
+func (snippetsCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionSnippets}
+}
+
+func (snippetsCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	snippets, err := client.ListSnippets(ctx, zone.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	// this is a request per snippet, but they all go through the client's rate limiter
+	backups := []snippetBackup{}
+	files := map[string][]byte{}
+	for _, snippet := range snippets {
+		content, err := client.GetSnippetContent(ctx, zone.ID, snippet.Name)
+		if err != nil {
+			return Section{}, err
+		}
+
+		backup := snippetBackup{Snippet: snippet, Files: []string{}}
+		for fileName, data := range content {
+			backup.Files = append(backup.Files, fileName)
+			files[snippet.Name+"/"+fileName] = data
+		}
+		sort.Strings(backup.Files)
+		backups = append(backups, backup)
+	}
+
+	rules, err := client.GetSnippetRules(ctx, zone.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	return Section{
+		Name:  "snippets",
+		Title: "Snippets",
+		Data: struct {
+			Snippets []snippetBackup `json:"snippets"`
+			Rules    json.RawMessage `json:"rules"`
+		}{backups, rules},
+		Files: files,
+	}, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(tlsCollector{}, false)
+}
+
+// tlsSettings is the section written by tlsCollector.
+type tlsSettings struct {
+	HostnameMinTLSVersion []cloudflare.HostnameSetting `json:"hostname_min_tls_version"`
+	HostnameCiphers       []cloudflare.HostnameSetting `json:"hostname_ciphers"`
+	TotalTLS              *cloudflare.TotalTLS         `json:"total_tls"`
+	Unavailable           map[string]string            `json:"unavailable,omitempty"`
+}
+
+// tlsCollector fetches the TLS settings that aren't part of the zone settings: per-hostname overrides, and Total TLS.
+type tlsCollector struct{}
+
+func (tlsCollector) Name() string {
+	return "tls"
+}
+
+func (tlsCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionSSL}
+}
+
+func (tlsCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	optional := newOptionalResources()
+	settings := tlsSettings{
+		HostnameMinTLSVersion: []cloudflare.HostnameSetting{},
+		HostnameCiphers:       []cloudflare.HostnameSetting{},
+	}
+
+	minTLSVersion, err := client.ListHostnameSettings(ctx, zone.ID, "min_tls_version")
+	ok, err := optional.check("hostname_min_tls_version", err)
+	if err != nil {
+		return Section{}, err
+	}
+	if ok {
+		settings.HostnameMinTLSVersion = minTLSVersion
+	}
+
+	ciphers, err := client.ListHostnameSettings(ctx, zone.ID, "ciphers")
+	ok, err = optional.check("hostname_ciphers", err)
+	if err != nil {
+		return Section{}, err
+	}
+	if ok {
+		settings.HostnameCiphers = ciphers
+	}
+
+	totalTLS, err := client.GetTotalTLS(ctx, zone.ID)
+	ok, err = optional.check("total_tls", err)
+	if err != nil {
+		return Section{}, err
+	}
+	if ok {
+		settings.TotalTLS = &totalTLS
+	}
+
+	err = optional.allDenied()
+	if err != nil {
+		return Section{}, err
+	}
+	if len(optional.Unavailable) > 0 {
+		settings.Unavailable = optional.Unavailable
+	}
+
+	return Section{
+		Name:    "tls",
+		Title:   "TLS settings",
+		Data:    settings,
+		Summary: settings.summary(),
+	}, nil
+}
+
+func (s tlsSettings) summary() []string {
+	lines := []string{}
+
+	if s.TotalTLS != nil {
+		if s.TotalTLS.Enabled {
+			line := "Total TLS: enabled"
+			if s.TotalTLS.CertificateAuthority != "" {
+				line += ", CA " + s.TotalTLS.CertificateAuthority
+			}
+			if s.TotalTLS.ValidityPeriod != 0 {
+				line += ", valid for " + strconv.Itoa(s.TotalTLS.ValidityPeriod) + " days"
+			}
+			lines = append(lines, line)
+		} else {
+			lines = append(lines, "Total TLS: disabled")
+		}
+	}
+
+	for _, setting := range s.HostnameMinTLSVersion {
+		lines = append(lines, "Minimum TLS version for "+setting.Hostname+": "+strings.Trim(string(setting.Value), `"`))
+	}
+	for _, setting := range s.HostnameCiphers {
+		lines = append(lines, "Ciphers for "+setting.Hostname+": "+string(setting.Value))
+	}
+
+	return lines
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(managedWAFCollector{}, false)
+}
+
+// managedRulesetNames are the names of Cloudflare's managed rulesets, which are only referred to by ID in the
+// entrypoint. Rulesets that aren't listed here are shown by ID.
+var managedRulesetNames = map[string]string{
+	"efb7b8c949ac4650a09736fc376e9aee": "Cloudflare Managed Ruleset",
+	"4814384a9e5d4991b9815dcfc25d2f1f": "Cloudflare OWASP Core Ruleset",
+	"c2e184081120413c86c3ab7e14069605": "Cloudflare Exposed Credentials Check Ruleset",
+}
+
+// managedWAFRule is a rule in the zone's managed WAF entrypoint. Only the rules that deploy a managed ruleset
+// (execute) or make an exception to one (skip) are kept.
+type managedWAFRule struct {
+	ID               string                   `json:"id"`
+	Action           string                   `json:"action"`
+	Expression       string                   `json:"expression"`
+	Description      string                   `json:"description,omitempty"`
+	Enabled          bool                     `json:"enabled"`
+	ActionParameters managedWAFRuleParameters `json:"action_parameters"`
+}
+
+type managedWAFRuleParameters struct {
+	// ID is the managed ruleset that an execute rule deploys.
+	ID        string              `json:"id,omitempty"`
+	Overrides *managedWAFOverride `json:"overrides,omitempty"`
+
+	// these say what a skip rule skips
+	Ruleset  string              `json:"ruleset,omitempty"`
+	Rulesets []string            `json:"rulesets,omitempty"`
+	Rules    map[string][]string `json:"rules,omitempty"`
+	Phases   []string            `json:"phases,omitempty"`
+	Products []string            `json:"products,omitempty"`
+}
+
+// managedWAFOverride changes what a deployed managed ruleset does, for the whole ruleset, by tag, or for single rules.
+type managedWAFOverride struct {
+	Action           string                       `json:"action,omitempty"`
+	Enabled          *bool                        `json:"enabled,omitempty"`
+	SensitivityLevel string                       `json:"sensitivity_level,omitempty"`
+	Categories       []managedWAFOverrideCategory `json:"categories,omitempty"`
+	Rules            []managedWAFOverrideRule     `json:"rules,omitempty"`
+}
+
+type managedWAFOverrideCategory struct {
+	Category string `json:"category"`
+	Action   string `json:"action,omitempty"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+}
+
+type managedWAFOverrideRule struct {
+	ID               string `json:"id"`
+	Action           string `json:"action,omitempty"`
+	Enabled          *bool  `json:"enabled,omitempty"`
+	ScoreThreshold   int    `json:"score_threshold,omitempty"`
+	SensitivityLevel string `json:"sensitivity_level,omitempty"`
+}
+
+// managedWAFCollector fetches the zone's overrides of Cloudflare's managed WAF rulesets, and the skip rules that make
+// exceptions to them. These are kept apart from the rulesets themselves, since they're the part that was configured
+// for the zone. The whole entrypoint is kept too, exactly as the API returns it.
+type managedWAFCollector struct{}
+
+func (managedWAFCollector) Name() string {
+	return "managed_waf"
+}
+
+func (managedWAFCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionZoneWAF}
+}
+
+func (managedWAFCollector) RequiredPermission() string {
+	return "#waf:read"
+}
+
+func (managedWAFCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	section := Section{
+		Name:  "managed_waf",
+		Title: "Managed WAF overrides",
+	}
+
+	entrypoint, err := client.GetResult(ctx, "zones/"+zone.ID+"/rulesets/phases/http_request_firewall_managed/entrypoint", url.Values{})
+	apiError := &cloudflare.APIError{}
+	if errors.As(err, &apiError) && apiError.StatusCode == http.StatusNotFound {
+		// the entrypoint only exists once a managed ruleset has been deployed
+		section.Data = struct {
+			Deployed  []managedWAFRule `json:"deployed"`
+			SkipRules []managedWAFRule `json:"skip_rules"`
+		}{[]managedWAFRule{}, []managedWAFRule{}}
+		section.Summary = []string{"No managed rulesets are deployed on this zone."}
+		return section, nil
+	}
+
+	optional := newOptionalResources()
+	ok, err := optional.check("managed_waf", err)
+	if err != nil {
+		return Section{}, err
+	}
+	err = optional.allDenied()
+	if err != nil {
+		return Section{}, err
+	}
+	if !ok {
+		section.Data = struct {
+			Unavailable map[string]string `json:"unavailable"`
+		}{optional.Unavailable}
+		section.Summary = []string{"Managed WAF rulesets aren't available on this zone's plan."}
+		return section, nil
+	}
+
+	ruleset := struct {
+		Rules []managedWAFRule `json:"rules"`
+	}{}
+	err = json.Unmarshal(entrypoint, &ruleset)
+	if err != nil {
+		return Section{}, err
+	}
+
+	deployed := []managedWAFRule{}
+	skipRules := []managedWAFRule{}
+	for _, rule := range ruleset.Rules {
+		switch rule.Action {
+		case "execute":
+			deployed = append(deployed, rule)
+		case "skip":
+			skipRules = append(skipRules, rule)
+		}
+	}
+
+	section.Data = struct {
+		Deployed   []managedWAFRule `json:"deployed"`
+		SkipRules  []managedWAFRule `json:"skip_rules"`
+		Entrypoint json.RawMessage  `json:"entrypoint"`
+	}{deployed, skipRules, entrypoint}
+	section.Summary = managedWAFSummary(deployed, skipRules)
+	return section, nil
+}
+
+// managedWAFSummary lists the skip rules and overrides, one per line, in the order that they're applied.
+func managedWAFSummary(deployed []managedWAFRule, skipRules []managedWAFRule) []string {
+	lines := []string{}
+	for _, rule := range skipRules {
+		lines = append(lines, "skip "+managedWAFSkipped(rule.ActionParameters)+" for "+managedWAFExpression(rule.Expression)+managedWAFRuleState(rule))
+	}
+
+	for _, rule := range deployed {
+		lines = append(lines, "deploy "+managedRulesetName(rule.ActionParameters.ID)+" for "+managedWAFExpression(rule.Expression)+managedWAFRuleState(rule))
+
+		overrides := rule.ActionParameters.Overrides
+		if overrides == nil {
+			continue
+		}
+		if setting := managedWAFSetting(overrides.Action, overrides.Enabled, overrides.SensitivityLevel, 0); setting != "" {
+			lines = append(lines, "  all rules: "+setting)
+		}
+		for _, category := range overrides.Categories {
+			lines = append(lines, "  tag "+category.Category+": "+managedWAFSetting(category.Action, category.Enabled, "", 0))
+		}
+		for _, override := range overrides.Rules {
+			lines = append(lines, "  rule "+override.ID+": "+managedWAFSetting(override.Action, override.Enabled, override.SensitivityLevel, override.ScoreThreshold))
+		}
+	}
+
+	if len(lines) == 0 {
+		lines = append(lines, "No managed rulesets are deployed on this zone.")
+	}
+	return lines
+}
+
+// managedWAFSkipped describes what a skip rule skips.
+func managedWAFSkipped(parameters managedWAFRuleParameters) string {
+	parts := []string{}
+	if parameters.Ruleset == "current" {
+		parts = append(parts, "managed rules")
+	}
+	for _, id := range parameters.Rulesets {
+		parts = append(parts, managedRulesetName(id))
+	}
+
+	rulesets := []string{}
+	for id := range parameters.Rules {
+		rulesets = append(rulesets, id)
+	}
+	sort.Strings(rulesets)
+	for _, id := range rulesets {
+		parts = append(parts, "rules "+strings.Join(parameters.Rules[id], ", ")+" of "+managedRulesetName(id))
+	}
+
+	if len(parameters.Phases) > 0 {
+		parts = append(parts, "phases "+strings.Join(parameters.Phases, ", "))
+	}
+	if len(parameters.Products) > 0 {
+		parts = append(parts, "products "+strings.Join(parameters.Products, ", "))
+	}
+
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	return strings.Join(parts, " and ")
+}
+
+// managedWAFSetting describes an override, like "action log" or "disabled".
+func managedWAFSetting(action string, enabled *bool, sensitivityLevel string, scoreThreshold int) string {
+	parts := []string{}
+	if enabled != nil && !*enabled {
+		parts = append(parts, "disabled")
+	} else if enabled != nil {
+		parts = append(parts, "enabled")
+	}
+	if action != "" {
+		parts = append(parts, "action "+action)
+	}
+	if sensitivityLevel != "" {
+		parts = append(parts, "sensitivity "+sensitivityLevel)
+	}
+	if scoreThreshold != 0 {
+		parts = append(parts, "score threshold "+strconv.Itoa(scoreThreshold))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// managedWAFExpression describes which requests a rule applies to.
+func managedWAFExpression(expression string) string {
+	if expression == "true" {
+		return "all requests"
+	}
+	return expression
+}
+
+// managedWAFRuleState notes when a rule in the entrypoint is turned off, and adds its description.
+func managedWAFRuleState(rule managedWAFRule) string {
+	state := ""
+	if rule.Description != "" {
+		state += " (" + rule.Description + ")"
+	}
+	if !rule.Enabled {
+		state += " [disabled]"
+	}
+	return state
+}
+
+// managedRulesetName returns the name of a managed ruleset, or its ID if it isn't one that we know about.
+func managedRulesetName(id string) string {
+	name, ok := managedRulesetNames[id]
+	if !ok {
+		return "ruleset " + id
+	}
+	return name
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(web3Collector{}, false)
+}
+
+// web3Collector fetches the zone's Web3 gateway hostnames.
+type web3Collector struct{}
+
+func (web3Collector) Name() string {
+	return "web3"
+}
+
+func (web3Collector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionWeb3}
+}
+
+func (web3Collector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	hostnames, err := client.ListWeb3Hostnames(ctx, zone.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	return Section{
+		Name:  "web3",
+		Title: "Web3 hostnames",
+		Data:  hostnames,
+	}, nil
+}
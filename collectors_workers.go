@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerAccountCollector(workersCollector{}, false)
+}
+
+// workersCollector fetches the account's Workers services, with their environments, the custom domains routed to
+// them, their cron triggers, the names and types of their bindings, and their latest deployments. Each service is
+// saved in a file of its own.
+type workersCollector struct {
+	deploymentHistory int
+}
+
+func (workersCollector) Name() string {
+	return "workers"
+}
+
+func (workersCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionWorkersScripts}
+}
+
+func (workersCollector) singleAccount() {}
+
+func (c workersCollector) withOptions(opts *options) AccountCollector {
+	c.deploymentHistory = opts.DeploymentHistory
+	return c
+}
+
+func (c workersCollector) CollectAccount(ctx context.Context, client *cloudflare.Client, account cloudflare.Account) (Section, error) {
+	services, err := client.ListWorkersServices(ctx, account.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	domains, err := client.ListWorkersDomains(ctx, account.ID)
+	if err != nil {
+		return Section{}, err
+	}
+
+	names := []string{}
+	for _, service := range services {
+		parsed := struct {
+			ID string `json:"id"`
+		}{}
+		err = json.Unmarshal(service, &parsed)
+		if err != nil {
+			return Section{}, err
+		}
+		names = append(names, parsed.ID)
+	}
+	fileNames := uniqueFileNames(names, names)
+
+	index := []accountItem{}
+	files := map[string][]byte{}
+	for _, name := range names {
+		service, err := client.GetWorkersService(ctx, account.ID, name)
+		if err != nil {
+			return Section{}, err
+		}
+
+		serviceDomains := []cloudflare.WorkersDomain{}
+		for _, domain := range domains {
+			if domain.Service == name {
+				serviceDomains = append(serviceDomains, domain)
+			}
+		}
+
+		// the service's script has the same name as the service
+		deployments := []json.RawMessage{}
+		if c.deploymentHistory > 0 {
+			deployments, err = client.ListWorkersDeployments(ctx, account.ID, name)
+			if err != nil {
+				return Section{}, err
+			}
+			if len(deployments) > c.deploymentHistory {
+				deployments = deployments[:c.deploymentHistory]
+			}
+		}
+
+		// the lists are always written, even when they're empty, so that adding the first one shows up as a change
+		schedules, err := client.ListWorkersSchedules(ctx, account.ID, name)
+		if err != nil {
+			return Section{}, err
+		}
+		bindings, err := client.ListWorkersBindings(ctx, account.ID, name)
+		if err != nil {
+			return Section{}, err
+		}
+
+		fileName := fileNames[name] + ".json"
+		err = addJSONFile(files, fileName, struct {
+			Service     json.RawMessage              `json:"service"`
+			Domains     []cloudflare.WorkersDomain   `json:"domains"`
+			Schedules   []cloudflare.WorkersSchedule `json:"schedules"`
+			Bindings    []cloudflare.WorkersBinding  `json:"bindings"`
+			Deployments []json.RawMessage            `json:"deployments"`
+		}{service, serviceDomains, schedules, bindings, deployments})
+		if err != nil {
+			return Section{}, err
+		}
+		index = append(index, accountItem{Name: name, File: "workers/" + fileName})
+	}
+
+	return Section{
+		Name:  "workers",
+		Title: "Workers services",
+		Data:  index,
+		Files: files,
+	}, nil
+}
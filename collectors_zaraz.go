@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerCollector(zarazCollector{}, false)
+}
+
+// zarazConfig is the section written by zarazCollector.
+type zarazConfig struct {
+	Config json.RawMessage `json:"config"`
+
+	// LatestChange is the newest entry in the configuration's history, which says when it was last published and by
+	// whom.
+	LatestChange json.RawMessage `json:"latest_change"`
+}
+
+// zarazCollector fetches the zone's Zaraz configuration, with its tools, triggers, variables, and consent settings.
+type zarazCollector struct{}
+
+func (zarazCollector) Name() string {
+	return "zaraz"
+}
+
+func (zarazCollector) Permissions() []tokenPermission {
+	return []tokenPermission{permissionZaraz}
+}
+
+func (zarazCollector) Collect(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (Section, error) {
+	config, err := client.GetResult(ctx, "zones/"+zone.ID+"/settings/zaraz/config", url.Values{})
+	if err != nil {
+		return Section{}, err
+	}
+
+	history, err := client.GetResult(ctx, "zones/"+zone.ID+"/settings/zaraz/history", url.Values{
+		"limit":     []string{"1"},
+		"sortField": []string{"updated_at"},
+		"sortOrder": []string{"DESC"},
+	})
+	if err != nil {
+		return Section{}, err
+	}
+
+	data := zarazConfig{Config: config, LatestChange: json.RawMessage("null")}
+	entries := []json.RawMessage{}
+	if json.Unmarshal(history, &entries) == nil && len(entries) > 0 {
+		data.LatestChange = entries[0]
+	}
+
+	return Section{
+		Name:    "zaraz",
+		Title:   "Zaraz",
+		Data:    data,
+		Summary: zarazSummary(config),
+	}, nil
+}
+
+// SecretRules picks out the values of secret variables, and any tool setting that looks like a credential.
+func (zarazCollector) SecretRules() []redactionRule {
+	return []redactionRule{
+		{Path: "config.variables.*.value", When: "type=secret"},
+		{Path: "config.tools", Keys: credentialPattern},
+	}
+}
+
+// zarazSummary lists the tools in the configuration, with how many triggers fire each of them.
+func zarazSummary(config json.RawMessage) []string {
+	parsed := struct {
+		Tools map[string]struct {
+			Name      string `json:"name"`
+			Enabled   bool   `json:"enabled"`
+			NeoEvents []struct {
+				FiringTriggers []string `json:"firingTriggers"`
+			} `json:"neoEvents"`
+		} `json:"tools"`
+		Triggers map[string]json.RawMessage `json:"triggers"`
+	}{}
+	if json.Unmarshal(config, &parsed) != nil {
+		return nil
+	}
+
+	lines := []string{
+		strconv.Itoa(len(parsed.Tools)) + " tool(s), " + strconv.Itoa(len(parsed.Triggers)) + " trigger(s)",
+	}
+	tools := []string{}
+	for _, tool := range parsed.Tools {
+		triggers := map[string]bool{}
+		for _, event := range tool.NeoEvents {
+			for _, trigger := range event.FiringTriggers {
+				triggers[trigger] = true
+			}
+		}
+
+		status := "enabled"
+		if !tool.Enabled {
+			status = "disabled"
+		}
+		tools = append(tools, "Tool: "+tool.Name+" ("+status+", "+strconv.Itoa(len(triggers))+" trigger(s))")
+	}
+	sort.Strings(tools)
+
+	return append(lines, tools...)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// the names of the zone comparison's files in the output directory
+const (
+	compareTextFileName = "compare-zones.txt"
+	compareJSONFileName = "compare-zones.json"
+)
+
+// zoneComparison is a primary zone and the zones that are meant to mirror it, from -compare-zones.
+type zoneComparison struct {
+	Primary     string
+	Secondaries []string
+}
+
+// zoneComparisons is the value of -compare-zones, which can be given more than once, for each primary zone.
+type zoneComparisons []zoneComparison
+
+func (c *zoneComparisons) String() string {
+	groups := []string{}
+	for _, comparison := range *c {
+		groups = append(groups, comparison.Primary+"="+strings.Join(comparison.Secondaries, ","))
+	}
+	return strings.Join(groups, " ")
+}
+
+func (c *zoneComparisons) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i == -1 {
+		return errors.New("it takes a primary zone and the zones that mirror it, like example.com=example.net,example.org")
+	}
+
+	comparison := zoneComparison{Primary: normalizeName(strings.TrimSpace(value[:i]))}
+	if comparison.Primary == "" {
+		return errors.New("the primary zone is missing")
+	}
+	for _, name := range strings.Split(value[i+1:], ",") {
+		name = normalizeName(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == comparison.Primary {
+			return fmt.Errorf("%s can't be compared with itself", name)
+		}
+		comparison.Secondaries = appendUnique(comparison.Secondaries, name)
+	}
+	if len(comparison.Secondaries) == 0 {
+		return fmt.Errorf("there are no zones to compare with %s", comparison.Primary)
+	}
+
+	*c = append(*c, comparison)
+	return nil
+}
+
+// includes returns true if the zone is one of the zones being compared.
+func (c zoneComparisons) includes(name string) bool {
+	name = normalizeName(name)
+	for _, comparison := range c {
+		if comparison.Primary == name {
+			return true
+		}
+		for _, secondary := range comparison.Secondaries {
+			if secondary == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// zoneDifference is a way that a zone doesn't mirror its primary: a record that's missing from it, an extra record
+// that the primary doesn't have, or a record that's there in both, but differs. Name is relative to the zone, with "@"
+// for the apex.
+type zoneDifference struct {
+	Zone    string `json:"zone"`
+	Primary string `json:"primary"`
+	Kind    string `json:"kind"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+
+	// PrimaryRecord and Record are the record in the primary and in the zone, whichever of them there are.
+	PrimaryRecord *cloudflare.DNSRecord `json:"primary_record,omitempty"`
+	Record        *cloudflare.DNSRecord `json:"record,omitempty"`
+
+	Message string `json:"message"`
+}
+
+// writeZoneComparison compares each zone in -compare-zones with its primary, using the records that were fetched in
+// this run, and writes the differences to compare-zones.txt and compare-zones.json.
+func (b *backupRun) writeZoneComparison() error {
+	zones := map[string]auditZone{}
+	duplicates := map[string]bool{}
+	for _, zone := range b.zoneRecords {
+		name := normalizeName(zone.Name)
+		if _, ok := zones[name]; ok {
+			duplicates[name] = true
+		}
+		zones[name] = zone
+	}
+	find := func(name string) (auditZone, bool) {
+		zone, ok := zones[name]
+		if !ok {
+			b.report.AddWarning("%s wasn't backed up in this run, or its records were streamed, so -compare-zones couldn't compare it", name)
+			return auditZone{}, false
+		}
+		if duplicates[name] {
+			b.report.AddWarning("there's more than one zone named %s, so -compare-zones can't tell which one to compare", name)
+			return auditZone{}, false
+		}
+		return zone, true
+	}
+
+	differences := []zoneDifference{}
+	zonesCompared := 0
+	for _, comparison := range b.options.CompareZones {
+		primary, ok := find(comparison.Primary)
+		if !ok {
+			continue
+		}
+		for _, name := range comparison.Secondaries {
+			secondary, ok := find(name)
+			if !ok {
+				continue
+			}
+			differences = append(differences, compareZoneRecords(primary, secondary)...)
+			zonesCompared++
+		}
+	}
+	b.report.ZoneDifferences = len(differences)
+
+	err := b.writeRootFile(compareTextFileName, func(w io.Writer) error {
+		return writeZoneComparisonText(w, zonesCompared, differences)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = b.writeRootFile(compareJSONFileName, func(w io.Writer) error {
+		return writeJSON(w, map[string]interface{}{
+			"zones_compared": zonesCompared,
+			"differences":    differences,
+		})
+	})
+	return err
+}
+
+// compareZoneRecords finds the differences between a zone and its primary. Records are matched by their name relative
+// to their zone, their type, and their content, where a name in the content that's in the zone, like the target of a
+// CNAME to another name in the zone, is taken to be relative to it too. Matching records can still differ in whether
+// they're proxied, their TTL, and their priority.
+func compareZoneRecords(primary auditZone, secondary auditZone) []zoneDifference {
+	primaryGroups, keys := groupComparedRecords(primary, nil)
+	secondaryGroups, keys := groupComparedRecords(secondary, keys)
+	sort.Strings(keys)
+
+	differences := []zoneDifference{}
+	add := func(kind string, primaryRecord *cloudflare.DNSRecord, record *cloudflare.DNSRecord, message string) {
+		either := primaryRecord
+		zoneName := primary.Name
+		if either == nil {
+			either = record
+			zoneName = secondary.Name
+		}
+		differences = append(differences, zoneDifference{
+			Zone:          secondary.Name,
+			Primary:       primary.Name,
+			Kind:          kind,
+			Type:          either.Type,
+			Name:          relativeName(either.Name, zoneName),
+			PrimaryRecord: primaryRecord,
+			Record:        record,
+			Message:       message,
+		})
+	}
+
+	for _, key := range keys {
+		primaryRecords := primaryGroups[key]
+		records := secondaryGroups[key]
+
+		// records with the same content are matched first, then the rest are paired up as having different content
+		unmatched := []cloudflare.DNSRecord{}
+		for _, primaryRecord := range primaryRecords {
+			primaryRecord := primaryRecord
+			matched := -1
+			for i, record := range records {
+				if relativeContent(record.Content, secondary.Name) == relativeContent(primaryRecord.Content, primary.Name) {
+					matched = i
+					break
+				}
+			}
+			if matched == -1 {
+				unmatched = append(unmatched, primaryRecord)
+				continue
+			}
+
+			record := records[matched]
+			records = append(records[:matched:matched], records[matched+1:]...)
+			details := compareRecordSettings(primaryRecord, record, primary.Name, secondary.Name)
+			if len(details) > 0 {
+				add("differs", &primaryRecord, &record, strings.Join(details, " "))
+			}
+		}
+
+		for i := range unmatched {
+			primaryRecord := unmatched[i]
+			if i < len(records) {
+				record := records[i]
+				add("differs", &primaryRecord, &record, fmt.Sprintf("The content is %q in %s, but %q here.", primaryRecord.Content, primary.Name, record.Content))
+				continue
+			}
+			add("missing", &primaryRecord, nil, fmt.Sprintf("%s has this record, but this zone doesn't.", primary.Name))
+		}
+		for i := len(unmatched); i < len(records); i++ {
+			record := records[i]
+			add("extra", nil, &record, fmt.Sprintf("This zone has this record, but %s doesn't.", primary.Name))
+		}
+	}
+	return differences
+}
+
+// groupComparedRecords groups a zone's records by their type and relative name, with their content sorted, and adds
+// any keys that aren't there yet to keys.
+func groupComparedRecords(zone auditZone, keys []string) (map[string][]cloudflare.DNSRecord, []string) {
+	groups := map[string][]cloudflare.DNSRecord{}
+	for _, record := range zone.Records {
+		key := strings.ToUpper(record.Type) + " " + relativeName(record.Name, zone.Name)
+		if _, ok := groups[key]; !ok {
+			keys = appendUnique(keys, key)
+		}
+		groups[key] = append(groups[key], record)
+	}
+	for _, records := range groups {
+		sort.SliceStable(records, func(i, j int) bool {
+			return relativeContent(records[i].Content, zone.Name) < relativeContent(records[j].Content, zone.Name)
+		})
+	}
+	return groups, keys
+}
+
+// compareRecordSettings describes how two records with the same content differ otherwise.
+func compareRecordSettings(primaryRecord cloudflare.DNSRecord, record cloudflare.DNSRecord, primaryName string, zoneName string) []string {
+	details := []string{}
+	if primaryRecord.Proxied != record.Proxied {
+		details = append(details, fmt.Sprintf("It's %s in %s, but %s here.", proxiedState(primaryRecord.Proxied), primaryName, proxiedState(record.Proxied)))
+	}
+	if primaryRecord.TTL != record.TTL {
+		details = append(details, fmt.Sprintf("Its TTL is %s in %s, but %s here.", describeTTL(primaryRecord.TTL), primaryName, describeTTL(record.TTL)))
+	}
+	primaryPriority, priority := "none", "none"
+	if primaryRecord.Priority != nil {
+		primaryPriority = strconv.Itoa(int(*primaryRecord.Priority))
+	}
+	if record.Priority != nil {
+		priority = strconv.Itoa(int(*record.Priority))
+	}
+	if primaryPriority != priority {
+		details = append(details, fmt.Sprintf("Its priority is %s in %s, but %s here.", primaryPriority, primaryName, priority))
+	}
+	return details
+}
+
+func proxiedState(proxied bool) string {
+	if proxied {
+		return "proxied"
+	}
+	return "not proxied"
+}
+
+func describeTTL(ttl uint64) string {
+	if ttl == autoTTL {
+		return "Auto"
+	}
+	return strconv.FormatUint(ttl, 10)
+}
+
+// relativeContent replaces each name in a record's content that's the zone's name, or is in the zone, with a
+// placeholder, so that records that point within their own zones can be compared across zones. A name only counts if
+// it's the whole zone name, so example.com isn't replaced in notexample.com or example.com.au.
+func relativeContent(content string, zoneName string) string {
+	zoneName = normalizeName(zoneName)
+	// only ASCII letters are lower-cased, so that the indexes are the same in both
+	lower := strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, content)
+	isNameChar := func(c byte) bool {
+		return c == '-' || c == '_' || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+	}
+
+	result := strings.Builder{}
+	start := 0
+	for {
+		i := strings.Index(lower[start:], zoneName)
+		if i == -1 {
+			break
+		}
+		i += start
+		end := i + len(zoneName)
+
+		// a trailing dot is part of the name, but anything after it means the name is longer
+		after := end
+		if after < len(lower) && lower[after] == '.' {
+			after++
+		}
+		before := i == 0 || !isNameChar(lower[i-1])
+		if before && (after == len(lower) || (!isNameChar(lower[after]) && lower[after] != '.')) {
+			result.WriteString(content[start:i] + "\x00")
+			start = after
+			continue
+		}
+		result.WriteString(content[start : i+1])
+		start = i + 1
+	}
+	result.WriteString(content[start:])
+	return result.String()
+}
+
+// writeZoneComparisonText writes the differences that -compare-zones found, formatted like the text backup format.
+func writeZoneComparisonText(w io.Writer, zonesCompared int, differences []zoneDifference) error {
+	const separator = textSeparator
+
+	outputFile := bufio.NewWriter(w)
+	outputFile.WriteString(
+		"#\r\n" +
+			"# Zone comparison\r\n" +
+			"# " + strconv.Itoa(len(differences)) + " difference(s) found in " + strconv.Itoa(zonesCompared) + " zone(s)\r\n" +
+			"#\r\n",
+	)
+	if len(differences) == 0 {
+		outputFile.WriteString("# (no differences found)\r\n")
+	} else {
+		outputFile.WriteString("# Zone" + separator + "Primary" + separator + "Kind" + separator + "Record" + separator + "Difference\r\n")
+	}
+	for _, difference := range differences {
+		record := difference.Record
+		if record == nil {
+			record = difference.PrimaryRecord
+		}
+		outputFile.WriteString(difference.Zone + separator + difference.Primary + separator + difference.Kind + separator + describeRecord(*record) + separator + difference.Message + "\r\n")
+	}
+
+	return outputFile.Flush()
+}
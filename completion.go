@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerSubcommand("completion", subcommand{
+		Description: "Print a shell completion script",
+		Arguments:   completionShellNames,
+		Run:         runCompletion,
+	})
+}
+
+// completionZonesTimeout is how long zone name completion waits for the API. It's short, since the shell waits for it
+// before showing anything.
+const completionZonesTimeout = 3 * time.Second
+
+// enumeratedFlagValues holds the values of flags that only accept a fixed set of them, for completion. The formats,
+// resources, and reports come from their registries, so they can't go out of date.
+var enumeratedFlagValues = map[string]func() []string{
+	"format":         outputFormatNames,
+	"resources":      func() []string { return append([]string{"all"}, collectorNames()...) },
+	"report":         reportNames,
+	"layout":         func() []string { return []string{"flat", "dir"} },
+	"webhook-format": func() []string { return []string{"json", "slack"} },
+	"webhook-on":     func() []string { return []string{"failure", "always"} },
+	"output-format":  func() []string { return []string{"markdown", "json"} },
+}
+
+// listFlags are the flags that take a comma-separated list, rather than a single value.
+var listFlags = map[string]bool{"resources": true, "report": true, "zones": true}
+
+// completionShells holds the completion script generator for each shell.
+var completionShells = map[string]func(w io.Writer, commands []completionCommand){
+	"bash": writeBashCompletion,
+	"fish": writeFishCompletion,
+	"zsh":  writeZshCompletion,
+}
+
+func completionShellNames() []string {
+	names := []string{}
+	for name := range completionShells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completionCommand describes the backup itself (with an empty name) or a subcommand, for the completion scripts.
+type completionCommand struct {
+	Name        string
+	Description string
+	Flags       []completionFlag
+	Arguments   []string
+}
+
+// completionFlag describes a flag, for the completion scripts.
+type completionFlag struct {
+	Name        string
+	Description string
+	TakesValue  bool
+
+	// Values holds the values that the flag accepts, if it only accepts a fixed set of them.
+	Values []string
+
+	// List is set if the value is a comma-separated list. Zones is set for flags that take zone names, which come from
+	// the API.
+	List  bool
+	Zones bool
+}
+
+// completionCommands describes the backup and every subcommand, straight from their flag definitions.
+func completionCommands() []completionCommand {
+	backupFlags := flag.NewFlagSet("cloudflare-backup", flag.ContinueOnError)
+	(&options{}).registerFlags(backupFlags)
+	commands := []completionCommand{{Flags: completionFlags(backupFlags)}}
+
+	for _, name := range subcommandNames() {
+		command := subcommands[name]
+		flags := flag.NewFlagSet(name, flag.ContinueOnError)
+		if command.RegisterFlags != nil {
+			command.RegisterFlags(flags)
+		}
+		arguments := []string{}
+		if command.Arguments != nil {
+			arguments = command.Arguments()
+		}
+		commands = append(commands, completionCommand{
+			Name:        name,
+			Description: command.Description,
+			Flags:       completionFlags(flags),
+			Arguments:   arguments,
+		})
+	}
+	return commands
+}
+
+func completionFlags(flags *flag.FlagSet) []completionFlag {
+	result := []completionFlag{}
+	flags.VisitAll(func(f *flag.Flag) {
+		boolFlag, isBool := f.Value.(interface{ IsBoolFlag() bool })
+		completion := completionFlag{
+			Name: f.Name,
+			// the first sentence is enough for a completion menu
+			Description: strings.TrimSuffix(strings.SplitN(f.Usage, ". ", 2)[0], "."),
+			TakesValue:  !isBool || !boolFlag.IsBoolFlag(),
+			List:        listFlags[f.Name],
+			Zones:       f.Name == "zones" || f.Name == "zone",
+		}
+		values, ok := enumeratedFlagValues[f.Name]
+		if ok {
+			completion.Values = values()
+		}
+		result = append(result, completion)
+	})
+	return result
+}
+
+// runCompletion is the completion subcommand, which prints the completion script for a shell. The scripts also run
+// "completion zones" to complete -zones, which lists the zones if CLOUDFLARE_API_TOKEN is set.
+func runCompletion(args []string) error {
+	flags := flag.NewFlagSet("completion", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cloudflare-backup completion <%s>\n\n", strings.Join(completionShellNames(), "|"))
+		fmt.Fprintf(flags.Output(), "Prints a completion script for the shell. For example, add this to ~/.bashrc:\n\n")
+		fmt.Fprintf(flags.Output(), "\tsource <(cloudflare-backup completion bash)\n\n")
+		fmt.Fprintf(flags.Output(), "If CLOUDFLARE_API_TOKEN is set, the names of your zones are completed for -zones.\n")
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if flags.Arg(0) == "zones" {
+		return printCompletionZones(os.Stdout)
+	}
+
+	write, ok := completionShells[flags.Arg(0)]
+	if !ok {
+		return fmt.Errorf("Unknown shell %q. The available shells are: %s.", flags.Arg(0), strings.Join(completionShellNames(), ", "))
+	}
+	write(os.Stdout, completionCommands())
+	return nil
+}
+
+// printCompletionZones prints the name of each zone that the credentials in the environment (CLOUDFLARE_API_TOKEN,
+// or CLOUDFLARE_API_KEY and CLOUDFLARE_EMAIL) can access, one per line. Without any, it prints nothing.
+func printCompletionZones(w io.Writer) error {
+	credentials := apiCredentials{}
+	if credentials.resolve() != nil || credentials.empty() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionZonesTimeout)
+	defer cancel()
+
+	// the credentials aren't logged, since the output is read by the shell
+	credentials.source = ""
+	client := credentials.newClient()
+	client.HTTPClient = &http.Client{Timeout: completionZonesTimeout}
+	client.RetryPolicy = cloudflare.RetryPolicy{MaxAttempts: 1}
+	zones, err := client.ListZones(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, zone := range zones {
+		fmt.Fprintln(w, zone.Name)
+	}
+	return nil
+}
+
+// shellQuote quotes a string for bash or zsh.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote quotes a string for fish, which allows escapes inside single quotes.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func completionFlagNames(flags []completionFlag) []string {
+	names := []string{}
+	for _, f := range flags {
+		names = append(names, "-"+f.Name)
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer, commands []completionCommand) {
+	fmt.Fprint(w, `# bash completion for cloudflare-backup. Load it with:
+#   source <(cloudflare-backup completion bash)
+
+_cloudflare_backup_list() {
+	local prefix=""
+	if [[ "$cur" == *,* ]]; then
+		prefix="${cur%,*},"
+	fi
+	COMPREPLY=($(compgen -P "$prefix" -W "$1" -- "${cur##*,}"))
+	compopt -o nospace 2>/dev/null
+}
+
+_cloudflare_backup() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local prev="${COMP_WORDS[COMP_CWORD-1]}"
+	local command=""
+	if [[ $COMP_CWORD -gt 1 ]]; then
+		command="${COMP_WORDS[1]}"
+	fi
+
+	case "$command" in
+`)
+
+	for _, command := range completionOrder(commands) {
+		pattern := command.Name
+		words := completionFlagNames(command.Flags)
+		if command.Name == "" {
+			pattern = "*"
+			words = append(subcommandNames(), words...)
+		}
+		fmt.Fprintf(w, "\t%s)\n", pattern)
+
+		// flags with free-form values complete file names, since that's what most of them are
+		fmt.Fprintf(w, "\t\tcase \"$prev\" in\n")
+		freeForm := []string{}
+		for _, f := range command.Flags {
+			if !f.TakesValue {
+				continue
+			}
+			if !f.Zones && f.Values == nil {
+				freeForm = append(freeForm, "-"+f.Name+"|--"+f.Name)
+				continue
+			}
+			fmt.Fprintf(w, "\t\t-%s|--%s)\n", f.Name, f.Name)
+			switch {
+			case f.Zones:
+				fmt.Fprintf(w, "\t\t\t_cloudflare_backup_list \"$(\"${COMP_WORDS[0]}\" completion zones 2>/dev/null)\"\n")
+			case f.List:
+				fmt.Fprintf(w, "\t\t\t_cloudflare_backup_list %s\n", shellQuote(strings.Join(f.Values, " ")))
+			default:
+				fmt.Fprintf(w, "\t\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shellQuote(strings.Join(f.Values, " ")))
+			}
+			fmt.Fprintf(w, "\t\t\treturn\n\t\t\t;;\n")
+		}
+		if len(freeForm) > 0 {
+			fmt.Fprintf(w, "\t\t%s)\n", strings.Join(freeForm, "|"))
+			fmt.Fprintf(w, "\t\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+			fmt.Fprintf(w, "\t\t\treturn\n\t\t\t;;\n")
+		}
+		fmt.Fprintf(w, "\t\tesac\n")
+
+		if command.Name == "" {
+			// subcommands only come first
+			fmt.Fprintf(w, "\t\tif [[ $COMP_CWORD -eq 1 ]]; then\n")
+			fmt.Fprintf(w, "\t\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shellQuote(strings.Join(words, " ")))
+			fmt.Fprintf(w, "\t\telse\n")
+			fmt.Fprintf(w, "\t\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shellQuote(strings.Join(completionFlagNames(command.Flags), " ")))
+			fmt.Fprintf(w, "\t\tfi\n")
+		} else {
+			fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shellQuote(strings.Join(append(command.Arguments, words...), " ")))
+		}
+		fmt.Fprintf(w, "\t\t;;\n")
+	}
+
+	fmt.Fprint(w, `	esac
+}
+
+complete -F _cloudflare_backup cloudflare-backup
+`)
+}
+
+// completionOrder puts the backup itself after the subcommands, since it's the catch-all case in the scripts.
+func completionOrder(commands []completionCommand) []completionCommand {
+	return append(append([]completionCommand{}, commands[1:]...), commands[0])
+}
+
+// zshSpec formats a flag for zsh's _arguments.
+func zshSpec(f completionFlag) string {
+	description := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(f.Description)
+	spec := "-" + f.Name + "[" + description + "]"
+	switch {
+	case !f.TakesValue:
+	case f.Zones:
+		spec += ":zones:_cloudflare_backup_zones"
+	case f.List:
+		spec += ":" + f.Name + ":_values -s , " + f.Name + " " + strings.Join(f.Values, " ")
+	case f.Values != nil:
+		spec += ":" + f.Name + ":(" + strings.Join(f.Values, " ") + ")"
+	default:
+		spec += ":value:_files"
+	}
+	return shellQuote(spec)
+}
+
+func writeZshCompletion(w io.Writer, commands []completionCommand) {
+	fmt.Fprint(w, `#compdef cloudflare-backup
+# zsh completion for cloudflare-backup. Save it as _cloudflare-backup in a directory in $fpath, or load it with:
+#   source <(cloudflare-backup completion zsh)
+
+_cloudflare_backup_zones() {
+	local -a zones
+	zones=(${(f)"$(${words[1]} completion zones 2>/dev/null)"})
+	(( ${#zones} )) && _values -s , zone $zones
+}
+
+_cloudflare_backup() {
+	if (( CURRENT == 2 )) && [[ $words[CURRENT] != -* ]]; then
+		local -a commands
+		commands=(
+`)
+	for _, command := range commands[1:] {
+		fmt.Fprintf(w, "\t\t\t%s\n", shellQuote(command.Name+":"+command.Description))
+	}
+	fmt.Fprint(w, `		)
+		_describe subcommand commands
+		return
+	fi
+
+	case $words[2] in
+`)
+
+	for _, command := range completionOrder(commands) {
+		pattern := command.Name
+		if command.Name == "" {
+			pattern = "*"
+		}
+		fmt.Fprintf(w, "\t%s)\n", pattern)
+		if command.Name != "" {
+			fmt.Fprintf(w, "\t\tshift words\n\t\t(( CURRENT-- ))\n")
+		}
+
+		specs := []string{}
+		for _, f := range command.Flags {
+			specs = append(specs, zshSpec(f))
+		}
+		if len(command.Arguments) > 0 {
+			specs = append(specs, shellQuote("1:argument:("+strings.Join(command.Arguments, " ")+")"))
+		}
+		if len(specs) > 0 {
+			fmt.Fprintf(w, "\t\t_arguments \\\n\t\t\t%s\n", strings.Join(specs, " \\\n\t\t\t"))
+		}
+		fmt.Fprintf(w, "\t\t;;\n")
+	}
+
+	fmt.Fprint(w, `	esac
+}
+
+if [[ "$funcstack[1]" == "_cloudflare-backup" ]]; then
+	_cloudflare_backup "$@"
+else
+	compdef _cloudflare_backup cloudflare-backup
+fi
+`)
+}
+
+func writeFishCompletion(w io.Writer, commands []completionCommand) {
+	fmt.Fprint(w, `# fish completion for cloudflare-backup. Load it with:
+#   cloudflare-backup completion fish | source
+
+function __cloudflare_backup_list
+	set -l prefix (string match -r '.*,' -- (commandline -ct))
+	for value in $argv
+		echo $prefix$value
+	end
+end
+
+function __cloudflare_backup_zones
+	set -l command (commandline -opc)[1]
+	__cloudflare_backup_list ($command completion zones 2>/dev/null)
+end
+
+complete -c cloudflare-backup -f
+`)
+
+	names := subcommandNames()
+	for _, command := range commands[1:] {
+		fmt.Fprintf(w, "complete -c cloudflare-backup -n __fish_use_subcommand -a %s -d %s\n", command.Name, fishQuote(command.Description))
+	}
+
+	for _, command := range commands {
+		condition := "__fish_seen_subcommand_from " + command.Name
+		if command.Name == "" {
+			condition = "not __fish_seen_subcommand_from " + strings.Join(names, " ")
+		}
+		condition = fishQuote(condition)
+
+		if len(command.Arguments) > 0 {
+			fmt.Fprintf(w, "complete -c cloudflare-backup -n %s -a %s\n", condition, fishQuote(strings.Join(command.Arguments, " ")))
+		}
+		for _, f := range command.Flags {
+			line := "complete -c cloudflare-backup -n " + condition + " -o " + f.Name
+			switch {
+			case !f.TakesValue:
+			case f.Zones:
+				line += " -x -a '(__cloudflare_backup_zones)'"
+			case f.List:
+				line += " -x -a " + fishQuote("(__cloudflare_backup_list "+strings.Join(f.Values, " ")+")")
+			case f.Values != nil:
+				line += " -x -a " + fishQuote(strings.Join(f.Values, " "))
+			default:
+				line += " -r -F"
+			}
+			fmt.Fprintln(w, line+" -d "+fishQuote(f.Description))
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// compressedExtension is added to the name of each file that -compress compresses.
+const compressedExtension = ".gz"
+
+// gzipMagic is how every gzip stream starts, so that compressed files can be read whatever they're called.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// writeRecordsFile writes a zone's DNS records file like writeOutputFile, compressing it with -compress. The manifest
+// then has the size of the compressed file, which is what its hash is of, along with the size of what's inside it.
+//
+// The file from before -compress was turned on or off is removed once the new one is in place, so that -drift and the
+// tombstones, which read whichever of the two they find first, never compare against a stale backup.
+func (b *backupRun) writeRecordsFile(name string, zoneReport *ZoneReport, manifestZone *manifestZone, write func(w io.Writer) error) error {
+	if b.options.Compress == "" {
+		err := b.writeOutputFile(name, zoneReport, manifestZone, write)
+		if err != nil {
+			return err
+		}
+		return b.removeOutputFile(name + compressedExtension)
+	}
+
+	uncompressed := countingWriter{}
+	err := b.writeOutputFile(name+compressedExtension, zoneReport, manifestZone, func(w io.Writer) error {
+		compressor := gzip.NewWriter(w)
+		uncompressed = countingWriter{w: compressor}
+		err := write(&uncompressed)
+		closeErr := compressor.Close()
+		if err != nil {
+			return err
+		}
+		return closeErr
+	})
+	if err != nil {
+		return err
+	}
+	manifestZone.Files[len(manifestZone.Files)-1].UncompressedSize = uncompressed.count
+	return b.removeOutputFile(name)
+}
+
+// removeOutputFile removes a file from the output directory, if it's there. The name is the same as for writeFile.
+func (b *backupRun) removeOutputFile(name string) error {
+	outputPath := filepath.Join(b.options.OutputDir, filepath.FromSlash(name))
+	if b.options.GPGRecipient != "" {
+		outputPath += ".gpg"
+	}
+	err := os.Remove(outputPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// decompressedReader returns a reader for what's inside r if it's gzip compressed, or for r itself if it isn't.
+func decompressedReader(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	start, err := buffered.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(start, gzipMagic) {
+		return buffered, nil
+	}
+	return gzip.NewReader(buffered)
+}
+
+// readBackupFile reads a file from a backup, decompressing it if it was written with -compress.
+func readBackupFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.HasPrefix(data, gzipMagic) {
+		return data, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// deleteFirstRecord deletes the first of a fake zone's DNS records, and changes its modified_on with it, so that the
+// cached pages from the last backup aren't used.
+func deleteFirstRecord(zone *fakeZone, from string, to string) {
+	zone.DNSRecords = zone.DNSRecords[1:]
+	zone.Zone = []byte(strings.Replace(string(zone.Zone), from, to, 1))
+}
+
+func TestDriftAfterTurningOnCompression(t *testing.T) {
+	api := newFakeAPI(t, "all-types")
+	dir := runTestBackup(t, api, "-resources", "dns")
+
+	deleteFirstRecord(api.zones[0], "2024-05-01T10:00:00", "2024-05-02T10:00:00")
+	runTestBackup(t, api, "-resources", "dns", "-drift", "-compress", "gzip", "-output", dir)
+	_, err := os.Stat(filepath.Join(dir, "example.com.txt"))
+	if !os.IsNotExist(err) {
+		t.Errorf("the uncompressed file from before -compress is still there: %v", err)
+	}
+
+	// the next backup compares against the compressed file, so it doesn't find the first deleted record again
+	deleteFirstRecord(api.zones[0], "2024-05-02T10:00:00", "2024-05-03T10:00:00")
+	runTestBackup(t, api, "-resources", "dns", "-drift", "-compress", "gzip", "-output", dir)
+	changelog, err := ioutil.ReadFile(filepath.Join(dir, changelogFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time := testTime.UTC().Format(changelogTimeFormat)
+	want := time + " example.com - A @ 192.0.2.1\n" + time + " example.com - AAAA @ 2001:db8::1\n"
+	if string(changelog) != want {
+		t.Errorf("got changelog %q, want %q", changelog, want)
+	}
+}
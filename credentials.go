@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// the environment variables that Cloudflare's Terraform provider reads its credentials from. They're read here too,
+// so that the same environment works for both.
+const (
+	apiTokenEnv  = "CLOUDFLARE_API_TOKEN"
+	apiKeyEnv    = "CLOUDFLARE_API_KEY"
+	apiEmailEnv  = "CLOUDFLARE_EMAIL"
+	accountIDEnv = "CLOUDFLARE_ACCOUNT_ID"
+)
+
+// apiCredentials is how a subcommand authenticates with the API: either an API token, or a global API key along with
+// the email of the user that it belongs to.
+type apiCredentials struct {
+	APIToken string
+	APIKey   string
+	APIEmail string
+
+	// source says where the credentials came from, for the log, set by resolve
+	source string
+}
+
+// registerFlags defines the flags for the credentials. tokenUsage is the description of -api-token, which says what
+// the subcommand needs the token to be able to do.
+func (c *apiCredentials) registerFlags(flags *flag.FlagSet, tokenUsage string) {
+	flags.StringVar(&c.APIToken, "api-token", "", tokenUsage+" If not set, "+apiTokenEnv+" is used.")
+	flags.StringVar(&c.APIKey, "api-key", "", "A global API key to use instead of an API token, along with -api-email. If not set, "+apiKeyEnv+" is used.")
+	flags.StringVar(&c.APIEmail, "api-email", "", "The email of the user that -api-key belongs to. If not set, "+apiEmailEnv+" is used.")
+}
+
+// resolve picks the credentials to use, the same way as Cloudflare's Terraform provider: the flags come first, and
+// the environment is only used if none of them are set. Either way, an API token wins over a global API key. It's
+// fine for there to be no credentials at all, which callers check for with empty.
+func (c *apiCredentials) resolve() error {
+	if c.APIToken != "" || c.APIKey != "" || c.APIEmail != "" {
+		if c.APIToken != "" && c.APIKey != "" {
+			return errors.New("The -api-token and -api-key flags can't be used together.")
+		}
+		if (c.APIKey == "") != (c.APIEmail == "") {
+			return errors.New("The -api-key and -api-email flags have to be used together.")
+		}
+		c.source = "the API token from -api-token"
+		if c.APIKey != "" {
+			c.source = "the global API key from -api-key and -api-email"
+		}
+		return nil
+	}
+
+	if token := os.Getenv(apiTokenEnv); token != "" {
+		c.APIToken = token
+		c.source = "the API token from " + apiTokenEnv
+		return nil
+	}
+
+	key, email := os.Getenv(apiKeyEnv), os.Getenv(apiEmailEnv)
+	if key == "" {
+		return nil
+	}
+	if email == "" {
+		return fmt.Errorf("%s is set, but %s isn't. A global API key needs the email of the user that it belongs to.", apiKeyEnv, apiEmailEnv)
+	}
+	c.APIKey = key
+	c.APIEmail = email
+	c.source = "the global API key from " + apiKeyEnv + " and " + apiEmailEnv
+	return nil
+}
+
+// empty returns true if there aren't any credentials to use.
+func (c *apiCredentials) empty() bool {
+	return c.APIToken == "" && c.APIKey == ""
+}
+
+// newClient creates a client that authenticates with the credentials, and logs where they came from.
+func (c *apiCredentials) newClient() *cloudflare.Client {
+	if c.source != "" {
+		log.Printf("Authenticating with %s.", c.source)
+	}
+	if c.APIKey != "" {
+		return cloudflare.NewClientWithKey(c.APIKey, c.APIEmail)
+	}
+	return cloudflare.NewClient(c.APIToken)
+}
+
+// errNoCredentials is returned by a subcommand that needs credentials, but doesn't have any.
+var errNoCredentials = errors.New("You must provide a CloudFlare API token with the -api-token flag or " + apiTokenEnv + ", or a global API key with -api-key and -api-email, or " + apiKeyEnv + " and " + apiEmailEnv + ".")
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// changelogFileName and changelogJSONFileName are the names of the changelog files in the output directory.
+const changelogFileName = "CHANGELOG.txt"
+const changelogJSONFileName = "changelog.ndjson"
+
+// changelogTimeFormat is used for the timestamps in the changelog, like "2024-05-01T02:00Z".
+const changelogTimeFormat = "2006-01-02T15:04Z"
+
+// recordChange is a difference in a zone's DNS records since the previous backup. Kind is "+" for a record that was
+// added, "-" for one that was removed, and "~" for one that was modified. Old is nil for added records, and New is
+// nil for removed records.
+type recordChange struct {
+	Kind string                `json:"kind"`
+	Old  *cloudflare.DNSRecord `json:"old,omitempty"`
+	New  *cloudflare.DNSRecord `json:"new,omitempty"`
+}
+
+// settingChange is a change in one of the zone's own settings since the previous backup, like whether it's paused.
+type settingChange struct {
+	Setting string `json:"setting"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+func (c settingChange) String() string {
+	return "~ zone " + c.Setting + ": " + c.Old + " -> " + c.New
+}
+
+// zoneChanges holds the changes found in one zone.
+type zoneChanges struct {
+	Time     string          `json:"time"`
+	Zone     string          `json:"zone"`
+	Changes  []recordChange  `json:"changes"`
+	Settings []settingChange `json:"settings,omitempty"`
+}
+
+// recordKey identifies a record by everything about it that can change, including its priority and the fields of
+// records like SRV and CAA, so that records can be compared between backups even when they don't have IDs.
+func recordKey(record cloudflare.DNSRecord) string {
+	priority := ""
+	if record.Priority != nil {
+		priority = strconv.Itoa(int(*record.Priority))
+	}
+	return baseRecordKey(record) + "\x00" + priority + "\x00" + canonicalRecordData(record.Data)
+}
+
+// baseRecordKey identifies a record by what every backup format keeps, which leaves out its priority and data, for
+// comparing records that were read from a format like text.
+func baseRecordKey(record cloudflare.DNSRecord) string {
+	return strings.ToUpper(record.Type) + "\x00" + normalizeName(record.Name) + "\x00" + record.Content + "\x00" +
+		strconv.FormatUint(record.TTL, 10) + "\x00" + strconv.FormatBool(record.Proxied)
+}
+
+// canonicalRecordData formats a record's data the same way no matter how it was indented, or what order its fields
+// were in, since the formats that keep it don't write it exactly as the API returned it.
+func canonicalRecordData(data json.RawMessage) string {
+	if len(data) == 0 {
+		return ""
+	}
+	var value interface{}
+	if json.Unmarshal(data, &value) != nil {
+		return string(data)
+	}
+	if value == nil {
+		return ""
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return string(data)
+	}
+	return string(canonical)
+}
+
+// diffRecords compares two sets of records, using key to tell whether two records are the same. Records that are
+// identical in both are ignored. Of the rest, records with the same type and name are paired up and reported as
+// modified, and any left over are reported as added or removed.
+func diffRecords(oldRecords []cloudflare.DNSRecord, newRecords []cloudflare.DNSRecord, key func(cloudflare.DNSRecord) string) []recordChange {
+	unmatched := map[string]int{}
+	for _, record := range newRecords {
+		unmatched[key(record)]++
+	}
+
+	removed := []cloudflare.DNSRecord{}
+	for _, record := range oldRecords {
+		k := key(record)
+		if unmatched[k] > 0 {
+			unmatched[k]--
+			continue
+		}
+		removed = append(removed, record)
+	}
+
+	added := []cloudflare.DNSRecord{}
+	for _, record := range newRecords {
+		k := key(record)
+		if unmatched[k] > 0 {
+			unmatched[k]--
+			added = append(added, record)
+		}
+	}
+
+	changes := []recordChange{}
+	for i := range removed {
+		old := removed[i]
+		change := recordChange{Kind: "-", Old: &old}
+		for j := range added {
+			if strings.EqualFold(added[j].Type, old.Type) && normalizeName(added[j].Name) == normalizeName(old.Name) {
+				new := added[j]
+				change = recordChange{Kind: "~", Old: &old, New: &new}
+				added = append(added[:j], added[j+1:]...)
+				break
+			}
+		}
+		changes = append(changes, change)
+	}
+	for i := range added {
+		new := added[i]
+		changes = append(changes, recordChange{Kind: "+", New: &new})
+	}
+
+	return changes
+}
+
+// relativeName returns a record's name relative to its zone, like "www", or "@" for the apex.
+func relativeName(name string, zoneName string) string {
+	name = normalizeName(name)
+	zoneName = normalizeName(zoneName)
+	if name == zoneName {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zoneName)
+}
+
+// describeValue formats a record's value for the changelog. The TTL, proxy status, and priority are only included if
+// showExtra is set.
+func describeValue(record cloudflare.DNSRecord, showExtra bool) string {
+	if !showExtra {
+		return record.Content
+	}
+
+	proxied := "not proxied"
+	if record.Proxied {
+		proxied = "proxied"
+	}
+	priority := ""
+	if record.Priority != nil {
+		priority = ", priority " + strconv.Itoa(int(*record.Priority))
+	}
+	return record.Content + " (ttl " + strconv.FormatUint(record.TTL, 10) + ", " + proxied + priority + ")"
+}
+
+// extrasChanged returns true if anything that describeValue only shows with showExtra is different between the
+// records, so that a change to it can be seen.
+func extrasChanged(old cloudflare.DNSRecord, new cloudflare.DNSRecord) bool {
+	oldPriority, newPriority := -1, -1
+	if old.Priority != nil {
+		oldPriority = int(*old.Priority)
+	}
+	if new.Priority != nil {
+		newPriority = int(*new.Priority)
+	}
+	return old.TTL != new.TTL || old.Proxied != new.Proxied || oldPriority != newPriority
+}
+
+// String formats the change as a single line, like "~ A www 1.2.3.4 -> 5.6.7.8".
+func (c recordChange) String(zoneName string) string {
+	switch c.Kind {
+	case "+":
+		return "+ " + c.New.Type + " " + relativeName(c.New.Name, zoneName) + " " + describeValue(*c.New, false)
+	case "-":
+		return "- " + c.Old.Type + " " + relativeName(c.Old.Name, zoneName) + " " + describeValue(*c.Old, false)
+	}
+
+	showExtra := extrasChanged(*c.Old, *c.New)
+	return "~ " + c.New.Type + " " + relativeName(c.New.Name, zoneName) + " " + describeValue(*c.Old, showExtra) + " -> " +
+		describeValue(*c.New, showExtra)
+}
+
+// loadPreviousRecords reads the DNS records from the zone's previous backup, along with when it was written. It
+// returns false if there isn't one.
+func (b *backupRun) loadPreviousRecords(zone cloudflare.Zone) ([]cloudflare.DNSRecord, time.Time, bool, error) {
+	name, file, found, err := b.openPreviousBackup(zone, "dns."+b.format.Extension)
+	if !found || err != nil {
+		return nil, time.Time{}, found, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	reader, err := decompressedReader(file)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("%s: %w", name, err)
+	}
+	records, err := b.format.ParseRecords(reader)
+	if err != nil {
+		return nil, time.Time{}, false, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return records, info.ModTime(), true, nil
+}
+
+// loadPreviousZone reads the zone's metadata from its previous backup, for comparing its settings. It returns false
+// if there isn't one, or if the format doesn't keep the zone's metadata.
+func (b *backupRun) loadPreviousZone(zone cloudflare.Zone) (cloudflare.Zone, bool, error) {
+	if b.options.Layout != "dir" && !b.format.HasZone {
+		return cloudflare.Zone{}, false, nil
+	}
+
+	name, file, found, err := b.openPreviousBackup(zone, "zone.json")
+	if !found || err != nil {
+		return cloudflare.Zone{}, found, err
+	}
+	file.Close()
+
+	previous, err := readBackupZone(filepath.Join(b.options.OutputDir, filepath.FromSlash(name)))
+	if err != nil {
+		return cloudflare.Zone{}, false, fmt.Errorf("%s: %w", name, err)
+	}
+	return previous, true, nil
+}
+
+// openPreviousBackup opens the zone's previous backup file, or the file with the given name in its directory with
+// -layout dir, and returns its name relative to the output directory. It returns false if there isn't one.
+func (b *backupRun) openPreviousBackup(zone cloudflare.Zone, dirFileName string) (string, *os.File, bool, error) {
+	// the previous backup might have been made before -group-by-account was turned on or off, so both places are tried
+	bases := []string{b.zonePath(zone.ID), path.Join(b.accountDirs[zone.ID], b.fileNames[zone.ID])}
+	if b.options.GroupByAccount {
+		bases[1] = b.fileNames[zone.ID]
+	}
+
+	var name string
+	var file *os.File
+	var err error
+	for _, base := range bases {
+		name = base + "." + b.format.Extension
+		if b.options.Layout == "dir" {
+			name = path.Join(base, dirFileName)
+		}
+
+		// and so might have been compressed, or not, whatever -compress is set to now
+		file, err = os.Open(filepath.Join(b.options.OutputDir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			name += compressedExtension
+			file, err = os.Open(filepath.Join(b.options.OutputDir, filepath.FromSlash(name)))
+		}
+		if !os.IsNotExist(err) {
+			break
+		}
+	}
+	if os.IsNotExist(err) {
+		return "", nil, false, nil
+	}
+	if err != nil {
+		return "", nil, false, err
+	}
+	return name, file, true, nil
+}
+
+// diffZoneSettings compares the zone's own settings, like whether it's paused, to the previous backup. Settings that
+// the previous backup doesn't have are skipped.
+func diffZoneSettings(previous cloudflare.Zone, current cloudflare.Zone) []settingChange {
+	changes := []settingChange{}
+	if previous.Paused != current.Paused {
+		changes = append(changes, settingChange{"paused", yesNo(previous.Paused), yesNo(current.Paused)})
+	}
+	if previous.DevelopmentMode != nil && current.DevelopmentMode != nil && previous.DevelopmentMode.Value != current.DevelopmentMode.Value {
+		changes = append(changes, settingChange{"development_mode", previous.DevelopmentMode.Value, current.DevelopmentMode.Value})
+	}
+	return changes
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// appendChangelog adds the changes from this run to the end of the changelog files. Each file is rewritten to a
+// temporary file and renamed into place, so anything reading it never sees a partially-written entry.
+func (b *backupRun) appendChangelog() error {
+	if len(b.changes) == 0 {
+		return nil
+	}
+
+	text := ""
+	ndjson := ""
+	for _, zone := range b.changes {
+		for _, change := range zone.Settings {
+			text += zone.Time + " " + zone.Zone + " " + change.String() + "\n"
+		}
+		for _, change := range zone.Changes {
+			text += zone.Time + " " + zone.Zone + " " + change.String(zone.Zone) + "\n"
+		}
+
+		line, err := json.Marshal(zone)
+		if err != nil {
+			return err
+		}
+		ndjson += string(line) + "\n"
+	}
+
+	err := appendFileAtomic(filepath.Join(b.options.OutputDir, changelogFileName), text, os.FileMode(b.options.FileMode))
+	if err != nil {
+		return err
+	}
+
+	return appendFileAtomic(filepath.Join(b.options.OutputDir, changelogJSONFileName), ndjson, os.FileMode(b.options.FileMode))
+}
+
+// appendFileAtomic adds data to the end of a file by writing a new copy of the whole file and renaming it into place.
+func appendFileAtomic(path string, data string, mode os.FileMode) error {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return writeFileAtomic(path, append(existing, data...), mode)
+}
+
+// changelogTime formats the time of the run for the changelog.
+func (b *backupRun) changelogTime() string {
+	return b.report.Start.UTC().Format(changelogTimeFormat)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// endpointLabelPattern is what an endpoint's label can look like. It's used as a directory name, so it's kept to
+// characters that are safe everywhere.
+var endpointLabelPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// endpoint is an API host to back up from, with the token to use for it, as listed in the -endpoints file. Each
+// endpoint is backed up in a run of its own, into a directory named after its label. The token can be given directly,
+// or in an environment variable, so that the file doesn't have to hold secrets.
+type endpoint struct {
+	Label       string `json:"label"`
+	APIBaseURL  string `json:"api_base_url"`
+	APIToken    string `json:"api_token"`
+	APITokenEnv string `json:"api_token_env"`
+}
+
+// readEndpoints reads and checks the -endpoints file, which holds a JSON array of endpoints.
+func readEndpoints(path string) ([]endpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the -endpoints file: %w", err)
+	}
+
+	endpoints := []endpoint{}
+	err = json.Unmarshal(data, &endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the -endpoints file: %w", jsonParseError(data, err))
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("The -endpoints file doesn't list any endpoints.")
+	}
+
+	seen := map[string]bool{}
+	for i := range endpoints {
+		e := &endpoints[i]
+		if !endpointLabelPattern.MatchString(e.Label) {
+			return nil, fmt.Errorf("Endpoint %d in the -endpoints file needs a label made of letters, numbers, dots, dashes, and underscores, not %q.", i+1, e.Label)
+		}
+		for _, reserved := range []string{accountsDirName, htmlReportDirName, unknownAccountDirName, cacheDirName} {
+			if strings.EqualFold(e.Label, reserved) {
+				return nil, fmt.Errorf("The endpoint label %q can't be used, since the backup uses a directory with that name.", e.Label)
+			}
+		}
+		if seen[strings.ToLower(e.Label)] {
+			return nil, fmt.Errorf("The endpoint label %q is used more than once.", e.Label)
+		}
+		seen[strings.ToLower(e.Label)] = true
+
+		if e.APIBaseURL == "" {
+			e.APIBaseURL = cloudflare.DefaultBaseURL
+		}
+		baseURL, err := url.Parse(e.APIBaseURL)
+		if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+			return nil, fmt.Errorf("The api_base_url of endpoint %s must be an absolute http or https URL.", e.Label)
+		}
+		baseURL.Path = strings.TrimSuffix(baseURL.Path, "/") + "/"
+		e.APIBaseURL = baseURL.String()
+
+		if (e.APIToken == "") == (e.APITokenEnv == "") {
+			return nil, fmt.Errorf("Endpoint %s needs either an api_token or an api_token_env.", e.Label)
+		}
+		if e.APITokenEnv != "" {
+			e.APIToken = os.Getenv(e.APITokenEnv)
+			if e.APIToken == "" {
+				return nil, fmt.Errorf("The %s environment variable, which has the API token for endpoint %s, isn't set.", e.APITokenEnv, e.Label)
+			}
+		}
+	}
+
+	return endpoints, nil
+}
+
+// options returns a copy of the options for backing up from the endpoint. The backup goes in a directory named after
+// the endpoint, and the summary file gets the endpoint's label in its name, so each endpoint gets files of its own.
+func (e endpoint) options(opts *options) *options {
+	endpointOpts := *opts
+	endpointOpts.endpoint = e.Label
+	endpointOpts.apiCredentials = apiCredentials{APIToken: e.APIToken, source: "the API token of endpoint " + e.Label}
+	endpointOpts.APIBaseURL = e.APIBaseURL
+	endpointOpts.OutputDir = filepath.Join(opts.OutputDir, e.Label)
+	endpointOpts.SummaryJSON = endpointFileName(opts.SummaryJSON, e.Label)
+	return &endpointOpts
+}
+
+// endpointFileName adds the endpoint's label to a file name, before its extension, like summary.china.json.
+func endpointFileName(name string, label string) string {
+	if name == "" {
+		return ""
+	}
+	extension := filepath.Ext(name)
+	return strings.TrimSuffix(name, extension) + "." + label + extension
+}
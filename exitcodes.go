@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// the exit codes for the kinds of failure that need different fixes
+const (
+	exitFailure        = 1
+	exitAuthentication = 3
+	exitPermission     = 4
+	exitRateLimited    = 5
+	exitRequestLimit   = 6
+	exitBaseline       = 7
+
+	// exitInterrupted is what shells use for a process stopped by Ctrl+C
+	exitInterrupted = 130
+)
+
+// exitCode picks the exit code for a run that failed with the given errors. If there are several kinds of error, the
+// one that's most likely to be the cause of the others wins, and an interrupted run always says so.
+func exitCode(errs []error) int {
+	for _, kind := range []struct {
+		err  error
+		code int
+	}{
+		{errInterrupted, exitInterrupted},
+		{errRequestLimit, exitRequestLimit},
+		{cloudflare.ErrAuthentication, exitAuthentication},
+		{cloudflare.ErrPermission, exitPermission},
+		{cloudflare.ErrRateLimited, exitRateLimited},
+		{errBaselineDeviation, exitBaseline},
+	} {
+		for _, err := range errs {
+			if errors.Is(err, kind.err) {
+				return kind.code
+			}
+		}
+	}
+	return exitFailure
+}
+
+// errorHint returns advice on fixing an error from the API, or "" if there's nothing more to say than the error itself.
+func errorHint(err error) string {
+	apiError := &cloudflare.APIError{}
+	errors.As(err, &apiError)
+
+	switch {
+	case errors.Is(err, cloudflare.ErrAuthentication):
+		return "Cloudflare didn't accept the API token. Check that it was copied correctly, and that it hasn't expired or been revoked."
+	case errors.Is(err, cloudflare.ErrPermission) && apiError.MissingScope() != "":
+		return "The API token doesn't have permission for " + apiError.Path + ". It probably needs the " + apiError.MissingScope() + " permission."
+	case errors.Is(err, cloudflare.ErrPermission):
+		return "The API token doesn't have permission for something that was needed. Check the permissions that it was created with."
+	case errors.Is(err, cloudflare.ErrRateLimited) && apiError.RetryAfter > 0:
+		return "Cloudflare's rate limit was hit, and it asked for a wait of " + apiError.RetryAfter.Round(time.Second).String() + ". Try again later, or use -rate-limit to slow down."
+	case errors.Is(err, cloudflare.ErrRateLimited):
+		return "Cloudflare's rate limit was hit. Try again later, or use -rate-limit to slow down."
+	}
+	return ""
+}
+
+// logErrorHints logs the advice for each kind of error once.
+func logErrorHints(errs []error) {
+	seen := map[string]bool{}
+	for _, err := range errs {
+		hint := errorHint(err)
+		if hint != "" && !seen[hint] {
+			seen[hint] = true
+			log.Println(hint)
+		}
+	}
+}
+
+// fatal logs the error, along with any advice on fixing it, and exits with the matching exit code.
+func fatal(err error) {
+	log.Println(err)
+	logErrorHints([]error{err})
+	os.Exit(exitCode([]error{err}))
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// update rewrites the golden files with the current output, instead of comparing the output with them. Run
+// go test -run <test> -update after a change to the output, and check the diff of testdata/golden before committing it.
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden with the current output")
+
+// testTime is when every backup made by the tests was taken, so that the golden files don't change from run to run.
+var testTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	// the backup logs as it goes, which is only worth seeing when a test fails, and then with -v
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	os.Exit(m.Run())
+}
+
+// fakeZone is a zone in testdata/zones, with what the API returns for it.
+type fakeZone struct {
+	Zone       json.RawMessage   `json:"zone"`
+	DNSRecords []json.RawMessage `json:"dns_records"`
+	PageRules  []json.RawMessage `json:"pagerules"`
+
+	// EmailRoutingDNS is the result of the zone's email/routing/dns endpoint. Zones without it get a 403 from it, like
+	// a token without the Email Routing permission does.
+	EmailRoutingDNS json.RawMessage `json:"email_routing_dns"`
+
+	id   string
+	name string
+}
+
+// loadFakeZone reads testdata/zones/<fixture>.json.
+func loadFakeZone(t testing.TB, fixture string) *fakeZone {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "zones", fixture+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone := &fakeZone{}
+	err = json.Unmarshal(data, zone)
+	if err != nil {
+		t.Fatalf("couldn't parse fixture %s: %s", fixture, err)
+	}
+
+	info := cloudflare.Zone{}
+	err = json.Unmarshal(zone.Zone, &info)
+	if err != nil {
+		t.Fatalf("couldn't parse zone of fixture %s: %s", fixture, err)
+	}
+	zone.id = info.ID
+	zone.name = info.Name
+	return zone
+}
+
+// fakeAPI is an httptest server that answers the requests that a backup makes like the Cloudflare API does, from the
+// zones that it's given. Requests for anything else get the 403 that the API returns when the token doesn't have
+// permission, so the backup skips those resources. Tests can answer requests differently with handle.
+type fakeAPI struct {
+	server *httptest.Server
+	zones  []*fakeZone
+
+	// maxPerPage is the most items returned in a page of a list, however many were asked for, so that fixtures with a
+	// few records still take several pages
+	maxPerPage int
+
+	mu       sync.Mutex
+	handlers []fakeHandler
+	requests []string
+}
+
+// fakeHandler answers the requests whose path, without /client/v4/, matches a path.Match pattern.
+type fakeHandler struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// newFakeAPI starts a fake API with the zones from the given fixtures, which is stopped when the test finishes.
+func newFakeAPI(t testing.TB, fixtures ...string) *fakeAPI {
+	t.Helper()
+
+	api := &fakeAPI{maxPerPage: 3}
+	for _, fixture := range fixtures {
+		api.zones = append(api.zones, loadFakeZone(t, fixture))
+	}
+	api.server = httptest.NewServer(http.HandlerFunc(api.serveHTTP))
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+// URL returns the API's base URL, for -api-base-url.
+func (f *fakeAPI) URL() string {
+	return f.server.URL + "/client/v4/"
+}
+
+// handle answers requests whose path matches pattern, like "zones/*/dns_records", with handler, instead of the usual
+// response. Handlers added later take precedence.
+func (f *fakeAPI) handle(pattern string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers = append([]fakeHandler{{pattern, handler}}, f.handlers...)
+}
+
+// requested returns how many requests have been made for paths that match pattern.
+func (f *fakeAPI) requested(pattern string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, requestPath := range f.requests {
+		if matched, _ := path.Match(pattern, requestPath); matched {
+			count++
+		}
+	}
+	return count
+}
+
+func (f *fakeAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	requestPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/client/v4"), "/")
+
+	f.mu.Lock()
+	f.requests = append(f.requests, requestPath)
+	handlers := f.handlers
+	f.mu.Unlock()
+
+	if r.Header.Get("Authorization") == "" {
+		writeFakeError(w, http.StatusBadRequest, 9106, "Missing X-Auth-Key, X-Auth-Email or Authorization headers")
+		return
+	}
+
+	for _, handler := range handlers {
+		if matched, _ := path.Match(handler.pattern, requestPath); matched {
+			handler.handler(w, r)
+			return
+		}
+	}
+
+	f.serveDefault(w, r)
+}
+
+// serveDefault answers a request the way that the fake API does without any handlers, so that a handler can pass
+// requests on to it.
+func (f *fakeAPI) serveDefault(w http.ResponseWriter, r *http.Request) {
+	requestPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/client/v4"), "/")
+	if r.Method != http.MethodGet {
+		writeFakeError(w, http.StatusMethodNotAllowed, 10405, "Method not allowed for this endpoint")
+		return
+	}
+
+	parts := strings.Split(requestPath, "/")
+	switch {
+	case requestPath == "user/tokens/verify":
+		writeFakeResult(w, map[string]string{"id": "0123456789abcdef0123456789abcdef", "status": "active"})
+		return
+
+	case requestPath == "accounts":
+		accounts := []json.RawMessage{}
+		seen := map[string]bool{}
+		for _, zone := range f.zones {
+			info := cloudflare.Zone{}
+			json.Unmarshal(zone.Zone, &info)
+			if info.Account != nil && !seen[info.Account.ID] {
+				seen[info.Account.ID] = true
+				account, _ := json.Marshal(info.Account)
+				accounts = append(accounts, account)
+			}
+		}
+		f.writePage(w, r, accounts)
+		return
+
+	case requestPath == "zones":
+		zones := []json.RawMessage{}
+		for _, zone := range f.zones {
+			if name := r.URL.Query().Get("name"); name == "" || name == zone.name {
+				zones = append(zones, zone.Zone)
+			}
+		}
+		f.writePage(w, r, zones)
+		return
+
+	case len(parts) >= 2 && parts[0] == "zones":
+		zone := f.zone(parts[1])
+		if zone == nil {
+			writeFakeError(w, http.StatusNotFound, 1001, "Invalid zone identifier")
+			return
+		}
+
+		switch strings.Join(parts[2:], "/") {
+		case "":
+			writeFakeResult(w, zone.Zone)
+			return
+		case "dns_records":
+			f.writePage(w, r, zone.DNSRecords)
+			return
+		case "pagerules":
+			writeFakeResult(w, zone.PageRules)
+			return
+		case "pagerules/settings":
+			writeFakeResult(w, []json.RawMessage{})
+			return
+		case "email/routing/dns":
+			if zone.EmailRoutingDNS != nil {
+				writeFakeResult(w, zone.EmailRoutingDNS)
+				return
+			}
+		}
+	}
+
+	writeFakeError(w, http.StatusForbidden, 10000, "Authentication error")
+}
+
+// zone returns the zone with the given ID, or nil if there isn't one.
+func (f *fakeAPI) zone(id string) *fakeZone {
+	for _, zone := range f.zones {
+		if zone.id == id {
+			return zone
+		}
+	}
+	return nil
+}
+
+// writePage writes the page of items that the request asks for, with its result_info.
+func (f *fakeAPI) writePage(w http.ResponseWriter, r *http.Request, items []json.RawMessage) {
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = 20
+	}
+	if perPage > f.maxPerPage {
+		perPage = f.maxPerPage
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	start := (page - 1) * perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+	totalPages := (len(items) + perPage - 1) / perPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	writeFakeResponse(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"errors":   []interface{}{},
+		"messages": []interface{}{},
+		"result":   items[start:end],
+		"result_info": cloudflare.ResultInfo{
+			Page:       page,
+			PerPage:    perPage,
+			Count:      end - start,
+			TotalCount: len(items),
+			TotalPages: totalPages,
+		},
+	})
+}
+
+// writeFakeResult writes a successful response with the given result.
+func writeFakeResult(w http.ResponseWriter, result interface{}) {
+	writeFakeResponse(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"errors":   []interface{}{},
+		"messages": []interface{}{},
+		"result":   result,
+	})
+}
+
+// writeFakeError writes a failed response with the given status and error.
+func writeFakeError(w http.ResponseWriter, status int, code int, message string) {
+	writeFakeResponse(w, status, map[string]interface{}{
+		"success":  false,
+		"errors":   []cloudflare.Error{{Code: code, Message: message}},
+		"messages": []interface{}{},
+		"result":   nil,
+	})
+}
+
+func writeFakeResponse(w http.ResponseWriter, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// newTestBackup sets up a backup of the fake API with the given flags, the way main does, into a new directory unless
+// -output is one of them. It's taken at testTime, and retries failed requests without waiting.
+func newTestBackup(t testing.TB, api *fakeAPI, args ...string) *backupRun {
+	t.Helper()
+
+	opts := &options{}
+	flags := flag.NewFlagSet("cloudflare-backup", flag.ContinueOnError)
+	opts.registerFlags(flags)
+	err := flags.Parse(append([]string{"-api-token", "test-token", "-api-base-url", api.URL(), "-output", t.TempDir()}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.ZoneNames = flags.Args()
+
+	// every backup in the tests is read back in as it's written, unless the test says otherwise, or it's written in a
+	// way that can't be
+	selfCheckSet := false
+	flags.Visit(func(f *flag.Flag) {
+		selfCheckSet = selfCheckSet || f.Name == "self-check"
+	})
+	if !selfCheckSet {
+		opts.SelfCheck = !opts.StreamRecords && !opts.SingleFile
+	}
+
+	err = opts.validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = prepareOutputDir(opts.OutputDir, os.FileMode(opts.DirMode))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := newBackupRun(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.report.Start = testTime
+	run.client.RetryPolicy.Backoff = time.Millisecond
+	return run
+}
+
+// runTestBackup makes a backup of the fake API with the given flags, fails the test if it fails, and returns the
+// output directory.
+func runTestBackup(t testing.TB, api *fakeAPI, args ...string) string {
+	t.Helper()
+
+	run := newTestBackup(t, api, args...)
+	report := run.run(context.Background())
+	if report.Failed() {
+		t.Fatalf("backup failed: %s", strings.Join(report.Errors, "; "))
+	}
+	return run.options.OutputDir
+}
+
+// checkGolden compares output with testdata/golden/<name>, or writes it there with -update.
+func checkGolden(t testing.TB, name string, output []byte) {
+	t.Helper()
+
+	goldenPath := filepath.Join("testdata", "golden", filepath.FromSlash(name))
+	if *update {
+		err := os.MkdirAll(filepath.Dir(goldenPath), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(goldenPath, output, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("%s (run go test -update to create it)", err)
+	}
+	if bytes.Equal(output, golden) {
+		return
+	}
+
+	outputLines := strings.Split(string(output), "\n")
+	goldenLines := strings.Split(string(golden), "\n")
+	for i := 0; i < len(outputLines) || i < len(goldenLines); i++ {
+		outputLine, goldenLine := "(end of file)", "(end of file)"
+		if i < len(outputLines) {
+			outputLine = outputLines[i]
+		}
+		if i < len(goldenLines) {
+			goldenLine = goldenLines[i]
+		}
+		if outputLine != goldenLine {
+			t.Fatalf("output doesn't match %s at line %d (run go test -update if the change is intended):\ngot:  %q\nwant: %q", goldenPath, i+1, outputLine, goldenLine)
+		}
+	}
+}
+
+// checkGoldenFile compares a file in the output directory with testdata/golden/<name>.
+func checkGoldenFile(t testing.TB, dir string, file string, name string) {
+	t.Helper()
+
+	output, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, name, output)
+}
+
+// addZone adds a copy of a fixture's zone with a different ID and name, for tests that need several zones that only
+// differ in those.
+func (f *fakeAPI) addZone(t testing.TB, fixture string, id string, name string) {
+	t.Helper()
+
+	zone := loadFakeZone(t, fixture)
+	fields := map[string]interface{}{}
+	err := json.Unmarshal(zone.Zone, &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields["id"] = id
+	fields["name"] = name
+	zone.Zone, err = json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone.id = id
+	zone.name = name
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.zones = append(f.zones, zone)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// windowsReservedNames are the device names that Windows won't use as file names, even with an extension added, in
+// lowercase.
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// sanitizeFileName makes a zone name safe to use as a file name. Path separators, control characters, and characters
+// that Windows doesn't allow are replaced with underscores, and leading dots are removed so that the file isn't
+// hidden and can't refer to a parent directory.
+//
+// Windows also ignores trailing dots and spaces, so they're removed, and a name that starts with a reserved device
+// name, like con.example, gets an underscore after that part (con_.example). This is done on every platform, so that a
+// backup has the same file names wherever it was made.
+func sanitizeFileName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	sanitized = strings.TrimLeft(sanitized, ".")
+	sanitized = strings.TrimRight(sanitized, ". ")
+	if sanitized == "" {
+		sanitized = "_"
+	}
+
+	stem := strings.SplitN(sanitized, ".", 2)[0]
+	if windowsReservedNames[strings.ToLower(strings.TrimRight(stem, " "))] {
+		sanitized = stem + "_" + sanitized[len(stem):]
+	}
+
+	return sanitized
+}
+
+// zoneFileNames picks the base file name used for each zone's output, keyed by zone ID. If two zones sanitize to the
+// same name, each of them gets its zone ID appended to keep them apart. Names are compared case-insensitively, since
+// that's how Windows and macOS file systems compare them.
+func zoneFileNames(zones []cloudflare.Zone) map[string]string {
+	ids := []string{}
+	names := []string{}
+	for _, zone := range zones {
+		ids = append(ids, zone.ID)
+		names = append(names, zone.Name)
+	}
+	return uniqueFileNames(ids, names)
+}
+
+// unknownAccountDirName is the directory that -group-by-account puts zones in if the zone listing didn't say which
+// account they belong to.
+const unknownAccountDirName = "unknown-account"
+
+// reservedAccountDirNames are used for other things at the top of the output directory, so accounts with these names
+// get their ID added, like other collisions.
+var reservedAccountDirNames = map[string]bool{
+	accountsDirName:       true,
+	htmlReportDirName:     true,
+	unknownAccountDirName: true,
+}
+
+// zoneAccountDirNames picks the directory that each zone goes in with -group-by-account, keyed by zone ID. The
+// directory is named after the zone's account, or the account's ID if it doesn't have a name.
+func zoneAccountDirNames(zones []cloudflare.Zone) map[string]string {
+	accounts := []cloudflare.Account{}
+	seen := map[string]bool{}
+	for _, zone := range zones {
+		if zone.Account == nil || zone.Account.ID == "" || seen[zone.Account.ID] {
+			continue
+		}
+		seen[zone.Account.ID] = true
+
+		account := *zone.Account
+		if account.Name == "" {
+			account.Name = account.ID
+		}
+		accounts = append(accounts, account)
+	}
+
+	accountNames := accountDirNames(accounts)
+	for id, name := range accountNames {
+		if reservedAccountDirNames[strings.ToLower(name)] {
+			accountNames[id] = name + "_" + sanitizeFileName(id)
+		}
+	}
+
+	dirNames := map[string]string{}
+	for _, zone := range zones {
+		dirNames[zone.ID] = unknownAccountDirName
+		if zone.Account != nil && zone.Account.ID != "" {
+			dirNames[zone.ID] = accountNames[zone.Account.ID]
+		}
+	}
+	return dirNames
+}
+
+// uniqueFileNames sanitizes each name, appending its ID if it would collide with another one. The result is keyed by
+// ID.
+func uniqueFileNames(ids []string, names []string) map[string]string {
+	counts := map[string]int{}
+	for _, name := range names {
+		counts[strings.ToLower(sanitizeFileName(name))]++
+	}
+
+	fileNames := map[string]string{}
+	for i, id := range ids {
+		name := sanitizeFileName(names[i])
+		if counts[strings.ToLower(name)] > 1 {
+			name += "_" + sanitizeFileName(id)
+		}
+		fileNames[id] = name
+	}
+
+	return fileNames
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+		{"bücher.example", "bücher.example"},
+		{"../../etc/passwd", "_.._etc_passwd"},
+		{"..", "_"},
+		{".hidden.example", "hidden.example"},
+		{"a/b\\c.example", "a_b_c.example"},
+		{"nul\x00byte.example", "nul_byte.example"},
+		{"what?.example", "what_.example"},
+		{"trailing.example. ", "trailing.example"},
+		{"con.example", "con_.example"},
+		{"CON", "CON_"},
+		{"lpt1.example.com", "lpt1_.example.com"},
+		{"console.example", "console.example"},
+	} {
+		if got := sanitizeFileName(test.name); got != test.want {
+			t.Errorf("sanitizeFileName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestZoneFileNamesCollisions(t *testing.T) {
+	names := zoneFileNames([]cloudflare.Zone{
+		{ID: "zone1", Name: "a/b.example"},
+		{ID: "zone2", Name: "a_b.example"},
+		{ID: "zone3", Name: "Example.com"},
+		{ID: "zone4", Name: "example.com"},
+		{ID: "zone5", Name: "xn--bcher-kva.example"},
+	})
+	want := map[string]string{
+		"zone1": "a_b.example_zone1",
+		"zone2": "a_b.example_zone2",
+		"zone3": "Example.com_zone3",
+		"zone4": "example.com_zone4",
+		"zone5": "xn--bcher-kva.example",
+	}
+	for id, name := range want {
+		if names[id] != name {
+			t.Errorf("%s's file name is %q, want %q", id, names[id], name)
+		}
+	}
+}
+
+func TestBackupCollidingZoneNames(t *testing.T) {
+	// the same zone can be added to two accounts, and a zone name that differs only in case is the same file on
+	// Windows and macOS
+	api := newFakeAPI(t, "idn")
+	api.addZone(t, "empty", "aaaa0000000000000000000000000001", "Empty.example")
+	api.addZone(t, "empty", "bbbb0000000000000000000000000002", "empty.example")
+	dir := runTestBackup(t, api)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backups := []string{}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".txt") {
+			backups = append(backups, file.Name())
+		}
+	}
+	want := "Empty.example_aaaa0000000000000000000000000001.txt,empty.example_bbbb0000000000000000000000000002.txt,xn--bcher-kva.example.txt"
+	if got := strings.Join(backups, ","); got != want {
+		t.Errorf("got backups %s, want %s", got, want)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "empty.example_bbbb0000000000000000000000000002.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# DNS zone backup for empty.example\r\n") {
+		t.Error("the second zone's backup isn't of that zone")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "empty.example.txt")); err == nil {
+		t.Error("a zone that collides with another was backed up without its ID")
+	}
+}
@@ -0,0 +1,84 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// These tests need a real Windows file system, where reserved device names open the device instead of a file,
+// trailing dots and spaces are dropped, and names that differ only in case are the same file, so they only run on
+// Windows. They don't need anything else set up, so go test runs them on any Windows machine.
+
+func TestSanitizedFileNamesOnWindows(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"con.example", "CON", "aux.example.com", "nul", "prn.example", "com1.example", "lpt9.example.com",
+		"trailing.example.", "space.example ", "a:b.example", "what?.example", "star*.example", "pipe|.example",
+		`quote".example`, "<angle>.example", "back\\slash.example", "../parent.example", "xn--bcher-kva.example",
+	}
+
+	want := []string{}
+	for _, name := range names {
+		fileName := sanitizeFileName(name) + ".txt"
+		err := writeFileAtomic(filepath.Join(dir, fileName), []byte(name), 0644)
+		if err != nil {
+			t.Errorf("couldn't write %s for %q: %s", fileName, name, err)
+			continue
+		}
+		want = append(want, fileName)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, fileName))
+		if err != nil || string(data) != name {
+			t.Errorf("couldn't read %s back for %q: %v", fileName, name, err)
+		}
+	}
+
+	// writing to a device name would succeed without creating a file, so check that every file is really there,
+	// under the name it was written with
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, file := range files {
+		got = append(got, file.Name())
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("the directory has:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCaseCollidingFileNamesOnWindows(t *testing.T) {
+	dir := t.TempDir()
+	zones := []cloudflare.Zone{
+		{ID: "zone1", Name: "Example.com"},
+		{ID: "zone2", Name: "example.com"},
+		{ID: "zone3", Name: "EXAMPLE.COM"},
+	}
+	fileNames := zoneFileNames(zones)
+	for _, zone := range zones {
+		err := writeFileAtomic(filepath.Join(dir, fileNames[zone.ID]+".txt"), []byte(zone.ID), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the names only differ in case, which is the same file on Windows, so without the IDs each would overwrite
+	// the last
+	for _, zone := range zones {
+		data, err := ioutil.ReadFile(filepath.Join(dir, fileNames[zone.ID]+".txt"))
+		if err != nil || string(data) != zone.ID {
+			t.Errorf("%s's file has %q (%v), want its ID", zone.Name, data, err)
+		}
+	}
+}
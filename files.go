@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// fileMode is a flag.Value for file permissions, written in octal like chmod.
+type fileMode os.FileMode
+
+func (m *fileMode) String() string {
+	return "0" + strconv.FormatUint(uint64(*m), 8)
+}
+
+func (m *fileMode) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return strconv.ErrSyntax
+	}
+
+	*m = fileMode(mode)
+	return nil
+}
+
+// stringList is a flag.Value for flags that can be given more than once, collecting each value. Values can also be
+// separated by commas.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			*l = append(*l, part)
+		}
+	}
+	return nil
+}
+
+// prepareOutputDir creates the output directory, including any missing parents, and checks that we can write to it.
+// This way, permission problems show up before any time is spent talking to the API.
+func prepareOutputDir(outputDir string, mode os.FileMode) error {
+	outputDirStat, err := os.Stat(outputDir)
+	if os.IsNotExist(err) {
+		// create the output directory then
+		err = os.MkdirAll(outputDir, mode)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if !outputDirStat.IsDir() {
+		return errors.New("The provided output path must be a directory, not a file.")
+	}
+
+	probe, err := ioutil.TempFile(outputDir, ".cloudflare-backup-probe")
+	if err != nil {
+		return fmt.Errorf("The output directory isn't writable: %w", err)
+	}
+	probe.Close()
+
+	err = os.Remove(probe.Name())
+	if err != nil {
+		return fmt.Errorf("Couldn't remove the probe file from the output directory: %w", err)
+	}
+
+	return nil
+}
+
+// checkOutputDirWritable checks that the output directory could be written to, without creating it. If it doesn't
+// exist yet, its closest existing parent is checked instead.
+func checkOutputDirWritable(outputDir string) error {
+	dir := outputDir
+	for {
+		stat, err := os.Stat(dir)
+		if err == nil {
+			if !stat.IsDir() {
+				return fmt.Errorf("The output path %s isn't a directory.", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("None of the parents of the output directory %s exist.", outputDir)
+		}
+		dir = parent
+	}
+
+	probe, err := ioutil.TempFile(dir, ".cloudflare-backup-probe")
+	if err != nil {
+		return fmt.Errorf("The output directory isn't writable: %w", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// createFile creates or truncates a file with the given permissions. Unlike os.OpenFile, the permissions are also
+// applied when the file already exists.
+func createFile(path string, mode os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setFileMode(path, mode)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path, then renames it into place.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tempFile.Write(data)
+	if err != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return err
+	}
+
+	err = setFileMode(tempFile.Name(), mode)
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return err
+	}
+
+	err = os.Rename(tempFile.Name(), path)
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return err
+	}
+
+	return nil
+}
+
+// sameContent returns true if the two files have the same lines, ignoring lines that start with any of the volatile
+// prefixes (after any leading whitespace). It returns false if either file can't be read.
+func sameContent(pathA string, pathB string, volatilePrefixes []string) bool {
+	linesA, err := readNonVolatileLines(pathA, volatilePrefixes)
+	if err != nil {
+		return false
+	}
+
+	linesB, err := readNonVolatileLines(pathB, volatilePrefixes)
+	if err != nil {
+		return false
+	}
+
+	if len(linesA) != len(linesB) {
+		return false
+	}
+	for i := range linesA {
+		if linesA[i] != linesB[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func readNonVolatileLines(path string, volatilePrefixes []string) ([]string, error) {
+	data, err := readBackupFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		volatile := false
+		for _, prefix := range volatilePrefixes {
+			if strings.HasPrefix(strings.TrimLeft(line, " \t"), prefix) {
+				volatile = true
+				break
+			}
+		}
+		if !volatile {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
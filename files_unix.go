@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "os"
+
+// setFileMode sets the permissions of a file.
+func setFileMode(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// setFileMode does nothing on Windows, where Unix permissions don't apply. The -file-mode and -dir-mode flags are
+// still accepted so that the same command line works everywhere.
+func setFileMode(path string, mode os.FileMode) error {
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// recordFilter selects which DNS records are written to the backup. Records are always fetched in full, and filtered
+// afterwards.
+type recordFilter struct {
+	// types holds the record types to keep, in upper case. If it's empty, every type is kept.
+	types []string
+
+	proxiedOnly   bool
+	unproxiedOnly bool
+}
+
+// newRecordFilter builds a filter from the -record-types, -proxied-only, and -unproxied-only flags.
+func newRecordFilter(recordTypes string, proxiedOnly bool, unproxiedOnly bool) (recordFilter, error) {
+	if proxiedOnly && unproxiedOnly {
+		return recordFilter{}, errors.New("The -proxied-only and -unproxied-only flags can't be used together.")
+	}
+
+	f := recordFilter{
+		types:         []string{},
+		proxiedOnly:   proxiedOnly,
+		unproxiedOnly: unproxiedOnly,
+	}
+	for _, recordType := range strings.Split(recordTypes, ",") {
+		recordType = strings.ToUpper(strings.TrimSpace(recordType))
+		if recordType != "" {
+			f.types = append(f.types, recordType)
+		}
+	}
+
+	return f, nil
+}
+
+// active returns true if the filter would drop any records.
+func (f recordFilter) active() bool {
+	return len(f.types) > 0 || f.proxiedOnly || f.unproxiedOnly
+}
+
+func (f recordFilter) matches(record cloudflare.DNSRecord) bool {
+	if f.proxiedOnly && !record.Proxied {
+		return false
+	}
+	if f.unproxiedOnly && record.Proxied {
+		return false
+	}
+	if len(f.types) == 0 {
+		return true
+	}
+	for _, recordType := range f.types {
+		if strings.EqualFold(record.Type, recordType) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the records that match the filter.
+func (f recordFilter) apply(records []cloudflare.DNSRecord) []cloudflare.DNSRecord {
+	filtered := []cloudflare.DNSRecord{}
+	for _, record := range records {
+		if f.matches(record) {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// String describes the filter, like "types MX, TXT; proxied records only". It's empty if the filter isn't active.
+func (f recordFilter) String() string {
+	parts := []string{}
+	if len(f.types) > 0 {
+		parts = append(parts, "types "+strings.Join(f.types, ", "))
+	}
+	if f.proxiedOnly {
+		parts = append(parts, "proxied records only")
+	}
+	if f.unproxiedOnly {
+		parts = append(parts, "unproxied records only")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// zoneFilter selects which zones are backed up, by name. Each pattern is either a zone name, or a glob like
+// "*.example.com". An empty filter selects every zone.
+type zoneFilter struct {
+	patterns []string
+}
+
+// newZoneFilter builds a filter from a comma-separated list of patterns, as given to the -zones flag.
+func newZoneFilter(zones string) (zoneFilter, error) {
+	f := zoneFilter{
+		patterns: []string{},
+	}
+	for _, pattern := range strings.Split(zones, ",") {
+		pattern = normalizeName(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return zoneFilter{}, fmt.Errorf("The -zones flag has an invalid pattern %q.", pattern)
+		}
+		f.patterns = append(f.patterns, pattern)
+	}
+
+	return f, nil
+}
+
+// zoneFilterFor builds a filter that selects exactly the given zones.
+func zoneFilterFor(zones []cloudflare.Zone) zoneFilter {
+	f := zoneFilter{
+		patterns: []string{},
+	}
+	for _, zone := range zones {
+		f.patterns = append(f.patterns, normalizeName(zone.Name))
+	}
+	return f
+}
+
+// active returns true if the filter would drop any zones.
+func (f zoneFilter) active() bool {
+	return len(f.patterns) > 0
+}
+
+func (f zoneFilter) matches(zone cloudflare.Zone) bool {
+	if !f.active() {
+		return true
+	}
+
+	name := normalizeName(zone.Name)
+	for _, pattern := range f.patterns {
+		matched, _ := path.Match(pattern, name)
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the zones that match the filter. It also returns the patterns that didn't match any zone.
+func (f zoneFilter) apply(zones []cloudflare.Zone) ([]cloudflare.Zone, []string) {
+	filtered := []cloudflare.Zone{}
+	used := map[string]bool{}
+	for _, zone := range zones {
+		if !f.matches(zone) {
+			continue
+		}
+		filtered = append(filtered, zone)
+		for _, pattern := range f.patterns {
+			matched, _ := path.Match(pattern, normalizeName(zone.Name))
+			used[pattern] = used[pattern] || matched
+		}
+	}
+
+	unused := []string{}
+	for _, pattern := range f.patterns {
+		if !used[pattern] {
+			unused = append(unused, pattern)
+		}
+	}
+	return filtered, unused
+}
+
+// String formats the filter as the value of the -zones flag.
+func (f zoneFilter) String() string {
+	return strings.Join(f.patterns, ",")
+}
+
+// readZoneList reads the zone names for -zones-from, one on each line, from the given file, or from stdin if it's "-".
+// Blank lines and comments starting with # are skipped, and names that are given more than once are only kept once.
+func readZoneList(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		name := scanner.Text()
+		if i := strings.Index(name, "#"); i != -1 {
+			name = name[:i]
+		}
+		name = normalizeName(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if strings.ContainsAny(name, "*?[ \t,") {
+			return nil, fmt.Errorf("line %d: %q isn't a zone name", line, name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerSubcommand("format-spec", subcommand{
+		Description: "Describe the layout of each output format, in Markdown or JSON",
+		RegisterFlags: func(flags *flag.FlagSet) {
+			(&formatSpecOptions{}).registerFlags(flags)
+		},
+		Arguments: outputFormatNames,
+		Run:       runFormatSpec,
+	})
+}
+
+// formatSpecOptions holds the configuration for the format-spec subcommand.
+type formatSpecOptions struct {
+	OutputFormat string
+}
+
+func (o *formatSpecOptions) registerFlags(flags *flag.FlagSet) {
+	flags.StringVar(&o.OutputFormat, "output-format", "markdown", "How to write the description: markdown or json.")
+}
+
+// formatSpec describes the layout of an output format, for people and programs that read backups. It's built from
+// the constants and types that the writers and parsers use, so that it can't fall behind them.
+type formatSpec struct {
+	Name        string `json:"name"`
+	Version     int    `json:"version"`
+	Extension   string `json:"extension"`
+	Description string `json:"description"`
+
+	// VersionLocation says where a file in the format says which version of it it's in.
+	VersionLocation string `json:"version_location"`
+
+	// LineEnding is what lines end with, if the format is made up of lines.
+	LineEnding string `json:"line_ending,omitempty"`
+
+	// Lines describes the kinds of lines in the format, in the order that they come in, for formats made up of them.
+	Lines []formatSpecLine `json:"lines,omitempty"`
+
+	// Separator and Columns describe the columns of DNS records, for formats that have them.
+	Separator string             `json:"separator,omitempty"`
+	Columns   []formatSpecColumn `json:"columns,omitempty"`
+
+	// Fields describes the fields of a JSON document or line, and RecordFields the fields of each DNS record in it.
+	Fields       []formatSpecField `json:"fields,omitempty"`
+	RecordFields []formatSpecField `json:"record_fields,omitempty"`
+
+	Escaping []string `json:"escaping"`
+
+	// VolatilePrefixes are the starts of lines that change on every run, which are ignored when deciding whether a
+	// file has changed.
+	VolatilePrefixes []string `json:"volatile_prefixes"`
+}
+
+// formatSpecLine is a kind of line in a line-based format. Prefix is how the line starts, if it always starts the
+// same way.
+type formatSpecLine struct {
+	Prefix      string `json:"prefix,omitempty"`
+	Description string `json:"description"`
+	Optional    bool   `json:"optional"`
+}
+
+// formatSpecColumn is a column of DNS records. Values lists the values that it can have, if there are only a few.
+type formatSpecColumn struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Values      []string `json:"values,omitempty"`
+	Optional    bool     `json:"optional"`
+}
+
+// formatSpecField is a field of a JSON object. Type is the JSON type of its value.
+type formatSpecField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Optional    bool   `json:"optional"`
+}
+
+// jsonEscaping and ndjsonEscaping are the escaping rules of the formats that are JSON documents, and of those that have
+// a JSON object on each line.
+const (
+	jsonEscaping   = "Standard JSON, as encoded by Go's encoding/json, indented with tabs. <, >, and & in strings are escaped as \\u003c, \\u003e, and \\u0026."
+	ndjsonEscaping = "Each line is a JSON object, as encoded by Go's encoding/json, which never has a newline in it. <, >, and & in strings are escaped as \\u003c, \\u003e, and \\u0026."
+)
+
+// formatSpecs returns the description of each output format, sorted by name.
+func formatSpecs() []formatSpec {
+	specs := []formatSpec{}
+	for _, name := range outputFormatNames() {
+		format := outputFormats[name]
+		spec := format.Spec()
+		spec.Name = name
+		spec.Version = format.Version
+		spec.Extension = format.Extension
+		spec.VolatilePrefixes = append([]string{}, format.VolatilePrefixes...)
+		if spec.Escaping == nil {
+			spec.Escaping = []string{}
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// textColumns returns the columns in a header line of the text format, like "# Name\t\tTTL\t\tType".
+func textColumns(header string) []string {
+	return strings.Split(strings.TrimPrefix(header, "# "), textSeparator)
+}
+
+// jsonFields describes the fields of a struct, going by their json tags, with descriptions for some of them.
+// Embedded structs have their fields included, as encoding/json does.
+func jsonFields(value interface{}, descriptions map[string]string) []formatSpecField {
+	fields := []formatSpecField{}
+	t := reflect.TypeOf(value)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" {
+			fields = append(fields, jsonFields(reflect.Zero(field.Type).Interface(), descriptions)...)
+			continue
+		}
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		name := options[0]
+		if name == "" {
+			name = field.Name
+		}
+		optional := false
+		for _, option := range options[1:] {
+			if option == "omitempty" {
+				optional = true
+			}
+		}
+		fields = append(fields, formatSpecField{
+			Name:        name,
+			Type:        jsonTypeName(field.Type),
+			Description: descriptions[name],
+			Optional:    optional || field.Type.Kind() == reflect.Ptr,
+		})
+	}
+	return fields
+}
+
+// jsonTypeName returns the JSON type that encoding/json encodes values of a Go type as.
+func jsonTypeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		// json.RawMessage is whatever JSON it holds
+		if t == reflect.TypeOf(json.RawMessage{}) {
+			return "any"
+		}
+		return "string (base64)"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array of " + jsonTypeName(t.Elem())
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "any"
+}
+
+// runFormatSpec is the format-spec subcommand, which prints the description of each output format, or of the ones
+// named in its arguments.
+func runFormatSpec(args []string) error {
+	opts := formatSpecOptions{}
+	flags := flag.NewFlagSet("format-spec", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cloudflare-backup format-spec [-output-format markdown|json] [format...]\n\n")
+		fmt.Fprintf(flags.Output(), "Describes the layout of each output format, or of the given ones: their lines, columns, fields, escaping, and version.\n\n")
+		flags.PrintDefaults()
+	}
+	opts.registerFlags(flags)
+	flags.Parse(args)
+
+	if opts.OutputFormat != "markdown" && opts.OutputFormat != "json" {
+		return errors.New("The -output-format flag must be either markdown or json.")
+	}
+
+	specs := formatSpecs()
+	if flags.NArg() > 0 {
+		selected := []formatSpec{}
+		for _, name := range flags.Args() {
+			_, err := getOutputFormat(name)
+			if err != nil {
+				return err
+			}
+			for _, spec := range specs {
+				if spec.Name == name {
+					selected = append(selected, spec)
+				}
+			}
+		}
+		specs = selected
+	}
+
+	if opts.OutputFormat == "json" {
+		return writeJSON(os.Stdout, map[string]interface{}{
+			"generated_by": "cloudflare-backup " + version,
+			"formats":      specs,
+		})
+	}
+	return writeFormatSpecMarkdown(os.Stdout, specs)
+}
+
+// formatSpecEscaper shows the separators and line endings in the Markdown description, which would otherwise be
+// invisible.
+var formatSpecEscaper = strings.NewReplacer("\t", `\t`, "\r", `\r`, "\n", `\n`)
+
+// writeFormatSpecMarkdown writes the descriptions of the formats as Markdown.
+func writeFormatSpecMarkdown(w io.Writer, specs []formatSpec) error {
+	output := bufio.NewWriter(w)
+	code := func(text string) string {
+		return "`" + formatSpecEscaper.Replace(text) + "`"
+	}
+	cell := func(text string) string {
+		return strings.Replace(text, "|", `\|`, -1)
+	}
+
+	fmt.Fprintf(output, "# Output formats\n\n")
+	fmt.Fprintf(output, "Generated by cloudflare-backup %s. Each format has a version, which goes up whenever its layout changes, and files in a later version than the tool knows are refused when they're read back.\n", version)
+
+	for _, spec := range specs {
+		fmt.Fprintf(output, "\n## %s (version %d)\n\n", spec.Name, spec.Version)
+		fmt.Fprintf(output, "%s\n\n", spec.Description)
+		fmt.Fprintf(output, "- Extension: %s\n", code("."+spec.Extension))
+		fmt.Fprintf(output, "- Version: %s\n", spec.VersionLocation)
+		if spec.LineEnding != "" {
+			fmt.Fprintf(output, "- Line ending: %s\n", code(spec.LineEnding))
+		}
+		if spec.Separator != "" {
+			fmt.Fprintf(output, "- Column separator: %s\n", code(spec.Separator))
+		}
+		if len(spec.VolatilePrefixes) > 0 {
+			prefixes := []string{}
+			for _, prefix := range spec.VolatilePrefixes {
+				prefixes = append(prefixes, code(prefix))
+			}
+			fmt.Fprintf(output, "- Changes on every run: lines starting with %s\n", strings.Join(prefixes, ", "))
+		}
+
+		if len(spec.Lines) > 0 {
+			fmt.Fprintf(output, "\n### Lines\n\n| Starts with | Meaning | Optional |\n| --- | --- | --- |\n")
+			for _, line := range spec.Lines {
+				prefix := ""
+				if line.Prefix != "" {
+					prefix = code(line.Prefix)
+				}
+				fmt.Fprintf(output, "| %s | %s | %s |\n", cell(prefix), cell(line.Description), yesNo(line.Optional))
+			}
+		}
+
+		if len(spec.Columns) > 0 {
+			fmt.Fprintf(output, "\n### Columns\n\n| # | Column | Meaning | Values | Optional |\n| --- | --- | --- | --- | --- |\n")
+			for i, column := range spec.Columns {
+				values := []string{}
+				for _, value := range column.Values {
+					values = append(values, code(value))
+				}
+				fmt.Fprintf(output, "| %d | %s | %s | %s | %s |\n", i+1, cell(column.Name), cell(column.Description), cell(strings.Join(values, ", ")), yesNo(column.Optional))
+			}
+		}
+
+		for _, fields := range []struct {
+			title  string
+			fields []formatSpecField
+		}{{"Fields", spec.Fields}, {"Record fields", spec.RecordFields}} {
+			if len(fields.fields) == 0 {
+				continue
+			}
+			fmt.Fprintf(output, "\n### %s\n\n| Field | Type | Meaning | Optional |\n| --- | --- | --- | --- |\n", fields.title)
+			for _, field := range fields.fields {
+				fmt.Fprintf(output, "| %s | %s | %s | %s |\n", code(field.Name), field.Type, cell(field.Description), yesNo(field.Optional))
+			}
+		}
+
+		if len(spec.Escaping) > 0 {
+			fmt.Fprintf(output, "\n### Escaping\n\n")
+			for _, rule := range spec.Escaping {
+				fmt.Fprintf(output, "- %s\n", rule)
+			}
+		}
+	}
+
+	return output.Flush()
+}
+
+// formatVersionLine describes a header line that has the format's version.
+func formatVersionLine(prefix string, version int) string {
+	return "the `" + prefix + strconv.Itoa(version) + "` line of the header"
+}
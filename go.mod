@@ -1,3 +1,3 @@
 module github.com/thatoddmailbox/cloudflare-backup
 
-go 1.13
+go 1.18
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// encryptedFile is an output file whose contents are piped through gpg before they hit the disk.
+type encryptedFile struct {
+	path      string
+	recipient string
+	file      *os.File
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stderr    bytes.Buffer
+	writeErr  error
+}
+
+// checkGPG makes sure that the gpg binary is available and that it has a public key for the given recipient.
+func checkGPG(recipient string) error {
+	_, err := exec.LookPath("gpg")
+	if err != nil {
+		return errors.New("the gpg binary could not be found in your PATH, but it is required by -gpg-recipient")
+	}
+
+	stderr := bytes.Buffer{}
+	cmd := exec.Command("gpg", "--batch", "--list-keys", recipient)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("gpg has no public key for recipient %q in its keyring (import it with gpg --import first)", recipient)
+	}
+
+	return nil
+}
+
+// createEncryptedFile starts gpg, writing its output to the given path.
+func createEncryptedFile(path string, mode os.FileMode, recipient string) (*encryptedFile, error) {
+	file, err := createFile(path, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &encryptedFile{
+		path:      path,
+		recipient: recipient,
+		file:      file,
+	}
+
+	// trust-model always is needed because we run in batch mode, where gpg would otherwise refuse keys that the
+	// local user hasn't signed
+	f.cmd = exec.Command("gpg", "--batch", "--yes", "--trust-model", "always", "--encrypt", "--recipient", recipient)
+	f.cmd.Stdout = file
+	f.cmd.Stderr = &f.stderr
+
+	f.stdin, err = f.cmd.StdinPipe()
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	err = f.cmd.Start()
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, errors.New("the gpg binary could not be found in your PATH")
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *encryptedFile) Write(p []byte) (int, error) {
+	n, err := f.stdin.Write(p)
+	if err != nil && f.writeErr == nil {
+		f.writeErr = err
+	}
+	return n, err
+}
+
+// Close waits for gpg to finish. If anything went wrong, the partial output file is removed.
+func (f *encryptedFile) Close() error {
+	f.stdin.Close()
+	waitErr := f.cmd.Wait()
+	closeErr := f.file.Close()
+
+	if waitErr != nil || f.writeErr != nil || closeErr != nil {
+		os.Remove(f.path)
+	}
+
+	if waitErr != nil {
+		stderr := strings.TrimSpace(f.stderr.String())
+		if strings.Contains(stderr, "No public key") || strings.Contains(stderr, "skipped:") {
+			return fmt.Errorf("gpg has no public key for recipient %q", f.recipient)
+		}
+		return fmt.Errorf("gpg failed: %v: %s", waitErr, stderr)
+	}
+	if f.writeErr != nil {
+		return f.writeErr
+	}
+	return closeErr
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// pingHealthcheck notifies the healthcheck service. The suffix can be "/start", "/fail", or empty for success. If
+// body is non-nil, it is POSTed along with the ping. Failures are logged and otherwise ignored, so that a monitoring
+// outage can't hide the real result of the backup.
+func pingHealthcheck(opts *options, suffix string, body []byte) {
+	if opts.HealthcheckURL == "" {
+		return
+	}
+
+	pingURL := strings.TrimSuffix(opts.HealthcheckURL, "/") + suffix
+
+	client := http.Client{
+		Timeout: opts.Timeout,
+	}
+
+	var response *http.Response
+	var err error
+	if body != nil {
+		response, err = client.Post(pingURL, "text/plain; charset=utf-8", bytes.NewReader(body))
+	} else {
+		response, err = client.Get(pingURL)
+	}
+	if err != nil {
+		log.Printf("Healthcheck ping to %s failed: %s", pingURL, err)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		log.Printf("Healthcheck ping to %s failed: server responded with %s", pingURL, response.Status)
+	}
+}
+
+// healthcheckSummary returns the body to send with the final ping, if enabled.
+func healthcheckSummary(opts *options, report *RunReport) []byte {
+	if !opts.HealthcheckSummary {
+		return nil
+	}
+
+	summary := fmt.Sprintf(
+		"zones succeeded: %d\nzones failed: %d\nzones unchanged: %d\nduration: %s\n",
+		report.ZonesSucceeded(), report.ZonesFailed(), report.ZonesUnchanged(), report.Duration(),
+	)
+	for _, err := range report.Errors {
+		summary += "error: " + err + "\n"
+	}
+
+	return []byte(summary)
+}
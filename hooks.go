@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// zoneHook runs the -pre-zone-hook or -post-zone-hook command for a zone, if it was given. The command gets the zone's
+// details in CB_* environment variables, and its output is logged a line at a time, prefixed with the zone's name. The
+// zone's status is "starting" for the pre-zone hook, and "succeeded", "failed", or "timed_out" for the post-zone hook,
+// depending on zoneErr. The pre-zone hook also gets CB_ALLOW_SHRINK_FILE, where it can create a file to let the zone
+// shrink past -max-shrink-percent.
+//
+// A hook that fails or takes longer than -hook-timeout returns an error, which fails the zone, unless
+// -hook-failures-ignore is set, in which case it's only a warning.
+func (b *backupRun) zoneHook(ctx context.Context, name string, command string, zone cloudflare.Zone, zoneReport *ZoneReport, zoneErr error) error {
+	if command == "" {
+		return nil
+	}
+
+	status := "starting"
+	if name == "post-zone" {
+		status = "succeeded"
+		if zoneReport.TimedOut {
+			status = "timed_out"
+		} else if zoneReport.Vanished {
+			status = "vanished"
+		} else if zoneErr != nil {
+			status = "failed"
+		}
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, b.options.HookTimeout)
+	defer cancel()
+
+	output := &hookLogger{prefix: zone.Name + " (" + name + " hook): "}
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(),
+		"CB_ZONE_NAME="+zone.Name,
+		"CB_ZONE_ID="+zone.ID,
+		"CB_OUTPUT_FILE="+b.zoneOutputPath(zone),
+		"CB_STATUS="+status,
+		"CB_RECORD_COUNT="+strconv.Itoa(zoneReport.Records),
+	)
+	shrinkPath := ""
+	if name == "pre-zone" {
+		shrinkPath = allowShrinkPath(zone)
+		os.Remove(shrinkPath)
+		cmd.Env = append(cmd.Env, allowShrinkFileEnv+"="+shrinkPath)
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	b.debugf("running the %s hook for %s", name, zone.Name)
+	err := cmd.Start()
+	if err == nil {
+		stopped := make(chan struct{})
+		go func() {
+			select {
+			case <-hookCtx.Done():
+				killCommand(cmd)
+			case <-stopped:
+			}
+		}()
+		err = cmd.Wait()
+		close(stopped)
+	}
+	output.flush()
+	if shrinkPath != "" {
+		if _, statErr := os.Stat(shrinkPath); statErr == nil {
+			b.debugf("the pre-zone hook let %s shrink", zone.Name)
+			zoneReport.ShrinkAllowed = true
+			os.Remove(shrinkPath)
+		}
+	}
+	if hookCtx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", b.options.HookTimeout)
+	}
+	if err == nil {
+		return nil
+	}
+
+	err = fmt.Errorf("the %s hook failed: %w", name, err)
+	if b.options.HookFailuresIgnore {
+		b.report.AddWarning("%s: %s", zone.Name, err)
+		return nil
+	}
+	return err
+}
+
+// zoneOutputPath returns the path of the zone's backup file, or its directory with -layout dir, for hooks. With
+// -single-file, it's the file that every zone is written into.
+func (b *backupRun) zoneOutputPath(zone cloudflare.Zone) string {
+	if b.singleFile != nil {
+		return b.singleFile.path
+	}
+
+	name := filepath.Join(b.options.OutputDir, filepath.FromSlash(b.zonePath(zone.ID)))
+	if b.options.Layout == "dir" {
+		return name
+	}
+
+	name += "." + b.format.Extension
+	if b.options.Compress != "" {
+		name += compressedExtension
+	}
+	if b.options.GPGRecipient != "" {
+		name += ".gpg"
+	}
+	return name
+}
+
+// hookLogger logs the output of a hook a line at a time, with a prefix on each line.
+type hookLogger struct {
+	prefix string
+
+	mutex   sync.Mutex
+	partial []byte
+}
+
+func (h *hookLogger) Write(data []byte) (int, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.partial = append(h.partial, data...)
+	for {
+		end := bytes.IndexByte(h.partial, '\n')
+		if end == -1 {
+			break
+		}
+		log.Print(h.prefix + string(bytes.TrimRight(h.partial[:end], "\r")))
+		h.partial = h.partial[end+1:]
+	}
+	return len(data), nil
+}
+
+// flush logs the last line of output, if it didn't end with a newline.
+func (h *hookLogger) flush() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.partial) > 0 {
+		log.Print(h.prefix + string(h.partial))
+		h.partial = nil
+	}
+}
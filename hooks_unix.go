@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand creates a command that runs the given command line with the shell. It gets a process group of its
+// own, so that killCommand can stop anything that it starts too.
+func shellCommand(command string) *exec.Cmd {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// killCommand kills a command started by shellCommand, along with the rest of its process group. Otherwise, a
+// process that it started could keep its output open, and waiting for the command would never finish.
+func killCommand(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os/exec"
+)
+
+// shellCommand creates a command that runs the given command line with cmd.exe.
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd.exe", "/C", command)
+}
+
+// killCommand kills a command started by shellCommand.
+func killCommand(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerSubcommand("import", subcommand{
+		Description: "Create the records from a BIND zone file in a zone",
+		RegisterFlags: func(flags *flag.FlagSet) {
+			(&importOptions{}).registerFlags(flags)
+		},
+		Run: runImport,
+	})
+}
+
+// importOptions holds the configuration for the import subcommand.
+type importOptions struct {
+	apiCredentials
+
+	APIBaseURL string
+	Zone       string
+	File       string
+	DryRun     bool
+	UseBulk    bool
+	Proxied    bool
+}
+
+func (o *importOptions) registerFlags(flags *flag.FlagSet) {
+	o.apiCredentials.registerFlags(flags, "The CloudFlare API token to use. It needs permission to edit DNS records.")
+	flags.StringVar(&o.APIBaseURL, "api-base-url", cloudflare.DefaultBaseURL, "The base URL of the CloudFlare API, if you need to go through a proxy or gateway.")
+	flags.StringVar(&o.Zone, "zone", "", "The name of the zone to import the records into. It's also the origin for relative names in the file.")
+	flags.StringVar(&o.File, "file", "", "The BIND zone file to import.")
+	flags.BoolVar(&o.DryRun, "dry-run", false, "If set, show the records that would be created, without creating them.")
+	flags.BoolVar(&o.UseBulk, "use-bulk", false, "If set, upload the whole file to Cloudflare's own importer in one request, instead of creating the records one by one.")
+	flags.BoolVar(&o.Proxied, "proxied", false, "If set, proxy the A, AAAA, and CNAME records that are created.")
+}
+
+func (o *importOptions) validate() error {
+	if o.Zone == "" {
+		return errors.New("You must give the zone to import into with the -zone flag.")
+	}
+	if o.File == "" {
+		return errors.New("You must give the zone file to import with the -file flag.")
+	}
+	err := o.apiCredentials.resolve()
+	if err != nil {
+		return err
+	}
+	if o.apiCredentials.empty() && !o.DryRun {
+		return errNoCredentials
+	}
+
+	baseURL, err := url.Parse(o.APIBaseURL)
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+		return errors.New("The -api-base-url flag must be an absolute http or https URL.")
+	}
+	return nil
+}
+
+// runImport is the import subcommand, which loads the records from a BIND zone file into a zone.
+func runImport(args []string) error {
+	opts := importOptions{}
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cloudflare-backup import -zone example.com -file example.com.zone [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Creates the records from a BIND zone file in a Cloudflare zone. Supported record types: %s.\n\n", strings.Join(bindImportTypes, ", "))
+		flags.PrintDefaults()
+	}
+	opts.registerFlags(flags)
+	flags.Parse(args)
+
+	err := opts.validate()
+	if err != nil {
+		return err
+	}
+
+	zoneFile, err := readBackupFile(opts.File)
+	if err != nil {
+		return err
+	}
+
+	records, skipped, err := parseBINDZone(bytes.NewReader(zoneFile), opts.Zone)
+	if err != nil {
+		return fmt.Errorf("Couldn't read %s: %w", opts.File, err)
+	}
+	for i := range records {
+		records[i].Record.Proxied = opts.Proxied && isProxiableType(records[i].Record.Type)
+	}
+
+	for _, skip := range skipped {
+		log.Printf("Skipping line %d, since %s.", skip.Line, skip.Reason)
+	}
+	log.Printf("Found %d record(s) to import into %s:", len(records), opts.Zone)
+	for _, record := range records {
+		log.Printf("  %s", describeImportRecord(record.Record))
+	}
+
+	if opts.DryRun {
+		log.Println("Nothing was imported, since -dry-run is set.")
+		return nil
+	}
+
+	ctx := context.Background()
+	client := opts.apiCredentials.newClient()
+	client.BaseURL = opts.APIBaseURL
+	client.UserAgent = "cloudflare-backup/" + version + " (+" + repoURL + ")"
+
+	zone, err := findZone(ctx, client, opts.Zone)
+	if err != nil {
+		return err
+	}
+
+	if opts.UseBulk {
+		result, err := client.ImportDNSRecords(ctx, zone.ID, zoneFile, opts.Proxied)
+		if err != nil {
+			return fmt.Errorf("Couldn't import the records: %w", err)
+		}
+		log.Printf("Cloudflare added %d of the %d record(s) that it found in the file.", result.RecordsAdded, result.TotalRecordsParsed)
+		return nil
+	}
+
+	failed := 0
+	for _, record := range records {
+		_, err := client.CreateDNSRecord(ctx, zone.ID, record.Record)
+		if err != nil {
+			failed++
+			log.Printf("Couldn't create the record on line %d (%s): %s", record.Line, describeImportRecord(record.Record), err)
+		}
+	}
+
+	log.Printf("Created %d of %d record(s).", len(records)-failed, len(records))
+	if failed > 0 {
+		return fmt.Errorf("%d record(s) couldn't be created.", failed)
+	}
+	return nil
+}
+
+// findZone looks up a zone by name.
+func findZone(ctx context.Context, client *cloudflare.Client, name string) (cloudflare.Zone, error) {
+	zones, err := client.ListZones(ctx)
+	if err != nil {
+		return cloudflare.Zone{}, fmt.Errorf("Couldn't list zones: %w", err)
+	}
+
+	for _, zone := range zones {
+		if normalizeName(zone.Name) == normalizeName(name) {
+			return zone, nil
+		}
+	}
+	return cloudflare.Zone{}, fmt.Errorf("There's no zone named %s, or the API token can't access it.", name)
+}
+
+// isProxiableType returns true for the record types that Cloudflare can proxy.
+func isProxiableType(recordType string) bool {
+	switch strings.ToUpper(recordType) {
+	case "A", "AAAA", "CNAME":
+		return true
+	}
+	return false
+}
+
+// describeImportRecord formats a record for the import's output, like "www.example.com 3600 MX 10 mail.example.com".
+func describeImportRecord(record cloudflare.DNSRecord) string {
+	value := record.Content
+	if record.Priority != nil {
+		value = strconv.Itoa(int(*record.Priority)) + " " + value
+	}
+	if record.Data != nil {
+		value = string(record.Data)
+	}
+	return record.Name + " " + strconv.FormatUint(record.TTL, 10) + " " + record.Type + " " + value
+}
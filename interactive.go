@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// isTerminal returns true if the file is a terminal, rather than a pipe or a regular file. It's really checking for a
+// character device, so the null device is ruled out separately.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+// parseZoneSelection parses a selection like "1,3-7" or "all" into the chosen indexes, from a numbered list of count
+// items. The numbers start at 1, but the returned indexes start at 0, and are in the order of the list.
+func parseZoneSelection(input string, count int) ([]int, error) {
+	chosen := map[int]bool{}
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.EqualFold(part, "all") {
+			for i := 1; i <= count; i++ {
+				chosen[i] = true
+			}
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		last := first
+		if err == nil && len(bounds) == 2 {
+			last, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a number, a range like 3-7, or all", part)
+		}
+		if first < 1 || last > count || first > last {
+			return nil, fmt.Errorf("%q is outside of 1-%d", part, count)
+		}
+		for i := first; i <= last; i++ {
+			chosen[i] = true
+		}
+	}
+
+	indexes := []int{}
+	for i := 1; i <= count; i++ {
+		if chosen[i] {
+			indexes = append(indexes, i-1)
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("no zones were selected")
+	}
+	return indexes, nil
+}
+
+// pickZones lists the zones and asks which ones to back up, by reading from in and writing to out. The selection
+// replaces the zone filter. It returns false if the backup shouldn't go ahead.
+func (b *backupRun) pickZones(ctx context.Context, in io.Reader, out io.Writer) (bool, error) {
+	_, zones, err := b.listZones(ctx)
+	if err != nil {
+		return false, fmt.Errorf("Couldn't list zones: %w", err)
+	}
+	if len(zones) == 0 {
+		fmt.Fprintln(out, "There are no zones to choose from.")
+		return false, nil
+	}
+
+	for i, zone := range zones {
+		fmt.Fprintf(out, "%4d. %s\n", i+1, zone.Name)
+	}
+
+	reader := bufio.NewReader(in)
+	var selected []cloudflare.Zone
+	for selected == nil {
+		fmt.Fprint(out, "Which zones should be backed up? (like 1,3-7 or all) ")
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return false, nil
+		}
+
+		indexes, err := parseZoneSelection(line, len(zones))
+		if err != nil {
+			fmt.Fprintf(out, "Sorry, %s.\n", err)
+			continue
+		}
+
+		selected = []cloudflare.Zone{}
+		for _, i := range indexes {
+			selected = append(selected, zones[i])
+		}
+	}
+
+	b.options.zoneFilter = zoneFilterFor(selected)
+
+	fmt.Fprintf(out, "\nThis will back up %d zone(s) to %s:\n", len(selected), b.options.OutputDir)
+	for _, zone := range selected {
+		fmt.Fprintf(out, "  %s\n", zone.Name)
+	}
+	fmt.Fprintf(out, "To do the same without being asked, use -zones %s\n", b.options.zoneFilter)
+	fmt.Fprint(out, "Go ahead? [y/N] ")
+
+	line, _ := reader.ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// errRequestLimit is recorded when the run is stopped because it sent as many requests as -max-requests allows.
+var errRequestLimit = errors.New("The backup was stopped, since it sent as many API requests as -max-requests allows.")
+
+// requestLimitTransport stops the run once it has sent -max-requests requests to the API. Any request after that
+// fails with errRequestLimit, and cancels the run's context, so that anything else still in progress stops too. It
+// goes underneath the cache, so responses served from the cache don't count.
+type requestLimitTransport struct {
+	next  http.RoundTripper
+	limit int64
+
+	// sent is only accessed atomically, since requests can be made from more than one goroutine
+	sent int64
+
+	// cancel stops the run. It's set by run, and does nothing before then.
+	cancel context.CancelFunc
+}
+
+func newRequestLimitTransport(next http.RoundTripper, limit int) *requestLimitTransport {
+	return &requestLimitTransport{
+		next:   next,
+		limit:  int64(limit),
+		cancel: func() {},
+	}
+}
+
+func (t *requestLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if atomic.AddInt64(&t.sent, 1) > t.limit {
+		t.cancel()
+		return nil, errRequestLimit
+	}
+	return t.next.RoundTrip(request)
+}
+
+// reached returns true once a request has been turned away.
+func (t *requestLimitTransport) reached() bool {
+	return atomic.LoadInt64(&t.sent) > t.limit
+}
+
+// stopError returns the error that explains why the run's context was cancelled before every zone was backed up.
+func (b *backupRun) stopError() error {
+	if b.requestLimit != nil && b.requestLimit.reached() {
+		b.manifest.PartialRun = fmt.Sprintf("stopped after %d API requests, because of -max-requests", b.requestLimit.limit)
+		return errRequestLimit
+	}
+	return errInterrupted
+}
+
+// limitZones returns the first -max-zones of the selected zones, and marks the manifest as partial if that leaves
+// any out.
+func (b *backupRun) limitZones(zones []cloudflare.Zone) []cloudflare.Zone {
+	if b.options.MaxZones == 0 || len(zones) <= b.options.MaxZones {
+		return zones
+	}
+
+	b.manifest.PartialRun = fmt.Sprintf("only the first %d of %d zones, because of -max-zones", b.options.MaxZones, len(zones))
+	log.Printf("Only backing up the first %d of %d zones, because of -max-zones.", b.options.MaxZones, len(zones))
+	return zones[:b.options.MaxZones]
+}
+
+// zoneContext returns the context that a zone is backed up with, which is cancelled once the zone has taken longer
+// than -zone-timeout. Files are always written atomically, so a zone that times out never leaves a half-written file
+// behind, and it isn't added to the manifest or the state file.
+func (b *backupRun) zoneContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.options.ZoneTimeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, b.options.ZoneTimeout)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// lockFileName is the name of the file in the output directory that's locked while a backup is running.
+const lockFileName = ".cloudflare-backup.lock"
+
+// errLocked is returned by lockFile when another process holds the lock.
+var errLocked = errors.New("the file is locked by another process")
+
+// outputLock stops two backups from writing to the same output directory at once. The lock is held by the operating
+// system rather than by the file existing, so it goes away if the process dies, and the file itself is left behind.
+type outputLock struct {
+	file *os.File
+}
+
+// lockOutputDir takes the lock on the output directory, failing straight away if another backup holds it.
+func lockOutputDir(outputDir string, mode os.FileMode) (*outputLock, error) {
+	path := filepath.Join(outputDir, lockFileName)
+	file, err := lockFile(path, mode)
+	if err == errLocked {
+		return nil, fmt.Errorf("Another backup is already writing to %s. Wait for it to finish, or use a different -output directory.", outputDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't lock the output directory: %w", err)
+	}
+
+	// the process ID is only there to help whoever finds the file
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Couldn't lock the output directory: %w", err)
+	}
+
+	return &outputLock{file: file}, nil
+}
+
+// release gives up the lock.
+func (l *outputLock) release() error {
+	return l.file.Close()
+}
@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is ERROR_SHARING_VIOLATION, which the syscall package doesn't define.
+const errorSharingViolation syscall.Errno = 32
+
+// lockFile opens the file, creating it if needed, without sharing it. Windows refuses to open a file again while it's
+// held like this, even for reading, so that alone acts as the lock, and it's released when the handle is closed or the
+// process exits. The mode is ignored, since Unix permissions don't apply.
+func lockFile(path string, mode os.FileMode) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == errorSharingViolation {
+		return nil, errLocked
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	return os.NewFile(uintptr(handle), path), nil
+}
@@ -1,243 +1,210 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"path"
-	"strconv"
+	"sort"
+	"strings"
+	"time"
 )
 
-type resultInfo struct {
-	TotalPages int `json:"total_pages"`
-	Count      int `json:"count"`
-	TotalCount int `json:"total_count"`
-	Page       int `json:"page"`
-	PerPage    int `json:"per_page"`
-}
-
-type result struct {
-	Success    bool       `json:"success"`
-	Errors     []string   `json:"errors"`
-	Messages   []string   `json:"messages"`
-	ResultInfo resultInfo `json:"result_info"`
-}
-
-type pageRuleTargets struct {
-	Target     string `json:"target"`
-	Constraint struct {
-		Operator string `json:"operator"`
-		Value    string `json:"value"`
-	} `json:"constraint"`
-}
-
-type pageRuleActions struct {
-	ID    string      `json:"id"`
-	Value interface{} `json:"value"`
-}
-
-type pageRule struct {
-	ID         string            `json:"id"`
-	Targets    []pageRuleTargets `json:"targets"`
-	Actions    []pageRuleActions `json:"actions"`
-	Priority   int               `json:"priority"`
-	Status     string            `json:"status"`
-	ModifiedOn string            `json:"modified_on"`
-	CreatedOn  string            `json:"created_on"`
-}
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
 
-type dnsRecord struct {
-	ID        string `json:"id"`
-	Type      string `json:"type"`
-	Name      string `json:"name"`
-	Content   string `json:"content"`
-	Proxiable bool   `json:"proxiable"`
-	Proxied   bool   `json:"proxied"`
-	TTL       uint64 `json:"ttl"`
-	Locked    bool   `json:"locked"`
-}
-
-type zone struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	ModifiedOn  string `json:"modified_on"`
-	ActivatedOn string `json:"activated_on"`
-	CreatedOn   string `json:"created_on"`
-}
-
-type dnsRecordsResult struct {
-	result
-	DNSRecords []dnsRecord `json:"result"`
-}
-
-type pageRulesResult struct {
-	result
-	PageRules []pageRule `json:"result"`
-}
-
-type zonesResult struct {
-	result
-	Zones []zone `json:"result"`
-}
+// repoURL is included in the User-Agent so that Cloudflare can find us.
+const repoURL = "https://github.com/thatoddmailbox/cloudflare-backup"
 
-const baseURL = "https://api.cloudflare.com/client/v4/"
-
-var apiToken string
-var outputDir string
+func main() {
+	log.Println("cloudflare-backup " + version)
 
-func get(path string, params url.Values, output interface{}) error {
-	request, err := http.NewRequest("GET", baseURL+path+"?"+params.Encode(), nil)
-	if err != nil {
-		return err
+	if len(os.Args) > 1 && runSubcommand(os.Args[1], os.Args[2:]) {
+		return
 	}
-	request.Header.Set("Authorization", "Bearer "+apiToken)
-	request.Header.Set("Content-Type", "application/json")
 
-	response, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return err
-	}
-	defer response.Body.Close()
+	opts := options{}
+	opts.registerFlags(flag.CommandLine)
+	flag.Parse()
+	opts.ZoneNames = flag.Args()
 
-	body, err := ioutil.ReadAll(response.Body)
+	err := opts.validate()
 	if err != nil {
-		return err
+		log.Fatalln(err)
 	}
 
-	return json.Unmarshal(body, output)
-}
+	if !opts.DryRun {
+		err = prepareOutputDir(opts.OutputDir, os.FileMode(opts.DirMode))
+		if err != nil {
+			log.Fatalln(err)
+		}
 
-func handleZone(zone zone) error {
-	// fetch the records for this zone
-	dnsResult := dnsRecordsResult{}
-	err := get("zones/"+zone.ID+"/dns_records", url.Values{
-		"per_page": []string{"100"},
-	}, &dnsResult)
-	if err != nil {
-		return err
+		// if the process exits without releasing the lock, the operating system does it instead
+		lock, err := lockOutputDir(opts.OutputDir, os.FileMode(opts.FileMode))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer lock.release()
 	}
 
-	// fetch the page rules for this zone
-	pageRuleResult := pageRulesResult{}
-	err = get("zones/"+zone.ID+"/pagerules", url.Values{
-		"order": []string{"priority"},
-	}, &pageRuleResult)
-	if err != nil {
-		return err
+	if opts.GPGRecipient != "" {
+		err = checkGPG(opts.GPGRecipient)
+		if err != nil {
+			log.Fatalln(err)
+		}
 	}
 
-	// write them out
-	outputFile, err := os.Create(path.Join(outputDir, zone.Name+".txt"))
-	if err != nil {
-		return err
-	}
-	defer outputFile.Close()
+	ctx, stop := interruptContext()
+	defer stop()
 
-	const separator = "\t\t"
+	if opts.Endpoints == "" {
+		errs := runBackup(ctx, &opts)
+		if len(errs) > 0 {
+			logErrorHints(errs)
+			os.Exit(exitCode(errs))
+		}
+		return
+	}
 
-	_, err = outputFile.WriteString(
-		"#\r\n" +
-			"# DNS zone backup for " + zone.Name + "\r\n" +
-			"# Domain created on: " + zone.CreatedOn + "\r\n" +
-			"# Domain activated on: " + zone.ActivatedOn + "\r\n" +
-			"# Domain last modified on: " + zone.ModifiedOn + "\r\n" +
-			"#\r\n" +
-			"# Name" + separator + "TTL" + separator + "Type" + separator + "Proxied" + separator + "Value\r\n",
-	)
+	endpoints, err := readEndpoints(opts.Endpoints)
 	if err != nil {
-		return err
+		log.Fatalln(err)
 	}
 
-	for _, record := range dnsResult.DNSRecords {
-		proxiedString := "NO_PROXY"
-		if record.Proxied {
-			proxiedString = "PROXY"
+	// every line logged while an endpoint is being backed up starts with its label, so it's clear where a failure
+	// came from
+	allErrs := []error{}
+	failed := []string{}
+	for _, endpoint := range endpoints {
+		if ctx.Err() != nil {
+			allErrs = append(allErrs, errInterrupted)
+			break
 		}
 
-		_, err = outputFile.WriteString(
-			record.Name + separator + strconv.FormatUint(record.TTL, 10) + separator + record.Type + separator + proxiedString + separator + record.Content + "\r\n",
-		)
-		if err != nil {
-			return err
+		log.Printf("Backing up endpoint %s (%s)...", endpoint.Label, endpoint.APIBaseURL)
+		log.SetPrefix("[" + endpoint.Label + "] ")
+		endpointOpts := endpoint.options(&opts)
+		errs := []error{}
+		if !opts.DryRun {
+			err = prepareOutputDir(endpointOpts.OutputDir, os.FileMode(opts.DirMode))
+			if err != nil {
+				log.Println(err)
+				errs = append(errs, err)
+			}
 		}
+		if len(errs) == 0 {
+			errs = runBackup(ctx, endpointOpts)
+		}
+		log.SetPrefix("")
+
+		if len(errs) > 0 {
+			failed = append(failed, endpoint.Label)
+			allErrs = append(allErrs, errs...)
+		}
+	}
+
+	if len(failed) > 0 {
+		log.Printf("Endpoints that failed: %s (%d of %d).", strings.Join(failed, ", "), len(failed), len(endpoints))
+		logErrorHints(allErrs)
+		os.Exit(exitCode(allErrs))
 	}
+}
 
-	_, err = outputFile.WriteString("#\r\n# Page rules\r\n")
+// runBackup makes a backup with the given options, or only checks that it would work with -dry-run. It returns the
+// errors that made it fail, which have already been logged.
+func runBackup(ctx context.Context, opts *options) []error {
+	start := time.Now()
+	run, err := newBackupRun(opts)
 	if err != nil {
-		return err
+		log.Println(err)
+		writeFailedMetrics(opts, start, err)
+		return []error{err}
 	}
-	if len(pageRuleResult.PageRules) == 0 {
-		_, err = outputFile.WriteString("# (no page rules)\r\n")
+
+	if opts.Interactive {
+		ok, err := run.pickZones(ctx, os.Stdin, os.Stderr)
 		if err != nil {
-			return err
+			log.Println(err)
+			writeFailedMetrics(opts, start, err)
+			return []error{err}
 		}
-	}
-	e := json.NewEncoder(outputFile)
-	for _, pageRule := range pageRuleResult.PageRules {
-		_, err = outputFile.WriteString("# ")
-		if err != nil {
-			return err
+		if !ok {
+			log.Println("Nothing was backed up.")
+			return nil
 		}
-		err = e.Encode(pageRule)
+	}
+
+	if opts.DryRun {
+		err = run.plan(ctx)
 		if err != nil {
-			return err
+			log.Println(err)
+			return []error{err}
 		}
+		log.Println("The backup looks like it would work.")
+		return nil
 	}
 
+	report := run.run(ctx)
+
+	if report.Failed() {
+		log.Printf("Finished with %d error(s).", len(report.Errors))
+		return report.errors
+	}
+
+	log.Println("Done!")
 	return nil
 }
 
-func main() {
-	log.Println("cloudflare-backup")
+// subcommand is something other than a backup that the tool can do, like import.
+type subcommand struct {
+	// Description is a short summary of what the subcommand does, for shell completion.
+	Description string
 
-	flag.StringVar(&apiToken, "api-token", "", "The CloudFlare API token to use.")
-	flag.StringVar(&outputDir, "output", "output/", "The output directory.")
-	flag.Parse()
+	// RegisterFlags defines the subcommand's flags on the given flag set. It's used for shell completion, so it's
+	// nil for subcommands without flags.
+	RegisterFlags func(flags *flag.FlagSet)
 
-	outputDirStat, err := os.Stat(outputDir)
-	if os.IsNotExist(err) {
-		// create the output directory then
-		err := os.Mkdir(outputDir, 0777)
-		if err != nil {
-			panic(err)
-		}
-	} else if err != nil {
-		panic(err)
-	}
+	// Arguments returns the values that the subcommand's first argument can take, for shell completion. It's nil for
+	// subcommands that don't take one.
+	Arguments func() []string
 
-	if err == nil && !outputDirStat.IsDir() {
-		log.Fatalf("The provided output path must be a directory, not a file.")
-	}
+	// Run runs the subcommand with the arguments after its name.
+	Run func(args []string) error
+}
 
-	if apiToken == "" {
-		log.Fatalf("You must provide a CloudFlare API token with the -api-token flag.")
-	}
+// subcommands holds every registered subcommand, keyed by name. They're registered in init functions, since the
+// completion subcommand needs to look at all of them.
+var subcommands = map[string]subcommand{}
 
-	result := zonesResult{}
-	err = get("zones", url.Values{
-		"per_page": []string{"50"},
-	}, &result)
-	if err != nil {
-		panic(err)
+// registerSubcommand adds a subcommand to the registry.
+func registerSubcommand(name string, command subcommand) {
+	if _, exists := subcommands[name]; exists {
+		panic("subcommand " + name + " registered twice")
 	}
+	subcommands[name] = command
+}
 
-	if result.ResultInfo.Count != result.ResultInfo.TotalCount {
-		// TODO: implement pagination so that this doesn't happen
-		log.Fatalln("This program currently does not support accounts with more than 50 zones.")
+// subcommandNames returns the names of every subcommand, sorted alphabetically.
+func subcommandNames() []string {
+	names := []string{}
+	for name := range subcommands {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	for _, zone := range result.Zones {
-		log.Printf("Processing %s...", zone.Name)
-
-		err := handleZone(zone)
-		if err != nil {
-			panic(err)
-		}
+// runSubcommand runs the named subcommand, if there is one, and exits if it fails. It returns false if the name isn't
+// a subcommand, meaning that the arguments are flags for a backup.
+func runSubcommand(name string, args []string) bool {
+	command, ok := subcommands[name]
+	if !ok {
+		return false
 	}
 
-	log.Println("Done!")
+	err := command.Run(args)
+	if err != nil {
+		fatal(err)
+	}
+	return true
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// managedByPrefix starts the line that tags a record as managed by Cloudflare, in the formats that can't add a field to
+// the record itself: it follows the record's line in the text format, and starts the commented-out record in the
+// dnscontrol format.
+const managedByPrefix = "managed-by: "
+
+// managedRecords works out which of a zone's DNS records Cloudflare manages itself. Creating those again when the zone
+// is restored would conflict with the ones that Cloudflare adds back, so they're tagged with what manages them.
+type managedRecords struct {
+	emailRouting map[string]bool
+}
+
+// fetchManagedRecords looks up the records that the zone's Email Routing needs. Their meta usually says so as well,
+// but not for records that were added by hand before Email Routing was turned on.
+func fetchManagedRecords(ctx context.Context, client *cloudflare.Client, zone cloudflare.Zone) (managedRecords, error) {
+	managed := managedRecords{emailRouting: map[string]bool{}}
+	records, err := client.ListEmailRoutingDNSRecords(ctx, zone.ID)
+	if cloudflare.IsClientError(err) {
+		// Email Routing isn't set up, or the token can't read it, so the records' meta is all there is to go by
+		return managed, nil
+	}
+	if err != nil {
+		return managedRecords{}, err
+	}
+
+	for _, record := range records {
+		managed.emailRouting[managedRecordKey(record)] = true
+	}
+	return managed, nil
+}
+
+// managedRecordKey identifies a record by its type, name, and content, ignoring case, trailing dots, and the quotes
+// around TXT records, since the Email Routing endpoint doesn't always write them the same way as the record itself.
+func managedRecordKey(record cloudflare.DNSRecord) string {
+	return strings.ToUpper(record.Type) + "\x00" + normalizeName(record.Name) + "\x00" + normalizeName(strings.Trim(record.Content, `"`))
+}
+
+// tag sets the record's ManagedBy, if Cloudflare manages it. The meta is cleared afterwards, since it's only needed for
+// this, and would otherwise add the same empty object to nearly every record.
+func (m managedRecords) tag(record *cloudflare.DNSRecord) {
+	meta := cloudflare.DNSRecordMeta{}
+	if record.Meta != nil {
+		meta = *record.Meta
+	}
+
+	switch {
+	case meta.EmailRouting || m.emailRouting[managedRecordKey(*record)]:
+		record.ManagedBy = "email_routing"
+	case meta.ManagedByArgoTunnel:
+		record.ManagedBy = "argo_tunnel"
+	case meta.ManagedByApps:
+		record.ManagedBy = "apps"
+	}
+	record.Meta = nil
+}
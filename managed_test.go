@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// managedFixtureRecords are the records in testdata/zones/managed.json that Cloudflare manages, by what manages them.
+// Some of the Email Routing ones only say so in the zone's email/routing/dns endpoint, not in their own meta.
+var managedFixtureRecords = map[string]int{
+	"email_routing": 5,
+	"argo_tunnel":   1,
+	"apps":          1,
+}
+
+func TestManagedRecordsGolden(t *testing.T) {
+	for _, name := range outputFormatNames() {
+		t.Run(name, func(t *testing.T) {
+			format := outputFormats[name]
+			api := newFakeAPI(t, "managed")
+			dir := runTestBackup(t, api, "-format", name, "-resources", "dns")
+			checkGoldenFile(t, dir, "managed.example."+format.Extension, "managed/"+name+"."+format.Extension)
+
+			file := filepath.Join(dir, "managed.example."+format.Extension)
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for managedBy, want := range managedFixtureRecords {
+				tag := `"managed_by":"` + managedBy + `"`
+				switch name {
+				case "text":
+					tag = "# " + managedByPrefix + managedBy + "\r\n"
+				case "dnscontrol":
+					tag = "// " + managedByPrefix + managedBy + dnscontrolBodyMarker
+				case "json", "api-json":
+					tag = `"managed_by": "` + managedBy + `"`
+				}
+				if count := strings.Count(string(data), tag); count != want {
+					t.Errorf("%d record(s) have %q, want %d", count, tag, want)
+				}
+			}
+
+			// the tag is read back in as well, for -drift and restores
+			parsed, err := format.ParseRecords(strings.NewReader(string(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts := map[string]int{}
+			for _, record := range parsed {
+				if record.ManagedBy != "" {
+					counts[record.ManagedBy]++
+				}
+			}
+			for managedBy, want := range managedFixtureRecords {
+				if counts[managedBy] != want {
+					t.Errorf("%d record(s) were read back as managed by %s, want %d", counts[managedBy], managedBy, want)
+				}
+			}
+		})
+	}
+}
+
+func TestManagedRecordsWithoutEmailRoutingPermission(t *testing.T) {
+	// without the email/routing/dns endpoint, only the records whose meta says so are known to be managed
+	api := newFakeAPI(t, "managed")
+	api.handle("zones/*/email/routing/dns", func(w http.ResponseWriter, r *http.Request) {
+		writeFakeError(w, http.StatusForbidden, 10000, "Authentication error")
+	})
+	dir := runTestBackup(t, api, "-format", "api-json")
+	data, err := ioutil.ReadFile(filepath.Join(dir, "managed.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(string(data), `"managed_by": "email_routing"`); count != 2 {
+		t.Errorf("%d record(s) are managed by email_routing, want the 2 whose meta says so", count)
+	}
+}
+
+// createdRecords answers requests to create DNS records in the fake API, passing the rest on as usual, and returns the
+// "type name" of each record that was created, sorted.
+func createdRecords(api *fakeAPI) func() []string {
+	mu := sync.Mutex{}
+	created := []string{}
+	api.handle("zones/*/dns_records", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			api.serveDefault(w, r)
+			return
+		}
+
+		record := cloudflare.DNSRecord{}
+		err := json.NewDecoder(r.Body).Decode(&record)
+		if err != nil {
+			writeFakeError(w, http.StatusBadRequest, 9207, "Request body is invalid")
+			return
+		}
+		mu.Lock()
+		created = append(created, record.Type+" "+record.Name)
+		record.ID = "restored" + strconv.Itoa(len(created))
+		mu.Unlock()
+		writeFakeResult(w, record)
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		sorted := append([]string{}, created...)
+		sort.Strings(sorted)
+		return sorted
+	}
+}
+
+func TestRestoreSkipsManagedRecords(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			"managed skipped",
+			[]string{"-record", "managed.example/MX", "-record", "www.managed.example/CNAME"},
+			[]string{"CNAME www.managed.example"},
+			"",
+		},
+		{
+			"include managed",
+			[]string{"-record", "managed.example/MX", "-record", "www.managed.example/CNAME", "-include-managed"},
+			[]string{"CNAME www.managed.example", "MX managed.example", "MX managed.example", "MX managed.example"},
+			"",
+		},
+		{
+			"only managed",
+			[]string{"-record", "managed.example/MX"},
+			[]string{},
+			"All of the matching records are managed by Cloudflare",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			api := newFakeAPI(t, "managed")
+			dir := runTestBackup(t, api, "-format", "json", "-resources", "dns", "-drift")
+
+			// the MX records on the zone itself and www are deleted, and found to be by the next backup
+			zone := api.zones[0]
+			kept := []json.RawMessage{}
+			for _, data := range zone.DNSRecords {
+				record := cloudflare.DNSRecord{}
+				json.Unmarshal(data, &record)
+				if (record.Type == "MX" && record.Name == "managed.example") || record.Name == "www.managed.example" {
+					continue
+				}
+				kept = append(kept, data)
+			}
+			zone.DNSRecords = kept
+			// the zone's modified_on changes with it, so the cached pages from the last backup aren't used
+			zone.Zone = json.RawMessage(strings.Replace(string(zone.Zone), "2024-05-06T07:08:09", "2024-05-07T07:08:09", 1))
+			runTestBackup(t, api, "-format", "json", "-resources", "dns", "-drift", "-output", dir)
+
+			created := createdRecords(api)
+			err := runRestore(append([]string{
+				"-api-token", "test-token", "-api-base-url", api.URL(), "-restore-rate", "0", "-tombstones", filepath.Join(dir, tombstonesFileName),
+			}, test.args...))
+			if test.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("got error %v, want one with %q", err, test.wantErr)
+			}
+			if got := created(); strings.Join(got, ", ") != strings.Join(test.want, ", ") {
+				t.Errorf("created %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifestFileName is the name of the manifest file written to the output directory.
+const manifestFileName = "manifest.json"
+
+// manifest describes the contents of a backup. Filter describes the filter applied to the DNS records, if the backup
+// doesn't have all of them. PartialRun says why the backup doesn't have every selected zone, if it was limited with
+// -max-zones or -max-requests. ContainsSecrets is set if -include-secrets was used with resources that have secrets, so
+// the backup needs to be kept as safe as the secrets themselves.
+type manifest struct {
+	CreatedAt       time.Time       `json:"created_at"`
+	Layout          string          `json:"layout"`
+	Filter          string          `json:"filter,omitempty"`
+	PartialRun      string          `json:"partial_run,omitempty"`
+	Endpoint        string          `json:"endpoint,omitempty"`
+	ContainsSecrets bool            `json:"contains_secrets"`
+	Zones           []*manifestZone `json:"zones"`
+	Accounts        []*manifestZone `json:"accounts"`
+
+	// Files lists the files that don't belong to a single zone, like the one written with -single-file, the
+	// changelog, the tombstones, and the reports.
+	Files []manifestFile `json:"files,omitempty"`
+
+	// Warnings lists every resource that was skipped because the token didn't have permission to read it, from all
+	// of the zones and accounts. It's filled in by write.
+	Warnings []missingResource `json:"warnings"`
+}
+
+// manifestZone describes the backup of a single zone, or of a single account.
+type manifestZone struct {
+	ID                string         `json:"id"`
+	Name              string         `json:"name"`
+	Files             []manifestFile `json:"files"`
+	Collectors        []string       `json:"collectors"`
+	SkippedCollectors []string       `json:"skipped_collectors"`
+
+	// Account is the directory that the zone's files are in, with -group-by-account.
+	Account string `json:"account,omitempty"`
+
+	// ContentHash is the zone's content hash, which only changes when something in the zone, or the way its files
+	// are written, does. It's left out if the records were streamed.
+	ContentHash string `json:"content_hash,omitempty"`
+
+	// Records is how many DNS records were backed up, if they were, and RecordsFetched is how many there were before
+	// the record filter (-record-types, -proxied-only, or -unproxied-only), if one was used, for the next run to
+	// compare to.
+	Records        *int `json:"records,omitempty"`
+	RecordsFetched *int `json:"records_fetched,omitempty"`
+
+	// Warnings describes the skipped collectors that the token didn't have permission for.
+	Warnings []missingResource `json:"warnings,omitempty"`
+}
+
+// missingResource is a resource that wasn't backed up because the API token doesn't have permission to read it.
+type missingResource struct {
+	Zone       string `json:"zone"`
+	Resource   string `json:"resource"`
+	Permission string `json:"permission"`
+}
+
+// manifestFile describes a file in the backup. Section is set for the extra files saved by a section, like API Shield
+// schemas, to the name of that section.
+type manifestFile struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Section string `json:"section,omitempty"`
+
+	// UncompressedSize is the size of what's inside the file, if it was compressed with -compress.
+	UncompressedSize int64 `json:"uncompressed_size,omitempty"`
+}
+
+func newManifest(layout string, filter string) *manifest {
+	return &manifest{
+		CreatedAt: time.Now().UTC(),
+		Layout:    layout,
+		Filter:    filter,
+		Zones:     []*manifestZone{},
+		Accounts:  []*manifestZone{},
+	}
+}
+
+// newManifestFile hashes the file at the given path. The path stored in the manifest is relative to the output
+// directory.
+func newManifestFile(outputDir string, path string) (manifestFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return manifestFile{}, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return manifestFile{}, err
+	}
+
+	relativePath, err := filepath.Rel(outputDir, path)
+	if err != nil {
+		return manifestFile{}, err
+	}
+
+	return manifestFile{
+		Path:   filepath.ToSlash(relativePath),
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// write saves the manifest into the given output directory.
+func (m *manifest) write(outputDir string, mode os.FileMode) error {
+	m.Warnings = []missingResource{}
+	for _, zones := range [][]*manifestZone{m.Zones, m.Accounts} {
+		for _, zone := range zones {
+			m.Warnings = append(m.Warnings, zone.Warnings...)
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(outputDir, manifestFileName), data, mode)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metricLastSuccess = "cloudflare_backup_last_success_timestamp"
+const metricZonesTotal = "cloudflare_backup_zones_total"
+
+// escapeLabelValue escapes a string for use as a label value in the Prometheus text exposition format.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// previousMetric reads the value of a metric without labels from an existing metrics file, like the last success
+// timestamp, so that it survives failed runs.
+func previousMetric(path string, name string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == name {
+			return fields[1]
+		}
+	}
+
+	return ""
+}
+
+// writeMetrics writes metrics about the run to the given path, in a format suitable for node_exporter's textfile
+// collector. The file is replaced atomically, so that the collector never sees a partially written file.
+func writeMetrics(path string, report *RunReport) error {
+	lastSuccess := previousMetric(path, metricLastSuccess)
+	if !report.Failed() {
+		lastSuccess = strconv.FormatInt(report.End.Unix(), 10)
+	}
+
+	// a run that failed before it got to any zones, like when the zones couldn't be listed, counts every zone from the
+	// last run as failed, or just one if there wasn't a last run, so that an alert on zones_failed still goes off
+	zonesFailed := report.ZonesFailed()
+	if report.Failed() && len(report.Zones) == 0 {
+		zonesFailed, _ = strconv.Atoi(previousMetric(path, metricZonesTotal))
+		if zonesFailed < 1 {
+			zonesFailed = 1
+		}
+	}
+
+	metrics := ""
+	if lastSuccess != "" {
+		metrics += "# HELP " + metricLastSuccess + " Unix time of the last successful backup.\n" +
+			"# TYPE " + metricLastSuccess + " gauge\n" +
+			metricLastSuccess + " " + lastSuccess + "\n"
+	}
+
+	metrics += "# HELP " + metricZonesTotal + " Number of zones processed in the last run.\n" +
+		"# TYPE " + metricZonesTotal + " gauge\n" +
+		metricZonesTotal + " " + strconv.Itoa(len(report.Zones)) + "\n"
+
+	metrics += "# HELP cloudflare_backup_zones_failed Number of zones that failed in the last run.\n" +
+		"# TYPE cloudflare_backup_zones_failed gauge\n" +
+		"cloudflare_backup_zones_failed " + strconv.Itoa(zonesFailed) + "\n"
+
+	metrics += "# HELP cloudflare_backup_zones_timed_out Number of zones that failed in the last run because they took longer than -zone-timeout.\n" +
+		"# TYPE cloudflare_backup_zones_timed_out gauge\n" +
+		"cloudflare_backup_zones_timed_out " + strconv.Itoa(report.ZonesTimedOut()) + "\n"
+
+	metrics += "# HELP cloudflare_backup_zones_vanished Number of zones that were deleted or moved during the last run, and so were skipped.\n" +
+		"# TYPE cloudflare_backup_zones_vanished gauge\n" +
+		"cloudflare_backup_zones_vanished " + strconv.Itoa(report.ZonesVanished()) + "\n"
+
+	metrics += "# HELP cloudflare_backup_records_total Number of DNS records backed up per zone in the last run.\n" +
+		"# TYPE cloudflare_backup_records_total gauge\n"
+	zones := append([]*ZoneReport{}, report.Zones...)
+	sort.Slice(zones, func(i, j int) bool {
+		return zones[i].Name < zones[j].Name
+	})
+	for _, zone := range zones {
+		if zone.Error != "" {
+			continue
+		}
+		metrics += "cloudflare_backup_records_total{zone=\"" + escapeLabelValue(zone.Name) + "\"} " + strconv.Itoa(zone.Records) + "\n"
+	}
+
+	metrics += "# HELP cloudflare_backup_duration_seconds How long the last run took.\n" +
+		"# TYPE cloudflare_backup_duration_seconds gauge\n" +
+		"cloudflare_backup_duration_seconds " + strconv.FormatFloat(report.Duration().Seconds(), 'f', -1, 64) + "\n"
+
+	metrics += "# HELP cloudflare_backup_api_requests_total Number of Cloudflare API requests made in the last run, by response status.\n" +
+		"# TYPE cloudflare_backup_api_requests_total gauge\n"
+	statuses := []string{}
+	for requestStatus := range report.APIRequestsByStatus {
+		statuses = append(statuses, requestStatus)
+	}
+	sort.Strings(statuses)
+	for _, requestStatus := range statuses {
+		metrics += "cloudflare_backup_api_requests_total{status=\"" + escapeLabelValue(requestStatus) + "\"} " + strconv.Itoa(report.APIRequestsByStatus[requestStatus]) + "\n"
+	}
+
+	metrics += "# HELP cloudflare_backup_api_requests_sent Number of requests that reached the Cloudflare API in the last run, by endpoint category. Cached responses aren't included.\n" +
+		"# TYPE cloudflare_backup_api_requests_sent gauge\n"
+	categories := []string{}
+	for category := range report.APIUsage.RequestsByCategory {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		metrics += "cloudflare_backup_api_requests_sent{category=\"" + escapeLabelValue(category) + "\"} " + strconv.Itoa(report.APIUsage.RequestsByCategory[category]) + "\n"
+	}
+
+	metrics += "# HELP cloudflare_backup_api_peak_requests_per_second The most API requests made in any one second of the last run.\n" +
+		"# TYPE cloudflare_backup_api_peak_requests_per_second gauge\n" +
+		"cloudflare_backup_api_peak_requests_per_second " + strconv.Itoa(report.APIUsage.PeakRequestRate) + "\n"
+
+	metrics += "# HELP cloudflare_backup_api_rate_limited Number of API requests rejected with a 429 in the last run.\n" +
+		"# TYPE cloudflare_backup_api_rate_limited gauge\n" +
+		"cloudflare_backup_api_rate_limited " + strconv.Itoa(report.APIUsage.RateLimited) + "\n"
+
+	metrics += "# HELP cloudflare_backup_api_backoff_seconds Time spent waiting to retry API requests in the last run.\n" +
+		"# TYPE cloudflare_backup_api_backoff_seconds gauge\n" +
+		"cloudflare_backup_api_backoff_seconds " + strconv.FormatFloat(report.APIUsage.BackoffSeconds, 'f', -1, 64) + "\n"
+
+	metrics += "# HELP cloudflare_backup_api_paused_seconds Time that every API request was held back for after a 429 in the last run.\n" +
+		"# TYPE cloudflare_backup_api_paused_seconds gauge\n" +
+		"cloudflare_backup_api_paused_seconds " + strconv.FormatFloat(report.APIUsage.PausedSeconds, 'f', -1, 64) + "\n"
+
+	metrics += "# HELP cloudflare_backup_api_rate_limit_wait_seconds Total time that API requests waited for the rate limiter or a pause before they were sent in the last run.\n" +
+		"# TYPE cloudflare_backup_api_rate_limit_wait_seconds gauge\n" +
+		"cloudflare_backup_api_rate_limit_wait_seconds " + strconv.FormatFloat(report.APIUsage.RateLimitWaitSeconds, 'f', -1, 64) + "\n"
+
+	metrics += writeCollectorMetrics(zones)
+
+	if report.APIUsage.RateLimitRemaining != nil {
+		metrics += "# HELP cloudflare_backup_api_rate_limit_remaining The fewest requests left in the API's rate limit window during the last run.\n" +
+			"# TYPE cloudflare_backup_api_rate_limit_remaining gauge\n" +
+			"cloudflare_backup_api_rate_limit_remaining " + strconv.Itoa(*report.APIUsage.RateLimitRemaining) + "\n"
+	}
+
+	// the metrics need to be readable by node_exporter, which usually runs as a different user
+	return writeFileAtomic(path, []byte(metrics), 0644)
+}
+
+// writeFailedMetrics writes the metrics file for a run that failed before it could start, like when -ca-cert couldn't
+// be read, so that it still shows up as a failure.
+func writeFailedMetrics(opts *options, start time.Time, err error) {
+	if opts.MetricsFile == "" {
+		return
+	}
+
+	report := newRunReport()
+	report.Start = start
+	report.AddError(err)
+	report.Finish()
+	err = writeMetrics(opts.MetricsFile, report)
+	if err != nil {
+		log.Printf("Couldn't write metrics file: %s", err)
+	}
+}
+
+// writeCollectorMetrics returns the metrics for how long each zone and each of its collectors took, and how much of
+// that was spent waiting for the rate limit. The zones should already be sorted.
+func writeCollectorMetrics(zones []*ZoneReport) string {
+	metrics := "# HELP cloudflare_backup_zone_duration_seconds How long each zone took to back up in the last run.\n" +
+		"# TYPE cloudflare_backup_zone_duration_seconds gauge\n"
+	for _, zone := range zones {
+		if zone.Resumed {
+			continue
+		}
+		metrics += "cloudflare_backup_zone_duration_seconds{zone=\"" + escapeLabelValue(zone.Name) + "\"} " + strconv.FormatFloat(zone.DurationSeconds, 'f', -1, 64) + "\n"
+	}
+
+	collectorMetrics := []struct {
+		name  string
+		help  string
+		value func(timing collectorTiming) string
+	}{
+		{"cloudflare_backup_collector_duration_seconds", "How long each collector took for each zone in the last run.", func(timing collectorTiming) string {
+			return strconv.FormatFloat(timing.DurationSeconds, 'f', -1, 64)
+		}},
+		{"cloudflare_backup_collector_rate_limit_wait_seconds", "How long each collector's requests waited for the rate limiter or a pause for each zone in the last run.", func(timing collectorTiming) string {
+			return strconv.FormatFloat(timing.RateLimitWaitSeconds, 'f', -1, 64)
+		}},
+		{"cloudflare_backup_collector_api_requests_sent", "Number of requests that reached the Cloudflare API for each collector and zone in the last run.", func(timing collectorTiming) string {
+			return strconv.Itoa(timing.Requests)
+		}},
+	}
+	for _, metric := range collectorMetrics {
+		metrics += "# HELP " + metric.name + " " + metric.help + "\n" +
+			"# TYPE " + metric.name + " gauge\n"
+		for _, zone := range zones {
+			for _, timing := range zone.Collectors {
+				metrics += metric.name + "{zone=\"" + escapeLabelValue(zone.Name) + "\",collector=\"" + escapeLabelValue(timing.Name) + "\"} " + metric.value(timing) + "\n"
+			}
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetricsWhenSetupFails(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		previous string
+		want     []string
+	}{
+		{
+			"after a successful run",
+			metricLastSuccess + " 1767323045\n" + metricZonesTotal + " 3\n",
+			[]string{metricLastSuccess + " 1767323045\n", metricZonesTotal + " 0\n", "cloudflare_backup_zones_failed 3\n"},
+		},
+		{
+			"first run",
+			"",
+			[]string{metricZonesTotal + " 0\n", "cloudflare_backup_zones_failed 1\n"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			metricsFile := filepath.Join(dir, "cloudflare_backup.prom")
+			if test.previous != "" {
+				err := ioutil.WriteFile(metricsFile, []byte(test.previous), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// a -ca-cert file without any certificates in it makes the run fail before it starts
+			caCert := filepath.Join(dir, "ca.pem")
+			err := ioutil.WriteFile(caCert, []byte("not a certificate\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts := &options{}
+			flags := flag.NewFlagSet("cloudflare-backup", flag.ContinueOnError)
+			opts.registerFlags(flags)
+			err = flags.Parse([]string{"-api-token", "test-token", "-output", filepath.Join(dir, "output"), "-ca-cert", caCert, "-metrics-file", metricsFile})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = opts.validate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errs := runBackup(context.Background(), opts)
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), "-ca-cert") {
+				t.Fatalf("got errors %v, want one about -ca-cert", errs)
+			}
+
+			metrics, err := ioutil.ReadFile(metricsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(string(metrics), want) {
+					t.Errorf("the metrics don't have %q:\n%s", want, metrics)
+				}
+			}
+			if test.previous == "" && strings.Contains(string(metrics), metricLastSuccess) {
+				t.Errorf("the metrics have a last success, but there's never been one:\n%s", metrics)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// options holds the configuration for a backup run.
+type options struct {
+	apiCredentials
+
+	Endpoints          string
+	OutputDir          string
+	GPGRecipient       string
+	WebhookURL         string
+	WebhookFormat      string
+	WebhookOn          string
+	HealthcheckURL     string
+	HealthcheckSummary bool
+	Timeout            time.Duration
+	MetricsFile        string
+	SummaryJSON        string
+	Resources          string
+	Format             string
+	SingleFile         bool
+	TextRecordFlags    bool
+	APIBaseURL         string
+	Debug              bool
+	StrictDecode       bool
+	MaxZones           int
+	GroupByAccount     bool
+	MaxRequests        int
+	ZoneTimeout        time.Duration
+	RDAP               bool
+	PreZoneHook        string
+	PostZoneHook       string
+	HookTimeout        time.Duration
+	HookFailuresIgnore bool
+	RDAPServer         string
+	UserAgent          string
+	Proxy              string
+	CACert             string
+	MaxIdleConns       int
+	DisableHTTP2       bool
+	Layout             string
+	Compress           string
+	DirMode            fileMode
+	FileMode           fileMode
+	SkipUnchanged      bool
+	TimeZone           string
+	TimeFormat         string
+	RecordTypes        string
+	ProxiedOnly        bool
+	UnproxiedOnly      bool
+	Audit              bool
+	AuditStrict        bool
+	AuditBaseline      string
+	AuditMinTTL        uint64
+	AuditMaxTTL        uint64
+	AuditDisable       string
+	RequireOwnerTag    bool
+	CompareZones       zoneComparisons
+	VerifyDNS          bool
+	VerifyDNSAll       bool
+	VerifyDNSSample    int
+	VerifyDNSResolver  string
+	VerifyDNSRate      float64
+	VerifyDNSTimeout   time.Duration
+	Drift              bool
+	NoCache            bool
+	CacheDir           string
+	Resume             bool
+	ResumeMaxAge       time.Duration
+	TombstoneMaxAge    time.Duration
+	DryRun             bool
+	RateLimit          float64
+
+	IncludeAccountResources bool
+	IncludeSecrets          bool
+	AccountID               string
+	DeploymentHistory       int
+	Zones                   string
+	ZoneIDs                 stringList
+	ZoneNames               []string
+	ZonesFrom               string
+	Interactive             bool
+	PerPage                 int
+	IncludeCFExport         bool
+	Report                  string
+	StreamRecords           bool
+	RequireAllResources     bool
+	SelfCheck               bool
+	AllowShrink             bool
+	MaxShrinkPercent        int
+	SignKey                 string
+
+	// timeZone is the parsed version of TimeZone, set by validate
+	timeZone *time.Location
+
+	// recordFilter is built from RecordTypes, ProxiedOnly, and UnproxiedOnly by validate
+	recordFilter recordFilter
+
+	// zonesFromNames is read from the file named by ZonesFrom by validate
+	zonesFromNames []string
+
+	// zoneFilter is built from Zones by validate, and replaced by the selection made with -interactive
+	zoneFilter zoneFilter
+
+	// reports is the list of reports from Report, set by validate
+	reports []string
+
+	// accountIDFromEnv is set by validate if AccountID came from CLOUDFLARE_ACCOUNT_ID, rather than -account-id
+	accountIDFromEnv bool
+
+	// auditConfig is built from AuditMinTTL, AuditMaxTTL, AuditDisable, and RequireOwnerTag by validate
+	auditConfig auditConfig
+
+	// baseline is read from AuditBaseline by validate
+	baseline map[string]baselineValue
+
+	// signingKey is the key read from SignKey, set by validate
+	signingKey ed25519.PrivateKey
+
+	// endpoint is the label of the endpoint that's being backed up from, with -endpoints
+	endpoint string
+}
+
+// registerFlags defines the command line flags that set each option.
+func (o *options) registerFlags(flags *flag.FlagSet) {
+	o.apiCredentials.registerFlags(flags, "The CloudFlare API token to use.")
+	flags.StringVar(&o.Endpoints, "endpoints", "", "If set, a JSON file listing several API hosts to back up from, each with its own token, like the one for the China network. Each one is backed up into a directory named after its label.")
+	flags.StringVar(&o.APIBaseURL, "api-base-url", cloudflare.DefaultBaseURL, "The base URL of the CloudFlare API, if you need to go through a proxy or gateway.")
+	flags.StringVar(&o.OutputDir, "output", "output", "The output directory.")
+	flags.StringVar(&o.GPGRecipient, "gpg-recipient", "", "If set, encrypt each output file for this recipient with the gpg binary.")
+	flags.StringVar(&o.WebhookURL, "webhook-url", "", "If set, a URL to POST a JSON summary of the run to when it finishes.")
+	flags.StringVar(&o.WebhookFormat, "webhook-format", "json", "The format of the webhook payload, either json or slack.")
+	flags.StringVar(&o.WebhookOn, "webhook-on", "failure", "When to send the webhook, either failure or always.")
+	flags.StringVar(&o.HealthcheckURL, "healthcheck-url", "", "If set, a healthchecks.io-style URL to ping when the run starts, succeeds, or fails.")
+	flags.BoolVar(&o.HealthcheckSummary, "healthcheck-summary", false, "If set, include a summary of the run in the final healthcheck ping.")
+	flags.DurationVar(&o.Timeout, "timeout", 30*time.Second, "The timeout for each HTTP request made by the tool.")
+	flags.StringVar(&o.MetricsFile, "metrics-file", "", "If set, write Prometheus metrics about the run to this file, for node_exporter's textfile collector.")
+	flags.StringVar(&o.UserAgent, "user-agent", "cloudflare-backup/"+version+" (+"+repoURL+")", "The User-Agent header to send with API requests.")
+	flags.StringVar(&o.Proxy, "proxy", "", "The proxy to use for API requests. By default, HTTPS_PROXY and NO_PROXY from the environment are used.")
+	flags.StringVar(&o.CACert, "ca-cert", "", "A PEM file with extra CA certificates to trust for API requests, such as for a TLS-intercepting proxy.")
+	flags.IntVar(&o.MaxIdleConns, "max-idle-conns", 0, "How many idle connections to keep open to each API host for reuse. By default, it's enough for the requests that are made at once.")
+	flags.BoolVar(&o.DisableHTTP2, "disable-http2", false, "If set, only use HTTP/1.1 for API requests, for proxies and middleboxes that don't handle HTTP/2 well.")
+	flags.BoolVar(&o.Debug, "debug", false, "Enable debug logging.")
+	flags.BoolVar(&o.GroupByAccount, "group-by-account", false, "If set, put each zone's backup in a directory named after its account.")
+	flags.IntVar(&o.MaxZones, "max-zones", 0, "If set, only back up this many of the selected zones, in the order that they're listed. The manifest says that the backup is partial.")
+	flags.IntVar(&o.MaxRequests, "max-requests", 0, "If set, stop the run once it has sent this many requests to the API, and exit with code 6.")
+	flags.DurationVar(&o.ZoneTimeout, "zone-timeout", 0, "If set, give up on a zone that takes longer than this to back up (like 10m), mark it as failed, and go on to the next one.")
+	flags.BoolVar(&o.RDAP, "rdap", false, "If set, the registrar resource also looks each zone's domain up with RDAP, which works for any registrar. This sends the zone names to the RDAP server.")
+	flags.StringVar(&o.RDAPServer, "rdap-server", "https://rdap.org", "The RDAP server to use with -rdap. The default one redirects to the right server for each domain.")
+	flags.StringVar(&o.PreZoneHook, "pre-zone-hook", "", "If set, a command to run with the shell before each zone is backed up. It gets the zone's details in CB_ZONE_NAME, CB_ZONE_ID, CB_OUTPUT_FILE, CB_STATUS, and CB_RECORD_COUNT, and the zone isn't backed up if it fails.")
+	flags.StringVar(&o.PostZoneHook, "post-zone-hook", "", "If set, a command to run with the shell after each zone is backed up, whether or not that worked. It gets the same environment variables as -pre-zone-hook, and the zone is marked as failed if it fails.")
+	flags.DurationVar(&o.HookTimeout, "hook-timeout", time.Minute, "How long -pre-zone-hook and -post-zone-hook can run for before they're stopped and count as failed.")
+	flags.BoolVar(&o.HookFailuresIgnore, "hook-failures-ignore", false, "If set, a hook that fails is only a warning, rather than failing the zone.")
+	flags.BoolVar(&o.StrictDecode, "strict-decode", false, "If set, check API responses for fields that this tool doesn't know about, and so doesn't back up, and list them in the summary. This makes decoding responses about twice as slow.")
+	flags.StringVar(&o.SummaryJSON, "summary-json", "", "If set, write a summary of the run to this file as JSON.")
+	flags.StringVar(&o.Format, "format", "text", "The format of the backup files. Available formats: "+strings.Join(outputFormatNames(), ", ")+".")
+	flags.BoolVar(&o.SingleFile, "single-file", false, "With -format ndjson, write every zone into a single "+singleFileName+" file in the output directory as the run goes, instead of a file per zone.")
+	flags.BoolVar(&o.TextRecordFlags, "text-record-flags", false, "If set, the text format has Proxiable and Locked columns for each DNS record, before its value.")
+	o.DirMode = 0700
+	flags.Var(&o.DirMode, "dir-mode", "The permissions for the output directory and any directories created in it, in octal. Ignored on Windows.")
+	o.FileMode = 0600
+	flags.Var(&o.FileMode, "file-mode", "The permissions for files created in the output directory, in octal. Ignored on Windows.")
+	flags.BoolVar(&o.SkipUnchanged, "skip-unchanged", false, "If set, backup files whose contents haven't changed since the last run are left untouched.")
+	flags.StringVar(&o.TimeZone, "time-zone", "UTC", "The time zone to show timestamps in, like America/New_York or Local. The json format always uses the original timestamps.")
+	flags.StringVar(&o.TimeFormat, "time-format", time.RFC3339, "How to format timestamps, as a Go time layout. The json format always uses the original timestamps.")
+	flags.StringVar(&o.Layout, "layout", "flat", "How to lay out the output directory: flat, for a single file per zone, or dir, for a directory per zone with a file per resource.")
+	flags.StringVar(&o.Compress, "compress", "", "If set, compress each zone's DNS records file as it's written, adding .gz to its name. Available compression: gzip.")
+	flags.StringVar(&o.RecordTypes, "record-types", "", "If set, a comma-separated list of the DNS record types to back up, like MX,TXT.")
+	flags.BoolVar(&o.ProxiedOnly, "proxied-only", false, "If set, only back up DNS records that are proxied through Cloudflare.")
+	flags.BoolVar(&o.UnproxiedOnly, "unproxied-only", false, "If set, only back up DNS records that aren't proxied through Cloudflare.")
+	flags.BoolVar(&o.Audit, "audit", false, "If set, check the DNS records for common problems and write the findings to audit.txt and audit.json.")
+	flags.BoolVar(&o.AuditStrict, "audit-strict", false, "Like -audit, but the run fails if the audit finds any problems.")
+	flags.Uint64Var(&o.AuditMinTTL, "audit-min-ttl", 0, "If set, the audit reports records with a TTL lower than this many seconds, other than ones set to Auto.")
+	flags.Uint64Var(&o.AuditMaxTTL, "audit-max-ttl", defaultAuditMaxTTL, "The audit reports records with a TTL higher than this many seconds, other than the NS records at the zone apex.")
+	flags.StringVar(&o.AuditDisable, "audit-disable", "", "If set, a comma-separated list of the audit rules to turn off. Available rules: "+strings.Join(auditRuleNames(), ", ")+".")
+	flags.BoolVar(&o.RequireOwnerTag, "require-owner-tag", false, "If set, the audit reports every record without an owner, from an owner:<name> tag or an owner: <name> in its comment. Implies -audit.")
+	flags.StringVar(&o.AuditBaseline, "audit-baseline", "", "If set, a YAML file with the value that each zone setting should have, like ssl: strict. The audit reports every zone whose settings don't match it. Implies -audit, and needs the settings resource.")
+	flags.Var(&o.CompareZones, "compare-zones", "If set, a primary zone and the zones that are meant to mirror it, like example.com=example.net,example.org. Each one's records are compared with the primary's, and the differences are written to "+compareTextFileName+" and "+compareJSONFileName+". Can be given more than once.")
+	flags.BoolVar(&o.VerifyDNS, "verify-dns", false, "If set, look up a sample of each zone's records with a DNS resolver, and warn about any that don't match.")
+	flags.BoolVar(&o.VerifyDNSAll, "verify-dns-all", false, "Like -verify-dns, but look up every record instead of a sample.")
+	flags.IntVar(&o.VerifyDNSSample, "verify-dns-sample", 10, "How many records to look up in each zone with -verify-dns.")
+	flags.StringVar(&o.VerifyDNSResolver, "verify-dns-resolver", "1.1.1.1:53", "The DNS resolver to use for -verify-dns.")
+	flags.Float64Var(&o.VerifyDNSRate, "verify-dns-rate", 10, "The most DNS lookups per second to make with -verify-dns.")
+	flags.DurationVar(&o.VerifyDNSTimeout, "verify-dns-timeout", time.Minute, "How long to spend on -verify-dns in total.")
+	flags.BoolVar(&o.Drift, "drift", false, "If set, compare each zone's DNS records to its previous backup, and append any changes to CHANGELOG.txt and changelog.ndjson.")
+	flags.DurationVar(&o.TombstoneMaxAge, "tombstone-max-age", 0, "With -drift, forget removed records in deleted-records.ndjson once they've been gone this long, like 2160h for 90 days. By default, they're kept forever.")
+	flags.BoolVar(&o.NoCache, "no-cache", false, "If set, don't reuse API responses saved by previous runs.")
+	flags.StringVar(&o.CacheDir, "cache-dir", "", "Where to save API responses for reuse by later runs. Defaults to .cache in the output directory.")
+	flags.BoolVar(&o.Resume, "resume", false, "If set, skip zones that were already backed up by a recent run with the same options, such as one that was interrupted.")
+	flags.DurationVar(&o.ResumeMaxAge, "resume-max-age", 24*time.Hour, "How recently a zone must have been backed up to be skipped by -resume.")
+	flags.BoolVar(&o.DryRun, "dry-run", false, "If set, check the token and list what would be backed up, without backing anything up or writing any files.")
+	flags.Float64Var(&o.RateLimit, "rate-limit", 0, "If set, the most API requests to make per second, on average. Fractions like 0.5 are allowed.")
+	flags.BoolVar(&o.IncludeAccountResources, "include-account-resources", false, "If set, back up every account-level resource as well, into the accounts directory. They can also be selected one by one with -resources.")
+	flags.StringVar(&o.AccountID, "account-id", "", "If set, only back up account-level resources from this account. The pages and workers resources need this.")
+	flags.IntVar(&o.DeploymentHistory, "deployment-history", 5, "How many of the latest deployments to keep for each Pages project and Workers script.")
+	flags.BoolVar(&o.IncludeSecrets, "include-secrets", false, "If set, keep secrets like API keys in the backup, instead of removing them.")
+	flags.StringVar(&o.Zones, "zones", "", "If set, a comma-separated list of the zones to back up. Globs like *.example.com are allowed.")
+	flags.StringVar(&o.ZonesFrom, "zones-from", "", "If set, a file with the names of the zones to back up, one on each line, or - to read them from stdin. Blank lines and comments starting with # are skipped.")
+	flags.Var(&o.ZoneIDs, "zone-id", "If set, the ID of a zone to back up, without listing the zones first, for tokens that can only access that zone. Can be given more than once.")
+	flags.BoolVar(&o.Interactive, "interactive", false, "If set, list the zones and ask which ones to back up.")
+	flags.IntVar(&o.PerPage, "per-page", 0, "If set, the number of items to ask for in each page of a list, instead of the most that each endpoint allows.")
+	flags.BoolVar(&o.IncludeCFExport, "include-cf-export", false, "If set, also save each zone's DNS records as exported by Cloudflare itself, in BIND format.")
+	flags.StringVar(&o.Report, "report", "", "If set, a comma-separated list of reports to write into the output directory once the backup is done. Available reports: "+strings.Join(reportNames(), ", ")+".")
+	flags.BoolVar(&o.SelfCheck, "self-check", false, "If set, read each zone's backup file back in with the parser that restores use as it's written, and fail the zone if the records don't come out the same.")
+	flags.BoolVar(&o.AllowShrink, "allow-shrink", false, "If set, overwrite a zone's previous backup even if the zone has lost more than -max-shrink-percent of its DNS records since then.")
+	flags.IntVar(&o.MaxShrinkPercent, "max-shrink-percent", 50, "If a zone has lost more than this percentage of its DNS records since its previous backup, keep the previous backup and fail the zone, unless -allow-shrink is set.")
+	flags.StringVar(&o.SignKey, "sign-key", "", "If set, the ed25519 private key to sign the manifest with, like one made with ssh-keygen -t ed25519. The signature is saved in "+manifestSignatureFileName+", and can be checked with the verify subcommand.")
+	flags.BoolVar(&o.RequireAllResources, "require-all-resources", false, "If set, fail the run if any resource is skipped because the API token doesn't have permission to read it, instead of only warning about it.")
+	flags.BoolVar(&o.StreamRecords, "stream-records", false, "If set, write each zone's DNS records as they're downloaded, instead of fetching them all first. This keeps memory use flat for very large zones, but can't be used with -drift, -audit, -verify-dns, or -report, which need every record at once, and a zone whose records can't be read fails instead of being skipped. Records are written in the order that the API returns them either way. Without it, a zone takes about 0.7 KB of memory for each record, or 70 MB for 100,000 of them, so it's only worth it for very large zones.")
+	flags.StringVar(&o.Resources, "resources", defaultResources(), "A comma-separated list of the resources to back up, or \"all\". Available resources: "+strings.Join(collectorNames(), ", ")+".")
+}
+
+// validate checks that the options make sense together.
+func (o *options) validate() error {
+	if o.Endpoints != "" {
+		// the environment isn't looked at, since each endpoint names the variable with its own token
+		if !o.apiCredentials.empty() || o.APIEmail != "" {
+			return errors.New("The -api-token and -api-key flags can't be used with -endpoints, since each endpoint has its own token.")
+		}
+		if o.Interactive || o.HealthcheckURL != "" || o.MetricsFile != "" {
+			return errors.New("The -interactive, -healthcheck-url, and -metrics-file flags can't be used with -endpoints yet, since each endpoint is backed up in a run of its own.")
+		}
+	} else {
+		err := o.apiCredentials.resolve()
+		if err != nil {
+			return err
+		}
+		if o.apiCredentials.empty() {
+			return errNoCredentials
+		}
+	}
+
+	if o.AccountID == "" && os.Getenv(accountIDEnv) != "" {
+		o.AccountID = os.Getenv(accountIDEnv)
+		o.accountIDFromEnv = true
+	}
+
+	baseURL, err := url.Parse(o.APIBaseURL)
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+		return errors.New("The -api-base-url flag must be an absolute http or https URL.")
+	}
+	baseURL.Path = strings.TrimSuffix(baseURL.Path, "/") + "/"
+	o.APIBaseURL = baseURL.String()
+
+	o.timeZone, err = time.LoadLocation(o.TimeZone)
+	if err != nil {
+		return fmt.Errorf("The -time-zone flag must be a time zone name, like America/New_York: %w", err)
+	}
+
+	o.zoneFilter, err = newZoneFilter(o.Zones)
+	if err != nil {
+		return err
+	}
+
+	if len(o.ZoneIDs) > 0 && (o.Zones != "" || o.Interactive) {
+		return errors.New("The -zone-id flag picks the zones itself, so it can't be used with -zones or -interactive.")
+	}
+
+	for _, name := range o.ZoneNames {
+		if strings.HasPrefix(name, "-") {
+			// the flag package stops at the first argument that isn't a flag, so anything after a zone name is left as is
+			return fmt.Errorf("The flag %s comes after a zone name, so it wasn't read. Put the flags first, like cloudflare-backup -format json example.com.", name)
+		}
+		if strings.ContainsAny(name, "*?[") {
+			return fmt.Errorf("%s isn't a zone name. Use -zones to pick zones with a glob.", name)
+		}
+	}
+	if len(o.ZoneNames) > 0 && (o.Zones != "" || len(o.ZoneIDs) > 0 || o.Interactive) {
+		return errors.New("Zone names on the command line pick the zones themselves, so they can't be used with -zones, -zone-id, or -interactive.")
+	}
+
+	if o.ZonesFrom != "" {
+		if o.Zones != "" || len(o.ZoneIDs) > 0 || len(o.ZoneNames) > 0 || o.Interactive {
+			return errors.New("The -zones-from flag picks the zones itself, so it can't be used with -zones, -zone-id, zone names on the command line, or -interactive.")
+		}
+		o.zonesFromNames, err = readZoneList(o.ZonesFrom)
+		if err != nil {
+			return fmt.Errorf("Couldn't read the zone names from -zones-from: %w", err)
+		}
+		if len(o.zonesFromNames) == 0 {
+			return errors.New("The -zones-from list doesn't name any zones.")
+		}
+	}
+
+	if o.Interactive && !isTerminal(os.Stdin) {
+		return errors.New("The -interactive flag can only be used from a terminal, since it asks which zones to back up.")
+	}
+
+	o.recordFilter, err = newRecordFilter(o.RecordTypes, o.ProxiedOnly, o.UnproxiedOnly)
+	if err != nil {
+		return err
+	}
+
+	if o.DryRun {
+		// the cache directory would otherwise be created in the output directory
+		o.NoCache = true
+	}
+
+	if o.RateLimit < 0 {
+		return errors.New("The -rate-limit flag can't be negative.")
+	}
+
+	if o.PerPage < 0 || o.PerPage > cloudflare.MaxPerPage {
+		return fmt.Errorf("The -per-page flag must be between 1 and %d. Endpoints that allow fewer items per page use their own maximum instead.", cloudflare.MaxPerPage)
+	}
+
+	if o.DeploymentHistory < 0 {
+		return errors.New("The -deployment-history flag can't be negative.")
+	}
+
+	o.reports, err = parseReports(o.Report)
+	if err != nil {
+		return err
+	}
+
+	if o.AuditStrict {
+		o.Audit = true
+	}
+	o.auditConfig, err = newAuditConfig(o.AuditMinTTL, o.AuditMaxTTL, o.AuditDisable)
+	if err != nil {
+		return err
+	}
+	if o.RequireOwnerTag && !o.auditConfig.Disabled["owner-missing"] {
+		o.Audit = true
+		o.auditConfig.RequireOwnerTag = true
+	}
+	if o.AuditBaseline != "" && !o.auditConfig.Disabled[baselineRule] {
+		o.Audit = true
+		o.baseline, err = loadBaseline(o.AuditBaseline)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.VerifyDNSAll {
+		o.VerifyDNS = true
+	}
+	if o.VerifyDNSRate <= 0 {
+		return errors.New("The -verify-dns-rate flag must be greater than zero.")
+	}
+
+	if o.Layout != "flat" && o.Layout != "dir" {
+		return errors.New("The -layout flag must be either flat or dir.")
+	}
+
+	if o.Compress == "zstd" {
+		// there's no zstd in the standard library, and this tool has no dependencies outside of it
+		return errors.New("The zstd compression isn't supported yet, use -compress gzip instead.")
+	}
+	if o.Compress != "" && o.Compress != "gzip" {
+		return errors.New("The -compress flag must be gzip.")
+	}
+	if o.Compress != "" && o.SingleFile {
+		return errors.New("The -compress flag can't be used with -single-file, since it compresses each zone's file on its own.")
+	}
+
+	if o.SkipUnchanged && o.GPGRecipient != "" {
+		// encrypting the same file twice gives different ciphertext, so there's nothing to compare
+		return errors.New("The -skip-unchanged flag can't be used with -gpg-recipient.")
+	}
+
+	for _, report := range o.reports {
+		if report == "markdown" && !o.Drift {
+			return errors.New("The markdown report lists the changes found by -drift, so it can only be used with -drift.")
+		}
+	}
+
+	if o.StreamRecords && (o.Drift || o.Audit || o.VerifyDNS || len(o.reports) > 0) {
+		return errors.New("The -stream-records flag can't be used with -drift, -audit, -verify-dns, or -report, since they need all of a zone's records at once.")
+	}
+
+	if o.SelfCheck && (o.StreamRecords || o.SingleFile) {
+		return errors.New("The -self-check flag can't be used with -stream-records or -single-file, since it needs each zone's records and file on their own.")
+	}
+
+	if o.SingleFile {
+		if o.Format != "ndjson" || o.Layout != "flat" {
+			return errors.New("The -single-file flag only works with -format ndjson and -layout flat.")
+		}
+		if o.Drift || o.Resume || o.SkipUnchanged {
+			return errors.New("The -single-file flag can't be used with -drift, -resume, or -skip-unchanged, since they need a file for each zone.")
+		}
+	}
+
+	if o.MaxShrinkPercent < 0 || o.MaxShrinkPercent > 100 {
+		return errors.New("The -max-shrink-percent flag must be between 0 and 100.")
+	}
+
+	if o.SignKey != "" {
+		o.signingKey, err = loadSigningKey(o.SignKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.MaxZones < 0 {
+		return errors.New("The -max-zones flag can't be negative.")
+	}
+	if o.MaxRequests < 0 {
+		return errors.New("The -max-requests flag can't be negative.")
+	}
+	if o.MaxIdleConns < 0 {
+		return errors.New("The -max-idle-conns flag can't be negative.")
+	}
+
+	if o.ZoneTimeout < 0 {
+		return errors.New("The -zone-timeout flag can't be negative.")
+	}
+	if o.HookTimeout <= 0 {
+		return errors.New("The -hook-timeout flag must be positive.")
+	}
+
+	rdapServer, err := url.Parse(o.RDAPServer)
+	if err != nil || (rdapServer.Scheme != "http" && rdapServer.Scheme != "https") || rdapServer.Host == "" {
+		return errors.New("The -rdap-server flag must be an absolute http or https URL.")
+	}
+
+	if o.TombstoneMaxAge < 0 {
+		return errors.New("The -tombstone-max-age flag can't be negative.")
+	}
+
+	if o.Drift && o.GPGRecipient != "" {
+		// we'd need the private key to read the previous backup
+		return errors.New("The -drift flag can't be used with -gpg-recipient.")
+	}
+
+	if o.WebhookFormat != "json" && o.WebhookFormat != "slack" {
+		return errors.New("The -webhook-format flag must be either json or slack.")
+	}
+
+	if o.WebhookOn != "failure" && o.WebhookOn != "always" {
+		return errors.New("The -webhook-on flag must be either failure or always.")
+	}
+
+	return nil
+}
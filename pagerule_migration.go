@@ -0,0 +1,445 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// migrationFileName is the name of the file in the pagerules section's directory with the suggested replacements for
+// the zone's page rules.
+const migrationFileName = "migration-suggestions.json"
+
+// migrationNote explains the order of the suggestions at the top of the file.
+const migrationNote = "These are suggestions only, worked out from the page rules, and nothing has been changed in the zone. " +
+	"Page rules stop at the first one that matches, but every Config, Cache, and Origin Rule that matches is applied, " +
+	"with later rules winning, so add those in the reverse of the order here. Single Redirects stop at the first match, " +
+	"like page rules, so add them in this order."
+
+// the phases of the rulesets that each kind of suggestion goes in
+const (
+	redirectPhase = "http_request_dynamic_redirect"
+	configPhase   = "http_config_settings"
+	cachePhase    = "http_request_cache_settings"
+	originPhase   = "http_request_origin"
+)
+
+// pageRuleMigrations is what's in migration-suggestions.json.
+type pageRuleMigrations struct {
+	Zone  string              `json:"zone"`
+	Note  string              `json:"note"`
+	Rules []pageRuleMigration `json:"rules"`
+}
+
+// pageRuleMigration holds the suggested replacements for one page rule, and the actions that couldn't be translated,
+// with the reason why.
+type pageRuleMigration struct {
+	PageRuleID    string                `json:"page_rule_id"`
+	Priority      int                   `json:"priority"`
+	Status        string                `json:"status"`
+	Targets       string                `json:"targets"`
+	Suggestions   []migrationSuggestion `json:"suggestions,omitempty"`
+	NotTranslated []migrationGap        `json:"not_translated,omitempty"`
+}
+
+// migrationSuggestion is a rule that would do what some of a page rule's actions do, in the form that the Rulesets API
+// takes it, along with the phase of the ruleset that it goes in.
+type migrationSuggestion struct {
+	Kind             string                 `json:"kind"`
+	Phase            string                 `json:"phase"`
+	Description      string                 `json:"description"`
+	Expression       string                 `json:"expression"`
+	Action           string                 `json:"action"`
+	ActionParameters map[string]interface{} `json:"action_parameters"`
+	Enabled          bool                   `json:"enabled"`
+}
+
+// migrationGap is a part of a page rule that couldn't be translated. Action is empty if it's the whole rule.
+type migrationGap struct {
+	Action string `json:"action,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// the page rule actions that become a setting of a Config Rule, by the name of the setting
+var (
+	configOnOffActions = map[string]string{
+		"automatic_https_rewrites": "automatic_https_rewrites",
+		"browser_check":            "bic",
+		"email_obfuscation":        "email_obfuscation",
+		"hotlink_protection":       "hotlink_protection",
+		"mirage":                   "mirage",
+		"opportunistic_encryption": "opportunistic_encryption",
+		"rocket_loader":            "rocket_loader",
+		"server_side_exclude":      "server_side_excludes",
+	}
+	configValueActions = map[string]string{
+		"polish":         "polish",
+		"security_level": "security_level",
+		"ssl":            "ssl",
+	}
+)
+
+// cacheOnOffActions are the page rule actions that become a setting of a Cache Rule, by the path of the setting in its
+// action parameters.
+var cacheOnOffActions = map[string][]string{
+	"cache_by_device_type":        {"cache_key", "custom_key", "user", "device_type"},
+	"cache_deception_armor":       {"cache_key", "cache_deception_armor"},
+	"explicit_cache_control":      {"origin_cache_control"},
+	"origin_error_page_pass_thru": {"origin_error_page_passthru"},
+	"respect_strong_etag":         {"respect_strong_etags"},
+	"sort_query_string_for_cache": {"cache_key", "ignore_query_strings_order"},
+}
+
+// untranslatableActions are the page rule actions that have no equivalent that can be worked out from the page rule.
+var untranslatableActions = map[string]string{
+	"always_online":          "Always Online can only be turned on for the whole zone now.",
+	"bypass_cache_on_cookie": "This needs a Cache Rule that matches the cookie with http.request.cookies, which has to be written by hand.",
+	"cache_key_fields":       "Custom cache keys have to be set up by hand in a Cache Rule.",
+	"cache_on_cookie":        "This needs a Cache Rule that matches the cookie with http.request.cookies, which has to be written by hand.",
+	"disable_security":       "There's no single setting for this. Skip the security features that should be off with a WAF custom rule instead.",
+	"ip_geolocation":         "Use the \"Add visitor location headers\" Managed Transform instead.",
+	"minify":                 "Auto Minify has been retired, so there's nothing to move it to.",
+	"true_client_ip_header":  "Use the \"Add True-Client-IP header\" Managed Transform instead.",
+	"waf":                    "The old WAF has been replaced by the WAF managed rules, which are set up on their own.",
+}
+
+// redirectBackreference is a $1 in a forwarding URL, for the part of the URL that the first * matched.
+var redirectBackreference = regexp.MustCompile(`\$([0-9])`)
+
+// migratePageRules works out the suggested replacements for each of a zone's page rules. It's only advice: nothing is
+// sent to the API.
+func migratePageRules(zone cloudflare.Zone, pageRules []cloudflare.PageRule) pageRuleMigrations {
+	migrations := pageRuleMigrations{Zone: zone.Name, Note: migrationNote, Rules: []pageRuleMigration{}}
+	for _, pageRule := range pageRules {
+		migrations.Rules = append(migrations.Rules, migratePageRule(pageRule))
+	}
+	return migrations
+}
+
+func migratePageRule(pageRule cloudflare.PageRule) pageRuleMigration {
+	migration := pageRuleMigration{
+		PageRuleID: pageRule.ID,
+		Priority:   pageRule.Priority,
+		Status:     pageRule.Status,
+		Targets:    describePageRuleTargets(pageRule),
+	}
+	gap := func(action string, reason string) {
+		migration.NotTranslated = append(migration.NotTranslated, migrationGap{Action: action, Reason: reason})
+	}
+
+	expression, err := pageRuleExpression(pageRule)
+	if err != nil {
+		gap("", err.Error())
+		return migration
+	}
+	enabled := pageRule.Status == "active"
+	suggest := func(kind string, phase string, description string, expression string, action string, parameters map[string]interface{}) {
+		migration.Suggestions = append(migration.Suggestions, migrationSuggestion{
+			Kind:             kind,
+			Phase:            phase,
+			Description:      description,
+			Expression:       expression,
+			Action:           action,
+			ActionParameters: parameters,
+			Enabled:          enabled,
+		})
+	}
+
+	config := map[string]interface{}{}
+	cache := map[string]interface{}{}
+	origin := map[string]interface{}{}
+	for _, action := range pageRule.Actions {
+		value, isString := action.Value.(string)
+		on := value == "on"
+		onOff := isString && (value == "on" || value == "off")
+
+		switch {
+		case action.ID == "forwarding_url":
+			parameters, err := redirectParameters(pageRule, action)
+			if err != nil {
+				gap(action.ID, err.Error())
+				continue
+			}
+			suggest("single_redirect", redirectPhase, "Redirect of page rule "+pageRule.ID, expression, "redirect", parameters)
+		case action.ID == "always_use_https":
+			suggest("single_redirect", redirectPhase, "Always Use HTTPS of page rule "+pageRule.ID, "("+expression+") and not ssl", "redirect", map[string]interface{}{
+				"from_value": map[string]interface{}{
+					"status_code":           301,
+					"target_url":            map[string]interface{}{"expression": `concat("https://", http.host, http.request.uri.path)`},
+					"preserve_query_string": true,
+				},
+			})
+		case configOnOffActions[action.ID] != "" && onOff:
+			config[configOnOffActions[action.ID]] = on
+		case configValueActions[action.ID] != "" && isString:
+			config[configValueActions[action.ID]] = value
+		case action.ID == "disable_apps" || action.ID == "disable_zaraz":
+			config[action.ID] = true
+		case action.ID == "disable_performance":
+			config["mirage"] = false
+			config["rocket_loader"] = false
+			config["polish"] = "off"
+		case cacheOnOffActions[action.ID] != nil && onOff:
+			setNested(cache, cacheOnOffActions[action.ID], on)
+		case action.ID == "cache_level" && isString:
+			switch value {
+			case "bypass":
+				cache["cache"] = false
+			case "cache_everything":
+				cache["cache"] = true
+			case "basic", "simplified":
+				setNested(cache, []string{"cache_key", "custom_key", "query_string", "exclude", "all"}, true)
+			case "aggressive":
+				gap(action.ID, "Standard caching is what Cloudflare does anyway, so there's no need for a rule.")
+			default:
+				gap(action.ID, fmt.Sprintf("The cache level %q isn't known.", value))
+			}
+		case action.ID == "edge_cache_ttl" && isNumber(action.Value):
+			setNested(cache, []string{"edge_ttl", "mode"}, "override_origin")
+			setNested(cache, []string{"edge_ttl", "default"}, action.Value)
+		case action.ID == "browser_cache_ttl" && isNumber(action.Value):
+			if action.Value.(float64) == 0 {
+				cache["browser_ttl"] = map[string]interface{}{"mode": "respect_origin"}
+			} else {
+				cache["browser_ttl"] = map[string]interface{}{"mode": "override_origin", "default": action.Value}
+			}
+		case action.ID == "cache_ttl_by_status":
+			statusTTLs, err := statusCodeTTLs(action.Value)
+			if err != nil {
+				gap(action.ID, err.Error())
+				continue
+			}
+			if _, ok := nestedMap(cache, "edge_ttl")["mode"]; !ok {
+				setNested(cache, []string{"edge_ttl", "mode"}, "respect_origin")
+			}
+			setNested(cache, []string{"edge_ttl", "status_code_ttl"}, statusTTLs)
+		case action.ID == "host_header_override" && isString:
+			origin["host_header"] = value
+		case action.ID == "resolve_override" && isString:
+			origin["origin"] = map[string]interface{}{"host": value}
+		case untranslatableActions[action.ID] != "":
+			gap(action.ID, untranslatableActions[action.ID])
+		default:
+			gap(action.ID, "There's no automatic translation for this action, so it has to be moved by hand.")
+		}
+	}
+
+	if len(config) > 0 {
+		suggest("config_rule", configPhase, "Settings of page rule "+pageRule.ID, expression, "set_config", config)
+	}
+	if len(cache) > 0 {
+		suggest("cache_rule", cachePhase, "Caching of page rule "+pageRule.ID, expression, "set_cache_settings", cache)
+	}
+	if len(origin) > 0 {
+		suggest("origin_rule", originPhase, "Origin of page rule "+pageRule.ID, expression, "route", origin)
+	}
+	return migration
+}
+
+// pageRuleExpression turns the URL patterns of a page rule into a rule expression that matches the same requests.
+func pageRuleExpression(pageRule cloudflare.PageRule) (string, error) {
+	expressions := []string{}
+	for _, target := range pageRule.Targets {
+		if target.Target != "url" {
+			return "", fmt.Errorf("The page rule has a %q target, and only URL patterns can be translated.", target.Target)
+		}
+		expression, err := urlPatternExpression(target.Constraint.Value)
+		if err != nil {
+			return "", err
+		}
+		expressions = append(expressions, expression)
+	}
+	if len(expressions) == 0 {
+		return "", errors.New("The page rule doesn't have a URL pattern.")
+	}
+	if len(expressions) == 1 {
+		return expressions[0], nil
+	}
+	return "(" + strings.Join(expressions, ") or (") + ")", nil
+}
+
+// urlPatternExpression turns a page rule's URL pattern, like *example.com/images/*, into a rule expression. A pattern
+// without a path only matches the root, like in a page rule.
+func urlPatternExpression(pattern string) (string, error) {
+	if strings.Contains(pattern, "?") {
+		return "", fmt.Errorf("The URL pattern %s has a query string, which has to be matched with http.request.uri.query by hand.", pattern)
+	}
+
+	conditions := []string{}
+	rest := pattern
+	lower := strings.ToLower(rest)
+	switch {
+	case strings.HasPrefix(lower, "https://"):
+		conditions = append(conditions, "ssl")
+		rest = rest[len("https://"):]
+	case strings.HasPrefix(lower, "http://"):
+		conditions = append(conditions, "not ssl")
+		rest = rest[len("http://"):]
+	}
+
+	host, urlPath := rest, ""
+	if i := strings.Index(rest, "/"); i != -1 {
+		host, urlPath = rest[:i], rest[i:]
+	}
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		port, err := strconv.Atoi(host[i+1:])
+		if err != nil {
+			return "", fmt.Errorf("The URL pattern %s has a port that isn't a number.", pattern)
+		}
+		conditions = append(conditions, "cf.edge.server_port eq "+strconv.Itoa(port))
+		host = host[:i]
+	}
+
+	host = strings.ToLower(host)
+	if strings.Contains(host, "*") {
+		conditions = append(conditions, "http.host wildcard "+ruleString(host))
+	} else {
+		conditions = append(conditions, "http.host eq "+ruleString(host))
+	}
+
+	switch {
+	case urlPath == "" || urlPath == "/":
+		conditions = append(conditions, `http.request.uri.path eq "/"`)
+	case urlPath == "/*":
+		// every path matches
+	case strings.Contains(urlPath, "*"):
+		conditions = append(conditions, "http.request.uri.path wildcard "+ruleString(urlPath))
+	default:
+		conditions = append(conditions, "http.request.uri.path eq "+ruleString(urlPath))
+	}
+
+	return strings.Join(conditions, " and "), nil
+}
+
+// redirectParameters builds the action parameters of a Single Redirect from a forwarding_url action. A forwarding URL
+// that uses what the wildcards matched, like https://example.com/$1, becomes a wildcard_replace over the whole URL.
+func redirectParameters(pageRule cloudflare.PageRule, action cloudflare.PageRuleAction) (map[string]interface{}, error) {
+	value, ok := action.Value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("The forwarding URL isn't in the form that was expected.")
+	}
+	url, _ := value["url"].(string)
+	statusCode, _ := value["status_code"].(float64)
+	if url == "" {
+		return nil, errors.New("The forwarding URL is empty.")
+	}
+	if statusCode == 0 {
+		statusCode = 301
+	}
+
+	from := map[string]interface{}{"status_code": int(statusCode)}
+	if !redirectBackreference.MatchString(url) {
+		from["target_url"] = map[string]interface{}{"value": url}
+		from["preserve_query_string"] = true
+		return map[string]interface{}{"from_value": from}, nil
+	}
+
+	if len(pageRule.Targets) != 1 {
+		return nil, errors.New("The forwarding URL uses what the wildcards matched, and the page rule has more than one URL pattern.")
+	}
+	source := pageRule.Targets[0].Constraint.Value
+	offset := 0
+	lower := strings.ToLower(source)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		// the full URL has a scheme, and matching it takes a wildcard of its own
+		source = "http*://" + source
+		offset = 1
+	}
+	if !strings.Contains(strings.SplitN(source, "://", 2)[1], "/") {
+		source += "/"
+	}
+	target := redirectBackreference.ReplaceAllStringFunc(url, func(reference string) string {
+		n, _ := strconv.Atoi(reference[1:])
+		return "${" + strconv.Itoa(n+offset) + "}"
+	})
+
+	// what the last wildcard matched already has the query string in it, if it's at the end
+	from["target_url"] = map[string]interface{}{"expression": "wildcard_replace(http.request.full_uri, " + ruleString(source) + ", " + ruleString(target) + ")"}
+	from["preserve_query_string"] = false
+	return map[string]interface{}{"from_value": from}, nil
+}
+
+// statusCodeTTLs turns the value of a cache_ttl_by_status action, like {"200": 3600, "500-599": "no-store"}, into the
+// status_code_ttl list of a Cache Rule.
+func statusCodeTTLs(value interface{}) ([]interface{}, error) {
+	byStatus, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("The TTLs by status code aren't in the form that was expected.")
+	}
+
+	statuses := []string{}
+	for status := range byStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	ttls := []interface{}{}
+	for _, status := range statuses {
+		ttl := map[string]interface{}{}
+		switch value := byStatus[status].(type) {
+		case float64:
+			ttl["value"] = value
+		case string:
+			switch value {
+			case "no-cache":
+				ttl["value"] = 0
+			case "no-store":
+				ttl["value"] = -1
+			default:
+				return nil, fmt.Errorf("The TTL %q for status %s isn't known.", value, status)
+			}
+		default:
+			return nil, fmt.Errorf("The TTL for status %s isn't in the form that was expected.", status)
+		}
+
+		parts := strings.SplitN(status, "-", 2)
+		from, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("The status code %s isn't a number.", status)
+		}
+		if len(parts) == 1 {
+			ttl["status_code"] = from
+		} else {
+			to, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("The status code range %s isn't made of numbers.", status)
+			}
+			ttl["status_code_range"] = map[string]interface{}{"from": from, "to": to}
+		}
+		ttls = append(ttls, ttl)
+	}
+	return ttls, nil
+}
+
+// ruleString quotes a string for use in a rule expression.
+func ruleString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func isNumber(value interface{}) bool {
+	_, ok := value.(float64)
+	return ok
+}
+
+// nestedMap returns the object under the given key, creating it if needed.
+func nestedMap(parent map[string]interface{}, key string) map[string]interface{} {
+	child, ok := parent[key].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		parent[key] = child
+	}
+	return child
+}
+
+// setNested sets a value in nested objects, creating them as needed.
+func setNested(parent map[string]interface{}, keys []string, value interface{}) {
+	for _, key := range keys[:len(keys)-1] {
+		parent = nestedMap(parent, key)
+	}
+	parent[keys[len(keys)-1]] = value
+}
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// maxParseLineLength is the longest line that the parsers accept. It's far longer than any record that Cloudflare
+// allows, but it stops a damaged file from being read into memory as one enormous line.
+const maxParseLineLength = 1024 * 1024
+
+// parseError is a problem with a file that's being read back in, along with the line that it's on. Files that go
+// through the parsers might have been edited by hand, so they report what's wrong rather than trusting the input.
+type parseError struct {
+	Line int
+	Err  error
+}
+
+func newParseError(line int, format string, args ...interface{}) error {
+	return &parseError{Line: line, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *parseError) Error() string {
+	return "line " + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+}
+
+func (e *parseError) Unwrap() error {
+	return e.Err
+}
+
+// newLineScanner returns a scanner for the lines of a file, which fails on lines longer than maxParseLineLength.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxParseLineLength)
+	return scanner
+}
+
+// scanError describes an error from a line scanner, given the number of the last line that was read successfully.
+func scanError(err error, lineNumber int) error {
+	if err == bufio.ErrTooLong {
+		return newParseError(lineNumber+1, "the line is longer than %d bytes", maxParseLineLength)
+	}
+	return err
+}
+
+// checkFormatVersion returns an error if a file is in a later version of its format than this build can read, since
+// its layout might have changed in a way that would be misread. Files from before the formats had versions don't have
+// one, and are read as version 1, which has the same layout.
+func checkFormatVersion(format string, version int, supported int) error {
+	if version > supported {
+		return fmt.Errorf("the file is in version %d of the %s format, but only versions up to %d can be read, so it was probably written by a newer version of cloudflare-backup", version, format, supported)
+	}
+	return nil
+}
+
+// parseFormatVersion reads the version from the header line of a format that has one, and checks it.
+func parseFormatVersion(format string, value string, supported int) error {
+	version, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || version < 1 {
+		return fmt.Errorf("invalid format version %q", value)
+	}
+	return checkFormatVersion(format, version, supported)
+}
+
+// parseTextRecords reads the DNS records back out of a file in the text format. Comment lines, which hold the header
+// and every other section, are skipped, but the header has to be there, so that other files aren't mistaken for
+// backups.
+func parseTextRecords(r io.Reader) ([]cloudflare.DNSRecord, error) {
+	records := []cloudflare.DNSRecord{}
+	hasHeader := false
+	hasFlags := false
+
+	scanner := newLineScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.ContainsRune(line, 0) {
+			return nil, newParseError(lineNumber, "the line contains a NUL byte")
+		}
+		if strings.HasPrefix(line, textZonePrefix) {
+			hasHeader = true
+		}
+		if strings.HasPrefix(line, textFormatVersionPrefix) {
+			err := parseFormatVersion("text", strings.TrimPrefix(line, textFormatVersionPrefix), textFormatVersion)
+			if err != nil {
+				return nil, &parseError{Line: lineNumber, Err: err}
+			}
+			continue
+		}
+		if line == textRecordHeader || line == textRecordFlagsHeader {
+			// backups made with -text-record-flags have two more columns
+			hasFlags = line == textRecordFlagsHeader
+		}
+		if strings.HasPrefix(line, "# "+managedByPrefix) && len(records) > 0 {
+			// the tag is on the line after the record that it's for
+			records[len(records)-1].ManagedBy = strings.TrimPrefix(line, "# "+managedByPrefix)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !hasHeader {
+			return nil, newParseError(lineNumber, "found a record before the backup's header")
+		}
+
+		// the value is last, so it's allowed to contain the separator
+		columns := 5
+		if hasFlags {
+			columns = 7
+		}
+		fields := strings.SplitN(line, textSeparator, columns)
+		if len(fields) != columns {
+			return nil, newParseError(lineNumber, "expected %d columns, found %d", columns, len(fields))
+		}
+		if fields[0] == "" || fields[2] == "" {
+			return nil, newParseError(lineNumber, "the record doesn't have a name and type")
+		}
+
+		ttl, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, newParseError(lineNumber, "invalid TTL %q", fields[1])
+		}
+
+		record := cloudflare.DNSRecord{
+			Name:    fields[0],
+			TTL:     ttl,
+			Type:    fields[2],
+			Content: fields[columns-1],
+		}
+		switch fields[3] {
+		case textProxied:
+			record.Proxied = true
+		case textNotProxied:
+		default:
+			return nil, newParseError(lineNumber, "invalid proxy status %q", fields[3])
+		}
+		if hasFlags {
+			switch fields[4] {
+			case textProxiable:
+				record.Proxiable = true
+			case textNotProxiable:
+			default:
+				return nil, newParseError(lineNumber, "invalid proxiable status %q", fields[4])
+			}
+			switch fields[5] {
+			case textLocked:
+				record.Locked = true
+			case textUnlocked:
+			default:
+				return nil, newParseError(lineNumber, "invalid locked status %q", fields[5])
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, scanError(err, lineNumber)
+	}
+	if !hasHeader {
+		return nil, newParseError(1, "the file doesn't have a backup header")
+	}
+
+	return records, nil
+}
+
+// parseJSONRecords reads the DNS records back out of a file in the json format.
+func parseJSONRecords(r io.Reader) ([]cloudflare.DNSRecord, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	document := struct {
+		FormatVersion int `json:"format_version"`
+		Sections      struct {
+			DNS []cloudflare.DNSRecord `json:"dns"`
+		} `json:"sections"`
+	}{}
+
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return nil, jsonParseError(data, err)
+	}
+	err = checkFormatVersion("json", document.FormatVersion, jsonFormatVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if document.Sections.DNS == nil {
+		return []cloudflare.DNSRecord{}, nil
+	}
+	return document.Sections.DNS, nil
+}
+
+// jsonParseError adds the line that a JSON decoding error is on. The decoder only gives the offset of the problem,
+// which isn't much use in a file that's been edited by hand.
+func jsonParseError(data []byte, err error) error {
+	offset := int64(-1)
+	syntaxError := &json.SyntaxError{}
+	typeError := &json.UnmarshalTypeError{}
+	if errors.As(err, &syntaxError) {
+		offset = syntaxError.Offset
+	} else if errors.As(err, &typeError) {
+		offset = typeError.Offset
+	}
+	if offset >= 0 && offset <= int64(len(data)) {
+		return &parseError{Line: bytes.Count(data[:offset], []byte("\n")) + 1, Err: err}
+	}
+	return err
+}
+
+// parseAPIJSONRecords reads the DNS records back out of a file in the api-json format. They don't have IDs, since the
+// format leaves them out.
+func parseAPIJSONRecords(r io.Reader) ([]cloudflare.DNSRecord, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bodies := []apiRecordBody{}
+	err = json.Unmarshal(data, &bodies)
+	if err != nil {
+		return nil, jsonParseError(data, err)
+	}
+
+	records := []cloudflare.DNSRecord{}
+	for _, body := range bodies {
+		record := recordFromBody(body.DNSRecordBody)
+		record.ManagedBy = body.ManagedBy
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// parseAPINDJSONRecords reads the DNS records back out of a file in the api-ndjson format, one line at a time.
+func parseAPINDJSONRecords(r io.Reader) ([]cloudflare.DNSRecord, error) {
+	records := []cloudflare.DNSRecord{}
+
+	scanner := newLineScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		body := apiRecordBody{}
+		err := json.Unmarshal([]byte(line), &body)
+		if err != nil {
+			return nil, &parseError{Line: lineNumber, Err: err}
+		}
+		record := recordFromBody(body.DNSRecordBody)
+		record.ManagedBy = body.ManagedBy
+		records = append(records, record)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, scanError(err, lineNumber)
+	}
+
+	return records, nil
+}
+
+// parseNDJSONRecords reads the DNS records back out of a file in the ndjson format, skipping the lines that hold
+// anything else. With -single-file, the file holds every zone, so the records of all of them are returned.
+func parseNDJSONRecords(r io.Reader) ([]cloudflare.DNSRecord, error) {
+	records := []cloudflare.DNSRecord{}
+	hasZone := false
+
+	scanner := newLineScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		parsed := struct {
+			Resource      string          `json:"resource"`
+			FormatVersion int             `json:"format_version"`
+			Data          json.RawMessage `json:"data"`
+		}{}
+		err := json.Unmarshal([]byte(line), &parsed)
+		if err != nil {
+			return nil, &parseError{Line: lineNumber, Err: err}
+		}
+		if parsed.Resource == ndjsonZoneResource {
+			hasZone = true
+			err = checkFormatVersion("ndjson", parsed.FormatVersion, ndjsonFormatVersion)
+			if err != nil {
+				return nil, &parseError{Line: lineNumber, Err: err}
+			}
+		}
+		if parsed.Resource != "dns" {
+			continue
+		}
+
+		record := cloudflare.DNSRecord{}
+		err = json.Unmarshal(parsed.Data, &record)
+		if err != nil {
+			return nil, &parseError{Line: lineNumber, Err: err}
+		}
+		records = append(records, record)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, scanError(err, lineNumber)
+	}
+	if !hasZone {
+		return nil, errors.New("this doesn't look like a backup in the ndjson format, since it has no zone line")
+	}
+
+	return records, nil
+}
+
+// recordFromBody turns a record's request body back into a record, without the fields that the API sets.
+func recordFromBody(body cloudflare.DNSRecordBody) cloudflare.DNSRecord {
+	return cloudflare.DNSRecord{
+		Type:     body.Type,
+		Name:     body.Name,
+		Content:  body.Content,
+		Proxied:  body.Proxied,
+		TTL:      body.TTL,
+		Priority: body.Priority,
+		Data:     body.Data,
+		Comment:  body.Comment,
+		Tags:     body.Tags,
+	}
+}
+
+// dnscontrolCall is a function call read from a dnscontrol file, like A("www", "192.0.2.1", TTL(300)).
+type dnscontrolCall struct {
+	Name string
+	Args []dnscontrolArg
+}
+
+// dnscontrolArg is an argument of a call. Exactly one of its fields is set, unless it's a bare name like CF_PROXY_ON,
+// which is kept in Text with Quoted unset.
+type dnscontrolArg struct {
+	Text   string
+	Quoted bool
+	List   []string
+	Call   *dnscontrolCall
+}
+
+// parseDNSControlRecords reads the DNS records back out of a file in the dnscontrol format. Only the lines that the
+// dnscontrol writer produces are understood: the D() line, one record call per line, and commented-out records with
+// their API request bodies. Everything that dnscontrol doesn't keep, like record IDs, is left empty, and SRV and CAA
+// records get their content in the form that Cloudflare uses.
+func parseDNSControlRecords(r io.Reader) ([]cloudflare.DNSRecord, error) {
+	records := []cloudflare.DNSRecord{}
+	zone := ""
+	defaultTTL := uint64(300)
+
+	scanner := newLineScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, dnscontrolFormatVersionPrefix) {
+			err := parseFormatVersion("dnscontrol", strings.TrimPrefix(line, dnscontrolFormatVersionPrefix), dnscontrolFormatVersion)
+			if err != nil {
+				return nil, &parseError{Line: lineNumber, Err: err}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "//") {
+			marker := strings.Index(line, dnscontrolBodyMarker)
+			if marker == -1 {
+				continue
+			}
+			body := cloudflare.DNSRecordBody{}
+			err := json.Unmarshal([]byte(line[marker+len(dnscontrolBodyMarker):]), &body)
+			if err != nil {
+				return nil, &parseError{Line: lineNumber, Err: err}
+			}
+			record := recordFromBody(body)
+			if strings.HasPrefix(line, "// "+managedByPrefix) {
+				record.ManagedBy = strings.TrimPrefix(line[:marker], "// "+managedByPrefix)
+			}
+			records = append(records, record)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "var ") || line == "END);" {
+			continue
+		}
+
+		call, err := parseDNSControlCall(strings.TrimSuffix(line, ","))
+		if strings.HasPrefix(line, "D(") {
+			// the D() call isn't closed until the end of the file
+			call, err = parseDNSControlCall(strings.TrimSuffix(line, ",") + ")")
+		}
+		if err != nil {
+			return nil, newParseError(lineNumber, "%s", err)
+		}
+
+		if call.Name == "D" {
+			if len(call.Args) == 0 || !call.Args[0].Quoted {
+				return nil, newParseError(lineNumber, "the D() call doesn't start with the zone's name")
+			}
+			zone = normalizeName(call.Args[0].Text)
+			for _, arg := range call.Args[1:] {
+				if arg.Call != nil && arg.Call.Name == "DefaultTTL" {
+					defaultTTL, err = dnscontrolTTL(*arg.Call)
+					if err != nil {
+						return nil, newParseError(lineNumber, "%s", err)
+					}
+				}
+			}
+			continue
+		}
+		if zone == "" {
+			return nil, newParseError(lineNumber, "found a record before the D() call")
+		}
+
+		record, err := dnscontrolRecord(call, zone, defaultTTL)
+		if err != nil {
+			return nil, newParseError(lineNumber, "%s record: %s", call.Name, err)
+		}
+		records = append(records, record)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, scanError(err, lineNumber)
+	}
+	if zone == "" {
+		return nil, newParseError(1, "the file doesn't have a D() call")
+	}
+
+	return records, nil
+}
+
+// dnscontrolRecord turns a record helper call back into a record.
+func dnscontrolRecord(call dnscontrolCall, zone string, defaultTTL uint64) (cloudflare.DNSRecord, error) {
+	record := cloudflare.DNSRecord{Type: call.Name, TTL: defaultTTL}
+
+	// the positional arguments come first, then the modifiers
+	values := []dnscontrolArg{}
+	for _, arg := range call.Args {
+		if arg.Call != nil {
+			if arg.Call.Name != "TTL" {
+				return record, fmt.Errorf("unknown modifier %s()", arg.Call.Name)
+			}
+			ttl, err := dnscontrolTTL(*arg.Call)
+			if err != nil {
+				return record, err
+			}
+			record.TTL = ttl
+			continue
+		}
+		if !arg.Quoted && arg.List == nil && !isDigits(arg.Text) {
+			switch arg.Text {
+			case "CF_PROXY_ON":
+				record.Proxied = true
+				record.Proxiable = true
+			case "CF_PROXY_OFF":
+				record.Proxiable = true
+			case "CAA_CRITICAL":
+			default:
+				return record, fmt.Errorf("unknown modifier %s", arg.Text)
+			}
+			continue
+		}
+		values = append(values, arg)
+	}
+
+	counts := map[string]int{"A": 2, "AAAA": 2, "CNAME": 2, "MX": 3, "TXT": 2, "SRV": 5, "CAA": 3}
+	count, ok := counts[call.Name]
+	if !ok {
+		return record, errors.New("the record type isn't supported")
+	}
+	if len(values) != count {
+		return record, fmt.Errorf("expected %d argument(s), found %d", count, len(values))
+	}
+	numbers := []uint16{}
+	for _, value := range values {
+		if !value.Quoted && value.List == nil {
+			number, err := strconv.ParseUint(value.Text, 10, 16)
+			if err != nil {
+				return record, fmt.Errorf("invalid number %q", value.Text)
+			}
+			numbers = append(numbers, uint16(number))
+		}
+	}
+
+	record.Name = absoluteBINDName(values[0].Text, zone)
+	target := values[len(values)-1].Text
+	if target != "." {
+		target = strings.TrimSuffix(target, ".")
+	}
+
+	switch call.Name {
+	case "A", "AAAA", "CNAME":
+		record.Content = target
+
+	case "MX":
+		if len(numbers) != 1 {
+			return record, errors.New("expected a priority")
+		}
+		record.Priority = &numbers[0]
+		record.Content = target
+
+	case "TXT":
+		if values[1].List == nil {
+			record.Content = values[1].Text
+			break
+		}
+		parts := []string{}
+		for _, part := range values[1].List {
+			parts = append(parts, strconv.Quote(part))
+		}
+		record.Content = strings.Join(parts, " ")
+
+	case "SRV":
+		if len(numbers) != 3 {
+			return record, errors.New("expected a priority, weight, and port")
+		}
+		record.Priority = &numbers[0]
+		record.Content = strconv.Itoa(int(numbers[1])) + " " + strconv.Itoa(int(numbers[2])) + " " + target
+		record.Data, _ = json.Marshal(srvFields{numbers[0], numbers[1], numbers[2], target})
+
+	case "CAA":
+		flags := uint8(0)
+		for _, arg := range call.Args {
+			if !arg.Quoted && arg.Text == "CAA_CRITICAL" {
+				flags = 128
+			}
+		}
+		record.Content = strconv.Itoa(int(flags)) + " " + values[1].Text + " " + strconv.Quote(values[2].Text)
+		record.Data, _ = json.Marshal(caaFields{flags, values[1].Text, values[2].Text})
+	}
+
+	return record, nil
+}
+
+// dnscontrolTTL reads the number from a TTL() or DefaultTTL() call.
+func dnscontrolTTL(call dnscontrolCall) (uint64, error) {
+	if len(call.Args) != 1 {
+		return 0, fmt.Errorf("%s() needs a single TTL", call.Name)
+	}
+	ttl, ok := parseBINDTTL(call.Args[0].Text)
+	if !ok {
+		return 0, fmt.Errorf("invalid TTL %q", call.Args[0].Text)
+	}
+	return ttl, nil
+}
+
+// parseDNSControlCall parses a single call, which has to take up the whole of the text.
+func parseDNSControlCall(text string) (dnscontrolCall, error) {
+	call, end, err := readDNSControlCall(text, 0)
+	if err != nil {
+		return dnscontrolCall{}, err
+	}
+	if strings.TrimSpace(text[end:]) != "" {
+		return dnscontrolCall{}, fmt.Errorf("unexpected %q after the call", strings.TrimSpace(text[end:]))
+	}
+	return call, nil
+}
+
+// readDNSControlCall reads the call starting at text[start], and returns it along with the index just past its closing
+// parenthesis.
+func readDNSControlCall(text string, start int) (dnscontrolCall, int, error) {
+	name, i := readDNSControlName(text, start)
+	if name == "" || i >= len(text) || text[i] != '(' {
+		return dnscontrolCall{}, 0, errors.New("expected a function call")
+	}
+	call := dnscontrolCall{Name: name, Args: []dnscontrolArg{}}
+	i++
+
+	for {
+		i = skipDNSControlSpaces(text, i)
+		if i >= len(text) {
+			return dnscontrolCall{}, 0, errors.New("the ( is never closed")
+		}
+		if text[i] == ')' {
+			return call, i + 1, nil
+		}
+		if len(call.Args) > 0 {
+			if text[i] != ',' {
+				return dnscontrolCall{}, 0, fmt.Errorf("expected a comma, found %q", text[i:i+1])
+			}
+			i = skipDNSControlSpaces(text, i+1)
+		}
+
+		arg := dnscontrolArg{}
+		switch {
+		case i < len(text) && text[i] == '"':
+			value, end, err := readDNSControlString(text, i)
+			if err != nil {
+				return dnscontrolCall{}, 0, err
+			}
+			arg = dnscontrolArg{Text: value, Quoted: true}
+			i = end
+
+		case i < len(text) && text[i] == '[':
+			arg.List = []string{}
+			i++
+			for {
+				i = skipDNSControlSpaces(text, i)
+				if i < len(text) && text[i] == ']' {
+					i++
+					break
+				}
+				if len(arg.List) > 0 {
+					if i >= len(text) || text[i] != ',' {
+						return dnscontrolCall{}, 0, errors.New("expected a comma or ] in the list")
+					}
+					i = skipDNSControlSpaces(text, i+1)
+				}
+				value, end, err := readDNSControlString(text, i)
+				if err != nil {
+					return dnscontrolCall{}, 0, err
+				}
+				arg.List = append(arg.List, value)
+				i = end
+			}
+
+		default:
+			word, end := readDNSControlName(text, i)
+			if word == "" {
+				return dnscontrolCall{}, 0, errors.New("expected an argument")
+			}
+			arg.Text = word
+			i = end
+			if i < len(text) && text[i] == '(' {
+				nested, end, err := readDNSControlCall(text, i-len(word))
+				if err != nil {
+					return dnscontrolCall{}, 0, err
+				}
+				arg = dnscontrolArg{Call: &nested}
+				i = end
+			}
+		}
+		call.Args = append(call.Args, arg)
+	}
+}
+
+// readDNSControlName reads a name or number starting at text[start].
+func readDNSControlName(text string, start int) (string, int) {
+	i := start
+	for i < len(text) && (text[i] == '_' || (text[i] >= '0' && text[i] <= '9') || (text[i]|0x20 >= 'a' && text[i]|0x20 <= 'z')) {
+		i++
+	}
+	return text[start:i], i
+}
+
+// readDNSControlString reads the quoted string starting at text[start], which is written as a JSON string.
+func readDNSControlString(text string, start int) (string, int, error) {
+	if start >= len(text) || text[start] != '"' {
+		return "", 0, errors.New("expected a string")
+	}
+	for i := start + 1; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+		if text[i] == '"' {
+			value := ""
+			err := json.Unmarshal([]byte(text[start:i+1]), &value)
+			return value, i + 1, err
+		}
+	}
+	return "", 0, errors.New("the quoted string is never closed")
+}
+
+func skipDNSControlSpaces(text string, i int) int {
+	for i < len(text) && (text[i] == ' ' || text[i] == '\t') {
+		i++
+	}
+	return i
+}
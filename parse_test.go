@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// addGoldenSeeds adds the golden files that match pattern to the fuzzer's seed corpus.
+func addGoldenSeeds(f *testing.F, pattern string) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", pattern))
+	if err != nil {
+		f.Fatal(err)
+	}
+	if len(paths) == 0 {
+		f.Fatalf("no golden files match %s", pattern)
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(data))
+	}
+}
+
+// checkParseError fails the test unless err is a parseError on one of the input's lines, or just after the last one.
+func checkParseError(t *testing.T, input string, err error) {
+	t.Helper()
+
+	parseErr := &parseError{}
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("got error %v, want one with a line number", err)
+	}
+	if lines := strings.Count(input, "\n") + 1; parseErr.Line < 1 || parseErr.Line > lines+1 {
+		t.Fatalf("got an error on line %d, but the input has %d line(s): %v", parseErr.Line, lines, err)
+	}
+}
+
+func FuzzParseTextRecords(f *testing.F) {
+	addGoldenSeeds(f, "*/*.txt")
+	f.Add("# DNS zone backup for example.com\nexample.com\t\t1\t\tA\t\tPROXY\t\t192.0.2.1\n")
+	f.Add("example.com\t\t1\t\tA\t\tPROXY\t\t192.0.2.1\n")
+	f.Add("# DNS zone backup for example.com\n# Format version: 99\n")
+	f.Add("# DNS zone backup for example.com\nexample.com\t\t1\t\tTXT\t\tNO_PROXY\t\ta\x00b\n")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		records, err := parseTextRecords(strings.NewReader(input))
+		if err != nil {
+			checkParseError(t, input, err)
+			return
+		}
+		if len(records) > strings.Count(input, "\n")+1 {
+			t.Fatalf("got %d records from %d line(s)", len(records), strings.Count(input, "\n")+1)
+		}
+		for _, record := range records {
+			if record.Name == "" || record.Type == "" {
+				t.Fatalf("got a record without a name or type: %+v", record)
+			}
+		}
+	})
+}
+
+func TestParseTextRecordsErrors(t *testing.T) {
+	header := "# DNS zone backup for example.com\r\n# Name\t\tTTL\t\tType\t\tProxied\t\tValue\r\n"
+	for _, test := range []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"no header", "example.com\t\t1\t\tA\t\tPROXY\t\t192.0.2.1\r\n", "line 1: found a record before the backup's header"},
+		{"empty", "", "line 1: the file doesn't have a backup header"},
+		{"NUL", header + "example.com\t\t1\t\tTXT\t\tNO_PROXY\t\ta\x00b\r\n", "line 3: the line contains a NUL byte"},
+		{"columns", header + "example.com\t\t1\t\tA\r\n", "line 3: expected 5 columns, found 3"},
+		{"TTL", header + "example.com\t\tsoon\t\tA\t\tPROXY\t\t192.0.2.1\r\n", `line 3: invalid TTL "soon"`},
+		{"proxy status", header + "example.com\t\t1\t\tA\t\tMAYBE\t\t192.0.2.1\r\n", `line 3: invalid proxy status "MAYBE"`},
+		{"version", "# DNS zone backup for example.com\r\n# Format version: 99\r\n", "line 2: the file is in version 99 of the text format"},
+		{"long line", header + strings.Repeat("a", maxParseLineLength+1) + "\r\n", "line 3: the line is longer than"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseTextRecords(strings.NewReader(test.input))
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Fatalf("got error %v, want %s", err, test.want)
+			}
+			checkParseError(t, test.input, err)
+		})
+	}
+}
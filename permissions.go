@@ -0,0 +1,80 @@
+package main
+
+// tokenPermission is a permission that an API token can be given. Label is how the dashboard shows it, and Group is
+// the name of its permission group in the API, which is what the token-scopes subcommand asks for with -create.
+// Account is set for permissions that apply to accounts, rather than zones.
+type tokenPermission struct {
+	Label   string
+	Group   string
+	Account bool
+}
+
+// the permissions that the collectors need, so that each one is only spelled out once
+var (
+	permissionZone             = tokenPermission{"Zone / Zone / Read", "Zone Read", false}
+	permissionDNS              = tokenPermission{"Zone / DNS / Read", "DNS Read", false}
+	permissionEmailRouting     = tokenPermission{"Zone / Email Routing Rules / Read", "Email Routing Rules Read", false}
+	permissionPageRules        = tokenPermission{"Zone / Page Rules / Read", "Page Rules Read", false}
+	permissionZoneSettings     = tokenPermission{"Zone / Zone Settings / Read", "Zone Settings Read", false}
+	permissionTransformRules   = tokenPermission{"Zone / Transform Rules / Read", "Transform Rules Read", false}
+	permissionZoneWAF          = tokenPermission{"Zone / Zone WAF / Read", "Zone WAF Read", false}
+	permissionOriginRules      = tokenPermission{"Zone / Origin Rules / Read", "Origin Read", false}
+	permissionSSL              = tokenPermission{"Zone / SSL and Certificates / Read", "SSL and Certificates Read", false}
+	permissionBotManagement    = tokenPermission{"Zone / Bot Management / Read", "Bot Management Read", false}
+	permissionWeb3             = tokenPermission{"Zone / Web3 Hostnames / Read", "Web3 Hostnames Read", false}
+	permissionSnippets         = tokenPermission{"Zone / Snippets / Read", "Snippets Read", false}
+	permissionZaraz            = tokenPermission{"Zone / Zaraz / Read", "Zaraz Read", false}
+	permissionAPIGateway       = tokenPermission{"Zone / API Gateway / Read", "API Gateway Read", false}
+	permissionCacheSettings    = tokenPermission{"Zone / Cache Settings / Read", "Cache Settings Read", false}
+	permissionArgo             = tokenPermission{"Zone / Argo / Read", "Argo Smart Routing Read", false}
+	permissionAccountSettings  = tokenPermission{"Account / Account Settings / Read", "Account Settings Read", true}
+	permissionPages            = tokenPermission{"Account / Cloudflare Pages / Read", "Pages Read", true}
+	permissionWorkersScripts   = tokenPermission{"Account / Workers Scripts / Read", "Workers Scripts Read", true}
+	permissionR2               = tokenPermission{"Account / Workers R2 Storage / Read", "Workers R2 Storage Read", true}
+	permissionD1               = tokenPermission{"Account / D1 / Read", "D1 Read", true}
+	permissionRegistrarDomains = tokenPermission{"Account / Registrar Domains / Read", "Registrar Domains Read", true}
+)
+
+// basePermissions are needed by every backup, whichever resources are selected, along with what they're needed for.
+// The development mode is left out of the backup if it can't be read, rather than failing it.
+var basePermissions = []struct {
+	Permission tokenPermission
+	Reason     string
+}{
+	{permissionZone, "every backup, to list the zones and read their holds"},
+	{permissionZoneSettings, "every backup, to read each zone's development mode"},
+}
+
+// neededPermissions returns the permissions that a backup of the given collectors needs, in the order that they're
+// first needed, along with the names of the resources that need each one.
+func neededPermissions(selected []Collector, selectedAccount []AccountCollector) ([]tokenPermission, map[tokenPermission][]string) {
+	permissions := []tokenPermission{}
+	for _, base := range basePermissions {
+		permissions = append(permissions, base.Permission)
+	}
+	users := map[tokenPermission][]string{}
+	add := func(name string, needed []tokenPermission) {
+		for _, permission := range needed {
+			if !containsPermission(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+			users[permission] = append(users[permission], name)
+		}
+	}
+	for _, collector := range selected {
+		add(collector.Name(), collector.Permissions())
+	}
+	for _, collector := range selectedAccount {
+		add(collector.Name(), collector.Permissions())
+	}
+	return permissions, users
+}
+
+func containsPermission(permissions []tokenPermission, permission tokenPermission) bool {
+	for _, existing := range permissions {
+		if existing == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// plan checks the token and lists what a backup would do, without fetching any of the zones' resources or writing
+// anything. It returns an error if the backup couldn't succeed.
+func (b *backupRun) plan(ctx context.Context) error {
+	problems := []string{}
+
+	if b.client.APIKey != "" {
+		// global API keys don't have a status of their own, so listing the zones is what checks them
+		log.Printf("Using a global API key, which can't be verified on its own.")
+	} else {
+		status, err := b.client.VerifyToken(ctx)
+		if err != nil {
+			return fmt.Errorf("Couldn't verify the API token: %w", err)
+		}
+		if status.Status != "active" {
+			return fmt.Errorf("The API token's status is %q, not active.", status.Status)
+		}
+		log.Printf("The API token is active.")
+	}
+
+	_, zones, err := b.listZones(ctx)
+	if err != nil {
+		return fmt.Errorf("Couldn't list zones: %w", err)
+	}
+	zones = b.limitZones(zones)
+
+	log.Printf("Would back up %d zone(s):", len(zones))
+	totalRequests := 0
+	for _, zone := range zones {
+		names := []string{}
+		for _, collector := range b.collectors {
+			names = append(names, collector.Name())
+
+			missing := missingPermission(collector, zone)
+			if missing != "" {
+				problems = append(problems, fmt.Sprintf("%s: the token doesn't have the %s permission needed by %s", zone.Name, missing, collector.Name()))
+			}
+		}
+
+		// each collector makes at least one request, and more for resources with several pages, and there's one more
+		// for the zone's hold
+		totalRequests += len(b.collectors) + 1
+		log.Printf("  %s: %s (at least %d API requests)", zone.Name, strings.Join(names, ", "), len(b.collectors)+1)
+	}
+	if len(b.options.zonesFromNames) > 0 {
+		log.Printf("That's at least %d API requests in total, plus %d to look up the zones.", totalRequests, len(b.options.zonesFromNames))
+	} else if len(b.options.ZoneIDs) > 0 || len(b.options.ZoneNames) > 0 {
+		log.Printf("That's at least %d API requests in total, plus %d to look up the zones.", totalRequests, len(zones))
+	} else {
+		log.Printf("That's at least %d API requests in total, plus %d to list zones.", totalRequests, len(zones)/50+1)
+	}
+
+	if len(b.accountCollectors) > 0 {
+		accounts, err := b.listAccounts(ctx)
+		if err != nil {
+			return fmt.Errorf("Couldn't list accounts: %w", err)
+		}
+
+		names := []string{}
+		for _, collector := range b.accountCollectors {
+			names = append(names, collector.Name())
+		}
+		log.Printf("Would back up %s from %d account(s), with at least %d API requests.", strings.Join(names, ", "), len(accounts), len(accounts)*len(names))
+	}
+
+	err = checkOutputDirWritable(b.options.OutputDir)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		log.Printf("The output directory %s is writable.", b.options.OutputDir)
+	}
+
+	if len(problems) > 0 {
+		log.Println("Problems:")
+		for _, problem := range problems {
+			log.Printf("  %s", problem)
+		}
+		return fmt.Errorf("The backup would fail, because of %d problem(s).", len(problems))
+	}
+
+	return nil
+}
+
+// missingPermission returns the permission that the collector needs but the token doesn't have in the zone, if the
+// zone listing told us what the token has.
+func missingPermission(collector Collector, zone cloudflare.Zone) string {
+	permissionCollector, ok := collector.(permissionCollector)
+	if !ok || len(zone.Permissions) == 0 {
+		return ""
+	}
+
+	required := permissionCollector.RequiredPermission()
+	for _, permission := range zone.Permissions {
+		if permission == required || permission == strings.TrimSuffix(required, ":read")+":edit" {
+			return ""
+		}
+	}
+	return required
+}
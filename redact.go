@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// redactedPrefix starts every value that was removed from the backup. It's followed by the start of the value's
+// SHA-256 hash, so that a change to a secret still shows up as a change in the backup.
+const redactedPrefix = "REDACTED:"
+
+// redactedHashLength is how many hex digits of the hash are kept.
+const redactedHashLength = 12
+
+// credentialPattern matches the names of keys that usually hold credentials.
+var credentialPattern = regexp.MustCompile(`(?i)key|token|secret|password`)
+
+// redactionRule picks out values in a section that are secrets.
+type redactionRule struct {
+	// Path is a dot-separated path to the values to redact, from the root of the section's data. In the path, "*"
+	// matches any key or array index, and "**" matches any number of them. An empty path matches every value.
+	Path string
+
+	// Keys, if set, only matches values under Path whose key matches it, at any depth.
+	Keys *regexp.Regexp
+
+	// When, if set, only matches values whose parent object has a field with the given value, written "field=value".
+	When string
+}
+
+// redactSecrets redacts the secrets in a section, if its collector has any and -include-secrets isn't set. The
+// collector can be a zone or account collector.
+func (b *backupRun) redactSecrets(collector interface{}, section Section) (Section, error) {
+	secrets, ok := collector.(secretCollector)
+	if !ok || b.options.IncludeSecrets {
+		return section, nil
+	}
+	return redactSection(section, secrets.SecretRules())
+}
+
+// redactSection replaces the secrets picked out by the rules in the section's data and in its JSON files.
+func redactSection(section Section, rules []redactionRule) (Section, error) {
+	data, err := json.Marshal(section.Data)
+	if err != nil {
+		return Section{}, err
+	}
+	data, err = redactJSON(data, rules)
+	if err != nil {
+		return Section{}, err
+	}
+	section.Data = json.RawMessage(data)
+
+	for name, file := range section.Files {
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		file, err = redactJSON(file, rules)
+		if err != nil {
+			return Section{}, err
+		}
+
+		// keep the file formatted the same way as before
+		indented := bytes.Buffer{}
+		err = json.Indent(&indented, file, "", "\t")
+		if err != nil {
+			return Section{}, err
+		}
+		section.Files[name] = append(indented.Bytes(), '\n')
+	}
+
+	return section, nil
+}
+
+// redactJSON applies the rules to a JSON document.
+func redactJSON(data []byte, rules []redactionRule) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	err := decoder.Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		path := []string{}
+		if rule.Path != "" {
+			path = strings.Split(rule.Path, ".")
+		}
+		if rule.Keys != nil || rule.Path == "" {
+			path = append(path, "**", "*")
+		}
+		document = redactPath(document, nil, "", path, rule)
+	}
+
+	return json.Marshal(document)
+}
+
+// redactPath walks down the path from a value, redacting whatever the path ends at. It returns the new value. parent
+// and key are where the value was found, for checking the rule's Keys and When.
+func redactPath(value interface{}, parent map[string]interface{}, key string, path []string, rule redactionRule) interface{} {
+	if len(path) == 0 {
+		if value == nil || !redactionApplies(parent, rule.When) {
+			return value
+		}
+		if rule.Keys != nil {
+			// key names are only a guess, so only plain values are redacted by them, not whole objects
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				return value
+			}
+			if !rule.Keys.MatchString(key) {
+				return value
+			}
+		}
+		return redactValue(value)
+	}
+
+	if path[0] == "**" {
+		// either "**" matches nothing here, or it matches this level and keeps going
+		value = redactPath(value, parent, key, path[1:], rule)
+		return redactChildren(value, func(child interface{}, object map[string]interface{}, childKey string) interface{} {
+			return redactPath(child, object, childKey, path, rule)
+		})
+	}
+
+	return redactChildren(value, func(child interface{}, object map[string]interface{}, childKey string) interface{} {
+		if path[0] != "*" && path[0] != childKey {
+			return child
+		}
+		return redactPath(child, object, childKey, path[1:], rule)
+	})
+}
+
+// redactChildren replaces each child of an object or array with the result of the given function. Array elements are
+// given their index as their key, and a nil parent.
+func redactChildren(value interface{}, redact func(child interface{}, object map[string]interface{}, key string) interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			value[key] = redact(child, value, key)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = redact(child, nil, strconv.Itoa(i))
+		}
+	}
+	return value
+}
+
+// redactionApplies checks a rule's When condition against the object that holds the value.
+func redactionApplies(parent map[string]interface{}, when string) bool {
+	if when == "" {
+		return true
+	}
+	if parent == nil {
+		return false
+	}
+
+	field := strings.SplitN(when, "=", 2)
+	value, ok := parent[field[0]].(string)
+	return ok && len(field) == 2 && value == field[1]
+}
+
+// redactValue replaces a secret with redactedPrefix and the start of its hash. Strings are hashed as is, and anything
+// else is hashed as JSON. Values that were already redacted are left alone.
+func redactValue(value interface{}) interface{} {
+	str, isString := value.(string)
+	if isString && (str == "" || strings.HasPrefix(str, redactedPrefix)) {
+		return value
+	}
+	if !isString {
+		data, _ := json.Marshal(value)
+		str = string(data)
+	}
+
+	sum := sha256.Sum256([]byte(str))
+	return redactedPrefix + hex.EncodeToString(sum[:])[:redactedHashLength]
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// fixtureSecrets are the secrets in testdata/secrets/zaraz-config.json, which a backup must never contain unless
+// -include-secrets is set.
+var fixtureSecrets = []string{
+	"fixture-secret-variable-9f8e7d",
+	"fixture-secret-api-4c3b2a",
+	"fixture-secret-token-6d5e4f",
+	"fixture-secret-password-1a2b3c",
+}
+
+// newZarazAPI returns a fake API with the empty zone, whose Zaraz configuration is testdata/secrets/zaraz-config.json.
+func newZarazAPI(t *testing.T) *fakeAPI {
+	t.Helper()
+
+	config, err := ioutil.ReadFile(filepath.Join("testdata", "secrets", "zaraz-config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := newFakeAPI(t, "empty")
+	api.handle("zones/*/settings/zaraz/config", func(w http.ResponseWriter, r *http.Request) {
+		writeFakeResult(w, json.RawMessage(config))
+	})
+	api.handle("zones/*/settings/zaraz/history", func(w http.ResponseWriter, r *http.Request) {
+		writeFakeResult(w, []json.RawMessage{})
+	})
+	return api
+}
+
+// findSecrets returns the files in dir, including the cache and other hidden ones, that have any of the fixture's
+// secrets in them, as is or base64-encoded.
+func findSecrets(t *testing.T, dir string) []string {
+	t.Helper()
+
+	found := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, secret := range fixtureSecrets {
+			if strings.Contains(string(data), secret) || strings.Contains(string(data), base64.StdEncoding.EncodeToString([]byte(secret))) {
+				found = append(found, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestRedactedBackupHasNoSecrets(t *testing.T) {
+	for _, format := range outputFormatNames() {
+		t.Run(format, func(t *testing.T) {
+			api := newZarazAPI(t)
+			dir := runTestBackup(t, api, "-resources", "dns,zaraz", "-format", format)
+			for _, path := range findSecrets(t, dir) {
+				t.Errorf("%s has a secret in it", path)
+			}
+
+			manifest, err := readManifest(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.ContainsSecrets {
+				t.Error("the manifest says that the backup contains secrets")
+			}
+		})
+	}
+
+	t.Run("layout dir", func(t *testing.T) {
+		api := newZarazAPI(t)
+		dir := runTestBackup(t, api, "-resources", "dns,zaraz", "-layout", "dir")
+		for _, path := range findSecrets(t, dir) {
+			t.Errorf("%s has a secret in it", path)
+		}
+	})
+}
+
+func TestRedactedBackupKeepsOtherValues(t *testing.T) {
+	api := newZarazAPI(t)
+	dir := runTestBackup(t, api, "-resources", "dns,zaraz", "-format", "json")
+	data, err := ioutil.ReadFile(filepath.Join(dir, "empty.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kept := range []string{"Example site", "G-EXAMPLE123", "1234567890", `"hideOriginalIP": true`} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("the backup doesn't have %s, which isn't a secret", kept)
+		}
+	}
+	if count := strings.Count(string(data), redactedPrefix); count != len(fixtureSecrets) {
+		t.Errorf("the backup has %d redacted values, want %d", count, len(fixtureSecrets))
+	}
+}
+
+func TestIncludeSecrets(t *testing.T) {
+	api := newZarazAPI(t)
+	dir := runTestBackup(t, api, "-resources", "dns,zaraz", "-format", "json", "-include-secrets")
+	data, err := ioutil.ReadFile(filepath.Join(dir, "empty.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range fixtureSecrets {
+		if !strings.Contains(string(data), secret) {
+			t.Errorf("the backup doesn't have %s, even with -include-secrets", secret)
+		}
+	}
+
+	manifest, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.ContainsSecrets {
+		t.Error("the manifest doesn't say that the backup contains secrets")
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		input string
+		rules []redactionRule
+		want  string
+	}{
+		{
+			"path",
+			`{"env_vars":{"A":{"value":"one"},"B":{"value":"two"}},"name":"x"}`,
+			[]redactionRule{{Path: "env_vars.*.value"}},
+			`{"env_vars":{"A":{"value":"REDACTED:7692c3ad3540"},"B":{"value":"REDACTED:3fc4ccfe7458"}},"name":"x"}`,
+		},
+		{
+			"any depth",
+			`[{"deployment":{"env_vars":{"A":{"value":"one"}}}}]`,
+			[]redactionRule{{Path: "**.env_vars.*.value"}},
+			`[{"deployment":{"env_vars":{"A":{"value":"REDACTED:7692c3ad3540"}}}}]`,
+		},
+		{
+			"when",
+			`{"vars":[{"type":"secret","value":"one"},{"type":"string","value":"two"}]}`,
+			[]redactionRule{{Path: "vars.*.value", When: "type=secret"}},
+			`{"vars":[{"type":"secret","value":"REDACTED:7692c3ad3540"},{"type":"string","value":"two"}]}`,
+		},
+		{
+			"keys",
+			`{"tools":{"t":{"apiKey":"one","nested":{"token":2},"secret":{"not":"plain"},"name":"x"}}}`,
+			[]redactionRule{{Path: "tools", Keys: regexp.MustCompile(`(?i)key|token|secret`)}},
+			`{"tools":{"t":{"apiKey":"REDACTED:7692c3ad3540","name":"x","nested":{"token":"REDACTED:d4735e3a265e"},"secret":{"not":"plain"}}}}`,
+		},
+		{
+			"already redacted",
+			`{"value":"REDACTED:7692c3ad3540","empty":""}`,
+			[]redactionRule{{Path: ""}},
+			`{"empty":"","value":"REDACTED:7692c3ad3540"}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := redactJSON([]byte(test.input), test.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
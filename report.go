@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// RunReport collects statistics about a backup run as it progresses. It's used for the summary printed at the end of
+// the run, and by the notification and metrics features.
+type RunReport struct {
+	Endpoint            string            `json:"endpoint,omitempty"`
+	Start               time.Time         `json:"start"`
+	End                 time.Time         `json:"end"`
+	DurationSeconds     float64           `json:"duration_seconds"`
+	Zones               []*ZoneReport     `json:"zones"`
+	APIRequests         int               `json:"api_requests"`
+	APIRequestsByStatus map[string]int    `json:"api_requests_by_status"`
+	Retries             int               `json:"retries"`
+	CacheHits           int               `json:"cache_hits"`
+	APIUsage            apiUsage          `json:"api_usage"`
+	BytesWritten        int64             `json:"bytes_written"`
+	AuditFindings       int               `json:"audit_findings"`
+	ZoneDifferences     int               `json:"zone_differences"`
+	DNSRecordsChecked   int               `json:"dns_records_checked"`
+	DNSMismatches       int               `json:"dns_mismatches"`
+	MissingResources    []missingResource `json:"missing_resources"`
+	SchemaDrift         []schemaDrift     `json:"schema_drift"`
+	Warnings            []string          `json:"warnings"`
+	Errors              []string          `json:"errors"`
+
+	// errors holds the errors behind Errors, so that the exit code can depend on what went wrong
+	errors []error
+}
+
+// ZoneReport holds the statistics for a single zone.
+type ZoneReport struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Records         int      `json:"records"`
+	RecordsFetched  int      `json:"records_fetched"`
+	PageRules       int      `json:"page_rules"`
+	APIRequestsSent int      `json:"api_requests_sent"`
+	RecordsAdded    int      `json:"records_added"`
+	RecordsRemoved  int      `json:"records_removed"`
+	RecordsModified int      `json:"records_modified"`
+	SettingsChanged []string `json:"settings_changed,omitempty"`
+
+	// PreviousRecords is how many records the zone had in its previous backup, if that's known. Shrunk is set if the
+	// zone failed because it had far fewer records this time, and ShrinkAllowed if the pre-zone hook let it shrink.
+	PreviousRecords *int `json:"previous_records,omitempty"`
+	Shrunk          bool `json:"shrunk,omitempty"`
+	ShrinkAllowed   bool `json:"shrink_allowed,omitempty"`
+
+	// ContentHash is the zone's content hash, and PreviousContentHash is the one from the previous backup, if there
+	// was one.
+	ContentHash         string `json:"content_hash,omitempty"`
+	PreviousContentHash string `json:"previous_content_hash,omitempty"`
+
+	// Collectors is how long each collector took for the zone, in the order that they ran, including those that were
+	// skipped because they failed.
+	Collectors []collectorTiming `json:"collectors"`
+
+	SkippedCollectors []string `json:"skipped_collectors"`
+	BytesWritten      int64    `json:"bytes_written"`
+	DurationSeconds   float64  `json:"duration_seconds"`
+	Unchanged         bool     `json:"unchanged"`
+	Resumed           bool     `json:"resumed"`
+	Partial           bool     `json:"partial"`
+	TimedOut          bool     `json:"timed_out"`
+	Vanished          bool     `json:"vanished,omitempty"`
+	Error             string   `json:"error,omitempty"`
+}
+
+func newRunReport() *RunReport {
+	return &RunReport{
+		Start:               time.Now(),
+		Zones:               []*ZoneReport{},
+		APIRequestsByStatus: map[string]int{},
+		MissingResources:    []missingResource{},
+		SchemaDrift:         []schemaDrift{},
+		Warnings:            []string{},
+		Errors:              []string{},
+	}
+}
+
+// AddZone starts tracking a new zone.
+func (r *RunReport) AddZone(zone cloudflare.Zone) *ZoneReport {
+	zoneReport := &ZoneReport{
+		ID:                zone.ID,
+		Name:              zone.Name,
+		Collectors:        []collectorTiming{},
+		SkippedCollectors: []string{},
+	}
+	r.Zones = append(r.Zones, zoneReport)
+	return zoneReport
+}
+
+// AddError records an error that made the run fail.
+func (r *RunReport) AddError(err error) {
+	r.Errors = append(r.Errors, err.Error())
+	r.errors = append(r.errors, err)
+}
+
+// AddWarning records a problem that didn't make the run fail, but that the user should know about.
+func (r *RunReport) AddWarning(format string, args ...interface{}) {
+	warning := fmt.Sprintf(format, args...)
+	log.Printf("Warning: %s", warning)
+	r.Warnings = append(r.Warnings, warning)
+}
+
+// schemaDrift is a field in API responses that the tool doesn't know about, found with -strict-decode. Field is its
+// path in the response, like "result[].comment", and Responses counts the responses that had it.
+type schemaDrift struct {
+	Endpoint  string `json:"endpoint"`
+	Field     string `json:"field"`
+	Responses int    `json:"responses"`
+}
+
+// AddSchemaDrift records fields that weren't decoded from a response to the given kind of endpoint, like
+// "dns_records". Each field is logged the first time that it's seen.
+func (r *RunReport) AddSchemaDrift(endpoint string, fields []string) {
+	for _, field := range fields {
+		found := false
+		for i := range r.SchemaDrift {
+			if r.SchemaDrift[i].Endpoint == endpoint && r.SchemaDrift[i].Field == field {
+				r.SchemaDrift[i].Responses++
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Printf("The API returned a field that isn't backed up: %s in %s", field, endpoint)
+			r.SchemaDrift = append(r.SchemaDrift, schemaDrift{Endpoint: endpoint, Field: field, Responses: 1})
+		}
+	}
+}
+
+// AddAPIRequest records a request made to the API. The status should be the HTTP status code, or "error" if no
+// response was received.
+func (r *RunReport) AddAPIRequest(status string) {
+	r.APIRequests++
+	r.APIRequestsByStatus[status]++
+}
+
+// Finish marks the end of the run.
+func (r *RunReport) Finish() {
+	r.End = time.Now()
+	r.DurationSeconds = r.Duration().Seconds()
+}
+
+// Duration returns how long the run took.
+func (r *RunReport) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// RequestRate returns the average number of API requests made per second.
+func (r *RunReport) RequestRate() float64 {
+	seconds := r.Duration().Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(r.APIRequests) / seconds
+}
+
+// Failed returns true if anything went wrong during the run.
+func (r *RunReport) Failed() bool {
+	return len(r.Errors) > 0
+}
+
+// ZonesSucceeded returns the number of zones that were backed up successfully.
+func (r *RunReport) ZonesSucceeded() int {
+	count := 0
+	for _, zone := range r.Zones {
+		if zone.Error == "" && !zone.Vanished {
+			count++
+		}
+	}
+	return count
+}
+
+// ZonesVanished returns the number of zones that disappeared between listing them and backing them up.
+func (r *RunReport) ZonesVanished() int {
+	count := 0
+	for _, zone := range r.Zones {
+		if zone.Vanished {
+			count++
+		}
+	}
+	return count
+}
+
+// ZonesFailed returns the number of zones that could not be backed up.
+func (r *RunReport) ZonesFailed() int {
+	return len(r.Zones) - r.ZonesSucceeded() - r.ZonesVanished()
+}
+
+// ZonesTimedOut returns the number of zones that failed because they took longer than -zone-timeout.
+func (r *RunReport) ZonesTimedOut() int {
+	count := 0
+	for _, zone := range r.Zones {
+		if zone.TimedOut {
+			count++
+		}
+	}
+	return count
+}
+
+// ZonesUnchanged returns the number of zones whose backup didn't change since the last run.
+func (r *RunReport) ZonesUnchanged() int {
+	count := 0
+	for _, zone := range r.Zones {
+		if zone.Error == "" && !zone.Vanished && zone.Unchanged {
+			count++
+		}
+	}
+	return count
+}
+
+// Print logs a human-readable summary of the run.
+func (r *RunReport) Print() {
+	log.Println("Summary:")
+	for _, zone := range r.Zones {
+		if zone.TimedOut {
+			log.Printf("  %s: TIMED OUT (%s)", zone.Name, zone.Error)
+			continue
+		}
+		if zone.Error != "" {
+			log.Printf("  %s: FAILED (%s)", zone.Name, zone.Error)
+			continue
+		}
+		if zone.Vanished {
+			log.Printf("  %s: VANISHED during the run, so its previous backup was kept", zone.Name)
+			continue
+		}
+		unchanged := ""
+		if zone.Partial {
+			unchanged = " (partial setup)"
+		}
+		if zone.Resumed {
+			log.Printf("  %s: already backed up by a previous run", zone.Name)
+			continue
+		} else if zone.Unchanged {
+			unchanged += " (unchanged)"
+		} else if zone.RecordsAdded+zone.RecordsRemoved+zone.RecordsModified > 0 {
+			unchanged += fmt.Sprintf(" (%d added, %d removed, %d modified)", zone.RecordsAdded, zone.RecordsRemoved, zone.RecordsModified)
+		}
+		if len(zone.SettingsChanged) > 0 {
+			unchanged += " (changed " + strings.Join(zone.SettingsChanged, ", ") + ")"
+		}
+		records := strconv.Itoa(zone.Records)
+		if zone.Records != zone.RecordsFetched {
+			records += " of " + strconv.Itoa(zone.RecordsFetched)
+		}
+		log.Printf(
+			"  %s: %s records, %d page rules, %d bytes, %d API requests, took %.1fs%s",
+			zone.Name, records, zone.PageRules, zone.BytesWritten, zone.APIRequestsSent, zone.DurationSeconds, unchanged,
+		)
+	}
+	hashChanges := []string{}
+	for _, zone := range r.Zones {
+		if zone.Error == "" && zone.PreviousContentHash != "" && zone.ContentHash != "" && zone.ContentHash != zone.PreviousContentHash {
+			hashChanges = append(hashChanges, fmt.Sprintf("  %s: %s → %s", zone.Name, shortHash(zone.PreviousContentHash), shortHash(zone.ContentHash)))
+		}
+	}
+	if len(hashChanges) > 0 {
+		log.Printf("Content hashes that changed:")
+		for _, change := range hashChanges {
+			log.Print(change)
+		}
+	}
+
+	r.printSlowest()
+
+	timedOut := ""
+	if r.ZonesTimedOut() > 0 {
+		timedOut = fmt.Sprintf(", %d of them timed out", r.ZonesTimedOut())
+	}
+	log.Printf(
+		"Zones processed: %d (%d succeeded, %d failed%s, %d unchanged)",
+		len(r.Zones), r.ZonesSucceeded(), r.ZonesFailed(), timedOut, r.ZonesUnchanged(),
+	)
+	if r.ZonesVanished() > 0 {
+		log.Printf("%d zone(s) vanished during the run", r.ZonesVanished())
+	}
+	log.Printf(
+		"API requests: %d (%d retries, %d served from cache), %.1f per second",
+		r.APIRequests, r.Retries, r.CacheHits, r.RequestRate(),
+	)
+	log.Printf(
+		"Sent to the API: %d requests (peak %d per second), %d rate limited, %.1fs spent backing off, paused for %.1fs, %.1fs spent waiting on the rate limit",
+		r.APIUsage.RequestsSent, r.APIUsage.PeakRequestRate, r.APIUsage.RateLimited, r.APIUsage.BackoffSeconds,
+		r.APIUsage.PausedSeconds, r.APIUsage.RateLimitWaitSeconds,
+	)
+	if r.APIUsage.RateLimitRemaining != nil {
+		quota := ""
+		if r.APIUsage.RateLimitQuota != nil {
+			quota = " of " + strconv.Itoa(*r.APIUsage.RateLimitQuota)
+		}
+		log.Printf("Rate limit: at least %d%s requests were left at all times", *r.APIUsage.RateLimitRemaining, quota)
+	}
+	log.Printf("Bytes written: %d", r.BytesWritten)
+	if r.DNSRecordsChecked > 0 {
+		log.Printf("DNS records checked: %d (%d mismatches)", r.DNSRecordsChecked, r.DNSMismatches)
+	}
+	if r.AuditFindings > 0 {
+		log.Printf("Audit findings: %d (see audit.txt)", r.AuditFindings)
+	}
+	if r.ZoneDifferences > 0 {
+		log.Printf("Zone differences: %d (see %s)", r.ZoneDifferences, compareTextFileName)
+	}
+	log.Printf("Duration: %s", r.Duration().Round(time.Millisecond))
+
+	if len(r.Warnings) > 0 {
+		log.Printf("Warnings:")
+		for _, warning := range r.Warnings {
+			log.Printf("  %s", warning)
+		}
+	}
+
+	if len(r.SchemaDrift) > 0 {
+		log.Printf("Schema drift: the API returned %d field(s) that this version of the tool doesn't know about, so they aren't in the backup:", len(r.SchemaDrift))
+		for _, drift := range r.SchemaDrift {
+			log.Printf("  %s: %s (in %d response(s))", drift.Endpoint, drift.Field, drift.Responses)
+		}
+	}
+
+	// these are easy to miss among the other warnings, and mean that the backup isn't complete
+	shrunk := []*ZoneReport{}
+	for _, zone := range r.Zones {
+		if zone.Shrunk {
+			shrunk = append(shrunk, zone)
+		}
+	}
+	if len(shrunk) > 0 {
+		log.Printf("WARNING: %d zone(s) have far fewer DNS records than in their previous backups, which were kept instead of being overwritten:", len(shrunk))
+		for _, zone := range shrunk {
+			log.Printf("  %s: %d record(s), down from %d", zone.Name, zone.Records, *zone.PreviousRecords)
+		}
+	}
+	if len(r.MissingResources) > 0 {
+		log.Printf("WARNING: %d resource(s) weren't backed up, because the API token is missing permissions:", len(r.MissingResources))
+		for _, missing := range r.MissingResources {
+			log.Printf("  %s: %s needs %s", missing.Zone, missing.Resource, missing.Permission)
+		}
+	}
+}
+
+// WriteJSON writes the report to the given path as JSON.
+func (r *RunReport) WriteJSON(path string, mode os.FileMode) error {
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, mode)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// htmlReportDirName is the directory in the output directory that holds the per-zone pages of the HTML report.
+// The index is written to the top of the output directory, as index.html.
+const htmlReportDirName = "report"
+
+//go:embed templates/*.html
+var htmlReportTemplates embed.FS
+
+var htmlReportTemplate = template.Must(template.ParseFS(htmlReportTemplates, "templates/*.html"))
+
+// htmlIndexPage is what index.html is rendered from.
+type htmlIndexPage struct {
+	TakenAt      string
+	Duration     string
+	DriftEnabled bool
+	Zones        []htmlIndexZone
+	Warnings     []string
+	Errors       []string
+}
+
+// htmlIndexZone is a row in the index's table of zones. Page is empty if the zone has no page of its own, like when it
+// failed, or was already backed up by a previous run.
+type htmlIndexZone struct {
+	Name         string
+	Page         string
+	Records      int
+	PageRules    int
+	Drift        string
+	Changed      bool
+	LastModified string
+	Status       string
+	Failed       bool
+}
+
+// htmlZonePage is what each zone's page is rendered from.
+type htmlZonePage struct {
+	Name         string
+	TakenAt      string
+	LastModified string
+	Drift        string
+	Records      []htmlRecordRow
+	PageRules    []htmlPageRuleRow
+}
+
+// htmlRecordRow is a row in a zone page's table of DNS records. Change is "added", "modified", or "removed" for
+// records that changed since the previous backup, in which case Previous describes a modified record's old value.
+type htmlRecordRow struct {
+	Name     string
+	Type     string
+	Content  string
+	TTL      string
+	Proxied  bool
+	Change   string
+	Previous string
+}
+
+// htmlPageRuleRow is a row in a zone page's table of page rules.
+type htmlPageRuleRow struct {
+	Priority int
+	Status   string
+	Targets  []string
+	Actions  []string
+}
+
+// writeHTMLReport writes index.html, with a table of the zones in this run, and a page for each zone listing its
+// records and page rules. With -drift, records that changed since the previous backup are highlighted.
+func (b *backupRun) writeHTMLReport() error {
+	err := b.createDir(htmlReportDirName)
+	if err != nil {
+		return err
+	}
+
+	info := b.backupInfo()
+	index := htmlIndexPage{
+		TakenAt:      b.report.Start.In(b.options.timeZone).Format(b.options.TimeFormat),
+		Duration:     time.Since(b.report.Start).Round(time.Millisecond).String(),
+		DriftEnabled: b.options.Drift,
+		Zones:        []htmlIndexZone{},
+		Warnings:     b.report.Warnings,
+		Errors:       b.report.Errors,
+	}
+
+	for _, zoneReport := range b.report.Zones {
+		row := htmlIndexZone{
+			Name:      zoneReport.Name,
+			Records:   zoneReport.Records,
+			PageRules: zoneReport.PageRules,
+			Status:    "backed up",
+		}
+		switch {
+		case zoneReport.Error != "":
+			row.Status = "failed: " + zoneReport.Error
+			row.Failed = true
+		case zoneReport.Resumed:
+			row.Status = "already backed up by a previous run"
+		case zoneReport.Unchanged:
+			row.Status = "backed up (files unchanged)"
+		}
+
+		zone, ok := b.reportZones[zoneReport.ID]
+		if ok {
+			row.Drift = driftStatus(zone, b.options.Drift)
+			row.Changed = len(zone.Changes) > 0
+			row.LastModified = info.displayTime(zone.Zone.ModifiedOn)
+		}
+		if ok && zoneReport.Error == "" {
+			row.Page = path.Join(htmlReportDirName, b.fileNames[zoneReport.ID]+".html")
+
+			page := newHTMLZonePage(zone, index.TakenAt, row.Drift, row.LastModified)
+			err = b.writeRootFile(row.Page, func(w io.Writer) error {
+				return htmlReportTemplate.ExecuteTemplate(w, "zone.html", page)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		index.Zones = append(index.Zones, row)
+	}
+
+	err = b.writeRootFile("index.html", func(w io.Writer) error {
+		return htmlReportTemplate.ExecuteTemplate(w, "index.html", index)
+	})
+	return err
+}
+
+func newHTMLZonePage(zone *reportZone, takenAt string, drift string, lastModified string) htmlZonePage {
+	page := htmlZonePage{
+		Name:         zone.Zone.Name,
+		TakenAt:      takenAt,
+		LastModified: lastModified,
+		Drift:        drift,
+		Records:      []htmlRecordRow{},
+		PageRules:    []htmlPageRuleRow{},
+	}
+
+	// the changes hold copies of the records, so they're matched up with the current records by their contents
+	added := map[string]int{}
+	modified := map[string][]cloudflare.DNSRecord{}
+	removed := []cloudflare.DNSRecord{}
+	for _, change := range zone.Changes {
+		switch change.Kind {
+		case "+":
+			added[recordKey(*change.New)]++
+		case "~":
+			key := recordKey(*change.New)
+			modified[key] = append(modified[key], *change.Old)
+		case "-":
+			removed = append(removed, *change.Old)
+		}
+	}
+
+	for _, record := range zone.Records {
+		row := newHTMLRecordRow(record, zone.Zone.Name)
+		key := recordKey(record)
+		if len(modified[key]) > 0 {
+			old := modified[key][0]
+			modified[key] = modified[key][1:]
+			row.Change = "modified"
+			row.Previous = describeValue(old, extrasChanged(old, record))
+		} else if added[key] > 0 {
+			added[key]--
+			row.Change = "added"
+		}
+		page.Records = append(page.Records, row)
+	}
+	for _, record := range removed {
+		row := newHTMLRecordRow(record, zone.Zone.Name)
+		row.Change = "removed"
+		page.Records = append(page.Records, row)
+	}
+
+	for _, pageRule := range zone.PageRules {
+		row := htmlPageRuleRow{
+			Priority: pageRule.Priority,
+			Status:   pageRule.Status,
+			Targets:  []string{},
+			Actions:  []string{},
+		}
+		for _, target := range pageRule.Targets {
+			row.Targets = append(row.Targets, target.Target+" "+target.Constraint.Operator+" "+target.Constraint.Value)
+		}
+		for _, action := range pageRule.Actions {
+			row.Actions = append(row.Actions, describePageRuleAction(action))
+		}
+		page.PageRules = append(page.PageRules, row)
+	}
+
+	return page
+}
+
+func newHTMLRecordRow(record cloudflare.DNSRecord, zoneName string) htmlRecordRow {
+	ttl := strconv.FormatUint(record.TTL, 10)
+	if record.TTL == 1 {
+		ttl = "auto"
+	}
+	content := record.Content
+	if record.Priority != nil && strings.EqualFold(record.Type, "MX") {
+		content = strconv.Itoa(int(*record.Priority)) + " " + content
+	}
+	return htmlRecordRow{
+		Name:    relativeName(record.Name, zoneName),
+		Type:    record.Type,
+		Content: content,
+		TTL:     ttl,
+		Proxied: record.Proxied,
+	}
+}
+
+// describePageRuleAction formats a page rule's action, like "cache_level: bypass". Actions without a value, like
+// always_use_https, are just their ID.
+func describePageRuleAction(action cloudflare.PageRuleAction) string {
+	if action.Value == nil {
+		return action.ID
+	}
+	value, err := json.Marshal(action.Value)
+	if err != nil {
+		return action.ID
+	}
+	return action.ID + ": " + displayJSONValue(value)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// markdownReportFileName is the name of the Markdown summary in the output directory.
+const markdownReportFileName = "SUMMARY.md"
+
+// markdownEscaper escapes the characters that would otherwise be read as Markdown (or break a table) in record values.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "|", `\|`, "`", "\\`", "*", `\*`, "_", `\_`, "<", `\<`, ">", `\>`, "[", `\[`, "]", `\]`, "\n", " ",
+)
+
+// writeMarkdownReport writes SUMMARY.md, with a table of the record changes in each zone since the previous backup,
+// suitable for a pull request description. Zones without changes are only counted, to keep it short.
+func (b *backupRun) writeMarkdownReport() error {
+	err := b.writeRootFile(markdownReportFileName, b.renderMarkdownReport)
+	return err
+}
+
+func (b *backupRun) renderMarkdownReport(w io.Writer) error {
+	output := bufio.NewWriter(w)
+
+	changed := []*reportZone{}
+	unchanged := 0
+	notCompared := []string{}
+	failed := []string{}
+	totals := map[string]int{}
+	for _, zoneReport := range b.report.Zones {
+		zone, ok := b.reportZones[zoneReport.ID]
+		switch {
+		case zoneReport.Error != "":
+			failed = append(failed, zoneReport.Name)
+		case !ok:
+			// already backed up by a previous run, so there's nothing new to say about it
+		case !zone.Compared:
+			notCompared = append(notCompared, zoneReport.Name)
+		case len(zone.Changes) == 0:
+			unchanged++
+		default:
+			changed = append(changed, zone)
+			for _, change := range zone.Changes {
+				totals[change.Kind]++
+			}
+		}
+	}
+
+	fmt.Fprintf(output, "# Backup summary\n\n")
+	fmt.Fprintf(output, "Taken at %s.\n\n", b.report.Start.In(b.options.timeZone).Format(b.options.TimeFormat))
+	fmt.Fprintf(
+		output, "**%d zone(s) changed**: %d record(s) added, %d removed, %d modified.\n\n",
+		len(changed), totals["+"], totals["-"], totals["~"],
+	)
+	if unchanged > 0 {
+		fmt.Fprintf(output, "%d zone(s) had no changes.\n\n", unchanged)
+	}
+	if len(notCompared) > 0 {
+		fmt.Fprintf(output, "%d zone(s) had no previous backup to compare to: %s.\n\n", len(notCompared), markdownEscaper.Replace(strings.Join(notCompared, ", ")))
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(output, "**%d zone(s) failed to back up**: %s.\n\n", len(failed), markdownEscaper.Replace(strings.Join(failed, ", ")))
+	}
+
+	for _, zone := range changed {
+		fmt.Fprintf(output, "## %s\n\n", markdownEscaper.Replace(zone.Zone.Name))
+		fmt.Fprintf(output, "| Change | Type | Name | Before | After |\n")
+		fmt.Fprintf(output, "| --- | --- | --- | --- | --- |\n")
+		for _, change := range zone.Changes {
+			var kind, recordType, name, before, after string
+			switch change.Kind {
+			case "+":
+				kind = "Added"
+				recordType, name = change.New.Type, relativeName(change.New.Name, zone.Zone.Name)
+				after = describeValue(*change.New, false)
+			case "-":
+				kind = "Removed"
+				recordType, name = change.Old.Type, relativeName(change.Old.Name, zone.Zone.Name)
+				before = describeValue(*change.Old, false)
+			case "~":
+				kind = "Modified"
+				recordType, name = change.New.Type, relativeName(change.New.Name, zone.Zone.Name)
+				showExtra := extrasChanged(*change.Old, *change.New)
+				before = describeValue(*change.Old, showExtra)
+				after = describeValue(*change.New, showExtra)
+			}
+			fmt.Fprintf(
+				output, "| %s | %s | %s | %s | %s |\n",
+				kind, markdownEscaper.Replace(recordType), markdownEscaper.Replace(name),
+				markdownEscaper.Replace(before), markdownEscaper.Replace(after),
+			)
+		}
+		fmt.Fprintf(output, "\n")
+	}
+
+	return output.Flush()
+}
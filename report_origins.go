@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// originsFileName is the name of the origins report's file in the output directory.
+const originsFileName = "origins.csv"
+
+// originRewriteActions are the page rule actions that change where a request is sent, or what host it's sent with.
+var originRewriteActions = map[string]string{
+	"resolve_override":     "resolves the origin as",
+	"host_header_override": "sets the host header to",
+}
+
+// originRuleHostPattern finds the hostnames that an origin rule's expression compares http.host to, like
+// http.host eq "api.example.com" or http.host in {"a.example.com" "b.example.com"}.
+var originRuleHostPattern = regexp.MustCompile(`http\.host\s*(?:eq|==|in)\s*(?:"([^"]*)"|\{([^}]*)\})`)
+
+// originRow is a line of the origins report: an origin behind the proxy, with every proxied record that points at it.
+type originRow struct {
+	Type     string
+	Origin   string
+	Zones    []string
+	Names    []string
+	Rewrites []string
+}
+
+// writeOriginsReport writes origins.csv, listing every origin that sits behind a proxied record, across all of the
+// zones in the run, and whether a page rule or origin rule sends some of the requests for it somewhere else. It only
+// uses what the backup already fetched, so origin rules are only looked at if the origin_rules resource was backed up.
+func (b *backupRun) writeOriginsReport() error {
+	zones := []*reportZone{}
+	for _, zone := range b.reportZones {
+		zones = append(zones, zone)
+	}
+	rows := originRows(zones)
+
+	err := b.writeRootFile(originsFileName, func(w io.Writer) error {
+		return renderOriginsCSV(w, rows)
+	})
+	return err
+}
+
+// originRows groups the proxied records of every zone by where they point, sorted by type and then origin.
+func originRows(zones []*reportZone) []*originRow {
+	rows := map[string]*originRow{}
+	for _, zone := range zones {
+		for _, record := range zone.Records {
+			if !record.Proxied {
+				continue
+			}
+
+			recordType := strings.ToUpper(record.Type)
+			origin := normalizeName(record.Content)
+			if recordType != "CNAME" {
+				origin = record.Content
+			}
+			key := recordType + " " + origin
+			row, ok := rows[key]
+			if !ok {
+				row = &originRow{Type: recordType, Origin: origin}
+				rows[key] = row
+			}
+			row.Zones = appendUnique(row.Zones, zone.Zone.Name)
+			row.Names = append(row.Names, normalizeName(record.Name))
+			for _, rewrite := range originRewrites(zone, normalizeName(record.Name)) {
+				row.Rewrites = appendUnique(row.Rewrites, rewrite)
+			}
+		}
+	}
+
+	sorted := []*originRow{}
+	for _, row := range rows {
+		sort.Strings(row.Zones)
+		sort.Strings(row.Names)
+		sorted = append(sorted, row)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Type != sorted[j].Type {
+			return sorted[i].Type < sorted[j].Type
+		}
+		return sorted[i].Origin < sorted[j].Origin
+	})
+	return sorted
+}
+
+// originRewrites describes the active page rules and enabled origin rules in the zone that can send requests for the
+// given name somewhere other than its record, or with a different host header. Page rules match by the hostname in
+// their URL pattern. Origin rules match if their expression compares http.host to the name, or doesn't look at
+// http.host at all, since then they can match requests for any name in the zone.
+func originRewrites(zone *reportZone, name string) []string {
+	rewrites := []string{}
+	for _, pageRule := range zone.PageRules {
+		if pageRule.Status != "active" || !pageRuleMatchesHost(pageRule, name) {
+			continue
+		}
+		for _, action := range pageRule.Actions {
+			description, ok := originRewriteActions[action.ID]
+			if ok {
+				rewrites = append(rewrites, fmt.Sprintf("%s: page rule %s %s %v", name, describePageRuleTargets(pageRule), description, action.Value))
+			}
+		}
+	}
+
+	for _, rule := range zone.OriginRules {
+		if !rule.Enabled || rule.Action != "route" || !originRuleMatchesHost(rule, name) {
+			continue
+		}
+		label := rule.Description
+		if label == "" {
+			label = rule.ID
+		}
+
+		parameters := rule.ActionParameters
+		changes := []string{}
+		if parameters.Origin != nil && parameters.Origin.Host != "" {
+			changes = append(changes, "sends requests to "+parameters.Origin.Host)
+		}
+		if parameters.Origin != nil && parameters.Origin.Port != 0 {
+			changes = append(changes, "uses port "+strconv.Itoa(parameters.Origin.Port))
+		}
+		if parameters.HostHeader != "" {
+			changes = append(changes, "sets the host header to "+parameters.HostHeader)
+		}
+		if parameters.SNI != nil && parameters.SNI.Value != "" {
+			changes = append(changes, "sets the SNI to "+parameters.SNI.Value)
+		}
+		if len(changes) > 0 {
+			rewrites = append(rewrites, fmt.Sprintf("%s: origin rule %q %s", name, label, strings.Join(changes, ", ")))
+		}
+	}
+	return rewrites
+}
+
+// pageRuleMatchesHost returns true if one of the page rule's URL patterns is for the given hostname.
+func pageRuleMatchesHost(pageRule cloudflare.PageRule, name string) bool {
+	for _, target := range pageRule.Targets {
+		if target.Target != "url" {
+			continue
+		}
+		host := target.Constraint.Value
+		if i := strings.Index(host, "://"); i != -1 {
+			host = host[i+3:]
+		}
+		if i := strings.IndexAny(host, "/:"); i != -1 {
+			host = host[:i]
+		}
+		matched, _ := path.Match(normalizeName(host), name)
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// originRuleMatchesHost returns true if the origin rule's expression can match requests for the given hostname.
+func originRuleMatchesHost(rule originRule, name string) bool {
+	if !strings.Contains(rule.Expression, "http.host") {
+		return true
+	}
+	for _, match := range originRuleHostPattern.FindAllStringSubmatch(rule.Expression, -1) {
+		hosts := []string{match[1]}
+		if match[2] != "" {
+			hosts = strings.Fields(strings.ReplaceAll(match[2], `"`, " "))
+		}
+		for _, host := range hosts {
+			if normalizeName(host) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describePageRuleTargets lists the URL patterns of a page rule.
+func describePageRuleTargets(pageRule cloudflare.PageRule) string {
+	values := []string{}
+	for _, target := range pageRule.Targets {
+		values = append(values, target.Constraint.Value)
+	}
+	return strings.Join(values, ", ")
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// renderOriginsCSV writes the origins report as CSV. Zones and names that share an origin are separated by spaces,
+// and the rewrites by semicolons.
+func renderOriginsCSV(w io.Writer, rows []*originRow) error {
+	output := csv.NewWriter(w)
+	err := output.Write([]string{"zone", "name", "type", "origin", "count", "rewritten", "rewritten_by"})
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		err = output.Write([]string{
+			strings.Join(row.Zones, " "),
+			strings.Join(row.Names, " "),
+			row.Type,
+			row.Origin,
+			strconv.Itoa(len(row.Names)),
+			yesNo(len(row.Rewrites) > 0),
+			strings.Join(row.Rewrites, "; "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	output.Flush()
+	return output.Error()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// overviewTextFileName and overviewCSVFileName are the names of the summary report's files in the output directory.
+	overviewTextFileName = "overview.txt"
+	overviewCSVFileName  = "overview.csv"
+)
+
+// writeOverviewReport writes overview.txt and overview.csv, with a line or two about each zone: its plan, its DNSSEC
+// status, how many records of each type it has, how many of them are proxied, and how many page rules it has. It's
+// meant to be read the way a registrar's domain list is, so it only uses what the backup already fetched.
+func (b *backupRun) writeOverviewReport() error {
+	zones := b.overviewZones()
+
+	err := b.writeRootFile(overviewTextFileName, func(w io.Writer) error {
+		return b.renderOverviewText(w, zones)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = b.writeRootFile(overviewCSVFileName, func(w io.Writer) error {
+		return renderOverviewCSV(w, zones)
+	})
+	return err
+}
+
+// overviewZone is a zone's line in the summary report.
+type overviewZone struct {
+	Name string
+
+	// Note is set instead of the rest if the zone wasn't backed up in this run, like "Failed to back up".
+	Note string
+
+	Plan        string
+	DNSSEC      string
+	Records     int
+	Proxied     int
+	RecordTypes map[string]int
+	PageRules   int
+}
+
+// overviewZones returns every zone of the run for the summary report, sorted by name.
+func (b *backupRun) overviewZones() []overviewZone {
+	zones := []overviewZone{}
+	for _, zoneReport := range b.report.Zones {
+		zone, ok := b.reportZones[zoneReport.ID]
+		switch {
+		case zoneReport.Error != "":
+			zones = append(zones, overviewZone{Name: zoneReport.Name, Note: "Failed to back up"})
+			continue
+		case !ok:
+			zones = append(zones, overviewZone{Name: zoneReport.Name, Note: "Backed up by a previous run"})
+			continue
+		}
+
+		overview := overviewZone{
+			Name:        zone.Zone.Name,
+			Plan:        "unknown",
+			DNSSEC:      "not backed up",
+			Records:     len(zone.Records),
+			RecordTypes: map[string]int{},
+			PageRules:   len(zone.PageRules),
+		}
+		if zone.Zone.Plan != nil && zone.Zone.Plan.Name != "" {
+			overview.Plan = zone.Zone.Plan.Name
+		}
+		if zone.DNSSEC != nil {
+			overview.DNSSEC = zone.DNSSEC.Status
+		}
+		for _, record := range zone.Records {
+			overview.RecordTypes[record.Type]++
+			if record.Proxied {
+				overview.Proxied++
+			}
+		}
+		zones = append(zones, overview)
+	}
+
+	sort.SliceStable(zones, func(i, j int) bool {
+		return normalizeName(zones[i].Name) < normalizeName(zones[j].Name)
+	})
+	return zones
+}
+
+// overviewRecordTypes returns every record type that any of the zones has, sorted.
+func overviewRecordTypes(zones []overviewZone) []string {
+	seen := map[string]bool{}
+	types := []string{}
+	for _, zone := range zones {
+		for recordType := range zone.RecordTypes {
+			if !seen[recordType] {
+				seen[recordType] = true
+				types = append(types, recordType)
+			}
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (b *backupRun) renderOverviewText(w io.Writer, zones []overviewZone) error {
+	output := bufio.NewWriter(w)
+
+	fmt.Fprintf(output, "Overview of %d zone(s), taken at %s.\n", len(zones), b.report.Start.In(b.options.timeZone).Format(b.options.TimeFormat))
+	for _, zone := range zones {
+		fmt.Fprintf(output, "\n%s\n", zone.Name)
+		if zone.Note != "" {
+			fmt.Fprintf(output, "  %s.\n", zone.Note)
+			continue
+		}
+
+		types := []string{}
+		for _, recordType := range overviewRecordTypes([]overviewZone{zone}) {
+			types = append(types, fmt.Sprintf("%s: %d", recordType, zone.RecordTypes[recordType]))
+		}
+		fmt.Fprintf(output, "  Plan:       %s\n", zone.Plan)
+		fmt.Fprintf(output, "  DNSSEC:     %s\n", zone.DNSSEC)
+		fmt.Fprintf(output, "  Records:    %d (%d proxied)\n", zone.Records, zone.Proxied)
+		if len(types) > 0 {
+			fmt.Fprintf(output, "              %s\n", strings.Join(types, ", "))
+		}
+		fmt.Fprintf(output, "  Page rules: %d\n", zone.PageRules)
+	}
+
+	return output.Flush()
+}
+
+// renderOverviewCSV writes a row for each zone, with a column for each record type that any of the zones has. Zones
+// that weren't backed up in this run only have their name and a note.
+func renderOverviewCSV(w io.Writer, zones []overviewZone) error {
+	types := overviewRecordTypes(zones)
+
+	output := csv.NewWriter(w)
+	header := []string{"zone", "plan", "dnssec", "records", "proxied", "page_rules"}
+	header = append(header, types...)
+	header = append(header, "note")
+	err := output.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, zone := range zones {
+		row := []string{zone.Name}
+		if zone.Note != "" {
+			row = append(row, make([]string, len(header)-2)...)
+			row = append(row, zone.Note)
+		} else {
+			row = append(
+				row, zone.Plan, zone.DNSSEC, strconv.Itoa(zone.Records), strconv.Itoa(zone.Proxied), strconv.Itoa(zone.PageRules),
+			)
+			for _, recordType := range types {
+				row = append(row, strconv.Itoa(zone.RecordTypes[recordType]))
+			}
+			row = append(row, "")
+		}
+		err = output.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	output.Flush()
+	return output.Error()
+}
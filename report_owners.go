@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// ownersFileName is the name of the owners report's file in the output directory.
+const ownersFileName = "owners.json"
+
+// ownerTagName is the name of the record tag that says who owns a record, like owner:team-dns.
+const ownerTagName = "owner"
+
+// ownerCommentPattern finds an owner in a record's comment, like "owner: team-dns" or "owner=team-dns".
+var ownerCommentPattern = regexp.MustCompile(`(?i)\bowner\s*[:=]\s*([^\s,;]+)`)
+
+// ownerEntry is a record in the owners report.
+type ownerEntry struct {
+	Zone    string `json:"zone"`
+	ZoneID  string `json:"zone_id"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+// recordOwners returns who owns the record, going by its owner tags and any owners named in its comment.
+func recordOwners(record cloudflare.DNSRecord) []string {
+	owners := []string{}
+	for _, tag := range record.Tags {
+		i := strings.Index(tag, ":")
+		if i == -1 || !strings.EqualFold(strings.TrimSpace(tag[:i]), ownerTagName) {
+			continue
+		}
+		owner := strings.TrimSpace(tag[i+1:])
+		if owner != "" {
+			owners = appendUnique(owners, owner)
+		}
+	}
+	for _, match := range ownerCommentPattern.FindAllStringSubmatch(record.Comment, -1) {
+		owners = appendUnique(owners, match[1])
+	}
+	return owners
+}
+
+// writeOwnersReport writes owners.json, which lists the records that each owner has, going by the records' owner tags
+// and comments. It's built again in every run, but the owners of zones that weren't backed up in this run are carried
+// over from the previous file, so that a run of a few zones doesn't drop the rest. Everything is sorted, so that the
+// file only changes when ownership does.
+func (b *backupRun) writeOwnersReport() error {
+	owners := map[string][]ownerEntry{}
+	add := func(owner string, entry ownerEntry) {
+		owners[owner] = append(owners[owner], entry)
+	}
+
+	for _, zone := range b.reportZones {
+		for _, record := range zone.Records {
+			entry := ownerEntry{
+				Zone:    zone.Zone.Name,
+				ZoneID:  zone.Zone.ID,
+				ID:      record.ID,
+				Name:    record.Name,
+				Type:    record.Type,
+				Content: record.Content,
+			}
+			for _, owner := range recordOwners(record) {
+				add(owner, entry)
+			}
+		}
+	}
+
+	previous, err := b.readPreviousOwners()
+	if err != nil {
+		b.report.AddWarning("Couldn't read the previous %s, so it only has the zones that were backed up in this run: %s", ownersFileName, err)
+	}
+	for owner, ownerEntries := range previous {
+		for _, entry := range ownerEntries {
+			if b.keepPreviousOwner(entry.ZoneID) {
+				add(owner, entry)
+			}
+		}
+	}
+
+	for _, ownerEntries := range owners {
+		sort.SliceStable(ownerEntries, func(i, j int) bool {
+			x, y := ownerEntries[i], ownerEntries[j]
+			if x.Zone != y.Zone {
+				return x.Zone < y.Zone
+			}
+			if x.Name != y.Name {
+				return x.Name < y.Name
+			}
+			if x.Type != y.Type {
+				return x.Type < y.Type
+			}
+			if x.Content != y.Content {
+				return x.Content < y.Content
+			}
+			return x.ID < y.ID
+		})
+	}
+
+	b.debugf("found owners for the records in %d zone(s): %d owner(s)", len(b.reportZones), len(owners))
+	err = b.writeRootFile(ownersFileName, func(w io.Writer) error {
+		// encoding/json sorts the owners by name
+		return writeJSON(w, owners)
+	})
+	return err
+}
+
+// keepPreviousOwner says whether an entry from the previous owners.json should be kept: it's kept if its zone wasn't
+// backed up in this run, unless every zone was listed and the zone wasn't one of them, since it's then been deleted.
+func (b *backupRun) keepPreviousOwner(zoneID string) bool {
+	_, backedUp := b.reportZones[zoneID]
+	if backedUp {
+		return false
+	}
+	if len(b.options.ZoneIDs) > 0 || len(b.options.ZoneNames) > 0 || len(b.options.zonesFromNames) > 0 {
+		return true
+	}
+	_, listed := b.fileNames[zoneID]
+	return listed
+}
+
+// readPreviousOwners reads the owners.json of the previous run, if there is one. It can't be read back once it's
+// encrypted, so it's then ignored.
+func (b *backupRun) readPreviousOwners() (map[string][]ownerEntry, error) {
+	if b.options.GPGRecipient != "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(b.options.OutputDir, ownersFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	owners := map[string][]ownerEntry{}
+	err = json.Unmarshal(data, &owners)
+	if err != nil {
+		return nil, jsonParseError(data, err)
+	}
+	return owners, nil
+}
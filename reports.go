@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// reportZone holds what the -report outputs show about a zone that was backed up in this run.
+type reportZone struct {
+	Zone      cloudflare.Zone
+	Records   []cloudflare.DNSRecord
+	PageRules []cloudflare.PageRule
+
+	// OriginRules are the zone's origin rules, or nil if the origin_rules resource wasn't backed up.
+	OriginRules []originRule
+
+	// DNSSEC is the zone's DNSSEC setup, or nil if the dnssec resource wasn't backed up.
+	DNSSEC *cloudflare.DNSSEC
+
+	// Compared is set if the zone's records were compared to its previous backup, in which case Changes holds the
+	// differences that were found.
+	Compared bool
+	Changes  []recordChange
+}
+
+// reportWriters are the reports that can be selected with the -report flag. Each one is written once every zone and
+// account has been backed up.
+var reportWriters = map[string]func(b *backupRun) error{
+	"html":     (*backupRun).writeHTMLReport,
+	"markdown": (*backupRun).writeMarkdownReport,
+	"origins":  (*backupRun).writeOriginsReport,
+	"owners":   (*backupRun).writeOwnersReport,
+	"summary":  (*backupRun).writeOverviewReport,
+}
+
+func reportNames() []string {
+	names := []string{}
+	for name := range reportWriters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseReports checks the value of the -report flag, and returns the selected reports.
+func parseReports(value string) ([]string, error) {
+	reports := []string{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		_, ok := reportWriters[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown report %q in -report. The available reports are: %s.", name, strings.Join(reportNames(), ", "))
+		}
+		seen[name] = true
+		reports = append(reports, name)
+	}
+	return reports, nil
+}
+
+func newReportZone(zone cloudflare.Zone, sections []Section, compared bool, changes []recordChange) *reportZone {
+	result := &reportZone{
+		Zone:     zone,
+		Compared: compared,
+		Changes:  changes,
+	}
+	for _, section := range sections {
+		switch section.Name {
+		case "dns":
+			result.Records = section.Data.([]cloudflare.DNSRecord)
+		case "pagerules":
+			result.PageRules = section.Data.([]cloudflare.PageRule)
+		case "origin_rules":
+			result.OriginRules = section.Data.([]originRule)
+		case "dnssec":
+			dnssec := section.Data.(cloudflare.DNSSEC)
+			result.DNSSEC = &dnssec
+		}
+	}
+	return result
+}
+
+// driftStatus describes how a zone's records changed since the previous backup, like "2 added, 1 modified".
+func driftStatus(zone *reportZone, driftEnabled bool) string {
+	if !driftEnabled {
+		return "not checked"
+	}
+	if !zone.Compared {
+		return "no previous backup"
+	}
+
+	counts := map[string]int{}
+	for _, change := range zone.Changes {
+		counts[change.Kind]++
+	}
+	parts := []string{}
+	for _, kind := range []struct{ Kind, Label string }{{"+", "added"}, {"-", "removed"}, {"~", "modified"}} {
+		if counts[kind.Kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[kind.Kind], kind.Label))
+		}
+	}
+	if len(parts) == 0 {
+		return "unchanged"
+	}
+	return strings.Join(parts, ", ")
+}
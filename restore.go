@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerSubcommand("restore", subcommand{
+		Description: "Create deleted records again, put a zone's hold back, or recreate its page rules",
+		RegisterFlags: func(flags *flag.FlagSet) {
+			(&restoreOptions{}).registerFlags(flags)
+		},
+		Run: runRestore,
+	})
+}
+
+// restoreOptions holds the configuration for the restore subcommand.
+type restoreOptions struct {
+	apiCredentials
+
+	APIBaseURL     string
+	Tombstones     string
+	HoldFrom       string
+	PageRulesFrom  string
+	Zone           string
+	IDs            stringList
+	Records        stringList
+	List           bool
+	DryRun         bool
+	Strict         bool
+	IncludeManaged bool
+	AllowPartial   bool
+
+	Concurrency   int
+	Rate          float64
+	BatchSize     int
+	BulkThreshold int
+	StateFile     string
+	MaxIdleConns  int
+	DisableHTTP2  bool
+}
+
+func (o *restoreOptions) registerFlags(flags *flag.FlagSet) {
+	o.apiCredentials.registerFlags(flags, "The CloudFlare API token to use. It needs permission to edit DNS records.")
+	flags.StringVar(&o.APIBaseURL, "api-base-url", cloudflare.DefaultBaseURL, "The base URL of the CloudFlare API, if you need to go through a proxy or gateway.")
+	flags.StringVar(&o.Tombstones, "tombstones", "", "The deleted-records.ndjson file, written by -drift, to restore records from.")
+	flags.StringVar(&o.HoldFrom, "hold-from", "", "A backup of a zone to put the zone's hold back from, as it was when the backup was taken. This can be a backup in either format, or the zone.json of the dir layout.")
+	flags.StringVar(&o.PageRulesFrom, "page-rules-from", "", "A backup of a zone to recreate the zone's page rules from, in the same order and with the same priorities, including the disabled ones. This can be a backup in the text, json, or ndjson format, or the pagerules.json of the dir layout.")
+	flags.StringVar(&o.Zone, "zone", "", "With -tombstones, only restore records that were deleted from this zone. With -hold-from or -page-rules-from, the zone to restore into, if it isn't the one that was backed up.")
+	flags.Var(&o.IDs, "id", "The ID of a record to restore. Can be given more than once, or as a comma-separated list.")
+	flags.Var(&o.Records, "record", "The name and type of a record to restore, like www.example.com/CNAME. Can be given more than once, or as a comma-separated list.")
+	flags.BoolVar(&o.List, "list", false, "If set, list the deleted records in the file, without restoring anything.")
+	flags.BoolVar(&o.DryRun, "dry-run", false, "If set, show the records that would be restored, without creating them.")
+	flags.IntVar(&o.Concurrency, "restore-concurrency", 1, "How many requests to create records to make at once.")
+	flags.Float64Var(&o.Rate, "restore-rate", 4, "The most requests to make per second, on average, so that a large restore doesn't use up the API's rate limit. 0 turns the limit off.")
+	flags.IntVar(&o.BatchSize, "batch-size", 1, "How many records to create with each request. Batches of more than one record use the batch endpoint, which creates either all of them or none of them.")
+	flags.IntVar(&o.BulkThreshold, "bulk-threshold", 1000, "Restore a zone's records with Cloudflare's bulk import, in a single request, when there are at least this many of them, and they're all of types that a zone file can hold and all proxied or all unproxied. 0 turns bulk imports off.")
+	flags.StringVar(&o.StateFile, "state-file", "", "Where to record which records have been restored, so that running the same restore again after it was interrupted skips them. Defaults to "+restoreStateFileName+" next to the -tombstones file.")
+	flags.IntVar(&o.MaxIdleConns, "max-idle-conns", 0, "How many idle connections to keep open to the API for reuse. By default, it's -restore-concurrency.")
+	flags.BoolVar(&o.DisableHTTP2, "disable-http2", false, "If set, only use HTTP/1.1 for API requests, for proxies and middleboxes that don't handle HTTP/2 well.")
+	flags.BoolVar(&o.IncludeManaged, "include-managed", false, "If set, also restore records that Cloudflare manages itself, like the ones that Email Routing adds. They're skipped by default, since Cloudflare adds them back on its own, and creating them by hand conflicts with that.")
+	flags.BoolVar(&o.AllowPartial, "allow-partial", false, "If set, restore from a backup made with a filter like -record-types, or records that were found to be deleted by one, even though it only has some of the zone's records.")
+	flags.BoolVar(&o.Strict, "strict", false, "If set, refuse to restore anything if a record is marked as proxied but Cloudflare can't proxy its type, instead of restoring it unproxied with a warning.")
+}
+
+func (o *restoreOptions) validate() error {
+	sources := 0
+	for _, source := range []string{o.Tombstones, o.HoldFrom, o.PageRulesFrom} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("You must give one of -tombstones, to restore deleted records, -hold-from, to put a zone's hold back, or -page-rules-from, to recreate a zone's page rules.")
+	}
+	if o.List {
+		return nil
+	}
+	if o.Tombstones != "" && len(o.IDs) == 0 && len(o.Records) == 0 {
+		return errors.New("You must choose the records to restore with -id or -record. Use -list to see the deleted records.")
+	}
+	for _, record := range o.Records {
+		parts := strings.SplitN(record, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("The -record flag takes a name and type separated by a slash, like www.example.com/CNAME, not %s.", record)
+		}
+	}
+	err := o.apiCredentials.resolve()
+	if err != nil {
+		return err
+	}
+	if o.apiCredentials.empty() && !o.DryRun {
+		return errNoCredentials
+	}
+
+	baseURL, err := url.Parse(o.APIBaseURL)
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+		return errors.New("The -api-base-url flag must be an absolute http or https URL.")
+	}
+
+	if o.Concurrency < 1 {
+		return errors.New("The -restore-concurrency flag must be at least 1.")
+	}
+	if o.MaxIdleConns < 0 {
+		return errors.New("The -max-idle-conns flag can't be negative.")
+	}
+	if o.Rate < 0 {
+		return errors.New("The -restore-rate flag can't be negative.")
+	}
+	if o.BatchSize < 1 {
+		return errors.New("The -batch-size flag must be at least 1.")
+	}
+	if o.BulkThreshold < 0 {
+		return errors.New("The -bulk-threshold flag can't be negative.")
+	}
+	if o.StateFile == "" && o.Tombstones != "" {
+		o.StateFile = filepath.Join(filepath.Dir(o.Tombstones), restoreStateFileName)
+	}
+	return nil
+}
+
+// matches returns true if the tombstone is one of the records chosen with -zone, -id, and -record.
+func (o *restoreOptions) matches(entry tombstone) bool {
+	if o.Zone != "" && normalizeName(entry.Zone) != normalizeName(o.Zone) {
+		return false
+	}
+	if o.List {
+		return true
+	}
+
+	for _, id := range o.IDs {
+		if entry.Record.ID != "" && entry.Record.ID == id {
+			return true
+		}
+	}
+	for _, record := range o.Records {
+		parts := strings.SplitN(record, "/", 2)
+		if normalizeName(entry.Record.Name) == normalizeName(parts[0]) && strings.EqualFold(entry.Record.Type, parts[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// runRestore is the restore subcommand, which creates deleted records again from their tombstones.
+func runRestore(args []string) error {
+	opts := restoreOptions{}
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cloudflare-backup restore -tombstones output/deleted-records.ndjson -record www.example.com/CNAME [flags]\n")
+		fmt.Fprintf(flags.Output(), "       cloudflare-backup restore -hold-from output/example.com.txt [flags]\n")
+		fmt.Fprintf(flags.Output(), "       cloudflare-backup restore -page-rules-from output/example.com.txt [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Creates records that were deleted from a zone again, as they were in the last backup that had them, puts a zone's hold back on, or recreates a zone's page rules.\n\n")
+		flags.PrintDefaults()
+	}
+	opts.registerFlags(flags)
+	flags.Parse(args)
+
+	err := opts.validate()
+	if err != nil {
+		return err
+	}
+
+	if opts.HoldFrom != "" {
+		return restoreZoneHold(&opts)
+	}
+	if opts.PageRulesFrom != "" {
+		return restorePageRules(&opts)
+	}
+
+	if _, err := os.Stat(opts.Tombstones); err == nil {
+		err = checkBackupFile(opts.Tombstones)
+		if err != nil {
+			return err
+		}
+	}
+	tombstones, err := readTombstones(opts.Tombstones)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("There's no %s. It's written by backups made with -drift, once a record has been deleted.", opts.Tombstones)
+	}
+	if err != nil {
+		return fmt.Errorf("Couldn't read %s: %w", opts.Tombstones, err)
+	}
+
+	// a record can be deleted more than once, if it was restored in between, so only the latest tombstone is used
+	chosen := []tombstone{}
+	index := map[string]int{}
+	for _, entry := range tombstones {
+		if !opts.matches(entry) {
+			continue
+		}
+		key := normalizeName(entry.Zone) + "\x00" + entry.Record.ID
+		if entry.Record.ID == "" {
+			key = normalizeName(entry.Zone) + "\x00" + recordKey(entry.Record)
+		}
+		i, seen := index[key]
+		if seen {
+			chosen[i] = entry
+			continue
+		}
+		index[key] = len(chosen)
+		chosen = append(chosen, entry)
+	}
+
+	if len(chosen) == 0 {
+		return errors.New("None of the deleted records matched. Use -list to see them.")
+	}
+
+	log.Printf("Found %d deleted record(s):", len(chosen))
+	for _, entry := range chosen {
+		managed := ""
+		if entry.Record.ManagedBy != "" {
+			managed = ", managed by " + entry.Record.ManagedBy
+		}
+		log.Printf("  %s: %s (deleted %s, last seen %s%s)", entry.Zone, describeImportRecord(entry.Record), entry.DeletedAt, entry.LastSeen, managed)
+	}
+
+	if opts.List {
+		return nil
+	}
+
+	if !opts.AllowPartial {
+		filtered := 0
+		for _, entry := range chosen {
+			if entry.Filter != "" {
+				log.Printf("%s: %s was found to be deleted by a filtered backup (%s).", entry.Zone, describeImportRecord(entry.Record), entry.Filter)
+				filtered++
+			}
+		}
+		if filtered > 0 {
+			return fmt.Errorf("%d record(s) were found to be deleted by filtered backups, which only have some of the zone's records, so nothing was restored. Pass -allow-partial to restore them anyway.", filtered)
+		}
+	}
+
+	incomplete := 0
+	for _, entry := range chosen {
+		missing := missingRecordFields(entry.Record)
+		if len(missing) > 0 {
+			log.Printf("%s: %s can't be restored, since its tombstone doesn't have its %s.", entry.Zone, describeImportRecord(entry.Record), strings.Join(missing, " or "))
+			incomplete++
+		}
+	}
+	if incomplete > 0 {
+		return fmt.Errorf("%d record(s) can't be restored, since they were backed up in a format that doesn't keep every field that's needed to create them, so nothing was restored. Back up with -format json or ndjson to keep them.", incomplete)
+	}
+
+	if !opts.IncludeManaged {
+		unmanaged := []tombstone{}
+		for _, entry := range chosen {
+			if entry.Record.ManagedBy != "" {
+				log.Printf("Skipping %s: %s, since it's managed by %s, which adds it back itself. Pass -include-managed to restore it anyway.", entry.Zone, describeImportRecord(entry.Record), entry.Record.ManagedBy)
+				continue
+			}
+			unmanaged = append(unmanaged, entry)
+		}
+		if len(unmanaged) == 0 {
+			return errors.New("All of the matching records are managed by Cloudflare, so nothing was restored. Pass -include-managed to restore them anyway.")
+		}
+		chosen = unmanaged
+	}
+
+	err = checkProxiedRecords(chosen, opts.Strict)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		log.Println("Nothing was restored, since -dry-run is set.")
+		return nil
+	}
+
+	state, err := loadRestoreState(opts.StateFile)
+	if err != nil {
+		return fmt.Errorf("Couldn't read %s: %w", opts.StateFile, err)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	client := opts.newClient()
+	if opts.Rate > 0 {
+		client.RateLimiter = cloudflare.NewRateLimiter(opts.Rate, 1)
+	}
+	restorer := &recordRestorer{
+		client: client,
+		opts:   &opts,
+		state:  state,
+	}
+
+	// the records are restored a zone at a time, with each zone looked up by name, in case it was deleted and added
+	// again with a new ID
+	zoneNames := []string{}
+	byZone := map[string][]tombstone{}
+	for _, entry := range chosen {
+		name := normalizeName(entry.Zone)
+		if _, seen := byZone[name]; !seen {
+			zoneNames = append(zoneNames, name)
+		}
+		byZone[name] = append(byZone[name], entry)
+	}
+
+	failed := 0
+	for _, name := range zoneNames {
+		if ctx.Err() != nil {
+			failed += len(byZone[name])
+			continue
+		}
+
+		zone, err := findZone(ctx, client, byZone[name][0].Zone)
+		if err != nil {
+			return err
+		}
+		failed += restorer.restoreZone(ctx, zone, byZone[name])
+	}
+
+	log.Printf("Restored %d of %d record(s).", len(chosen)-failed, len(chosen))
+	if ctx.Err() != nil {
+		return fmt.Errorf("The restore was interrupted. Run it again to restore the other %d record(s), and the ones that were already restored will be skipped.", failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d record(s) couldn't be restored.", failed)
+	}
+	return nil
+}
+
+// checkProxiedRecords finds records that are marked as proxied, but are of a type that Cloudflare can't proxy, before
+// any of them are created, since the API would refuse them part of the way through. They're restored unproxied, or
+// with strict, nothing is restored at all.
+func checkProxiedRecords(entries []tombstone, strict bool) error {
+	unproxiable := 0
+	for i := range entries {
+		record := &entries[i].Record
+		if !record.Proxied || isProxiableType(record.Type) {
+			continue
+		}
+
+		unproxiable++
+		if strict {
+			log.Printf("%s is marked as proxied, but %s records can't be proxied.", describeImportRecord(*record), record.Type)
+			continue
+		}
+		log.Printf("Warning: %s is marked as proxied, but %s records can't be proxied, so it'll be restored unproxied.", describeImportRecord(*record), record.Type)
+		record.Proxied = false
+	}
+
+	if strict && unproxiable > 0 {
+		return fmt.Errorf("%d record(s) are marked as proxied, but can't be proxied, so nothing was restored.", unproxiable)
+	}
+	return nil
+}
+
+// newClient creates an API client with the options' token and base URL.
+func (o *restoreOptions) newClient() *cloudflare.Client {
+	client := o.apiCredentials.newClient()
+	client.OnPause = func(path string, wait time.Duration) {
+		log.Printf("Rate limited by the API, so pausing every request for %s.", wait.Round(time.Second))
+	}
+	client.BaseURL = o.APIBaseURL
+	client.UserAgent = "cloudflare-backup/" + version + " (+" + repoURL + ")"
+
+	// with -restore-concurrency, each of the requests that are made at once keeps its connection
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tuneConnections(transport, o.MaxIdleConns, o.Concurrency, o.DisableHTTP2)
+	client.HTTPClient = &http.Client{Transport: transport}
+	return client
+}
+
+// checkRestoreSource checks a backup against its manifest, and refuses it if it was made with a filter, unless
+// -allow-partial is set, since it isn't a complete copy of the zone.
+func (o *restoreOptions) checkRestoreSource(path string) error {
+	err := checkBackupFile(path)
+	if err != nil {
+		return err
+	}
+	if o.AllowPartial {
+		return nil
+	}
+	data, err := readBackupFile(path)
+	if err != nil {
+		return fmt.Errorf("Couldn't read %s: %w", path, err)
+	}
+	filter := backupFilter(data)
+	if filter != "" {
+		return fmt.Errorf("%s is a filtered backup (%s), so it isn't a complete copy of the zone. Pass -allow-partial to restore from it anyway.", path, filter)
+	}
+	return nil
+}
+
+// backupFilter returns the filter that a backup in the text, json, or ndjson format was made with, or an empty string
+// if it has every record.
+func backupFilter(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		firstLine := bytes.SplitN(trimmed, []byte("\n"), 2)[0]
+		line := ndjsonLine{}
+		if json.Unmarshal(firstLine, &line) == nil && line.Resource == ndjsonZoneResource {
+			return line.Filter
+		}
+
+		document := struct {
+			Filter string `json:"filter"`
+		}{}
+		json.Unmarshal(trimmed, &document)
+		return document.Filter
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if strings.HasPrefix(line, textFilteredPrefix) {
+			return strings.SplitN(strings.TrimPrefix(line, textFilteredPrefix), ")", 2)[0]
+		}
+	}
+	return ""
+}
+
+// restoreZoneHold turns a zone's hold back on, if it was on in the backup.
+func restoreZoneHold(opts *restoreOptions) error {
+	// the hold is backed up the same whether or not the records were filtered, so any backup is as good as the next
+	err := checkBackupFile(opts.HoldFrom)
+	if err != nil {
+		return err
+	}
+	backedUp, err := readBackupZone(opts.HoldFrom)
+	if err != nil {
+		return fmt.Errorf("Couldn't read %s: %w", opts.HoldFrom, err)
+	}
+	if backedUp.Hold == nil {
+		return fmt.Errorf("%s doesn't say whether %s had a hold. Backups only do if the API token could read it.", opts.HoldFrom, backedUp.Name)
+	}
+	if !backedUp.Hold.Hold {
+		log.Printf("%s didn't have a hold when it was backed up, so there's nothing to put back.", backedUp.Name)
+		return nil
+	}
+
+	zoneName := backedUp.Name
+	if opts.Zone != "" {
+		zoneName = opts.Zone
+	}
+	subdomains := ""
+	if backedUp.Hold.IncludeSubdomains {
+		subdomains = " and its subdomains"
+	}
+	log.Printf("Putting a hold on %s%s.", zoneName, subdomains)
+
+	if opts.DryRun {
+		log.Println("Nothing was changed, since -dry-run is set.")
+		return nil
+	}
+
+	ctx := context.Background()
+	client := opts.newClient()
+	zone, err := findZone(ctx, client, zoneName)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.SetZoneHold(ctx, zone.ID, backedUp.Hold.IncludeSubdomains)
+	if err != nil {
+		return fmt.Errorf("Couldn't put the hold on %s: %w", zone.Name, err)
+	}
+	log.Printf("%s has a hold again.", zone.Name)
+	return nil
+}
+
+// readBackupZone reads a zone's metadata, including its hold, from a backup in the text, json, or ndjson format, or from
+// the zone.json of the dir layout.
+func readBackupZone(path string) (cloudflare.Zone, error) {
+	data, err := readBackupFile(path)
+	if err != nil {
+		return cloudflare.Zone{}, err
+	}
+
+	zone := cloudflare.Zone{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		// the ndjson format has the zone on its first line
+		firstLine := bytes.SplitN(bytes.TrimSpace(data), []byte("\n"), 2)[0]
+		line := ndjsonLine{Data: &zone}
+		if json.Unmarshal(firstLine, &line) == nil && line.Resource == ndjsonZoneResource {
+			return zone, nil
+		}
+
+		document := struct {
+			Zone *cloudflare.Zone `json:"zone"`
+		}{}
+		err = json.Unmarshal(data, &document)
+		if err != nil {
+			return cloudflare.Zone{}, err
+		}
+		if document.Zone != nil {
+			return *document.Zone, nil
+		}
+
+		err = json.Unmarshal(data, &zone)
+		return zone, err
+	}
+
+	// the text format has the zone's name and hold in its header, which is the comments before the first record
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if strings.HasPrefix(line, textZonePrefix) {
+			zone.Name = strings.TrimPrefix(line, textZonePrefix)
+		}
+		if strings.HasPrefix(line, textZonePausedPrefix) {
+			zone.Paused = strings.HasPrefix(strings.TrimPrefix(line, textZonePausedPrefix), "yes")
+		}
+		if strings.HasPrefix(line, textDevelopmentModePrefix) {
+			value := strings.Fields(strings.TrimPrefix(line, textDevelopmentModePrefix))
+			if len(value) > 0 {
+				zone.DevelopmentMode = &cloudflare.DevelopmentMode{Value: value[0]}
+			}
+		}
+		if strings.HasPrefix(line, textZoneHoldPrefix) {
+			description := strings.TrimPrefix(line, textZoneHoldPrefix)
+			zone.Hold = &cloudflare.ZoneHold{
+				Hold:              strings.HasPrefix(description, "on"),
+				IncludeSubdomains: strings.Contains(description, textZoneHoldSubdomains),
+			}
+		}
+	}
+	if zone.Name == "" {
+		return cloudflare.Zone{}, errors.New("it isn't a backup made by this tool")
+	}
+	return zone, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// restorePageRules recreates the page rules from a backup in a zone that doesn't have any. The rules are created from
+// the lowest priority up, each with its priority and status from the backup, so that they end up in the same order,
+// and disabled rules stay disabled.
+func restorePageRules(opts *restoreOptions) error {
+	err := opts.checkRestoreSource(opts.PageRulesFrom)
+	if err != nil {
+		return err
+	}
+	pageRules, err := readBackupPageRules(opts.PageRulesFrom)
+	if err != nil {
+		return fmt.Errorf("Couldn't read %s: %w", opts.PageRulesFrom, err)
+	}
+	if len(pageRules) == 0 {
+		log.Printf("%s doesn't have any page rules, so there's nothing to recreate.", opts.PageRulesFrom)
+		return nil
+	}
+
+	zoneName := opts.Zone
+	if zoneName == "" {
+		zoneName, err = backupPageRulesZone(opts.PageRulesFrom)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the lowest priority is created first, so that each rule slots in above the ones before it
+	sortPageRules(pageRules)
+	creating := make([]cloudflare.PageRule, len(pageRules))
+	for i, pageRule := range pageRules {
+		creating[len(pageRules)-1-i] = pageRule
+	}
+
+	log.Printf("Recreating %d page rule(s) in %s:", len(creating), zoneName)
+	for _, line := range pageRulesSummary(cloudflare.Zone{}, pageRules) {
+		log.Printf("  %s", line)
+	}
+	if opts.DryRun {
+		log.Println("Nothing was changed, since -dry-run is set.")
+		return nil
+	}
+
+	ctx := context.Background()
+	client := opts.newClient()
+	zone, err := findZone(ctx, client, zoneName)
+	if err != nil {
+		return err
+	}
+
+	// the rules can only get the same priorities if they're the only ones in the zone
+	existing, err := client.ListPageRules(ctx, zone.ID)
+	if err != nil {
+		return fmt.Errorf("Couldn't list the page rules in %s: %w", zone.Name, err)
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("%s already has %d page rule(s). Delete them first, so that the recreated rules get the same priorities as in the backup.", zone.Name, len(existing))
+	}
+	if zone.Meta != nil && zone.Meta.PageRuleQuota > 0 && len(creating) > zone.Meta.PageRuleQuota {
+		return fmt.Errorf("%s can only have %d page rule(s), but the backup has %d, so none were created.", zone.Name, zone.Meta.PageRuleQuota, len(creating))
+	}
+
+	for i, pageRule := range creating {
+		created, err := client.CreatePageRule(ctx, zone.ID, pageRule)
+		if err != nil {
+			return fmt.Errorf("Couldn't create page rule %s (%d of %d created): %w", pageRule.ID, i, len(creating), err)
+		}
+		log.Printf("Recreated page rule %s as %s (priority %d, %s).", pageRule.ID, created.ID, pageRule.Priority, pageRule.Status)
+	}
+
+	// Cloudflare renumbers priorities when it has to, so they're checked once everything's in place
+	restored, err := client.ListPageRules(ctx, zone.ID)
+	if err != nil {
+		log.Printf("Warning: couldn't list the page rules in %s to check their priorities: %s", zone.Name, err)
+		return nil
+	}
+	sortPageRules(restored)
+	if !samePageRuleOrder(pageRules, restored) {
+		log.Printf("Warning: the page rules in %s don't have the same priorities and statuses as in the backup. Check their order in the dashboard.", zone.Name)
+		return nil
+	}
+	log.Printf("The page rules in %s are in the same order as in the backup.", zone.Name)
+	return nil
+}
+
+// samePageRuleOrder returns true if both lists of rules, in order, have the same priorities and statuses.
+func samePageRuleOrder(backedUp []cloudflare.PageRule, restored []cloudflare.PageRule) bool {
+	if len(backedUp) != len(restored) {
+		return false
+	}
+	for i := range backedUp {
+		if backedUp[i].Priority != restored[i].Priority || backedUp[i].Status != restored[i].Status {
+			return false
+		}
+	}
+	return true
+}
+
+// backupPageRulesZone returns the name of the zone that a backup of page rules is from. The pagerules.json of the dir
+// layout doesn't have it, so it comes from the zone.json next to it.
+func backupPageRulesZone(path string) (string, error) {
+	zone, err := readBackupZone(path)
+	if err != nil {
+		zone, err = readBackupZone(filepath.Join(filepath.Dir(path), "zone.json"))
+	}
+	if err != nil || zone.Name == "" {
+		return "", fmt.Errorf("%s doesn't say which zone it's from, so give the zone to restore into with -zone.", path)
+	}
+	return zone.Name, nil
+}
+
+// readBackupPageRules reads a zone's page rules from a backup in the text, json, or ndjson format, or from the
+// pagerules.json of the dir layout.
+func readBackupPageRules(path string) ([]cloudflare.PageRule, error) {
+	data, err := readBackupFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+
+	pageRules := []cloudflare.PageRule{}
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		err = json.Unmarshal(trimmed, &pageRules)
+		if err != nil {
+			return nil, jsonParseError(trimmed, err)
+		}
+		return pageRules, nil
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		// the ndjson format has a zone line first, and a line for each page rule
+		firstLine := bytes.SplitN(trimmed, []byte("\n"), 2)[0]
+		line := ndjsonLine{}
+		if json.Unmarshal(firstLine, &line) == nil && line.Resource == ndjsonZoneResource {
+			for _, text := range bytes.Split(trimmed, []byte("\n")) {
+				pageRule := cloudflare.PageRule{}
+				line := ndjsonLine{Data: &pageRule}
+				err = json.Unmarshal(text, &line)
+				if err != nil {
+					return nil, jsonParseError(text, err)
+				}
+				if line.Resource == "pagerules" {
+					pageRules = append(pageRules, pageRule)
+				}
+			}
+			return pageRules, nil
+		}
+
+		document := struct {
+			Sections map[string]json.RawMessage `json:"sections"`
+		}{}
+		err = json.Unmarshal(trimmed, &document)
+		if err != nil {
+			return nil, jsonParseError(trimmed, err)
+		}
+		section, ok := document.Sections["pagerules"]
+		if !ok {
+			return nil, errors.New("the backup doesn't have page rules")
+		}
+		err = json.Unmarshal(section, &pageRules)
+		return pageRules, err
+	}
+
+	// the text format has a comment line with each page rule's JSON, under the section's title
+	inSection := false
+	found := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "# Page rules" {
+			inSection = true
+			found = true
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if line == "#" || !strings.HasPrefix(line, "#") {
+			inSection = false
+			continue
+		}
+		if !strings.HasPrefix(line, "# {") {
+			continue
+		}
+
+		pageRule := cloudflare.PageRule{}
+		err = json.Unmarshal([]byte(strings.TrimPrefix(line, "# ")), &pageRule)
+		if err != nil {
+			return nil, err
+		}
+		pageRules = append(pageRules, pageRule)
+	}
+	if !found {
+		if _, err := readBackupZone(path); err != nil {
+			return nil, errors.New("it isn't a backup made by this tool")
+		}
+		return nil, errors.New("the backup doesn't have page rules")
+	}
+	return pageRules, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// restoreStateFileName is the default name of the file that records the progress of a restore, next to the
+// tombstones file.
+const restoreStateFileName = "restore-state.json"
+
+// restoreState records which tombstones have been restored, so that running the same restore again after it was
+// interrupted doesn't create the same records twice. It's saved after every request that creates records.
+type restoreState struct {
+	Restored map[string]restoredRecord `json:"restored"`
+
+	path  string
+	mutex sync.Mutex
+}
+
+// restoredRecord is a record that was created by a restore.
+type restoredRecord struct {
+	// ID is the ID of the new record. It's empty if the record was restored with a bulk import, and the zone couldn't be
+	// listed afterwards to find it.
+	ID         string `json:"id"`
+	RestoredAt string `json:"restored_at"`
+}
+
+// loadRestoreState reads the state file from an earlier restore, if there is one.
+func loadRestoreState(path string) (*restoreState, error) {
+	state := &restoreState{
+		Restored: map[string]restoredRecord{},
+		path:     path,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, jsonParseError(data, err)
+	}
+	if state.Restored == nil {
+		state.Restored = map[string]restoredRecord{}
+	}
+	return state, nil
+}
+
+// restoreKey identifies a tombstone in the state file. The deletion time is part of it, so that a record that's
+// deleted again after being restored can be restored again.
+func restoreKey(entry tombstone) string {
+	record := entry.Record.ID
+	if record == "" {
+		record = describeImportRecord(entry.Record)
+	}
+	return normalizeName(entry.Zone) + " " + entry.DeletedAt + " " + record
+}
+
+// get returns the record that the tombstone was restored as, if it's already been restored.
+func (s *restoreState) get(entry tombstone) (restoredRecord, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	restored, ok := s.Restored[restoreKey(entry)]
+	return restored, ok
+}
+
+// add records that the tombstones were restored, as the records with the given IDs, and saves the state file.
+func (s *restoreState) add(entries []tombstone, ids []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for i, entry := range entries {
+		s.Restored[restoreKey(entry)] = restoredRecord{ID: ids[i], RestoredAt: now}
+	}
+
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, append(data, '\n'), 0600)
+}
+
+// recordRestorer creates the records from a zone's tombstones, with as many requests at once, and as many records in
+// each request, as the options allow.
+type recordRestorer struct {
+	client *cloudflare.Client
+	opts   *restoreOptions
+	state  *restoreState
+}
+
+// restoreZone creates the records from the tombstones in the zone, skipping the ones that an earlier run already
+// restored. It returns the number of records that couldn't be restored.
+func (r *recordRestorer) restoreZone(ctx context.Context, zone cloudflare.Zone, entries []tombstone) int {
+	pending := []tombstone{}
+	for _, entry := range entries {
+		restored, ok := r.state.get(entry)
+		if ok {
+			log.Printf("Skipping %s, which an earlier run already restored as %s.", describeImportRecord(entry.Record), restoredID(restored.ID))
+			continue
+		}
+		pending = append(pending, entry)
+	}
+	if len(pending) == 0 {
+		return 0
+	}
+
+	if r.canBulkImport(pending) {
+		return r.bulkImport(ctx, zone, pending)
+	}
+
+	batches := make(chan []tombstone)
+	wait := sync.WaitGroup{}
+	for i := 0; i < r.opts.Concurrency; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for batch := range batches {
+				r.createBatch(ctx, zone, batch)
+			}
+		}()
+	}
+
+	for start := 0; start < len(pending); start += r.opts.BatchSize {
+		if ctx.Err() != nil {
+			break
+		}
+		end := start + r.opts.BatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batches <- pending[start:end]
+	}
+	close(batches)
+	wait.Wait()
+
+	// anything that failed, or wasn't sent because the restore was interrupted, is tried again by the next run
+	failed := 0
+	for _, entry := range pending {
+		if _, ok := r.state.get(entry); !ok {
+			failed++
+		}
+	}
+	return failed
+}
+
+// createBatch creates the records from a batch of tombstones, with a single request.
+func (r *recordRestorer) createBatch(ctx context.Context, zone cloudflare.Zone, batch []tombstone) {
+	records := []cloudflare.DNSRecord{}
+	for _, entry := range batch {
+		records = append(records, entry.Record)
+	}
+
+	var created []cloudflare.DNSRecord
+	var err error
+	if len(records) == 1 {
+		var record cloudflare.DNSRecord
+		record, err = r.client.CreateDNSRecord(ctx, zone.ID, records[0])
+		created = []cloudflare.DNSRecord{record}
+	} else {
+		created, err = r.client.BatchCreateDNSRecords(ctx, zone.ID, records)
+		if err == nil && len(created) != len(records) {
+			err = fmt.Errorf("the API created %d record(s) instead of %d", len(created), len(records))
+		}
+	}
+	if err != nil {
+		for _, record := range records {
+			log.Printf("Couldn't restore %s: %s", describeImportRecord(record), err)
+		}
+		return
+	}
+
+	ids := []string{}
+	for i, record := range records {
+		log.Printf("Restored %s as %s.", describeImportRecord(record), created[i].ID)
+		ids = append(ids, created[i].ID)
+	}
+	r.saveState(batch, ids)
+}
+
+// canBulkImport returns true if the records should be restored with Cloudflare's bulk import: there are at least
+// -bulk-threshold of them, and they can all be written as a zone file with a single proxied setting.
+func (r *recordRestorer) canBulkImport(entries []tombstone) bool {
+	if r.opts.BulkThreshold == 0 || len(entries) < r.opts.BulkThreshold {
+		return false
+	}
+	for _, entry := range entries {
+		_, ok := bindRecordLine(entry.Record)
+		if !ok || entry.Record.Proxied != entries[0].Record.Proxied {
+			return false
+		}
+	}
+	return true
+}
+
+// bulkImport restores the records by uploading them as a zone file. The import doesn't say what the new records'
+// IDs are, so they're looked up in the zone afterwards. It returns the number of records that couldn't be restored.
+func (r *recordRestorer) bulkImport(ctx context.Context, zone cloudflare.Zone, entries []tombstone) int {
+	lines := []string{}
+	for _, entry := range entries {
+		line, _ := bindRecordLine(entry.Record)
+		lines = append(lines, line)
+	}
+
+	log.Printf("Restoring %d record(s) into %s with a bulk import...", len(entries), zone.Name)
+	result, err := r.client.ImportDNSRecords(ctx, zone.ID, []byte(strings.Join(lines, "\n")+"\n"), entries[0].Record.Proxied)
+	if err != nil {
+		log.Printf("Couldn't import the records into %s: %s", zone.Name, err)
+		return len(entries)
+	}
+	log.Printf("Cloudflare added %d of the %d record(s) that it found in the import.", result.RecordsAdded, result.TotalRecordsParsed)
+
+	current, err := r.client.ListDNSRecords(ctx, zone.ID)
+	if err != nil {
+		// without the zone's records, there's no telling which ones were added, so the import's own count is used,
+		// and all of them are marked as restored, since running the import again could add the same records twice
+		log.Printf("Warning: couldn't list the records in %s to find the new records' IDs: %s", zone.Name, err)
+		r.saveState(entries, make([]string, len(entries)))
+
+		failed := result.TotalRecordsParsed - result.RecordsAdded
+		if failed < 0 {
+			failed = 0
+		}
+		return failed
+	}
+
+	byKey := map[string][]string{}
+	for _, record := range current {
+		byKey[recordKey(record)] = append(byKey[recordKey(record)], record.ID)
+	}
+	restored := []tombstone{}
+	ids := []string{}
+	for _, entry := range entries {
+		key := recordKey(entry.Record)
+		if len(byKey[key]) == 0 {
+			log.Printf("Couldn't restore %s: it isn't in the zone after the import.", describeImportRecord(entry.Record))
+			continue
+		}
+		log.Printf("Restored %s as %s.", describeImportRecord(entry.Record), byKey[key][0])
+		restored = append(restored, entry)
+		ids = append(ids, byKey[key][0])
+		byKey[key] = byKey[key][1:]
+	}
+	r.saveState(restored, ids)
+	return len(entries) - len(restored)
+}
+
+// saveState records that the tombstones were restored, warning if the state file couldn't be saved.
+func (r *recordRestorer) saveState(entries []tombstone, ids []string) {
+	err := r.state.add(entries, ids)
+	if err != nil {
+		log.Printf("Warning: couldn't save the progress to %s, so running the restore again would create these records again: %s", r.state.path, err)
+	}
+}
+
+// restoredID describes the ID of a restored record for the log.
+func restoredID(id string) string {
+	if id == "" {
+		return "a record whose ID isn't known"
+	}
+	return id
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRestoreHoldFromFilteredBackup(t *testing.T) {
+	api := newFakeAPI(t, "all-types")
+	mu := sync.Mutex{}
+	holdSet := false
+	api.handle("zones/*/hold", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		holdSet = holdSet || r.Method == http.MethodPost
+		mu.Unlock()
+		writeFakeResult(w, map[string]interface{}{"hold": true, "include_subdomains": false})
+	})
+	dir := runTestBackup(t, api, "-resources", "dns", "-record-types", "MX")
+
+	// the record filter has nothing to do with the hold, so -allow-partial isn't needed
+	err := runRestore([]string{"-api-token", "test-token", "-api-base-url", api.URL(), "-hold-from", filepath.Join(dir, "example.com.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !holdSet {
+		t.Error("the hold wasn't put back")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// maxSelfCheckChanges is how many of the differences found by -self-check are included in the error.
+const maxSelfCheckChanges = 3
+
+// selfChecked wraps the function that writes a zone's backup file so that, with -self-check, what it wrote is read back
+// in with the format's parser, the same one that restores and -drift use, and compared to the records that were
+// written. If they don't match, the write fails, so the file never replaces the previous backup, and the zone is
+// marked as failed. This catches a record that a format can't hold, like a TXT record with the separator in it, while
+// the records are still at hand, rather than when they're needed.
+func (b *backupRun) selfChecked(name string, zone cloudflare.Zone, sections []Section, write func(w io.Writer) error) func(w io.Writer) error {
+	if !b.options.SelfCheck {
+		return write
+	}
+
+	return func(w io.Writer) error {
+		written := bytes.Buffer{}
+		err := write(io.MultiWriter(w, &written))
+		if err != nil {
+			return err
+		}
+
+		records := []cloudflare.DNSRecord{}
+		for _, section := range sections {
+			if section.Name == "dns" {
+				records = section.Data.([]cloudflare.DNSRecord)
+			}
+		}
+
+		parsed, err := b.format.ParseRecords(&written)
+		if err != nil {
+			return fmt.Errorf("self-check: %s can't be read back in: %w", name, err)
+		}
+
+		changes := diffRecords(records, parsed, b.format.recordKey())
+		if len(changes) > 0 {
+			examples := []string{}
+			for i, change := range changes {
+				if i == maxSelfCheckChanges {
+					examples = append(examples, "...")
+					break
+				}
+				examples = append(examples, change.String(zone.Name))
+			}
+			return fmt.Errorf(
+				"self-check: reading %s back in gave %d record(s) out of %d, with %d difference(s): %s",
+				name, len(parsed), len(records), len(changes), strings.Join(examples, "; "),
+			)
+		}
+
+		b.debugf("self-check: read %d record(s) back in from %s", len(parsed), name)
+		return nil
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// fixtureRecords returns the DNS records of a fixture zone, as the API has them.
+func fixtureRecords(t *testing.T, fixture string) []cloudflare.DNSRecord {
+	t.Helper()
+
+	records := []cloudflare.DNSRecord{}
+	for _, data := range loadFakeZone(t, fixture).DNSRecords {
+		record := cloudflare.DNSRecord{}
+		err := json.Unmarshal(data, &record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		fixture string
+		zone    string
+	}{
+		{"all-types", "example.com"},
+		{"dnscontrol", "dnscontrol.example"},
+		{"idn", "xn--bcher-kva.example"},
+	} {
+		for _, name := range outputFormatNames() {
+			t.Run(test.fixture+"/"+name, func(t *testing.T) {
+				format := outputFormats[name]
+				dir := runTestBackup(t, newFakeAPI(t, test.fixture), "-format", name, "-resources", "dns", "-self-check=false")
+				file, err := os.Open(filepath.Join(dir, test.zone+"."+format.Extension))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+
+				parsed, err := format.ParseRecords(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				records := fixtureRecords(t, test.fixture)
+				for _, change := range diffRecords(records, parsed, format.recordKey()) {
+					t.Errorf("the record doesn't come back the same: %s", change.String(test.zone))
+				}
+				if len(parsed) != len(records) {
+					t.Errorf("got %d records back, want %d", len(parsed), len(records))
+				}
+			})
+		}
+	}
+}
+
+func TestSelfCheckFailsZone(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		parse func(records []cloudflare.DNSRecord) ([]cloudflare.DNSRecord, error)
+		want  string
+	}{
+		{
+			"record lost",
+			func(records []cloudflare.DNSRecord) ([]cloudflare.DNSRecord, error) {
+				return records[1:], nil
+			},
+			"self-check: reading example.com.txt back in gave 23 record(s) out of 24, with 1 difference(s): ",
+		},
+		{
+			"record changed",
+			func(records []cloudflare.DNSRecord) ([]cloudflare.DNSRecord, error) {
+				records[0].Content = "192.0.2.99"
+				return records, nil
+			},
+			"self-check: reading example.com.txt back in gave 24 record(s) out of 24, with 1 difference(s): ~ A @ 192.0.2.1 -> 192.0.2.99",
+		},
+		{
+			"unreadable",
+			func(records []cloudflare.DNSRecord) ([]cloudflare.DNSRecord, error) {
+				return nil, errors.New("line 12: too many columns")
+			},
+			"self-check: example.com.txt can't be read back in: line 12: too many columns",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			api := newFakeAPI(t, "all-types")
+			dir := runTestBackup(t, api)
+			previous, err := ioutil.ReadFile(filepath.Join(dir, "example.com.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a run the next day, whose parser doesn't read the file back in as it was written
+			run := newTestBackup(t, api, "-output", dir)
+			run.report.Start = testTime.AddDate(0, 0, 1)
+			parse := run.format.ParseRecords
+			run.format.ParseRecords = func(r io.Reader) ([]cloudflare.DNSRecord, error) {
+				records, err := parse(r)
+				if err != nil {
+					t.Error(err)
+					return nil, err
+				}
+				return test.parse(records)
+			}
+			report := run.run(context.Background())
+			if !report.Failed() || !strings.Contains(strings.Join(report.Errors, "; "), test.want) {
+				t.Errorf("got errors %q, want one with %q", report.Errors, test.want)
+			}
+
+			// the failed file never replaced the previous backup
+			current, err := ioutil.ReadFile(filepath.Join(dir, "example.com.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(current) != string(previous) {
+				t.Error("the previous backup was replaced")
+			}
+		})
+	}
+}
+
+func TestSelfCheckIncompatibleFlags(t *testing.T) {
+	for _, incompatible := range []string{"-stream-records", "-single-file"} {
+		opts := &options{}
+		flags := flag.NewFlagSet("cloudflare-backup", flag.ContinueOnError)
+		opts.registerFlags(flags)
+		err := flags.Parse([]string{"-api-token", "test-token", "-self-check", incompatible})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = opts.validate()
+		if err == nil || !strings.Contains(err.Error(), "-self-check") {
+			t.Errorf("%s: got error %v, want one about -self-check", incompatible, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// allowShrinkFileEnv is the environment variable that tells the pre-zone hook where to create a file to let the zone
+// shrink past -max-shrink-percent, for zones that are known to be getting smaller.
+const allowShrinkFileEnv = "CB_ALLOW_SHRINK_FILE"
+
+// loadPreviousRecordCounts reads how many DNS records each zone had from the manifest of the previous backup in the
+// output directory, keyed by zone ID, before any filter was applied to them. It also returns the previous backup's
+// filter, if it had one, in which case its backup files only have some of the records, so they can't be counted instead.
+// Zones from manifests written before the counts were kept aren't included.
+func loadPreviousRecordCounts(outputDir string) (map[string]int, string) {
+	counts := map[string]int{}
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, manifestFileName))
+	if err != nil {
+		return counts, ""
+	}
+
+	previous := manifest{}
+	if json.Unmarshal(data, &previous) != nil {
+		return counts, ""
+	}
+	for _, zone := range previous.Zones {
+		if zone.RecordsFetched != nil {
+			counts[zone.ID] = *zone.RecordsFetched
+		} else if zone.Records != nil && previous.Filter == "" {
+			counts[zone.ID] = *zone.Records
+		}
+	}
+	return counts, previous.Filter
+}
+
+// previousRecordCount returns how many DNS records the zone had in its previous backup, from the previous manifest,
+// or else from the backup file itself, if it wasn't filtered. It returns false if there's no previous backup to go by.
+func (b *backupRun) previousRecordCount(zone cloudflare.Zone) (int, bool) {
+	count, ok := b.previousRecordCounts[zone.ID]
+	if ok {
+		return count, true
+	}
+	if b.previousFilter != "" {
+		return 0, false
+	}
+
+	records, _, found, err := b.loadPreviousRecords(zone)
+	if !found || err != nil {
+		return 0, false
+	}
+	return len(records), true
+}
+
+// checkShrink makes sure that the zone didn't lose more than -max-shrink-percent of its DNS records since the previous
+// backup, which usually means that the API returned less than it should have, like when a token has lost access to
+// most of a zone. If it did, the zone fails before anything is written, so the previous backup is kept as it was.
+func (b *backupRun) checkShrink(zone cloudflare.Zone, sections []Section, zoneReport *ZoneReport) error {
+	if b.options.AllowShrink || zoneReport.ShrinkAllowed {
+		return nil
+	}
+
+	// the records are counted before the record filter, so that the count doesn't depend on it
+	count := -1
+	for _, section := range sections {
+		_, ok := section.Data.([]cloudflare.DNSRecord)
+		if ok {
+			count = zoneReport.RecordsFetched
+		}
+	}
+	if count < 0 {
+		// the records were streamed, or weren't backed up at all
+		return nil
+	}
+
+	previous, ok := b.previousRecordCount(zone)
+	if !ok || previous == 0 {
+		return nil
+	}
+	zoneReport.PreviousRecords = &previous
+	if (previous-count)*100 <= previous*b.options.MaxShrinkPercent {
+		return nil
+	}
+
+	zoneReport.Shrunk = true
+	return fmt.Errorf(
+		"it has %d DNS record(s), down from %d in the previous backup, which is more than %d%% fewer, so the previous backup was kept. Pass -allow-shrink if the zone really did shrink",
+		count, previous, b.options.MaxShrinkPercent,
+	)
+}
+
+// allowShrinkPath is where the pre-zone hook can create a file to let the zone shrink. It's only there while the hook
+// runs.
+func allowShrinkPath(zone cloudflare.Zone) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("cloudflare-backup-%d-%s.allow-shrink", os.Getpid(), sanitizeFileName(zone.ID)))
+}
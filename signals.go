@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// errInterrupted is recorded when the run is stopped by a signal before every zone was backed up.
+var errInterrupted = errors.New("The backup was interrupted before it finished.")
+
+// interruptContext returns a context that's cancelled when the process is asked to stop, with Ctrl+C or SIGTERM, so
+// that the run can stop cleanly: files that were being written are removed, and the summary and manifest are still
+// written for what was done. On Windows, Go also delivers closing the console window, logging off, and shutting down
+// as SIGTERM. A second signal exits straight away.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case received := <-signals:
+			log.Printf("Received %s, stopping. Send it again to stop straight away, without cleaning up.", received)
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+
+		<-signals
+		os.Exit(exitInterrupted)
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
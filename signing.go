@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestSignatureFileName is the name of the file that holds the manifest's signature, with -sign-key.
+const manifestSignatureFileName = "manifest.sig"
+
+// manifestSignatureNamespace is signed along with the manifest, so that a signature made for something else with the
+// same key can't be passed off as one for a manifest.
+const manifestSignatureNamespace = "cloudflare-backup-manifest-v1\n"
+
+// manifestSignature is what's saved in manifest.sig. KeyFingerprint is the SHA-256 fingerprint of the public key, in
+// the same form that ssh-keygen -l shows, so that it's easy to tell which key a backup was signed with.
+type manifestSignature struct {
+	Algorithm      string `json:"algorithm"`
+	KeyFingerprint string `json:"key_fingerprint"`
+	Signature      string `json:"signature"`
+}
+
+// canonicalManifest is the form of the manifest that's signed: its JSON with the whitespace removed and the keys of
+// every object sorted, so that the signature still matches if the manifest is reformatted or its keys are reordered.
+func canonicalManifest(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	canonical := bytes.Buffer{}
+	encoder := json.NewEncoder(&canonical)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(manifestSignatureNamespace), bytes.TrimSuffix(canonical.Bytes(), []byte("\n"))...), nil
+}
+
+// signManifest signs the manifest in the output directory with the given key, and saves the signature next to it.
+func signManifest(outputDir string, key ed25519.PrivateKey, mode os.FileMode) error {
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, manifestFileName))
+	if err != nil {
+		return err
+	}
+	canonical, err := canonicalManifest(data)
+	if err != nil {
+		return err
+	}
+
+	signature := manifestSignature{
+		Algorithm:      "ed25519",
+		KeyFingerprint: keyFingerprint(key.Public().(ed25519.PublicKey)),
+		Signature:      base64.StdEncoding.EncodeToString(ed25519.Sign(key, canonical)),
+	}
+	signatureJSON, err := json.MarshalIndent(signature, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(outputDir, manifestSignatureFileName), append(signatureJSON, '\n'), mode)
+}
+
+// verifyManifestSignature checks that the manifest in the given directory was signed by the given key, and hasn't
+// changed since.
+func verifyManifestSignature(dir string, key ed25519.PublicKey) error {
+	signatureJSON, err := ioutil.ReadFile(filepath.Join(dir, manifestSignatureFileName))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("the backup isn't signed, since there's no %s", manifestSignatureFileName)
+	}
+	if err != nil {
+		return err
+	}
+
+	signature := manifestSignature{}
+	err = json.Unmarshal(signatureJSON, &signature)
+	if err != nil {
+		return fmt.Errorf("couldn't read %s: %w", manifestSignatureFileName, jsonParseError(signatureJSON, err))
+	}
+	if signature.Algorithm != "ed25519" {
+		return fmt.Errorf("%s uses the %q algorithm, but only ed25519 is supported", manifestSignatureFileName, signature.Algorithm)
+	}
+	if fingerprint := keyFingerprint(key); signature.KeyFingerprint != fingerprint {
+		return fmt.Errorf("the backup was signed with the key %s, not %s", signature.KeyFingerprint, fingerprint)
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return fmt.Errorf("the signature in %s isn't valid base64", manifestSignatureFileName)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		return err
+	}
+	canonical, err := canonicalManifest(data)
+	if err != nil {
+		return fmt.Errorf("couldn't read %s: %w", manifestFileName, jsonParseError(data, err))
+	}
+	if !ed25519.Verify(key, canonical, signatureBytes) {
+		return fmt.Errorf("the signature in %s doesn't match %s, so the manifest was changed after it was signed", manifestSignatureFileName, manifestFileName)
+	}
+	return nil
+}
+
+// keyFingerprint is the SHA-256 fingerprint of a public key, like ssh-keygen -l shows it.
+func keyFingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(sshPublicKeyBlob(key))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// sshPublicKeyBlob encodes a public key the way that SSH does, as in the base64 part of an authorized_keys line.
+func sshPublicKeyBlob(key ed25519.PublicKey) []byte {
+	blob := appendSSHString(nil, []byte("ssh-ed25519"))
+	return appendSSHString(blob, key)
+}
+
+func appendSSHString(data []byte, value []byte) []byte {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(value)))
+	return append(append(data, length...), value...)
+}
+
+// loadSigningKey reads an ed25519 private key, either in the OpenSSH format that ssh-keygen -t ed25519 writes by
+// default, or in the PKCS #8 format that openssl genpkey -algorithm ed25519 writes.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the key in %s: %w.", path, err)
+	}
+	return key, nil
+}
+
+// loadVerifyKey reads an ed25519 public key, either as a line from a .pub file written by ssh-keygen, or in the PEM
+// format that openssl pkey -pubout writes. A private key works too, since its public key can be worked out from it.
+func loadVerifyKey(path string) (ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read the key in %s: %w.", path, err)
+	}
+	return key, nil
+}
+
+func parsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("it isn't a PEM-encoded private key")
+	}
+
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		return parseOpenSSHPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ed25519Key, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("it isn't an ed25519 key")
+		}
+		return ed25519Key, nil
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, errors.New("it's encrypted with a passphrase, which isn't supported")
+	}
+	return nil, fmt.Errorf("it's a %q block, which isn't an ed25519 private key", block.Type)
+}
+
+func parsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) >= 2 && strings.HasPrefix(fields[0], "ssh-") {
+		if fields[0] != "ssh-ed25519" {
+			return nil, fmt.Errorf("it's an %s key, not an ed25519 one", fields[0])
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, errors.New("the key isn't valid base64")
+		}
+		reader := sshReader{data: blob}
+		keyType := reader.readString()
+		key := reader.readString()
+		if reader.err != nil || string(keyType) != "ssh-ed25519" || len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("it isn't a valid ed25519 public key")
+		}
+		return ed25519.PublicKey(key), nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("it isn't an SSH or PEM-encoded public key")
+	}
+	if block.Type != "PUBLIC KEY" {
+		privateKey, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		return privateKey.Public().(ed25519.PublicKey), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ed25519Key, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("it isn't an ed25519 key")
+	}
+	return ed25519Key, nil
+}
+
+// parseOpenSSHPrivateKey decodes the private key format described in OpenSSH's PROTOCOL.key. Only unencrypted files
+// with a single ed25519 key are supported.
+func parseOpenSSHPrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, errors.New("it isn't a valid OpenSSH private key")
+	}
+
+	reader := sshReader{data: data[len(magic):]}
+	cipherName := reader.readString()
+	reader.readString() // kdf name
+	reader.readString() // kdf options
+	keyCount := reader.readUint32()
+	reader.readString() // public key
+	private := sshReader{data: reader.readString()}
+	if reader.err != nil {
+		return nil, errors.New("it isn't a valid OpenSSH private key")
+	}
+	if string(cipherName) != "none" {
+		return nil, errors.New("it's encrypted with a passphrase, which isn't supported (remove it with ssh-keygen -p)")
+	}
+	if keyCount != 1 {
+		return nil, errors.New("it holds more than one key")
+	}
+
+	check1 := private.readUint32()
+	check2 := private.readUint32()
+	keyType := private.readString()
+	if private.err == nil && string(keyType) != "ssh-ed25519" {
+		return nil, fmt.Errorf("it's an %s key, not an ed25519 one", keyType)
+	}
+	private.readString() // public key
+	key := private.readString()
+	if private.err != nil || check1 != check2 || len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("it isn't a valid OpenSSH private key")
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// sshReader reads the length-prefixed values used by SSH's encodings. Once a read fails, err is set and every read
+// after it returns nothing.
+type sshReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sshReader) readUint32() uint32 {
+	if r.err != nil || len(r.data) < 4 {
+		r.err = errors.New("unexpected end of data")
+		return 0
+	}
+	value := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return value
+}
+
+func (r *sshReader) readString() []byte {
+	length := r.readUint32()
+	if r.err != nil || uint32(len(r.data)) < length {
+		r.err = errors.New("unexpected end of data")
+		return nil
+	}
+	value := r.data[:length]
+	r.data = r.data[length:]
+	return value
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// singleFileName is the file that -single-file writes every zone into.
+const singleFileName = "zones.ndjson"
+
+// singleFile is the file that every zone is written into with -single-file. Unlike other output files, it's written
+// in place rather than renamed into place at the end, so that it can be followed while the run is going.
+type singleFile struct {
+	path    string
+	file    io.WriteCloser
+	counter *countingWriter
+}
+
+// openSingleFile creates the -single-file file, replacing the one from the last run.
+func (b *backupRun) openSingleFile() error {
+	outputPath := filepath.Join(b.options.OutputDir, singleFileName)
+	var file io.WriteCloser
+	var err error
+	if b.options.GPGRecipient != "" {
+		outputPath += ".gpg"
+		file, err = createEncryptedFile(outputPath, os.FileMode(b.options.FileMode), b.options.GPGRecipient)
+	} else {
+		file, err = createFile(outputPath, os.FileMode(b.options.FileMode))
+	}
+	if err != nil {
+		return err
+	}
+
+	b.singleFile = &singleFile{
+		path:    outputPath,
+		file:    file,
+		counter: &countingWriter{w: file},
+	}
+	return nil
+}
+
+// writeSingleFile appends a zone's sections to the -single-file file.
+func (b *backupRun) writeSingleFile(zone cloudflare.Zone, sections []Section, zoneReport *ZoneReport, manifestZone *manifestZone) error {
+	before := b.singleFile.counter.count
+	err := writeZone(b.format.NewWriter(b.singleFile.counter, b.zoneInfo(manifestZone)), zone, sections)
+	written := b.singleFile.counter.count - before
+	zoneReport.Unchanged = false
+	zoneReport.BytesWritten += written
+	b.report.BytesWritten += written
+	return err
+}
+
+// closeSingleFile finishes the -single-file file, and adds it to the manifest.
+func (b *backupRun) closeSingleFile() error {
+	err := b.singleFile.file.Close()
+	if err != nil {
+		return err
+	}
+
+	file, err := newManifestFile(b.options.OutputDir, b.singleFile.path)
+	if err != nil {
+		return err
+	}
+	b.manifest.Files = append(b.manifest.Files, file)
+	return nil
+}
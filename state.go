@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stateFileName is the name of the file in the output directory that tracks which zones have been backed up.
+const stateFileName = ".state.json"
+
+// runState records which zones have been backed up, so that an interrupted run can be resumed with -resume.
+type runState struct {
+	// Fingerprint identifies the options that affect what's written. A state file written with different options
+	// can't be resumed from, since the backup would end up with a mix of both.
+	Fingerprint string `json:"fingerprint"`
+
+	Zones map[string]*zoneState `json:"zones"`
+}
+
+// zoneState records a completed zone.
+type zoneState struct {
+	Name        string        `json:"name"`
+	ContentHash string        `json:"content_hash"`
+	FinishedAt  time.Time     `json:"finished_at"`
+	Manifest    *manifestZone `json:"manifest"`
+}
+
+// optionsFingerprint hashes the options that affect the contents of the backup.
+func optionsFingerprint(opts *options, collectors []Collector) string {
+	names := []string{}
+	for _, collector := range collectors {
+		names = append(names, collector.Name())
+	}
+
+	parts := []string{
+		"format=" + opts.Format,
+		"layout=" + opts.Layout,
+		"resources=" + strings.Join(names, ","),
+		"filter=" + opts.recordFilter.String(),
+		"gpg=" + opts.GPGRecipient,
+		"secrets=" + strconv.FormatBool(opts.IncludeSecrets),
+		"cf-export=" + strconv.FormatBool(opts.IncludeCFExport),
+		"api=" + opts.APIBaseURL,
+	}
+	if opts.GroupByAccount {
+		// only added when it's set, so that state files from before the flag existed can still be resumed from
+		parts = append(parts, "group-by-account=true")
+	}
+	if opts.RDAP {
+		parts = append(parts, "rdap="+opts.RDAPServer)
+	}
+	// these change the bytes of the files that are written, so a run can't be resumed with them changed either, and
+	// like -group-by-account they're only added when they aren't the default
+	if opts.Compress != "" {
+		parts = append(parts, "compress="+opts.Compress)
+	}
+	if opts.TextRecordFlags {
+		parts = append(parts, "text-record-flags=true")
+	}
+	if opts.TimeZone != "UTC" {
+		parts = append(parts, "time-zone="+opts.TimeZone)
+	}
+	if opts.TimeFormat != time.RFC3339 {
+		parts = append(parts, "time-format="+opts.TimeFormat)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRunState(fingerprint string) *runState {
+	return &runState{
+		Fingerprint: fingerprint,
+		Zones:       map[string]*zoneState{},
+	}
+}
+
+// loadRunState reads the state file from the output directory. If it's missing, unreadable, or was written with a
+// different fingerprint, an empty state is returned instead.
+func loadRunState(outputDir string, fingerprint string) (*runState, bool) {
+	emptyState := newRunState(fingerprint)
+
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, stateFileName))
+	if err != nil {
+		return emptyState, false
+	}
+
+	state := &runState{}
+	err = json.Unmarshal(data, state)
+	if err != nil || state.Fingerprint != fingerprint || state.Zones == nil {
+		return emptyState, false
+	}
+
+	return state, true
+}
+
+// write saves the state file to the output directory.
+func (s *runState) write(outputDir string, mode os.FileMode) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(outputDir, stateFileName), data, mode)
+}
+
+// completedSince returns the state of the zone if it was completed after the given time.
+func (s *runState) completedSince(zoneID string, since time.Time) (*zoneState, bool) {
+	zone, ok := s.Zones[zoneID]
+	if !ok || zone.Manifest == nil || zone.FinishedAt.Before(since) {
+		return nil, false
+	}
+	return zone, true
+}
+
+// manifestContentHash hashes the hashes of a zone's files, to give a single value that changes if any of them do.
+func manifestContentHash(zone *manifestZone) string {
+	hashes := []string{}
+	for _, file := range zone.Files {
+		hashes = append(hashes, file.Path+":"+file.SHA256)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(hashes, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestOptionsFingerprint(t *testing.T) {
+	fingerprint := func(args ...string) string {
+		opts := &options{}
+		flags := flag.NewFlagSet("cloudflare-backup", flag.ContinueOnError)
+		opts.registerFlags(flags)
+		err := flags.Parse(append([]string{"-api-token", "test-token"}, args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = opts.validate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return optionsFingerprint(opts, nil)
+	}
+
+	base := fingerprint()
+	for _, args := range [][]string{
+		{"-format", "json"},
+		{"-compress", "gzip"},
+		{"-text-record-flags"},
+		{"-time-zone", "Local"},
+		{"-time-format", "2006-01-02 15:04"},
+	} {
+		if fingerprint(args...) == base {
+			t.Errorf("%v doesn't change the fingerprint, so a run could be resumed with it changed", args)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// DNS zone backup for dnscontrol.example, for dnscontrol
+// Format version: 1
+// Backup taken at: 2026-01-02T03:04:05Z
+
+var REG_NONE = NewRegistrar("none");
+var DSP_CLOUDFLARE = NewDnsProvider("cloudflare");
+
+D("dnscontrol.example", REG_NONE, DnsProvider(DSP_CLOUDFLARE), DefaultTTL(1),
+	CNAME("@", "target.example.net.", CF_PROXY_ON),
+	A("unproxied", "203.0.113.10", CF_PROXY_OFF),
+	A("private", "10.0.0.1", TTL(600)),
+	AAAA("deep.sub", "2001:db8::10", CF_PROXY_ON),
+	CNAME("*", "dnscontrol.example.", CF_PROXY_OFF, TTL(300)),
+	MX("@", 0, ".", TTL(3600)),
+	TXT("@", "say \"hi\" with a \\ backslash"),
+	TXT("dkim._domainkey", ["v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAwvX", "kH1I9aQIDAQAB"]),
+	TXT("unicode", "héllo </script> & wörld"),
+	SRV("_xmpp._tcp", 5, 0, 5222, "xmpp.dnscontrol.example."),
+	CAA("@", "issuewild", ";", CAA_CRITICAL),
+	CAA("@", "iodef", "mailto:security@dnscontrol.example"),
+	// dnscontrol's helpers can't write NS records, so it's kept here as an API request body: {"type":"NS","name":"delegated.dnscontrol.example","content":"ns1.elsewhere.example","proxied":false,"ttl":86400}
+END);
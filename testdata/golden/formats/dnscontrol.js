@@ -0,0 +1,33 @@
+// DNS zone backup for example.com, for dnscontrol
+// Format version: 1
+// Backup taken at: 2026-01-02T03:04:05Z
+
+var REG_NONE = NewRegistrar("none");
+var DSP_CLOUDFLARE = NewDnsProvider("cloudflare");
+
+D("example.com", REG_NONE, DnsProvider(DSP_CLOUDFLARE), DefaultTTL(1),
+	A("@", "192.0.2.1", CF_PROXY_ON),
+	AAAA("@", "2001:db8::1", CF_PROXY_ON),
+	CNAME("www", "example.com.", CF_PROXY_ON),
+	MX("@", 10, "mx1.example.com.", TTL(3600)),
+	MX("@", 20, "mx2.example.com.", TTL(3600)),
+	TXT("@", "v=spf1 include:_spf.example.com ~all", TTL(300)),
+	TXT("_dmarc", "v=DMARC1; p=none; rua=mailto:dmarc@example.com", TTL(172800)),
+	TXT("quoted", ["one", "two"]),
+	// dnscontrol's helpers can't write NS records, so it's kept here as an API request body: {"type":"NS","name":"sub.example.com","content":"ns1.other.example","proxied":false,"ttl":86400}
+	SRV("_sip._tcp", 10, 5, 5060, "sip.example.com.", TTL(3600)),
+	CAA("@", "issue", "letsencrypt.org", TTL(3600)),
+	// dnscontrol's helpers can't write PTR records, so it's kept here as an API request body: {"type":"PTR","name":"1.2.0.192.example.com","content":"host.example.com","proxied":false,"ttl":3600}
+	// dnscontrol's helpers can't write LOC records, so it's kept here as an API request body: {"type":"LOC","name":"office.example.com","content":"51 30 12.748 N 0 7 39.611 W 0.00m 0.00m 0.00m 0.00m","proxied":false,"ttl":3600,"data":{"lat_degrees":51,"lat_minutes":30,"lat_seconds":12.748,"lat_direction":"N","long_degrees":0,"long_minutes":7,"long_seconds":39.611,"long_direction":"W","altitude":0,"size":0,"precision_horz":0,"precision_vert":0}}
+	// dnscontrol's helpers can't write SSHFP records, so it's kept here as an API request body: {"type":"SSHFP","name":"host.example.com","content":"4 2 123456789abcdef67890123456789abcdef67890123456789abcdef123456789","proxied":false,"ttl":3600,"data":{"algorithm":4,"type":2,"fingerprint":"123456789abcdef67890123456789abcdef67890123456789abcdef123456789"}}
+	// dnscontrol's helpers can't write TLSA records, so it's kept here as an API request body: {"type":"TLSA","name":"_443._tcp.example.com","content":"3 1 1 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef","proxied":false,"ttl":3600,"data":{"usage":3,"selector":1,"matching_type":1,"certificate":"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}}
+	// dnscontrol's helpers can't write DS records, so it's kept here as an API request body: {"type":"DS","name":"sub.example.com","content":"2371 13 2 1f987cc6583e92df0890718c42","proxied":false,"ttl":3600,"data":{"key_tag":2371,"algorithm":13,"digest_type":2,"digest":"1f987cc6583e92df0890718c42"}}
+	// dnscontrol's helpers can't write NAPTR records, so it's kept here as an API request body: {"type":"NAPTR","name":"sip.example.com","content":"100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.example.com.","proxied":false,"ttl":3600,"data":{"order":100,"preference":10,"flags":"S","service":"SIP+D2U","regex":"","replacement":"_sip._udp.example.com."}}
+	// dnscontrol's helpers can't write URI records, so it's kept here as an API request body: {"type":"URI","name":"_ftp._tcp.example.com","content":"1 \"ftp://ftp.example.com/public\"","proxied":false,"ttl":3600,"priority":10,"data":{"weight":1,"target":"ftp://ftp.example.com/public"}}
+	// dnscontrol's helpers can't write HTTPS records, so it's kept here as an API request body: {"type":"HTTPS","name":"example.com","content":"1 . alpn=\"h3,h2\"","proxied":false,"ttl":300,"data":{"priority":1,"target":".","value":"alpn=\"h3,h2\""}}
+	// dnscontrol's helpers can't write SVCB records, so it's kept here as an API request body: {"type":"SVCB","name":"_dns.example.com","content":"1 dns.example.com. alpn=\"dot\"","proxied":false,"ttl":300,"data":{"priority":1,"target":"dns.example.com.","value":"alpn=\"dot\""}}
+	// dnscontrol's helpers can't write CERT records, so it's kept here as an API request body: {"type":"CERT","name":"cert.example.com","content":"1 0 0 MIIBIjANBgkqhkiG9w0BAQEFAAOC","proxied":false,"ttl":3600,"data":{"type":1,"key_tag":0,"algorithm":0,"certificate":"MIIBIjANBgkqhkiG9w0BAQEFAAOC"}}
+	// dnscontrol's helpers can't write DNSKEY records, so it's kept here as an API request body: {"type":"DNSKEY","name":"sub.example.com","content":"257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0d","proxied":false,"ttl":3600,"data":{"flags":257,"protocol":3,"algorithm":13,"public_key":"mdsswUyr3DPW132mOi8V9xESWE8jTo0d"}}
+	// dnscontrol's helpers can't write SMIMEA records, so it's kept here as an API request body: {"type":"SMIMEA","name":"c93f1e400f26708f98cb19d936620da35eec8f72e57f9eec01c1afd6._smimecert.example.com","content":"3 0 0 3082","proxied":false,"ttl":3600,"data":{"usage":3,"selector":0,"matching_type":0,"certificate":"3082"}}
+	A("locked", "198.51.100.7", CF_PROXY_OFF, TTL(120)),
+END);
@@ -0,0 +1,20 @@
+// DNS zone backup for managed.example, for dnscontrol
+// Format version: 1
+// Backup taken at: 2026-01-02T03:04:05Z
+
+var REG_NONE = NewRegistrar("none");
+var DSP_CLOUDFLARE = NewDnsProvider("cloudflare");
+
+D("managed.example", REG_NONE, DnsProvider(DSP_CLOUDFLARE), DefaultTTL(1),
+	A("@", "192.0.2.10", CF_PROXY_ON),
+	CNAME("www", "managed.example.", CF_PROXY_ON),
+	// managed-by: email_routing, so it's kept here as an API request body: {"type":"MX","name":"managed.example","content":"route1.mx.cloudflare.net","proxied":false,"ttl":1,"priority":13}
+	// managed-by: email_routing, so it's kept here as an API request body: {"type":"MX","name":"managed.example","content":"route2.mx.cloudflare.net","proxied":false,"ttl":1,"priority":86}
+	// managed-by: email_routing, so it's kept here as an API request body: {"type":"MX","name":"managed.example","content":"route3.mx.cloudflare.net","proxied":false,"ttl":1,"priority":24}
+	// managed-by: email_routing, so it's kept here as an API request body: {"type":"TXT","name":"managed.example","content":"v=spf1 include:_spf.mx.cloudflare.net ~all","proxied":false,"ttl":1}
+	// managed-by: email_routing, so it's kept here as an API request body: {"type":"TXT","name":"cf2024-1._domainkey.managed.example","content":"v=DKIM1; h=sha256; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAiweykoi","proxied":false,"ttl":1}
+	TXT("@", "google-site-verification=abc123", TTL(3600)),
+	MX("lists", 10, "mx.lists-provider.example.", TTL(3600)),
+	// managed-by: argo_tunnel, so it's kept here as an API request body: {"type":"CNAME","name":"tunnel.managed.example","content":"6ff42ae2-765d-4adf-8112-31c55c1551ef.cfargotunnel.com","proxied":true,"ttl":1}
+	// managed-by: apps, so it's kept here as an API request body: {"type":"A","name":"shop.managed.example","content":"203.0.113.50","proxied":true,"ttl":1}
+END);
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// slowestShown is how many of the slowest collectors and zones the summary lists.
+const slowestShown = 5
+
+// collectorTiming is how long a collector took for a zone. DurationSeconds is the wall-clock time, which is split into
+// the time spent waiting for -rate-limit or a pause after a 429, the time spent waiting to retry, and the rest, which
+// is nearly all waiting on the API. Requests only counts the requests that reached the API.
+type collectorTiming struct {
+	Name                 string  `json:"name"`
+	DurationSeconds      float64 `json:"duration_seconds"`
+	APISeconds           float64 `json:"api_seconds"`
+	RateLimitWaitSeconds float64 `json:"rate_limit_wait_seconds"`
+	BackoffSeconds       float64 `json:"backoff_seconds"`
+	Requests             int     `json:"api_requests_sent"`
+
+	// Zones is how many zones the timing covers, when it's the total for a collector across the run
+	Zones int `json:"zones,omitempty"`
+}
+
+// startCollectorTiming starts timing a collector, and returns a function that stops it and returns the timing.
+func (b *backupRun) startCollectorTiming(name string) func() collectorTiming {
+	start := time.Now()
+	requestsBefore := b.accounting.requestsSent()
+	rateLimitBefore, backoffBefore := b.accounting.waited()
+
+	return func() collectorTiming {
+		rateLimitWait, backoff := b.accounting.waited()
+		timing := collectorTiming{
+			Name:                 name,
+			DurationSeconds:      time.Since(start).Seconds(),
+			RateLimitWaitSeconds: rateLimitWait - rateLimitBefore,
+			BackoffSeconds:       backoff - backoffBefore,
+			Requests:             b.accounting.requestsSent() - requestsBefore,
+		}
+
+		// requests for other zones don't overlap with this one, so the waits can't add up to more than the duration,
+		// but backoffs are counted when they start, so the last one might not have finished yet
+		timing.APISeconds = timing.DurationSeconds - timing.RateLimitWaitSeconds - timing.BackoffSeconds
+		if timing.APISeconds < 0 {
+			timing.APISeconds = 0
+		}
+		return timing
+	}
+}
+
+// CollectorTotals adds up each collector's timings across every zone, with the slowest first.
+func (r *RunReport) CollectorTotals() []collectorTiming {
+	totals := []collectorTiming{}
+	indexes := map[string]int{}
+	for _, zone := range r.Zones {
+		for _, timing := range zone.Collectors {
+			i, ok := indexes[timing.Name]
+			if !ok {
+				i = len(totals)
+				indexes[timing.Name] = i
+				totals = append(totals, collectorTiming{Name: timing.Name})
+			}
+			totals[i].DurationSeconds += timing.DurationSeconds
+			totals[i].APISeconds += timing.APISeconds
+			totals[i].RateLimitWaitSeconds += timing.RateLimitWaitSeconds
+			totals[i].BackoffSeconds += timing.BackoffSeconds
+			totals[i].Requests += timing.Requests
+			totals[i].Zones++
+		}
+	}
+	sort.SliceStable(totals, func(i, j int) bool {
+		return totals[i].DurationSeconds > totals[j].DurationSeconds
+	})
+	return totals
+}
+
+// SlowestZones returns the zones that took the longest, with the slowest first. Zones that were already backed up by a
+// previous run aren't included, since they took no time.
+func (r *RunReport) SlowestZones() []*ZoneReport {
+	zones := []*ZoneReport{}
+	for _, zone := range r.Zones {
+		if !zone.Resumed {
+			zones = append(zones, zone)
+		}
+	}
+	sort.SliceStable(zones, func(i, j int) bool {
+		return zones[i].DurationSeconds > zones[j].DurationSeconds
+	})
+	return zones
+}
+
+// slowestCollector returns the collector that took the longest for the zone, if any ran.
+func (z *ZoneReport) slowestCollector() (collectorTiming, bool) {
+	slowest := collectorTiming{}
+	for _, timing := range z.Collectors {
+		if timing.DurationSeconds > slowest.DurationSeconds {
+			slowest = timing
+		}
+	}
+	return slowest, slowest.Name != ""
+}
+
+// printSlowest logs the collectors and zones that took the longest, so that it's clear where a slow run's time went.
+func (r *RunReport) printSlowest() {
+	totals := r.CollectorTotals()
+	if len(totals) == 0 {
+		return
+	}
+	if len(totals) > slowestShown {
+		totals = totals[:slowestShown]
+	}
+	log.Printf("Slowest collectors:")
+	for _, total := range totals {
+		log.Printf(
+			"  %s: %.1fs in %d zone(s), %d API requests, %.1fs waiting on the API, %.1fs on the rate limit, %.1fs backing off",
+			total.Name, total.DurationSeconds, total.Zones, total.Requests, total.APISeconds, total.RateLimitWaitSeconds, total.BackoffSeconds,
+		)
+	}
+
+	zones := r.SlowestZones()
+	if len(zones) > slowestShown {
+		zones = zones[:slowestShown]
+	}
+	log.Printf("Slowest zones:")
+	for _, zone := range zones {
+		slowest := ""
+		if timing, ok := zone.slowestCollector(); ok {
+			slowest = fmt.Sprintf(", slowest collector %s (%.1fs)", timing.Name, timing.DurationSeconds)
+		}
+		log.Printf("  %s: %.1fs, %d API requests%s", zone.Name, zone.DurationSeconds, zone.APIRequestsSent, slowest)
+	}
+}
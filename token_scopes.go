@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+func init() {
+	registerSubcommand("token-scopes", subcommand{
+		Description: "List the API token permissions that a backup needs, or create a token with them",
+		RegisterFlags: func(flags *flag.FlagSet) {
+			(&tokenScopesOptions{}).registerFlags(flags)
+		},
+		Run: runTokenScopes,
+	})
+}
+
+// tokenScopesOptions holds the configuration for the token-scopes subcommand.
+type tokenScopesOptions struct {
+	apiCredentials
+
+	APIBaseURL              string
+	Resources               string
+	IncludeAccountResources bool
+	AccountID               string
+	Create                  bool
+	TokenName               string
+}
+
+func (o *tokenScopesOptions) registerFlags(flags *flag.FlagSet) {
+	o.apiCredentials.registerFlags(flags, "With -create, the CloudFlare API token to create the new token with. It needs permission to create API tokens.")
+	flags.StringVar(&o.APIBaseURL, "api-base-url", cloudflare.DefaultBaseURL, "The base URL of the CloudFlare API, if you need to go through a proxy or gateway.")
+	flags.StringVar(&o.Resources, "resources", defaultResources(), "The resources that the backup will use, as given to its -resources flag.")
+	flags.BoolVar(&o.IncludeAccountResources, "include-account-resources", false, "If set, include the account-level resources that the backup's -include-account-resources flag selects.")
+	flags.StringVar(&o.AccountID, "account-id", "", "If set, the account that the backup will use, as given to its -account-id flag. With -create, the token is limited to this account.")
+	flags.BoolVar(&o.Create, "create", false, "If set, create a read-only API token with exactly these permissions, and print it.")
+	flags.StringVar(&o.TokenName, "token-name", "cloudflare-backup (read-only)", "With -create, the name to give the new token.")
+}
+
+func (o *tokenScopesOptions) validate() error {
+	if !o.Create {
+		return nil
+	}
+
+	err := o.apiCredentials.resolve()
+	if err != nil {
+		return err
+	}
+	if o.apiCredentials.empty() {
+		return errNoCredentials
+	}
+	if strings.TrimSpace(o.TokenName) == "" {
+		return errors.New("The -token-name flag can't be empty.")
+	}
+
+	baseURL, err := url.Parse(o.APIBaseURL)
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+		return errors.New("The -api-base-url flag must be an absolute http or https URL.")
+	}
+	return nil
+}
+
+// runTokenScopes is the token-scopes subcommand, which works out the permissions that a backup of the selected
+// resources needs from the collectors themselves, so that the list can't fall behind them.
+func runTokenScopes(args []string) error {
+	opts := tokenScopesOptions{}
+	flags := flag.NewFlagSet("token-scopes", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cloudflare-backup token-scopes [-resources dns,pagerules] [-create] [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Lists the permissions that an API token needs to back up the given resources. With -create, creates a token with exactly those permissions.\n\n")
+		flags.PrintDefaults()
+	}
+	opts.registerFlags(flags)
+	flags.Parse(args)
+
+	err := opts.validate()
+	if err != nil {
+		return err
+	}
+
+	selected, selectedAccount, err := selectCollectors(opts.Resources, opts.IncludeAccountResources, opts.AccountID)
+	if err != nil {
+		return err
+	}
+	permissions, users := neededPermissions(selected, selectedAccount)
+
+	reasons := map[tokenPermission][]string{}
+	for _, base := range basePermissions {
+		reasons[base.Permission] = []string{base.Reason}
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, permission := range permissions {
+		fmt.Fprintf(table, "%s\t%s\n", permission.Label, strings.Join(append(reasons[permission], users[permission]...), ", "))
+	}
+	err = table.Flush()
+	if err != nil {
+		return err
+	}
+
+	if !opts.Create {
+		return nil
+	}
+
+	ctx := context.Background()
+	client := opts.apiCredentials.newClient()
+	client.BaseURL = opts.APIBaseURL
+	client.UserAgent = "cloudflare-backup/" + version + " (+" + repoURL + ")"
+
+	policies, err := tokenPolicies(ctx, client, permissions, opts.AccountID)
+	if err != nil {
+		return err
+	}
+	token, err := client.CreateToken(ctx, opts.TokenName, policies)
+	if err != nil {
+		return fmt.Errorf("Couldn't create the token: %w", err)
+	}
+
+	log.Printf("Created the token %q (ID %s). This is the only time that it's shown, so save it now:", token.Name, token.ID)
+	fmt.Println(token.Value)
+	return nil
+}
+
+// tokenPolicies looks up the permission groups for the given permissions, and returns the policies that give them to
+// a token: one for every zone, and one for every account, unless the token is limited to a single account.
+func tokenPolicies(ctx context.Context, client *cloudflare.Client, permissions []tokenPermission, accountID string) ([]cloudflare.TokenPolicy, error) {
+	groups, err := client.ListPermissionGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't list the permission groups: %w", err)
+	}
+	groupsByName := map[string]cloudflare.PermissionGroup{}
+	for _, group := range groups {
+		groupsByName[group.Name] = group
+	}
+
+	zoneGroups := []cloudflare.PermissionGroup{}
+	accountGroups := []cloudflare.PermissionGroup{}
+	missing := []string{}
+	for _, permission := range permissions {
+		group, ok := groupsByName[permission.Group]
+		switch {
+		case !ok:
+			missing = append(missing, permission.Group)
+		case permission.Account:
+			accountGroups = append(accountGroups, group)
+		default:
+			zoneGroups = append(zoneGroups, group)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("Cloudflare doesn't have the permission group(s) %s, so the token wasn't created. Create it in the dashboard instead, with the permissions listed above.", strings.Join(missing, ", "))
+	}
+
+	zones := map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"}
+	accounts := map[string]interface{}{"com.cloudflare.api.account.*": "*"}
+	if accountID != "" {
+		zones = map[string]interface{}{"com.cloudflare.api.account." + accountID: map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"}}
+		accounts = map[string]interface{}{"com.cloudflare.api.account." + accountID: "*"}
+	}
+
+	policies := []cloudflare.TokenPolicy{{Effect: "allow", Resources: zones, PermissionGroups: zoneGroups}}
+	if len(accountGroups) > 0 {
+		policies = append(policies, cloudflare.TokenPolicy{Effect: "allow", Resources: accounts, PermissionGroups: accountGroups})
+	}
+	return policies, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// tombstonesFileName is the name of the file in the output directory that keeps the records removed from each zone.
+const tombstonesFileName = "deleted-records.ndjson"
+
+// tombstone is a record that drift detection found was removed from a zone, with everything needed to create it
+// again. The times use changelogTimeFormat. FirstSeen is the run that the changelog says added the record, and is empty
+// if the record is older than the changelog. LastSeen is the backup that still had the record, and DeletedAt is the run
+// that found it gone. Filter is the filter that that run was made with, if it was filtered.
+type tombstone struct {
+	Zone      string               `json:"zone"`
+	ZoneID    string               `json:"zone_id"`
+	DeletedAt string               `json:"deleted_at"`
+	FirstSeen string               `json:"first_seen,omitempty"`
+	LastSeen  string               `json:"last_seen"`
+	Filter    string               `json:"filter,omitempty"`
+	Record    cloudflare.DNSRecord `json:"record"`
+}
+
+// addTombstones records the removed records from a zone's changes. lastSeen is when the previous backup was written.
+func (b *backupRun) addTombstones(zone cloudflare.Zone, changes []recordChange, lastSeen time.Time) {
+	for _, change := range changes {
+		if change.Kind != "-" {
+			continue
+		}
+		b.tombstones = append(b.tombstones, tombstone{
+			Zone:      zone.Name,
+			ZoneID:    zone.ID,
+			DeletedAt: b.changelogTime(),
+			LastSeen:  lastSeen.UTC().Format(changelogTimeFormat),
+			Filter:    b.options.recordFilter.String(),
+			Record:    *change.Old,
+		})
+	}
+}
+
+// writeTombstones adds the records removed in this run to the tombstone file, and removes any tombstones older than
+// -tombstone-max-age. The file is replaced atomically, like the changelog.
+func (b *backupRun) writeTombstones() error {
+	if len(b.tombstones) == 0 && b.options.TombstoneMaxAge == 0 {
+		return nil
+	}
+
+	path := filepath.Join(b.options.OutputDir, tombstonesFileName)
+	existing, err := readTombstones(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	kept := []tombstone{}
+	for _, entry := range existing {
+		deletedAt, err := time.Parse(changelogTimeFormat, entry.DeletedAt)
+		if err == nil && b.options.TombstoneMaxAge > 0 && b.report.Start.Sub(deletedAt) > b.options.TombstoneMaxAge {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	pruned := len(existing) - len(kept)
+	if pruned == 0 && len(b.tombstones) == 0 {
+		return nil
+	}
+
+	history, err := readChangelog(filepath.Join(b.options.OutputDir, changelogJSONFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := range b.tombstones {
+		entry := &b.tombstones[i]
+		seen, full := recordHistory(history, entry.Zone, entry.Record, b.format.recordKey())
+		entry.FirstSeen = seen
+		if full != nil && !b.format.KeepsRecordData {
+			// the changelog has every field of the record, which the backup's format didn't keep
+			entry.Record = *full
+		}
+
+		missing := missingRecordFields(entry.Record)
+		if len(missing) > 0 {
+			b.report.AddWarning(
+				"the %s format doesn't keep the %s of %s, so it can't be restored from its tombstone in %s",
+				b.options.Format, strings.Join(missing, " or "), describeImportRecord(entry.Record), tombstonesFileName,
+			)
+		}
+	}
+
+	data := []byte{}
+	for _, entry := range append(kept, b.tombstones...) {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	if pruned > 0 {
+		b.debugf("removed %d tombstone(s) older than %s", pruned, b.options.TombstoneMaxAge)
+	}
+	return writeFileAtomic(path, data, os.FileMode(b.options.FileMode))
+}
+
+// recordHistory finds the last time that the changelog says the record was added or changed into its current form,
+// and the record as the API returned it then, if it's there. The record was read from the previous backup, so it's
+// compared with recordKey, which only compares what its format kept.
+func recordHistory(history []zoneChanges, zoneName string, record cloudflare.DNSRecord, recordKey func(cloudflare.DNSRecord) string) (string, *cloudflare.DNSRecord) {
+	key := recordKey(record)
+	seen := ""
+	var full *cloudflare.DNSRecord
+	for _, zone := range history {
+		if normalizeName(zone.Zone) != normalizeName(zoneName) {
+			continue
+		}
+		for _, change := range zone.Changes {
+			if change.New != nil && recordKey(*change.New) == key {
+				seen = zone.Time
+				full = change.New
+			}
+		}
+	}
+	return seen, full
+}
+
+// missingRecordFields returns the fields that a record needs to be created again, but doesn't have, because it was
+// read from a format that doesn't keep them, like text. MX, SRV, and URI records need their priority, and records
+// like SRV and CAA need their data.
+func missingRecordFields(record cloudflare.DNSRecord) []string {
+	missing := []string{}
+	switch strings.ToUpper(record.Type) {
+	case "MX", "SRV", "URI":
+		if record.Priority == nil {
+			missing = append(missing, "priority")
+		}
+	}
+	switch strings.ToUpper(record.Type) {
+	case "CAA", "CERT", "DNSKEY", "DS", "HTTPS", "LOC", "NAPTR", "SMIMEA", "SRV", "SSHFP", "SVCB", "TLSA", "URI":
+		if len(record.Data) == 0 {
+			missing = append(missing, "data")
+		}
+	}
+	return missing
+}
+
+// readTombstones reads every tombstone in the given file.
+func readTombstones(path string) ([]tombstone, error) {
+	tombstones := []tombstone{}
+	err := readNDJSON(path, func(line []byte) error {
+		entry := tombstone{}
+		err := json.Unmarshal(line, &entry)
+		tombstones = append(tombstones, entry)
+		return err
+	})
+	return tombstones, err
+}
+
+// readChangelog reads every entry in changelog.ndjson.
+func readChangelog(path string) ([]zoneChanges, error) {
+	history := []zoneChanges{}
+	err := readNDJSON(path, func(line []byte) error {
+		entry := zoneChanges{}
+		err := json.Unmarshal(line, &entry)
+		history = append(history, entry)
+		return err
+	})
+	return history, err
+}
+
+// readNDJSON calls handle with each line of a file with one JSON value per line, skipping blank lines.
+func readNDJSON(path string, handle func(line []byte) error) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		err = handle(line)
+		if err != nil {
+			return fmt.Errorf("%s: line %d: %w", filepath.Base(path), i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// failFirst answers the first n requests that match pattern with a 503, and the rest as usual.
+func failFirst(api *fakeAPI, pattern string, n int) {
+	mu := sync.Mutex{}
+	failed := 0
+	api.handle(pattern, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failed < n
+		failed++
+		mu.Unlock()
+
+		if fail {
+			writeFakeError(w, http.StatusServiceUnavailable, 10001, "Service unavailable")
+			return
+		}
+
+		api.serveDefault(w, r)
+	})
+}
+
+// truncateFirst answers the first request that matches pattern as usual, but closes the connection halfway through
+// the response's body, and the rest as usual.
+func truncateFirst(t *testing.T, api *fakeAPI, pattern string) {
+	mu := sync.Mutex{}
+	truncated := false
+	api.handle(pattern, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		truncate := !truncated
+		truncated = true
+		mu.Unlock()
+
+		if !truncate {
+			api.serveDefault(w, r)
+			return
+		}
+
+		recorder := httptest.NewRecorder()
+		api.serveDefault(recorder, r)
+		body := recorder.Body.Bytes()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(recorder.Code)
+		w.Write(body[:len(body)/2])
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	})
+}
+
+func TestRetriesAreCounted(t *testing.T) {
+	// retries come before OnRequest and the accounting transport in the chain, so each attempt is counted, as well as
+	// the retry itself
+	api := newFakeAPI(t, "empty")
+	failFirst(api, "zones/*/dns_records", 1)
+	metricsFile := filepath.Join(t.TempDir(), "cloudflare-backup.prom")
+	run := newTestBackup(t, api, "-resources", "dns", "-metrics-file", metricsFile)
+	report := run.run(context.Background())
+	if report.Failed() {
+		t.Fatalf("backup failed: %s", strings.Join(report.Errors, "; "))
+	}
+
+	if report.Retries != 1 {
+		t.Errorf("got %d retries, want 1", report.Retries)
+	}
+	if report.APIRequestsByStatus["503"] != 1 {
+		t.Errorf("got %d requests with a 503, want 1", report.APIRequestsByStatus["503"])
+	}
+	if sent := run.accounting.requestsSent(); sent != len(api.requests) {
+		t.Errorf("counted %d requests sent, but the API got %d", sent, len(api.requests))
+	}
+
+	metrics, err := ioutil.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(metrics), "cloudflare_backup_api_requests_total{status=\"503\"} 1\n") {
+		t.Errorf("the metrics don't count the failed attempt:\n%s", metrics)
+	}
+}
+
+func TestCachedResponsesAreNotRetried(t *testing.T) {
+	api := newFakeAPI(t, "all-types")
+	dir := runTestBackup(t, api, "-resources", "dns")
+	requested := api.requested("zones/*/dns_records")
+
+	// the zone hasn't changed, so the second run uses the cached pages without asking the API, which would fail
+	api.handle("zones/*/dns_records", func(w http.ResponseWriter, r *http.Request) {
+		writeFakeError(w, http.StatusServiceUnavailable, 10001, "Service unavailable")
+	})
+	run := newTestBackup(t, api, "-resources", "dns", "-output", dir)
+	report := run.run(context.Background())
+	if report.Failed() {
+		t.Fatalf("backup failed: %s", strings.Join(report.Errors, "; "))
+	}
+
+	if report.CacheHits != requested {
+		t.Errorf("got %d cache hits, want %d", report.CacheHits, requested)
+	}
+	if report.Retries != 0 || api.requested("zones/*/dns_records") != requested {
+		t.Errorf("cached responses were retried %d times, with %d requests", report.Retries, api.requested("zones/*/dns_records")-requested)
+	}
+	if report.Zones[0].Records != 24 {
+		t.Errorf("got %d records from the cache, want 24", report.Zones[0].Records)
+	}
+}
+
+func TestTruncatedResponsesAreRetried(t *testing.T) {
+	// the broken page goes through the cache, which mustn't keep it, and is fetched again rather than failing the zone
+	api := newFakeAPI(t, "all-types")
+	truncateFirst(t, api, "zones/*/dns_records")
+	dir := t.TempDir()
+	run := newTestBackup(t, api, "-output", dir)
+	report := run.run(context.Background())
+	if report.Failed() {
+		t.Fatalf("backup failed: %s", strings.Join(report.Errors, "; "))
+	}
+	if report.Retries != 1 || report.Zones[0].Records != 24 {
+		t.Errorf("got %d records with %d retries, want 24 with 1", report.Zones[0].Records, report.Retries)
+	}
+	checkGoldenFile(t, dir, "example.com.txt", "backup/all-types.txt")
+
+	// only the complete pages were cached, so the next run gets all of the records from it
+	api.handle("zones/*/dns_records", func(w http.ResponseWriter, r *http.Request) {
+		writeFakeError(w, http.StatusServiceUnavailable, 10001, "Service unavailable")
+	})
+	report = newTestBackup(t, api, "-output", dir).run(context.Background())
+	if report.Failed() || report.Zones[0].Records != 24 {
+		t.Errorf("got %d records from the cache, want 24: %s", report.Zones[0].Records, strings.Join(report.Errors, "; "))
+	}
+}
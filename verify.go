@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	registerSubcommand("verify", subcommand{
+		Description: "Check a backup's files against its manifest, and the manifest's signature",
+		RegisterFlags: func(flags *flag.FlagSet) {
+			(&verifyOptions{}).registerFlags(flags)
+		},
+		Run: runVerify,
+	})
+}
+
+// verifyOptions holds the configuration for the verify subcommand.
+type verifyOptions struct {
+	Dir       string
+	VerifyKey string
+}
+
+func (o *verifyOptions) registerFlags(flags *flag.FlagSet) {
+	flags.StringVar(&o.Dir, "dir", "output", "The backup to check, which is the -output directory that it was written to.")
+	flags.StringVar(&o.VerifyKey, "verify-key", "", "If set, the ed25519 public key that the manifest must have been signed with by -sign-key, like the .pub file from ssh-keygen.")
+}
+
+// runVerify is the verify subcommand, which checks that a backup's files haven't changed since it was written. With
+// -verify-key, the manifest's signature is checked first, since the hashes in it can't be trusted otherwise.
+func runVerify(args []string) error {
+	opts := verifyOptions{}
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cloudflare-backup verify -dir output [-verify-key key.pub]\n\n")
+		fmt.Fprintf(flags.Output(), "Checks that every file listed in a backup's %s has the size and SHA-256 hash that it had when the backup was written, and that the manifest was signed with the given key.\n\n", manifestFileName)
+		flags.PrintDefaults()
+	}
+	opts.registerFlags(flags)
+	flags.Parse(args)
+
+	if opts.VerifyKey != "" {
+		key, err := loadVerifyKey(opts.VerifyKey)
+		if err != nil {
+			return err
+		}
+		err = verifyManifestSignature(opts.Dir, key)
+		if err != nil {
+			return fmt.Errorf("Couldn't verify the backup: %w.", err)
+		}
+		log.Printf("The manifest was signed with the key %s.", keyFingerprint(key))
+	} else if _, err := os.Stat(filepath.Join(opts.Dir, manifestSignatureFileName)); err == nil {
+		log.Printf("Warning: the backup is signed, but the signature wasn't checked, since -verify-key wasn't given.")
+	}
+
+	m, err := readManifest(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("Couldn't read the manifest: %w", err)
+	}
+
+	files := m.allFiles()
+	problems := 0
+	for _, file := range files {
+		problem := checkManifestFile(opts.Dir, file)
+		if problem != "" {
+			log.Printf("%s %s.", file.Path, problem)
+			problems++
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d of the %d file(s) in the manifest don't match it.", problems, len(files))
+	}
+	log.Printf("All %d file(s) in the manifest match it.", len(files))
+	return nil
+}
+
+// checkManifestFile compares a file in the backup to its entry in the manifest, returning what's wrong with it, or ""
+// if nothing is.
+func checkManifestFile(dir string, file manifestFile) string {
+	actual, err := newManifestFile(dir, filepath.Join(dir, filepath.FromSlash(file.Path)))
+	if errors.Is(err, os.ErrNotExist) {
+		return "is missing"
+	}
+	if err != nil {
+		return "couldn't be read: " + err.Error()
+	}
+	if actual.Size != file.Size {
+		return fmt.Sprintf("is %d bytes, but was %d bytes when the backup was written", actual.Size, file.Size)
+	}
+	if actual.SHA256 != file.SHA256 {
+		return "has changed since the backup was written"
+	}
+
+	if file.UncompressedSize > 0 {
+		// the hash only covers the compressed file, so this makes sure that it can still be decompressed
+		data, err := readBackupFile(filepath.Join(dir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return "can't be decompressed: " + err.Error()
+		}
+		if int64(len(data)) != file.UncompressedSize {
+			return fmt.Sprintf("decompresses to %d bytes, but was %d bytes when the backup was written", len(data), file.UncompressedSize)
+		}
+	}
+	return ""
+}
+
+// readManifest reads the manifest of the backup in the given directory.
+func readManifest(dir string) (manifest, error) {
+	m := manifest{}
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return m, jsonParseError(data, err)
+	}
+	return m, nil
+}
+
+// allFiles returns every file that the manifest lists, for the zones, the accounts, and the rest of the backup.
+func (m *manifest) allFiles() []manifestFile {
+	files := append([]manifestFile{}, m.Files...)
+	for _, zones := range [][]*manifestZone{m.Zones, m.Accounts} {
+		for _, zone := range zones {
+			files = append(files, zone.Files...)
+		}
+	}
+	return files
+}
+
+// checkBackupFile makes sure that a file that's about to be restored from matches its entry in the manifest of the
+// backup that it's in, so that nothing is restored from a file that's been changed since the backup was written. The
+// manifest is looked for next to the file, and then in each directory above it, since the dir layout puts files in a
+// directory for each zone. A file that isn't in a backup with a manifest, or isn't listed in it, is only warned about.
+func checkBackupFile(path string) error {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(absolute)
+	for {
+		_, err = os.Stat(filepath.Join(dir, manifestFileName))
+		if err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			log.Printf("Warning: %s isn't in a backup with a %s, so it couldn't be checked for changes since it was written.", path, manifestFileName)
+			return nil
+		}
+		dir = parent
+	}
+
+	manifestPath := filepath.Join(dir, manifestFileName)
+	m, err := readManifest(dir)
+	if err != nil {
+		return fmt.Errorf("Couldn't read %s: %w", manifestPath, err)
+	}
+	relativePath, err := filepath.Rel(dir, absolute)
+	if err != nil {
+		return err
+	}
+	for _, file := range m.allFiles() {
+		if file.Path != filepath.ToSlash(relativePath) {
+			continue
+		}
+		problem := checkManifestFile(dir, file)
+		if problem != "" {
+			return fmt.Errorf("%s %s, according to %s, so nothing was restored from it.", path, problem, manifestPath)
+		}
+		return nil
+	}
+
+	log.Printf("Warning: %s isn't listed in %s, so it couldn't be checked for changes since it was written.", path, manifestPath)
+	return nil
+}
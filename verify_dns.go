@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// cloudflareEdgeRanges are the IP ranges that Cloudflare answers with for proxied records, from
+// https://www.cloudflare.com/ips/.
+var cloudflareEdgeRanges = []string{
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22", "141.101.64.0/18", "108.162.192.0/18",
+	"190.93.240.0/20", "188.114.96.0/20", "197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32", "2405:8100::/32", "2a06:98c0::/29",
+	"2c0f:f248::/32",
+}
+
+// isCloudflareEdgeIP returns true if the IP is in one of Cloudflare's published ranges.
+func isCloudflareEdgeIP(ip net.IP) bool {
+	for _, cidr := range cloudflareEdgeRanges {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsVerifier compares DNS records against what a resolver answers for them.
+type dnsVerifier struct {
+	resolver *net.Resolver
+	ticker   *time.Ticker
+}
+
+func newDNSVerifier(server string, rate float64) *dnsVerifier {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	dialer := net.Dialer{}
+	return &dnsVerifier{
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+				// ignore the system's resolver, and always ask the one we were given
+				return dialer.DialContext(ctx, network, server)
+			},
+		},
+		ticker: time.NewTicker(time.Duration(float64(time.Second) / rate)),
+	}
+}
+
+func (v *dnsVerifier) stop() {
+	v.ticker.Stop()
+}
+
+// verifiable returns true if the record's type is one that can be checked.
+func verifiable(record cloudflare.DNSRecord) bool {
+	if strings.HasPrefix(record.Name, "*") {
+		return false
+	}
+	switch strings.ToUpper(record.Type) {
+	case "A", "AAAA", "CNAME":
+		return true
+	case "MX", "TXT":
+		return !record.Proxied
+	}
+	return false
+}
+
+// sampleRecords picks the records to verify. If count is zero or less, every verifiable record is returned.
+func sampleRecords(records []cloudflare.DNSRecord, count int) []cloudflare.DNSRecord {
+	candidates := []cloudflare.DNSRecord{}
+	for _, record := range records {
+		if verifiable(record) {
+			candidates = append(candidates, record)
+		}
+	}
+
+	if count <= 0 || len(candidates) <= count {
+		return candidates
+	}
+
+	sample := []cloudflare.DNSRecord{}
+	for _, i := range rand.Perm(len(candidates))[:count] {
+		sample = append(sample, candidates[i])
+	}
+	return sample
+}
+
+// errDNSMismatch is returned by verify when the resolver's answer doesn't match the record.
+var errDNSMismatch = errors.New("mismatch")
+
+// verify looks up the record and compares the answer to it. It returns a description of the answer, and
+// errDNSMismatch if it doesn't match. Any other error means the record couldn't be checked.
+func (v *dnsVerifier) verify(ctx context.Context, record cloudflare.DNSRecord) (string, error) {
+	select {
+	case <-v.ticker.C:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	name := normalizeName(record.Name)
+
+	if record.Proxied {
+		// proxied records are answered with Cloudflare's own addresses, not the record's content
+		ips, err := v.resolver.LookupIP(ctx, "ip", name)
+		if err != nil {
+			return "", mapLookupError(err)
+		}
+		for _, ip := range ips {
+			if !isCloudflareEdgeIP(ip) {
+				return ip.String() + " (not a Cloudflare address)", errDNSMismatch
+			}
+		}
+		return joinIPs(ips), nil
+	}
+
+	switch strings.ToUpper(record.Type) {
+	case "A", "AAAA":
+		network := "ip4"
+		if strings.EqualFold(record.Type, "AAAA") {
+			network = "ip6"
+		}
+		ips, err := v.resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return "", mapLookupError(err)
+		}
+		expected := net.ParseIP(record.Content)
+		for _, ip := range ips {
+			if ip.Equal(expected) {
+				return joinIPs(ips), nil
+			}
+		}
+		return joinIPs(ips), errDNSMismatch
+
+	case "CNAME":
+		// LookupCNAME follows the whole chain, so compare where both ends of the record end up
+		canonical, err := v.resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return "", mapLookupError(err)
+		}
+		expected, err := v.resolver.LookupCNAME(ctx, normalizeName(record.Content))
+		if err != nil {
+			expected = record.Content
+		}
+		if normalizeName(canonical) != normalizeName(expected) {
+			return canonical, errDNSMismatch
+		}
+		return canonical, nil
+
+	case "MX":
+		mxs, err := v.resolver.LookupMX(ctx, name)
+		if err != nil {
+			return "", mapLookupError(err)
+		}
+		hosts := []string{}
+		for _, mx := range mxs {
+			if normalizeName(mx.Host) == normalizeName(record.Content) {
+				return mx.Host, nil
+			}
+			hosts = append(hosts, mx.Host)
+		}
+		return strings.Join(hosts, ", "), errDNSMismatch
+
+	case "TXT":
+		txts, err := v.resolver.LookupTXT(ctx, name)
+		if err != nil {
+			return "", mapLookupError(err)
+		}
+		expected := strings.Trim(record.Content, `"`)
+		for _, txt := range txts {
+			if txt == expected {
+				return txt, nil
+			}
+		}
+		return strings.Join(txts, ", "), errDNSMismatch
+	}
+
+	return "", errors.New("unsupported record type " + record.Type)
+}
+
+// mapLookupError turns a lookup error saying the name doesn't exist into a mismatch, since the record says it does.
+func mapLookupError(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return errDNSMismatch
+	}
+	return err
+}
+
+func joinIPs(ips []net.IP) string {
+	parts := []string{}
+	for _, ip := range ips {
+		parts = append(parts, ip.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// verifyDNS checks a sample of each zone's records (or all of them, with -verify-dns-all) against live DNS, and adds
+// a warning to the report for each mismatch.
+func (b *backupRun) verifyDNS(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, b.options.VerifyDNSTimeout)
+	defer cancel()
+
+	verifier := newDNSVerifier(b.options.VerifyDNSResolver, b.options.VerifyDNSRate)
+	defer verifier.stop()
+
+	sampleSize := b.options.VerifyDNSSample
+	if b.options.VerifyDNSAll {
+		sampleSize = 0
+	}
+
+	log.Printf("Verifying DNS records against %s...", b.options.VerifyDNSResolver)
+	for _, zone := range b.zoneRecords {
+		for _, record := range sampleRecords(zone.Records, sampleSize) {
+			answer, err := verifier.verify(ctx, record)
+			if ctx.Err() != nil {
+				b.report.AddWarning("DNS verification stopped after %s, before every record was checked", b.options.VerifyDNSTimeout)
+				return
+			}
+
+			b.report.DNSRecordsChecked++
+			if err == errDNSMismatch {
+				b.report.DNSMismatches++
+				if answer == "" {
+					answer = "no such name"
+				}
+				b.report.AddWarning("%s: %s doesn't match live DNS, which answered: %s", zone.Name, describeRecord(record), answer)
+			} else if err != nil {
+				b.report.AddWarning("%s: couldn't verify %s: %s", zone.Name, describeRecord(record), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the maximum number of error messages included in a webhook payload
+const webhookMaxErrors = 5
+
+const webhookAttempts = 3
+
+type webhookPayload struct {
+	Endpoint        string   `json:"endpoint,omitempty"`
+	Status          string   `json:"status"`
+	ZonesSucceeded  int      `json:"zones_succeeded"`
+	ZonesFailed     int      `json:"zones_failed"`
+	ZonesUnchanged  int      `json:"zones_unchanged"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	Errors          []string `json:"errors"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+}
+
+type slackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+func newWebhookPayload(report *RunReport) webhookPayload {
+	payload := webhookPayload{
+		Endpoint:        report.Endpoint,
+		Status:          "success",
+		ZonesSucceeded:  report.ZonesSucceeded(),
+		ZonesFailed:     report.ZonesFailed(),
+		ZonesUnchanged:  report.ZonesUnchanged(),
+		DurationSeconds: report.Duration().Seconds(),
+		Errors:          []string{},
+	}
+	if report.Failed() {
+		payload.Status = "failure"
+	}
+
+	for i, err := range report.Errors {
+		if i == webhookMaxErrors {
+			break
+		}
+		payload.Errors = append(payload.Errors, err)
+	}
+
+	return payload
+}
+
+func newSlackPayload(payload webhookPayload) slackPayload {
+	summary := "cloudflare-backup succeeded"
+	if payload.Status != "success" {
+		summary = "cloudflare-backup FAILED"
+	}
+	if payload.Endpoint != "" {
+		summary += " for endpoint " + payload.Endpoint
+	}
+
+	details := "*" + summary + "*\n" +
+		"Zones succeeded: " + strconv.Itoa(payload.ZonesSucceeded) + "\n" +
+		"Zones failed: " + strconv.Itoa(payload.ZonesFailed) + "\n" +
+		"Zones unchanged: " + strconv.Itoa(payload.ZonesUnchanged) + "\n" +
+		"Duration: " + strconv.FormatFloat(payload.DurationSeconds, 'f', 1, 64) + "s"
+
+	blocks := []slackBlock{
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: details}},
+	}
+	if len(payload.Errors) > 0 {
+		blocks = append(blocks, slackBlock{Type: "divider"})
+		blocks = append(blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: "*Errors*\n```" + strings.Join(payload.Errors, "\n") + "```"},
+		})
+	}
+
+	return slackPayload{
+		Text:   summary,
+		Blocks: blocks,
+	}
+}
+
+// sendWebhook posts the run's status to the configured webhook URL. Failures are only logged, since the webhook
+// shouldn't affect the outcome of the backup itself.
+func sendWebhook(opts *options, report *RunReport) {
+	if opts.WebhookURL == "" {
+		return
+	}
+	if opts.WebhookOn == "failure" && !report.Failed() {
+		return
+	}
+
+	var payload interface{} = newWebhookPayload(report)
+	if opts.WebhookFormat == "slack" {
+		payload = newSlackPayload(payload.(webhookPayload))
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Couldn't encode webhook payload: %s", err)
+		return
+	}
+
+	client := http.Client{
+		Timeout: opts.Timeout,
+	}
+
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		err = postWebhook(&client, opts.WebhookURL, body)
+		if err == nil {
+			return
+		}
+
+		log.Printf("Webhook delivery failed (attempt %d of %d): %s", attempt, webhookAttempts, err)
+		if attempt < webhookAttempts {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+	}
+}
+
+func postWebhook(client *http.Client, webhookURL string, body []byte) error {
+	response, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("server responded with %s", response.Status)
+	}
+
+	return nil
+}
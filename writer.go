@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// Writer renders a zone's backup in some output format. Begin is called first, then WriteSection for each section,
+// then End, which must flush anything that's been buffered.
+type Writer interface {
+	Begin(zone cloudflare.Zone) error
+	WriteSection(section Section) error
+	End() error
+}
+
+// backupInfo describes the backup run, for writers that include it in their output.
+type backupInfo struct {
+	TakenAt time.Time
+
+	// TimeZone and TimeFormat control how timestamps from the API are displayed in human-readable formats.
+	TimeZone   *time.Location
+	TimeFormat string
+
+	// Filter describes the filter applied to the DNS records, or is empty if the backup has every record.
+	Filter string
+
+	// RecordFlags adds the Proxiable and Locked columns to the text format.
+	RecordFlags bool
+
+	// Missing lists the zone's resources that weren't backed up, because the token doesn't have permission for them.
+	Missing []missingResource
+
+	// Warn is called when something about the zone couldn't be written as expected.
+	Warn func(format string, args ...interface{})
+}
+
+// displayTime reformats a timestamp from the API for display. If it can't be parsed, it's returned unchanged, with a
+// warning.
+func (info backupInfo) displayTime(raw string) string {
+	if raw == "" {
+		return raw
+	}
+
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		if info.Warn != nil {
+			info.Warn("couldn't parse timestamp %q, so it was left as-is", raw)
+		}
+		return raw
+	}
+
+	return parsed.In(info.TimeZone).Format(info.TimeFormat)
+}
+
+// outputFormat describes a format that can be selected with the -format flag.
+type outputFormat struct {
+	// Extension is the file extension used for files in this format, without the leading dot.
+	Extension string
+
+	// NewWriter creates a Writer that writes to w.
+	NewWriter func(w io.Writer, info backupInfo) Writer
+
+	// VolatilePrefixes lists the starts of lines that change on every run, like the backup timestamp. They're
+	// ignored when deciding whether a file has changed since the last run. Leading whitespace is ignored.
+	VolatilePrefixes []string
+
+	// ParseRecords reads the DNS records back out of a file in this format.
+	ParseRecords func(r io.Reader) ([]cloudflare.DNSRecord, error)
+
+	// HasZone is set for formats whose files have the zone's metadata, which readBackupZone can read back.
+	HasZone bool
+
+	// KeepsRecordData is set for formats that keep each record's priority and data, so that records read back from
+	// them can be compared with recordKey, rather than baseRecordKey.
+	KeepsRecordData bool
+
+	// Version is the version of the format's layout, and Spec describes the layout, for the format-spec subcommand.
+	Version int
+	Spec    func() formatSpec
+}
+
+var outputFormats = map[string]outputFormat{
+	"text": {
+		Extension:        "txt",
+		NewWriter:        newTextWriter,
+		VolatilePrefixes: []string{textTakenAtPrefix},
+		ParseRecords:     parseTextRecords,
+		HasZone:          true,
+		Version:          textFormatVersion,
+		Spec:             textFormatSpec,
+	},
+	"json": {
+		Extension:        "json",
+		NewWriter:        newJSONWriter,
+		VolatilePrefixes: []string{`"taken_at":`},
+		ParseRecords:     parseJSONRecords,
+		HasZone:          true,
+		KeepsRecordData:  true,
+		Version:          jsonFormatVersion,
+		Spec:             jsonFormatSpec,
+	},
+	"dnscontrol": {
+		Extension:        "js",
+		NewWriter:        newDNSControlWriter,
+		VolatilePrefixes: []string{dnscontrolTakenAtPrefix},
+		ParseRecords:     parseDNSControlRecords,
+		Version:          dnscontrolFormatVersion,
+		Spec:             dnscontrolFormatSpec,
+	},
+	"api-json": {
+		Extension:       "json",
+		NewWriter:       newAPIJSONWriter,
+		ParseRecords:    parseAPIJSONRecords,
+		KeepsRecordData: true,
+		Version:         apiFormatVersion,
+		Spec:            apiJSONFormatSpec,
+	},
+	"ndjson": {
+		Extension:       "ndjson",
+		NewWriter:       newNDJSONWriter,
+		ParseRecords:    parseNDJSONRecords,
+		HasZone:         true,
+		KeepsRecordData: true,
+		Version:         ndjsonFormatVersion,
+		Spec:            ndjsonFormatSpec,
+	},
+	"api-ndjson": {
+		Extension:       "ndjson",
+		NewWriter:       newAPINDJSONWriter,
+		ParseRecords:    parseAPINDJSONRecords,
+		KeepsRecordData: true,
+		Version:         apiFormatVersion,
+		Spec:            apiNDJSONFormatSpec,
+	},
+}
+
+// recordKey returns the function that identifies records read back from files in the format, which only compares what
+// the format keeps.
+func (f outputFormat) recordKey() func(cloudflare.DNSRecord) string {
+	if f.KeepsRecordData {
+		return recordKey
+	}
+	return baseRecordKey
+}
+
+// sectionCounts formats the number of items in each section, like "Records: 5, Page rules: 2".
+func sectionCounts(counts []Section) string {
+	parts := []string{}
+	for _, section := range counts {
+		title := section.Title
+		if section.Name == "dns" {
+			title = "Records"
+		}
+		parts = append(parts, title+": "+strconv.Itoa(section.ItemCount()))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// outputFormatNames returns the names of every output format, sorted alphabetically.
+func outputFormatNames() []string {
+	names := []string{}
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getOutputFormat looks up an output format by name.
+func getOutputFormat(name string) (outputFormat, error) {
+	format, ok := outputFormats[name]
+	if !ok {
+		return outputFormat{}, fmt.Errorf("Unknown format %q. The available formats are: %s.", name, strings.Join(outputFormatNames(), ", "))
+	}
+	return format, nil
+}
+
+// writeZone renders a zone's sections with the given writer.
+func writeZone(writer Writer, zone cloudflare.Zone, sections []Section) error {
+	err := writer.Begin(zone)
+	if err != nil {
+		return err
+	}
+
+	for _, section := range sections {
+		err = writer.WriteSection(section)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.End()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// apiWriter writes a zone's DNS records as the request bodies that would create them again, without the fields that
+// only the API sets. The api-json format is a single JSON array, and the api-ndjson format has one body per line, so
+// that it can be read a record at a time. Every other section is left out, since these formats are meant to be fed
+// straight to the API.
+type apiWriter struct {
+	outputFile *bufio.Writer
+	ndjson     bool
+	count      int
+}
+
+// apiRecordBody is a record's request body, along with what manages it if Cloudflare does. Restore tools should leave
+// out the bodies that have managed_by, since Cloudflare adds those records back itself.
+type apiRecordBody struct {
+	cloudflare.DNSRecordBody
+	ManagedBy string `json:"managed_by,omitempty"`
+}
+
+func newAPIJSONWriter(w io.Writer, info backupInfo) Writer {
+	return &apiWriter{outputFile: bufio.NewWriter(w)}
+}
+
+func newAPINDJSONWriter(w io.Writer, info backupInfo) Writer {
+	return &apiWriter{outputFile: bufio.NewWriter(w), ndjson: true}
+}
+
+func (a *apiWriter) Begin(zone cloudflare.Zone) error {
+	return nil
+}
+
+func (a *apiWriter) WriteSection(section Section) error {
+	each := eachRecord(nil)
+	switch data := section.Data.(type) {
+	case []cloudflare.DNSRecord:
+		each = eachRecord(data)
+	case *recordStream:
+		each = data.each
+	default:
+		return nil
+	}
+
+	return each(func(record cloudflare.DNSRecord) error {
+		body := apiRecordBody{record.Body(), record.ManagedBy}
+		if a.ndjson {
+			bodyJSON, err := json.Marshal(body)
+			if err != nil {
+				return err
+			}
+			_, err = a.outputFile.WriteString(string(bodyJSON) + "\n")
+			return err
+		}
+
+		bodyJSON, err := json.MarshalIndent(body, "\t", "\t")
+		if err != nil {
+			return err
+		}
+
+		separator := ",\n\t"
+		if a.count == 0 {
+			separator = "[\n\t"
+		}
+		a.count++
+
+		_, err = a.outputFile.WriteString(separator + string(bodyJSON))
+		return err
+	})
+}
+
+func (a *apiWriter) End() error {
+	if !a.ndjson {
+		end := "\n]\n"
+		if a.count == 0 {
+			end = "[]\n"
+		}
+		_, err := a.outputFile.WriteString(end)
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.outputFile.Flush()
+}
+
+// apiFormatVersion is the version of the api-json and api-ndjson formats' layout. They're only request bodies, so the
+// version isn't in the files, but it has to be bumped whenever the layout changes all the same.
+const apiFormatVersion = 1
+
+// apiFormatVersionLocation says where the version of the api-json and api-ndjson formats is.
+const apiFormatVersionLocation = "not in the file, since it only has request bodies for the API."
+
+// apiJSONFormatSpec describes the api-json format, for format-spec.
+func apiJSONFormatSpec() formatSpec {
+	return formatSpec{
+		Description:     "A JSON array of the request bodies that would create each DNS record again, without the fields that only the API sets. Every other section is left out, so that the file can be fed straight to the API.",
+		VersionLocation: apiFormatVersionLocation,
+		LineEnding:      "\n",
+		RecordFields:    apiRecordFields(),
+		Escaping: []string{
+			jsonEscaping,
+		},
+	}
+}
+
+// apiNDJSONFormatSpec describes the api-ndjson format, for format-spec.
+func apiNDJSONFormatSpec() formatSpec {
+	return formatSpec{
+		Description:     "The request bodies that would create each DNS record again, like in the api-json format, with one on each line, so that they can be read a record at a time.",
+		VersionLocation: apiFormatVersionLocation,
+		LineEnding:      "\n",
+		RecordFields:    apiRecordFields(),
+		Escaping: []string{
+			ndjsonEscaping,
+		},
+	}
+}
+
+func apiRecordFields() []formatSpecField {
+	return jsonFields(apiRecordBody{}, map[string]string{
+		"managed_by": "What manages the record, if Cloudflare does. Restore tools should leave these records out, since Cloudflare adds them back itself.",
+	})
+}
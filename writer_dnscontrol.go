@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// dnscontrolWriter writes a zone as a dnsconfig.js snippet for dnscontrol (https://dnscontrol.org), with a D() block
+// holding the zone's records. Records that dnscontrol's helpers can't express are written as comments, with their
+// API request body, so that nothing is silently lost. Every other section is left out, like in the api-json format.
+type dnscontrolWriter struct {
+	outputFile *bufio.Writer
+	info       backupInfo
+	zone       string
+}
+
+func newDNSControlWriter(w io.Writer, info backupInfo) Writer {
+	return &dnscontrolWriter{
+		outputFile: bufio.NewWriter(w),
+		info:       info,
+	}
+}
+
+const dnscontrolTakenAtPrefix = "// Backup taken at: "
+
+// dnscontrolFormatVersion is the version of the dnscontrol format's layout, which is in the line of its header that
+// starts with dnscontrolFormatVersionPrefix. It has to be bumped whenever the layout changes, so that older parsers
+// refuse files that they'd misread.
+const dnscontrolFormatVersion = 1
+const dnscontrolFormatVersionPrefix = "// Format version: "
+
+// dnscontrolBodyMarker comes before the API request body of a record that's written as a comment, and is how the
+// record is found again when the file is read back.
+const dnscontrolBodyMarker = ", so it's kept here as an API request body: "
+
+// dnscontrolDefaultTTL is the TTL that records in the D() block get unless they have a TTL() of their own. It's
+// Cloudflare's automatic TTL, since that's what most records use.
+const dnscontrolDefaultTTL = 1
+
+func (d *dnscontrolWriter) Begin(zone cloudflare.Zone) error {
+	d.zone = normalizeName(zone.Name)
+
+	header := "// DNS zone backup for " + zone.Name + ", for dnscontrol\n" +
+		dnscontrolFormatVersionPrefix + strconv.Itoa(dnscontrolFormatVersion) + "\n" +
+		dnscontrolTakenAtPrefix + d.info.TakenAt.UTC().Format(time.RFC3339) + "\n"
+	if d.info.Filter != "" {
+		header += "// Filtered backup (" + d.info.Filter + "). This is NOT a complete copy of the zone.\n"
+	}
+	for _, missing := range d.info.Missing {
+		header += "// Not backed up: " + missing.Resource + ", since the API token doesn't have the " + missing.Permission + " permission.\n"
+	}
+
+	_, err := d.outputFile.WriteString(header + "\n" +
+		"var REG_NONE = NewRegistrar(\"none\");\n" +
+		"var DSP_CLOUDFLARE = NewDnsProvider(\"cloudflare\");\n\n" +
+		"D(" + dnscontrolString(zone.Name) + ", REG_NONE, DnsProvider(DSP_CLOUDFLARE), DefaultTTL(" + strconv.Itoa(dnscontrolDefaultTTL) + "),\n",
+	)
+	return err
+}
+
+func (d *dnscontrolWriter) WriteSection(section Section) error {
+	each := eachRecord(nil)
+	switch data := section.Data.(type) {
+	case []cloudflare.DNSRecord:
+		each = eachRecord(data)
+	case *recordStream:
+		each = data.each
+	default:
+		return nil
+	}
+
+	return each(func(record cloudflare.DNSRecord) error {
+		line, reason := d.recordLine(record)
+		if record.ManagedBy != "" {
+			// dnscontrol would try to create it, and conflict with the record that Cloudflare adds itself
+			reason = managedByPrefix + record.ManagedBy
+		}
+		if reason != "" {
+			bodyJSON, err := json.Marshal(record.Body())
+			if err != nil {
+				return err
+			}
+			line = "// " + reason + dnscontrolBodyMarker + string(bodyJSON)
+		}
+
+		_, err := d.outputFile.WriteString("\t" + line + "\n")
+		return err
+	})
+}
+
+// recordLine returns the helper call that creates the record, like A("www", "192.0.2.1", CF_PROXY_ON). If the record
+// can't be expressed, it returns the reason instead.
+func (d *dnscontrolWriter) recordLine(record cloudflare.DNSRecord) (string, string) {
+	args := []string{dnscontrolString(d.label(record.Name))}
+
+	switch record.Type {
+	case "A", "AAAA":
+		args = append(args, dnscontrolString(record.Content))
+
+	case "CNAME":
+		args = append(args, dnscontrolString(dnscontrolTarget(record.Content)))
+
+	case "MX":
+		if record.Priority == nil {
+			return "", "This MX record doesn't have a priority"
+		}
+		args = append(args, strconv.Itoa(int(*record.Priority)), dnscontrolString(dnscontrolTarget(record.Content)))
+
+	case "TXT":
+		parts, quoted := splitTXTContent(record.Content)
+		if !quoted {
+			args = append(args, dnscontrolString(record.Content))
+			break
+		}
+		strs := []string{}
+		for _, part := range parts {
+			strs = append(strs, dnscontrolString(part))
+		}
+		args = append(args, "["+strings.Join(strs, ", ")+"]")
+
+	case "SRV":
+		srv, ok := recordSRVFields(record)
+		if !ok {
+			return "", "This SRV record's fields couldn't be read"
+		}
+		args = append(args, strconv.Itoa(int(srv.Priority)), strconv.Itoa(int(srv.Weight)), strconv.Itoa(int(srv.Port)), dnscontrolString(dnscontrolTarget(srv.Target)))
+
+	case "CAA":
+		caa, ok := recordCAAFields(record)
+		if !ok {
+			return "", "This CAA record's fields couldn't be read"
+		}
+		args = append(args, dnscontrolString(caa.Tag), dnscontrolString(caa.Value))
+		if caa.Flags&128 != 0 {
+			args = append(args, "CAA_CRITICAL")
+		}
+
+	default:
+		return "", "dnscontrol's helpers can't write " + record.Type + " records"
+	}
+
+	if record.Proxied {
+		args = append(args, "CF_PROXY_ON")
+	} else if record.Proxiable {
+		args = append(args, "CF_PROXY_OFF")
+	}
+	if record.TTL != dnscontrolDefaultTTL {
+		args = append(args, "TTL("+strconv.FormatUint(record.TTL, 10)+")")
+	}
+
+	return record.Type + "(" + strings.Join(args, ", ") + "),", ""
+}
+
+// label returns a record's name relative to the zone, like "www", or "@" for the zone itself. Names outside of the
+// zone are written in full, with a trailing dot.
+func (d *dnscontrolWriter) label(name string) string {
+	name = normalizeName(name)
+	if name == d.zone {
+		return "@"
+	}
+	if strings.HasSuffix(name, "."+d.zone) {
+		return strings.TrimSuffix(name, "."+d.zone)
+	}
+	return name + "."
+}
+
+func (d *dnscontrolWriter) End() error {
+	_, err := d.outputFile.WriteString("END);\n")
+	if err != nil {
+		return err
+	}
+
+	return d.outputFile.Flush()
+}
+
+// dnscontrolTarget makes a hostname from a record's content absolute, since dnscontrol would otherwise take it to be
+// inside the zone.
+func dnscontrolTarget(name string) string {
+	if name == "." || strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// dnscontrolString quotes a string for JavaScript. JSON strings are valid JavaScript strings, and HTML characters are
+// left alone so that values stay readable.
+func dnscontrolString(s string) string {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// srvFields are the separate fields of an SRV record, as they are in its Data.
+type srvFields struct {
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Port     uint16 `json:"port"`
+	Target   string `json:"target"`
+}
+
+// recordSRVFields reads an SRV record's fields from its Data, or from its content and priority if it doesn't have any.
+func recordSRVFields(record cloudflare.DNSRecord) (srvFields, bool) {
+	srv := srvFields{}
+	if len(record.Data) > 0 {
+		err := json.Unmarshal(record.Data, &srv)
+		return srv, err == nil && srv.Target != ""
+	}
+
+	// the content is "weight port target", with the priority kept separately
+	fields := strings.Fields(record.Content)
+	if len(fields) != 3 || record.Priority == nil {
+		return srvFields{}, false
+	}
+	weight, weightErr := strconv.ParseUint(fields[0], 10, 16)
+	port, portErr := strconv.ParseUint(fields[1], 10, 16)
+	if weightErr != nil || portErr != nil {
+		return srvFields{}, false
+	}
+	return srvFields{*record.Priority, uint16(weight), uint16(port), fields[2]}, true
+}
+
+// caaFields are the separate fields of a CAA record, as they are in its Data.
+type caaFields struct {
+	Flags uint8  `json:"flags"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// recordCAAFields reads a CAA record's fields from its Data, or from its content if it doesn't have any.
+func recordCAAFields(record cloudflare.DNSRecord) (caaFields, bool) {
+	caa := caaFields{}
+	if len(record.Data) > 0 {
+		err := json.Unmarshal(record.Data, &caa)
+		return caa, err == nil && caa.Tag != ""
+	}
+
+	// the content is like: 0 issue "letsencrypt.org"
+	fields := strings.SplitN(record.Content, " ", 3)
+	if len(fields) != 3 {
+		return caaFields{}, false
+	}
+	flags, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return caaFields{}, false
+	}
+	value := fields[2]
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	return caaFields{uint8(flags), fields[1], value}, true
+}
+
+// splitTXTContent splits a TXT record's content into its strings, if it's written as a list of quoted strings like
+// "part one" "part two". Otherwise, it returns false, and the content is the record's only string.
+func splitTXTContent(content string) ([]string, bool) {
+	if !strings.HasPrefix(content, "\"") {
+		return nil, false
+	}
+
+	parts := []string{}
+	i := 0
+	for i < len(content) {
+		if content[i] == ' ' {
+			i++
+			continue
+		}
+		if content[i] != '"' {
+			return nil, false
+		}
+		part, end, err := readBINDQuoted(content, i)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, part)
+		i = end
+	}
+	return parts, true
+}
+
+// dnscontrolFormatSpec describes the dnscontrol format, for format-spec.
+func dnscontrolFormatSpec() formatSpec {
+	return formatSpec{
+		Description:     "A dnsconfig.js snippet for dnscontrol, with a D() block holding the zone's DNS records. Records that dnscontrol's helpers can't express are written as comments, with their API request body. Every other section is left out.",
+		VersionLocation: formatVersionLine(dnscontrolFormatVersionPrefix, dnscontrolFormatVersion) + ". Files from before the format had versions don't have it, and are read as version 1, which has the same layout.",
+		LineEnding:      "\n",
+		Lines: []formatSpecLine{
+			{Prefix: "// DNS zone backup for ", Description: "The zone's name."},
+			{Prefix: dnscontrolFormatVersionPrefix, Description: "The version of the format."},
+			{Prefix: dnscontrolTakenAtPrefix, Description: "When the backup was taken, in RFC 3339 format, in UTC."},
+			{Prefix: "// Filtered backup (", Description: "Says that the backup only has the DNS records that matched a filter.", Optional: true},
+			{Prefix: "// Not backed up: ", Description: "A resource that wasn't backed up, because the API token doesn't have permission for it. There's a line for each.", Optional: true},
+			{Prefix: "var ", Description: "The registrar and DNS provider that the D() block uses."},
+			{Prefix: "D(", Description: "The start of the zone's D() block, with its name and DefaultTTL(" + strconv.Itoa(dnscontrolDefaultTTL) + ")."},
+			{Description: "A DNS record, as a call to one of dnscontrol's helpers, like A(\"www\", \"192.0.2.1\", CF_PROXY_ON), indented with a tab. Names are relative to the zone, with @ for the zone itself, and names outside of it end with a dot. Records whose TTL isn't the DefaultTTL get a TTL()."},
+			{Prefix: "// ", Description: "A DNS record that dnscontrol's helpers can't express, or that Cloudflare manages (\"" + managedByPrefix + "...\"), with the reason, \"" + dnscontrolBodyMarker + "\", and its request body as JSON.", Optional: true},
+			{Prefix: "END);", Description: "The end of the D() block."},
+		},
+		RecordFields: jsonFields(cloudflare.DNSRecordBody{}, nil),
+		Escaping: []string{
+			"Strings are JavaScript string literals, written as JSON strings, except that <, >, and & are left alone.",
+			"The request bodies in comments are JSON, as encoded by Go's encoding/json, on a single line.",
+		},
+	}
+}
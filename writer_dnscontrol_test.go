@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// dnscontrolSignatures are the positional arguments that each of dnscontrol's record helpers takes, after the record's
+// label, and the modifiers that can follow them.
+var dnscontrolSignatures = map[string]struct {
+	args      []string
+	modifiers []string
+}{
+	"A":     {[]string{"ipv4"}, []string{"CF_PROXY_ON", "CF_PROXY_OFF", "TTL"}},
+	"AAAA":  {[]string{"ipv6"}, []string{"CF_PROXY_ON", "CF_PROXY_OFF", "TTL"}},
+	"CNAME": {[]string{"target"}, []string{"CF_PROXY_ON", "CF_PROXY_OFF", "TTL"}},
+	"MX":    {[]string{"uint16", "target"}, []string{"TTL"}},
+	"TXT":   {[]string{"strings"}, []string{"TTL"}},
+	"SRV":   {[]string{"uint16", "uint16", "uint16", "target"}, []string{"TTL"}},
+	"CAA":   {[]string{"caa tag", "string"}, []string{"CAA_CRITICAL", "TTL"}},
+}
+
+// checkDNSControlArg returns an error if arg isn't what dnscontrol expects for an argument of the given kind.
+func checkDNSControlArg(kind string, arg dnscontrolArg) error {
+	if kind == "strings" && arg.List != nil {
+		if len(arg.List) == 0 {
+			return fmt.Errorf("an empty list of strings")
+		}
+		return nil
+	}
+
+	switch kind {
+	case "uint16":
+		if arg.Quoted || arg.Call != nil {
+			return fmt.Errorf("expected a number, found %+v", arg)
+		}
+		_, err := strconv.ParseUint(arg.Text, 10, 16)
+		return err
+	}
+
+	if !arg.Quoted {
+		return fmt.Errorf("expected a string, found %+v", arg)
+	}
+	switch kind {
+	case "ipv4":
+		ip := net.ParseIP(arg.Text)
+		if ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%q isn't an IPv4 address", arg.Text)
+		}
+	case "ipv6":
+		ip := net.ParseIP(arg.Text)
+		if ip == nil || ip.To4() != nil {
+			return fmt.Errorf("%q isn't an IPv6 address", arg.Text)
+		}
+	case "target":
+		// dnscontrol takes a target without a trailing dot to be inside the zone
+		if !strings.HasSuffix(arg.Text, ".") {
+			return fmt.Errorf("the target %q doesn't end with a dot", arg.Text)
+		}
+	case "caa tag":
+		if arg.Text != "issue" && arg.Text != "issuewild" && arg.Text != "iodef" {
+			return fmt.Errorf("%q isn't a CAA tag that dnscontrol knows", arg.Text)
+		}
+	}
+	return nil
+}
+
+// checkDNSControlLabel returns an error if label isn't a valid record name for a D() block for zone.
+func checkDNSControlLabel(label string, zone string) error {
+	if label == "@" {
+		return nil
+	}
+	if label == "" || strings.HasPrefix(label, ".") || strings.Contains(label, "..") {
+		return fmt.Errorf("the label %q is invalid", label)
+	}
+	if !strings.HasSuffix(label, ".") && (label == zone || strings.HasSuffix(label, "."+zone)) {
+		// dnscontrol would add the zone to it again
+		return fmt.Errorf("the label %q is relative, but ends with the zone's name", label)
+	}
+	return nil
+}
+
+// checkDNSControlFile checks that the lines of a file from the dnscontrol writer are calls to dnscontrol's helpers with
+// the arguments that they take, or commented-out records, and returns how many records it has.
+func checkDNSControlFile(t *testing.T, data string, zone string) int {
+	t.Helper()
+
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "D(") {
+			start = i
+			break
+		}
+	}
+	if start < 3 || lines[start-3] != `var REG_NONE = NewRegistrar("none");` || lines[start-2] != `var DSP_CLOUDFLARE = NewDnsProvider("cloudflare");` {
+		t.Fatalf("the D() block doesn't come after the registrar and DNS provider:\n%s", data)
+	}
+	want := "D(" + strconv.Quote(zone) + ", REG_NONE, DnsProvider(DSP_CLOUDFLARE), DefaultTTL(1),"
+	if lines[start] != want {
+		t.Errorf("the D() block starts with %s, want %s", lines[start], want)
+	}
+	if lines[len(lines)-1] != "END);" {
+		t.Errorf("the file ends with %q, want END);", lines[len(lines)-1])
+	}
+
+	records := 0
+	for _, line := range lines[start+1 : len(lines)-1] {
+		if !strings.HasPrefix(line, "\t") {
+			t.Errorf("%q isn't indented with a tab", line)
+			continue
+		}
+		line = strings.TrimPrefix(line, "\t")
+		records++
+
+		if strings.HasPrefix(line, "// ") {
+			if !strings.Contains(line, dnscontrolBodyMarker+"{") {
+				t.Errorf("the commented-out record %q doesn't have its request body", line)
+			}
+			continue
+		}
+
+		if !strings.HasSuffix(line, ",") {
+			t.Errorf("%q doesn't end with a comma", line)
+			continue
+		}
+		call, err := parseDNSControlCall(strings.TrimSuffix(line, ","))
+		if err != nil {
+			t.Errorf("%q isn't a call: %v", line, err)
+			continue
+		}
+		signature, ok := dnscontrolSignatures[call.Name]
+		if !ok {
+			t.Errorf("%q calls %s, which isn't a record helper", line, call.Name)
+			continue
+		}
+		if len(call.Args) < 1+len(signature.args) {
+			t.Errorf("%q has %d arguments, but %s takes %d", line, len(call.Args), call.Name, 1+len(signature.args))
+			continue
+		}
+
+		if !call.Args[0].Quoted {
+			t.Errorf("%q doesn't have a quoted label", line)
+		} else if err := checkDNSControlLabel(call.Args[0].Text, zone); err != nil {
+			t.Errorf("%q: %v", line, err)
+		}
+		for i, kind := range signature.args {
+			if err := checkDNSControlArg(kind, call.Args[1+i]); err != nil {
+				t.Errorf("%q: argument %d: %v", line, 2+i, err)
+			}
+		}
+
+		seen := map[string]bool{}
+		for _, arg := range call.Args[1+len(signature.args):] {
+			name := arg.Text
+			if arg.Call != nil {
+				name = arg.Call.Name
+				if _, err := dnscontrolTTL(*arg.Call); name != "TTL" || err != nil {
+					t.Errorf("%q has an invalid modifier %s(): %v", line, name, err)
+				}
+			} else if arg.Quoted || arg.List != nil || name == "TTL" {
+				t.Errorf("%q has an extra argument %+v", line, arg)
+				continue
+			}
+			if !stringInSlice(name, signature.modifiers) {
+				t.Errorf("%q has the modifier %s, which %s doesn't take", line, name, call.Name)
+			}
+			if seen[name] || (strings.HasPrefix(name, "CF_PROXY_") && (seen["CF_PROXY_ON"] || seen["CF_PROXY_OFF"])) {
+				t.Errorf("%q has %s more than once", line, name)
+			}
+			seen[name] = true
+		}
+	}
+	return records
+}
+
+func stringInSlice(s string, slice []string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDNSControlFixture(t *testing.T) {
+	api := newFakeAPI(t, "dnscontrol")
+	dir := runTestBackup(t, api, "-format", "dnscontrol")
+	checkGoldenFile(t, dir, "dnscontrol.example.js", "dnscontrol/dnscontrol.example.js")
+}
+
+func TestDNSControlHelperSignatures(t *testing.T) {
+	for _, test := range []struct {
+		fixture string
+		zone    string
+	}{
+		{"all-types", "example.com"},
+		{"dnscontrol", "dnscontrol.example"},
+		{"idn", "xn--bcher-kva.example"},
+	} {
+		t.Run(test.fixture, func(t *testing.T) {
+			api := newFakeAPI(t, test.fixture)
+			dir := runTestBackup(t, api, "-format", "dnscontrol", "-resources", "dns")
+			data, err := ioutil.ReadFile(filepath.Join(dir, test.zone+".js"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// no record may be dropped, even the ones that have to be commented out
+			fixture := loadFakeZone(t, test.fixture)
+			if records := checkDNSControlFile(t, string(data), test.zone); records != len(fixture.DNSRecords) {
+				t.Errorf("the file has %d records, want %d", records, len(fixture.DNSRecords))
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// jsonWriter writes a single JSON document per zone, with the zone's metadata and an object holding each section,
+// keyed by the section's name. Sections are written out as they arrive, rather than building the whole document in
+// memory first.
+type jsonWriter struct {
+	outputFile *bufio.Writer
+	info       backupInfo
+	counts     map[string]int
+}
+
+// jsonFormatVersion is the version of the json format's layout, which is in its format_version field. It has to be
+// bumped whenever the layout changes, so that older parsers refuse files that they'd misread.
+const jsonFormatVersion = 1
+
+// jsonDocument is the layout of a file in the json format, with its fields in the order that they're written. The
+// writer writes it a piece at a time instead of encoding it, so that sections don't have to be kept in memory, but
+// format-spec describes the format from it.
+type jsonDocument struct {
+	Zone          cloudflare.Zone            `json:"zone"`
+	FormatVersion int                        `json:"format_version"`
+	TakenAt       string                     `json:"taken_at"`
+	Filter        string                     `json:"filter,omitempty"`
+	Warnings      []missingResource          `json:"warnings,omitempty"`
+	Sections      map[string]json.RawMessage `json:"sections"`
+	Counts        map[string]int             `json:"counts"`
+}
+
+func newJSONWriter(w io.Writer, info backupInfo) Writer {
+	return &jsonWriter{
+		outputFile: bufio.NewWriter(w),
+		info:       info,
+		counts:     map[string]int{},
+	}
+}
+
+func (j *jsonWriter) Begin(zone cloudflare.Zone) error {
+	zoneJSON, err := json.MarshalIndent(zone, "\t", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = j.outputFile.WriteString(
+		"{\n\t\"zone\": " + string(zoneJSON) + ",\n" +
+			"\t\"format_version\": " + strconv.Itoa(jsonFormatVersion) + ",\n" +
+			"\t\"taken_at\": \"" + j.info.TakenAt.UTC().Format(time.RFC3339) + "\",\n",
+	)
+	if err != nil {
+		return err
+	}
+
+	if j.info.Filter != "" {
+		filterJSON, err := json.Marshal(j.info.Filter)
+		if err != nil {
+			return err
+		}
+		_, err = j.outputFile.WriteString("\t\"filter\": " + string(filterJSON) + ",\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(j.info.Missing) > 0 {
+		missingJSON, err := json.MarshalIndent(j.info.Missing, "\t", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = j.outputFile.WriteString("\t\"warnings\": " + string(missingJSON) + ",\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = j.outputFile.WriteString("\t\"sections\": {")
+	return err
+}
+
+func (j *jsonWriter) WriteSection(section Section) error {
+	nameJSON, err := json.Marshal(section.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(j.counts) > 0 {
+		_, err = j.outputFile.WriteString(",")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = j.outputFile.WriteString("\n\t\t" + string(nameJSON) + ": ")
+	if err != nil {
+		return err
+	}
+
+	dnsRecords, isDNS := section.Data.([]cloudflare.DNSRecord)
+	stream, isStream := section.Data.(*recordStream)
+	switch {
+	case isDNS:
+		err = j.writeDNSRecords(eachRecord(dnsRecords))
+	case isStream:
+		err = j.writeDNSRecords(stream.each)
+	default:
+		var dataJSON []byte
+		dataJSON, err = json.MarshalIndent(section.Data, "\t\t", "\t")
+		if err == nil {
+			_, err = j.outputFile.Write(dataJSON)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	j.counts[section.Name] = section.ItemCount()
+	return nil
+}
+
+// writeDNSRecords writes a list of DNS records one at a time, laid out the same way as json.MarshalIndent would, so
+// that the whole list never has to be encoded in memory.
+func (j *jsonWriter) writeDNSRecords(each func(handle func(record cloudflare.DNSRecord) error) error) error {
+	count := 0
+	err := each(func(record cloudflare.DNSRecord) error {
+		recordJSON, err := json.MarshalIndent(record, "\t\t\t", "\t")
+		if err != nil {
+			return err
+		}
+
+		separator := ",\n\t\t\t"
+		if count == 0 {
+			separator = "[\n\t\t\t"
+		}
+		count++
+
+		_, err = j.outputFile.WriteString(separator + string(recordJSON))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		_, err = j.outputFile.WriteString("[]")
+		return err
+	}
+	_, err = j.outputFile.WriteString("\n\t\t]")
+	return err
+}
+
+func (j *jsonWriter) End() error {
+	countsJSON, err := json.MarshalIndent(j.counts, "\t", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = j.outputFile.WriteString("\n\t},\n\t\"counts\": " + string(countsJSON) + "\n}\n")
+	if err != nil {
+		return err
+	}
+
+	return j.outputFile.Flush()
+}
+
+// jsonFormatSpec describes the json format, for format-spec.
+func jsonFormatSpec() formatSpec {
+	return formatSpec{
+		Description:     "A single JSON object per zone, with the zone, when the backup was taken, and each section's data.",
+		VersionLocation: "the format_version field. Files from before the format had versions don't have it, and are read as version 1, which has the same layout.",
+		LineEnding:      "\n",
+		Fields: jsonFields(jsonDocument{}, map[string]string{
+			"zone":           "The zone, as the API returns it, along with its hold, development mode, and page rule entitlements if they were fetched.",
+			"format_version": "The version of the format.",
+			"taken_at":       "When the backup was taken, in RFC 3339 format, in UTC.",
+			"filter":         "The filter that the DNS records matched, if the backup doesn't have all of them.",
+			"warnings":       "The resources that weren't backed up, because the API token doesn't have permission for them.",
+			"sections":       "Each section's data, keyed by the section's name, like dns or pagerules. The dns section is an array of DNS records.",
+			"counts":         "The number of items in each section, keyed by the section's name.",
+		}),
+		RecordFields: jsonFields(cloudflare.DNSRecord{}, nil),
+		Escaping: []string{
+			jsonEscaping,
+		},
+	}
+}
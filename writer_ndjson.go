@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// ndjsonWriter writes a zone as newline-delimited JSON, for log pipelines like Elasticsearch's bulk API. Each line is
+// a single resource, like a record, a page rule, or a setting, along with the zone that it's from and when the backup
+// was taken, so that lines make sense on their own. The first line of each zone holds the zone itself. Every line is
+// flushed as soon as it's written, so the file can be followed while the run is going.
+type ndjsonWriter struct {
+	outputFile *bufio.Writer
+	info       backupInfo
+	zone       cloudflare.Zone
+	takenAt    string
+}
+
+func newNDJSONWriter(w io.Writer, info backupInfo) Writer {
+	return &ndjsonWriter{
+		outputFile: bufio.NewWriter(w),
+		info:       info,
+		takenAt:    info.TakenAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// ndjsonFormatVersion is the version of the ndjson format's layout, which is on each zone's line. It has to be bumped
+// whenever the layout changes, so that older parsers refuse files that they'd misread.
+const ndjsonFormatVersion = 1
+
+// ndjsonLine is a line of the ndjson format. Key is set for resources that are part of a map, like a setting's name.
+// FormatVersion, Filter, and Warnings are only set on the zone's own line.
+type ndjsonLine struct {
+	Zone          string            `json:"zone"`
+	ZoneID        string            `json:"zone_id"`
+	Resource      string            `json:"resource"`
+	Key           string            `json:"key,omitempty"`
+	TakenAt       string            `json:"taken_at"`
+	FormatVersion int               `json:"format_version,omitempty"`
+	Filter        string            `json:"filter,omitempty"`
+	Warnings      []missingResource `json:"warnings,omitempty"`
+	Data          interface{}       `json:"data"`
+}
+
+// ndjsonZoneResource is the resource of the line that holds the zone itself.
+const ndjsonZoneResource = "zone"
+
+func (n *ndjsonWriter) Begin(zone cloudflare.Zone) error {
+	n.zone = zone
+	return n.writeLine(ndjsonLine{
+		Resource:      ndjsonZoneResource,
+		FormatVersion: ndjsonFormatVersion,
+		Filter:        n.info.Filter,
+		Warnings:      n.info.Missing,
+		Data:          zone,
+	})
+}
+
+func (n *ndjsonWriter) WriteSection(section Section) error {
+	switch data := section.Data.(type) {
+	case []cloudflare.DNSRecord:
+		return n.writeRecords(section.Name, eachRecord(data))
+	case *recordStream:
+		return n.writeRecords(section.Name, data.each)
+	}
+
+	// sections of settings, like performance, get a line per setting, including the ones that weren't available
+	settings, ok := sectionSettings(section)
+	if ok {
+		keys := []string{}
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			err := n.writeLine(ndjsonLine{Resource: section.Name, Key: key, Data: settings[key]})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, item := range section.Items() {
+		err := n.writeLine(ndjsonLine{Resource: section.Name, Data: item})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) writeRecords(resource string, each func(handle func(record cloudflare.DNSRecord) error) error) error {
+	return each(func(record cloudflare.DNSRecord) error {
+		return n.writeLine(ndjsonLine{Resource: resource, Data: record})
+	})
+}
+
+// writeLine fills in the zone and time of a line, then writes and flushes it.
+func (n *ndjsonWriter) writeLine(line ndjsonLine) error {
+	line.Zone = n.zone.Name
+	line.ZoneID = n.zone.ID
+	line.TakenAt = n.takenAt
+
+	lineJSON, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.outputFile.Write(append(lineJSON, '\n'))
+	if err != nil {
+		return err
+	}
+	return n.outputFile.Flush()
+}
+
+func (n *ndjsonWriter) End() error {
+	return n.outputFile.Flush()
+}
+
+// sectionSettings returns the settings of a section whose data has a "settings" object, like the performance section,
+// keyed by the setting's name. Settings that weren't available are included, with the reason as their data.
+func sectionSettings(section Section) (map[string]interface{}, bool) {
+	dataJSON, err := json.Marshal(section.Data)
+	if err != nil {
+		return nil, false
+	}
+
+	parsed := struct {
+		Settings    map[string]json.RawMessage `json:"settings"`
+		Unavailable map[string]string          `json:"unavailable"`
+	}{}
+	if json.Unmarshal(dataJSON, &parsed) != nil || parsed.Settings == nil {
+		return nil, false
+	}
+
+	settings := map[string]interface{}{}
+	for key, value := range parsed.Settings {
+		settings[key] = value
+	}
+	for key, reason := range parsed.Unavailable {
+		settings[key] = map[string]string{"unavailable": reason}
+	}
+	return settings, true
+}
+
+// ndjsonFormatSpec describes the ndjson format, for format-spec.
+func ndjsonFormatSpec() formatSpec {
+	return formatSpec{
+		Description:     "Newline-delimited JSON, with a line for each resource, like a DNS record, a page rule, or a setting. Each zone starts with a line for the zone itself. With -single-file, every zone is in the same file, one after the other.",
+		VersionLocation: "the format_version field of each zone's line. Files from before the format had versions don't have it, and are read as version 1, which has the same layout.",
+		LineEnding:      "\n",
+		Fields: jsonFields(ndjsonLine{}, map[string]string{
+			"zone":           "The name of the zone that the line is from.",
+			"zone_id":        "The ID of the zone that the line is from.",
+			"resource":       "What the line has: \"" + ndjsonZoneResource + "\" for the zone's own line, or else the name of the section, like dns.",
+			"key":            "The name of the resource, for sections of settings, like a setting's name.",
+			"taken_at":       "When the backup was taken, in RFC 3339 format, in UTC.",
+			"format_version": "The version of the format. It's only on the zone's line.",
+			"filter":         "The filter that the DNS records matched, if the backup doesn't have all of them. It's only on the zone's line.",
+			"warnings":       "The resources that weren't backed up, because the API token doesn't have permission for them. It's only on the zone's line.",
+			"data":           "The resource, as it is in the json format. For the dns resource, it's a DNS record.",
+		}),
+		RecordFields: jsonFields(cloudflare.DNSRecord{}, nil),
+		Escaping: []string{
+			ndjsonEscaping,
+		},
+	}
+}
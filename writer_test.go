@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWritersGolden(t *testing.T) {
+	for _, name := range outputFormatNames() {
+		t.Run(name, func(t *testing.T) {
+			format := outputFormats[name]
+			api := newFakeAPI(t, "all-types")
+			dir := runTestBackup(t, api, "-format", name)
+			checkGoldenFile(t, dir, "example.com."+format.Extension, "formats/"+name+"."+format.Extension)
+		})
+	}
+}
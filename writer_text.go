@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// textWriter writes the human-readable text format. DNS records are written as tab-separated columns, and everything
+// else is written as commented-out JSON, one item per line.
+type textWriter struct {
+	outputFile *bufio.Writer
+	info       backupInfo
+	sections   []Section
+}
+
+func newTextWriter(w io.Writer, info backupInfo) Writer {
+	return &textWriter{
+		outputFile: bufio.NewWriter(w),
+		info:       info,
+	}
+}
+
+const textSeparator = "\t\t"
+
+// textFormatVersion is the version of the text format's layout, which is in its header. It has to be bumped whenever
+// the layout changes, so that older parsers refuse files that they'd misread.
+const textFormatVersion = 1
+
+// textZonePrefix starts the first line of the header, with the zone's name, and textFormatVersionPrefix starts the
+// line with the format's version.
+const textZonePrefix = "# DNS zone backup for "
+const textFormatVersionPrefix = "# Format version: "
+
+// the starts of the rest of the header's lines
+const (
+	textCreatedOnPrefix   = "# Domain created on: "
+	textActivatedOnPrefix = "# Domain activated on: "
+	textModifiedOnPrefix  = "# Domain last modified on: "
+	textPartialPrefix     = "# Partial setup: "
+	textFilteredPrefix    = "# Filtered backup ("
+	textNotBackedUpPrefix = "# Not backed up: "
+)
+
+// the values of the Proxied, Proxiable, and Locked columns
+const (
+	textProxied      = "PROXY"
+	textNotProxied   = "NO_PROXY"
+	textProxiable    = "PROXIABLE"
+	textNotProxiable = "NOT_PROXIABLE"
+	textLocked       = "LOCKED"
+	textUnlocked     = "UNLOCKED"
+)
+
+const textTakenAtPrefix = "# Backup taken at: "
+
+// textRecordHeader and textRecordFlagsHeader are the header lines of the DNS records, without and with the Proxiable
+// and Locked columns.
+const textRecordHeader = "# Name" + textSeparator + "TTL" + textSeparator + "Type" + textSeparator + "Proxied" + textSeparator + "Value"
+const textRecordFlagsHeader = "# Name" + textSeparator + "TTL" + textSeparator + "Type" + textSeparator + "Proxied" + textSeparator + "Proxiable" + textSeparator + "Locked" + textSeparator + "Value"
+
+// textZonePausedPrefix and textDevelopmentModePrefix start the header lines with whether the zone was paused and had
+// development mode on, which are read back to find changes with -drift.
+const textZonePausedPrefix = "# Zone paused: "
+const textDevelopmentModePrefix = "# Development mode: "
+
+// textZoneHoldPrefix starts the header line with the zone's hold, which is read back by the restore subcommand.
+const textZoneHoldPrefix = "# Zone hold: "
+
+func (t *textWriter) Begin(zone cloudflare.Zone) error {
+	_, err := t.outputFile.WriteString(
+		"#\r\n" +
+			textZonePrefix + zone.Name + "\r\n" +
+			textFormatVersionPrefix + strconv.Itoa(textFormatVersion) + "\r\n" +
+			textCreatedOnPrefix + t.info.displayTime(zone.CreatedOn) + "\r\n" +
+			textActivatedOnPrefix + t.info.displayTime(zone.ActivatedOn) + "\r\n" +
+			textModifiedOnPrefix + t.info.displayTime(zone.ModifiedOn) + "\r\n" +
+			textTakenAtPrefix + t.info.TakenAt.UTC().Format(time.RFC3339) + "\r\n" +
+			textZonePausedPrefix + describePaused(zone.Paused) + "\r\n",
+	)
+	if err != nil {
+		return err
+	}
+
+	if zone.DevelopmentMode != nil {
+		_, err = t.outputFile.WriteString(textDevelopmentModePrefix + describeDevelopmentMode(*zone.DevelopmentMode) + "\r\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	if isPartialZone(zone) {
+		_, err = t.outputFile.WriteString(textPartialPrefix + "this zone's DNS is hosted elsewhere, and uses CNAMEs to point at Cloudflare.\r\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	if zone.Hold != nil {
+		_, err = t.outputFile.WriteString(textZoneHoldPrefix + t.describeZoneHold(*zone.Hold) + "\r\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.info.Filter != "" {
+		_, err = t.outputFile.WriteString(textFilteredPrefix + t.info.Filter + "). This is NOT a complete copy of the zone.\r\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, missing := range t.info.Missing {
+		_, err = t.outputFile.WriteString(textNotBackedUpPrefix + missing.Resource + ", since the API token doesn't have the " + missing.Permission + " permission.\r\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describeZoneHold formats a zone's hold for the header, like "on, including subdomains".
+func (t *textWriter) describeZoneHold(hold cloudflare.ZoneHold) string {
+	if !hold.Hold {
+		return "off"
+	}
+
+	description := "on"
+	if hold.IncludeSubdomains {
+		description += textZoneHoldSubdomains
+	}
+	if hold.HoldAfter != "" {
+		description += ", enforced from " + t.info.displayTime(hold.HoldAfter)
+	}
+	return description
+}
+
+// describePaused formats whether a zone is paused for the header. A paused zone gets an explanation, since it changes
+// how all of its traffic is handled.
+func describePaused(paused bool) string {
+	if paused {
+		return "yes (Cloudflare isn't proxying or caching anything for this zone)"
+	}
+	return "no"
+}
+
+// describeDevelopmentMode formats a zone's development mode for the header, like "on (2h0m0s left)".
+func describeDevelopmentMode(developmentMode cloudflare.DevelopmentMode) string {
+	if developmentMode.Value == "on" && developmentMode.TimeRemaining > 0 {
+		return "on (the cache is bypassed, with " + (time.Duration(developmentMode.TimeRemaining) * time.Second).String() + " left)"
+	}
+	if developmentMode.Value == "on" {
+		return "on (the cache is bypassed)"
+	}
+	return developmentMode.Value
+}
+
+// textZoneHoldSubdomains is added to the hold's description when it covers subdomains.
+const textZoneHoldSubdomains = ", including subdomains"
+
+func (t *textWriter) WriteSection(section Section) error {
+	t.sections = append(t.sections, section)
+
+	dnsRecords, isDNS := section.Data.([]cloudflare.DNSRecord)
+	if isDNS {
+		return t.writeDNSRecords(eachRecord(dnsRecords))
+	}
+	stream, isStream := section.Data.(*recordStream)
+	if isStream {
+		return t.writeDNSRecords(stream.each)
+	}
+
+	_, err := t.outputFile.WriteString("#\r\n# " + section.Title + "\r\n")
+	if err != nil {
+		return err
+	}
+	for _, line := range section.Summary {
+		_, err = t.outputFile.WriteString("# " + line + "\r\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	items := section.Items()
+	if len(items) == 0 {
+		_, err = t.outputFile.WriteString("# (no " + strings.ToLower(section.Title) + ")\r\n")
+		if err != nil {
+			return err
+		}
+	}
+	e := json.NewEncoder(t.outputFile)
+	for _, item := range items {
+		_, err = t.outputFile.WriteString("# ")
+		if err != nil {
+			return err
+		}
+		err = e.Encode(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *textWriter) writeDNSRecords(each func(handle func(record cloudflare.DNSRecord) error) error) error {
+	const separator = textSeparator
+
+	header := textRecordHeader
+	if t.info.RecordFlags {
+		header = textRecordFlagsHeader
+	}
+	_, err := t.outputFile.WriteString("#\r\n" + header + "\r\n")
+	if err != nil {
+		return err
+	}
+
+	return each(func(record cloudflare.DNSRecord) error {
+		proxiedString := textNotProxied
+		if record.Proxied {
+			proxiedString = textProxied
+		}
+
+		flags := ""
+		if t.info.RecordFlags {
+			proxiableString := textNotProxiable
+			if record.Proxiable {
+				proxiableString = textProxiable
+			}
+			lockedString := textUnlocked
+			if record.Locked {
+				lockedString = textLocked
+			}
+			flags = proxiableString + separator + lockedString + separator
+		}
+
+		_, err := t.outputFile.WriteString(
+			record.Name + separator + strconv.FormatUint(record.TTL, 10) + separator + record.Type + separator + proxiedString + separator + flags + record.Content + "\r\n",
+		)
+		if err == nil && record.ManagedBy != "" {
+			_, err = t.outputFile.WriteString("# " + managedByPrefix + record.ManagedBy + "\r\n")
+		}
+		return err
+	})
+}
+
+func (t *textWriter) End() error {
+	_, err := t.outputFile.WriteString("#\r\n# " + sectionCounts(t.sections) + "\r\n")
+	if err != nil {
+		return err
+	}
+
+	return t.outputFile.Flush()
+}
+
+// textFormatSpec describes the text format, for format-spec.
+func textFormatSpec() formatSpec {
+	columns := map[string]formatSpecColumn{
+		"Name":      {Description: "The record's full name."},
+		"TTL":       {Description: "The record's TTL in seconds, or " + strconv.Itoa(autoTTL) + " for automatic."},
+		"Type":      {Description: "The record's type, like A or CNAME."},
+		"Proxied":   {Description: "Whether Cloudflare proxies the record.", Values: []string{textProxied, textNotProxied}},
+		"Proxiable": {Description: "Whether the record can be proxied. Only with -text-record-flags.", Values: []string{textProxiable, textNotProxiable}},
+		"Locked":    {Description: "Whether the record is locked. Only with -text-record-flags.", Values: []string{textLocked, textUnlocked}},
+		"Value":     {Description: "The record's content, as the API returns it. It's the last column, so it can contain the separator."},
+	}
+	always := map[string]bool{}
+	for _, name := range textColumns(textRecordHeader) {
+		always[name] = true
+	}
+
+	spec := formatSpec{
+		Description:     "A human-readable file per zone. The DNS records are written as columns, and everything else is written as comments, so that the file can be read at a glance.",
+		VersionLocation: formatVersionLine(textFormatVersionPrefix, textFormatVersion) + ". Files from before the format had versions don't have it, and are read as version 1, which has the same layout.",
+		LineEnding:      "\r\n",
+		Separator:       textSeparator,
+		Lines: []formatSpecLine{
+			{Prefix: "#", Description: "An empty comment, which starts the header and separates each section from the last."},
+			{Prefix: textZonePrefix, Description: "The zone's name."},
+			{Prefix: textFormatVersionPrefix, Description: "The version of the format."},
+			{Prefix: textCreatedOnPrefix, Description: "When the zone was created, in -time-zone and -time-format."},
+			{Prefix: textActivatedOnPrefix, Description: "When the zone was activated, in -time-zone and -time-format."},
+			{Prefix: textModifiedOnPrefix, Description: "When the zone was last modified, in -time-zone and -time-format."},
+			{Prefix: textTakenAtPrefix, Description: "When the backup was taken, in RFC 3339 format, in UTC."},
+			{Prefix: textZonePausedPrefix, Description: "Whether the zone is paused: \"no\", or \"yes\" with an explanation."},
+			{Prefix: textDevelopmentModePrefix, Description: "Whether the zone has development mode on, like \"on (the cache is bypassed)\" or \"off\".", Optional: true},
+			{Prefix: textPartialPrefix, Description: "Says that the zone has a partial (CNAME) setup.", Optional: true},
+			{Prefix: textZoneHoldPrefix, Description: "The zone's hold, like \"off\" or \"on" + textZoneHoldSubdomains + "\".", Optional: true},
+			{Prefix: textFilteredPrefix, Description: "Says that the backup only has the DNS records that matched a filter.", Optional: true},
+			{Prefix: textNotBackedUpPrefix, Description: "A resource that wasn't backed up, because the API token doesn't have permission for it. There's a line for each.", Optional: true},
+			{Prefix: textRecordHeader, Description: "The names of the DNS records' columns. With -text-record-flags, the Proxiable and Locked columns are there too."},
+			{Description: "A DNS record, with its columns separated by the separator. There's a line for each."},
+			{Prefix: "# " + managedByPrefix, Description: "What manages the DNS record on the line before, if Cloudflare does.", Optional: true},
+			{Prefix: "# ", Description: "Each other section: its title, any summary lines, and then each item as JSON on a line of its own, or \"(no ...)\" if it has none."},
+			{Prefix: "# ", Description: "The last line, with the number of items in each section, like \"Records: 5, Page rules: 2\"."},
+		},
+		Escaping: []string{
+			"Nothing in the DNS records is escaped. A record's value is its last column, so it can contain the separator, but its name and type can't.",
+			"The items of other sections are JSON, as encoded by Go's encoding/json, so each one is on a single line.",
+			"Lines that start with # are comments, and every line that doesn't, and isn't empty, is a DNS record.",
+		},
+	}
+	for _, name := range textColumns(textRecordFlagsHeader) {
+		column := columns[name]
+		column.Name = name
+		column.Optional = !always[name]
+		spec.Columns = append(spec.Columns, column)
+	}
+	return spec
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thatoddmailbox/cloudflare-backup/cloudflare"
+)
+
+// zoneHashExtension is added to a zone's name for the file that holds its content hash, like example.com.hash.
+const zoneHashExtension = ".hash"
+
+// zoneContentHash hashes what's in a zone's backup, as a cheap way to tell whether anything changed: the settings that
+// drift detection compares, the DNS records, normalized and sorted, and every other section. Fields that change
+// without the zone changing, like record IDs, modification times, and when the backup was taken, are left out, so the
+// hash only changes when the zone does, or when rendering does. It's "" if the records were streamed, since they were
+// never all in memory.
+//
+// rendering describes the options that change how the zone's files are written, from renderingOptions, so that
+// -skip-unchanged doesn't leave files from before they were changed alone.
+func zoneContentHash(zone cloudflare.Zone, sections []Section, rendering string) string {
+	lines := []string{"rendering " + rendering, "paused " + yesNo(zone.Paused)}
+	if zone.DevelopmentMode != nil {
+		lines = append(lines, "development_mode "+zone.DevelopmentMode.Value)
+	}
+	if zone.Hold != nil {
+		lines = append(lines, "hold "+yesNo(zone.Hold.Hold)+" "+yesNo(zone.Hold.IncludeSubdomains))
+	}
+
+	for _, section := range sections {
+		lines = append(lines, "section "+section.Name)
+		switch data := section.Data.(type) {
+		case *recordStream:
+			return ""
+		case []cloudflare.DNSRecord:
+			records := []string{}
+			for _, record := range data {
+				body := record.Body()
+				body.Name = normalizeName(body.Name)
+				bodyJSON, err := json.Marshal(body)
+				if err != nil {
+					return ""
+				}
+				records = append(records, string(bodyJSON))
+			}
+			sort.Strings(records)
+			lines = append(lines, records...)
+		default:
+			dataJSON, err := json.Marshal(section.Data)
+			if err != nil {
+				return ""
+			}
+			lines = append(lines, string(dataJSON))
+		}
+
+		files := []string{}
+		for name, file := range section.Files {
+			sum := sha256.Sum256(file)
+			files = append(files, "file "+name+" "+hex.EncodeToString(sum[:]))
+		}
+		sort.Strings(files)
+		lines = append(lines, files...)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// renderingOptions describes the options that change the bytes of a zone's files without changing what's in them: the
+// format and its version, the text format's extra columns, how timestamps are shown, and whether secrets are redacted.
+func (b *backupRun) renderingOptions() string {
+	return strings.Join([]string{
+		"format=" + b.options.Format,
+		"version=" + strconv.Itoa(b.format.Version),
+		"text-record-flags=" + strconv.FormatBool(b.options.TextRecordFlags),
+		"time-zone=" + b.options.TimeZone,
+		"time-format=" + b.options.TimeFormat,
+		"secrets=" + strconv.FormatBool(b.options.IncludeSecrets),
+	}, " ")
+}
+
+// readZoneHash reads a zone's content hash from the previous backup, or returns "" if there isn't one.
+func (b *backupRun) readZoneHash(zoneID string) string {
+	data, err := ioutil.ReadFile(b.zoneHashPath(zoneID))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// zoneHashPath is where the zone's content hash is kept, next to its backup.
+func (b *backupRun) zoneHashPath(zoneID string) string {
+	return filepath.Join(b.options.OutputDir, filepath.FromSlash(b.zonePath(zoneID)+zoneHashExtension))
+}
+
+// writeZoneHash saves the zone's content hash next to its backup, for the next run to compare to. It isn't encrypted,
+// since it doesn't say anything about the zone other than whether it changed. With -single-file, it's only in the
+// manifest, so that the output directory stays a single file.
+func (b *backupRun) writeZoneHash(zone cloudflare.Zone, manifestZone *manifestZone) error {
+	if manifestZone.ContentHash == "" || b.singleFile != nil {
+		return nil
+	}
+
+	hashPath := b.zoneHashPath(zone.ID)
+	if !b.zoneHashMatches {
+		err := writeFileAtomic(hashPath, []byte(manifestZone.ContentHash+"\n"), os.FileMode(b.options.FileMode))
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := newManifestFile(b.options.OutputDir, hashPath)
+	if err != nil {
+		return err
+	}
+	manifestZone.Files = append(manifestZone.Files, file)
+	return nil
+}
+
+// shortHash shortens a content hash for the summary, like "3f2a…".
+func shortHash(hash string) string {
+	if len(hash) > 4 {
+		return hash[:4] + "…"
+	}
+	return hash
+}
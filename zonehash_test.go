@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSkipUnchangedRewritesAfterRenderingChanges(t *testing.T) {
+	api := newFakeAPI(t, "all-types")
+	dir := runTestBackup(t, api, "-resources", "dns", "-skip-unchanged")
+
+	for _, test := range []struct {
+		timeFormat string
+		unchanged  bool
+		createdOn  string
+	}{
+		// the zone hasn't changed, but its timestamps are shown differently, so the file has to be written again
+		{"2006-01-02", false, "2019-06-01"},
+		{"2006-01-02", true, "2019-06-01"},
+	} {
+		run := newTestBackup(t, api, "-resources", "dns", "-skip-unchanged", "-time-format", test.timeFormat, "-output", dir)
+		report := run.run(context.Background())
+		if report.Failed() {
+			t.Fatalf("backup failed: %s", strings.Join(report.Errors, "; "))
+		}
+		if report.Zones[0].Unchanged != test.unchanged {
+			t.Errorf("with -time-format %s, the zone was unchanged: %t, want %t", test.timeFormat, report.Zones[0].Unchanged, test.unchanged)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "example.com.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), textCreatedOnPrefix+test.createdOn+"\r\n") {
+			t.Errorf("with -time-format %s, the file doesn't have %q:\n%s", test.timeFormat, textCreatedOnPrefix+test.createdOn, data)
+		}
+	}
+}